@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/config"
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/jsonschema"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/Pennsieve/integration-service/internal/processing"
+)
+
+// maxPayloadLimit is the largest body a channel may accept: Lambda's
+// request payload limit.
+const maxPayloadLimit = 6 << 20
+
+// channelNamePattern keeps channel names usable as a URL path segment.
+var channelNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// channelMethods are the methods a channel may accept, as for /webhook.
+var channelMethods = map[string]bool{
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+const usage = `usage: integration-service-channels command [arguments]
+
+commands:
+  set [flags] NAME          create the channel /webhook/NAME, or replace its policy:
+      -auth A               credentials accepted: any (default), secret or signature
+      -methods M            comma-separated HTTP methods (default POST)
+      -senders S            comma-separated names of the senders it accepts (required)
+      -max-bytes N          largest request body (default 1048576)
+      -schema S             JSON Schema payloads must match, inline or a file path
+      -processor P          worker processor for its messages: notification-rules or
+                            none (default: the usual routes)
+  list                      list channels with their policy
+  disable NAME              answer 404 on the channel from now on
+  enable NAME               accept requests on the channel again
+
+Configuration is read like the lambdas' (CONFIG_SOURCES, ENV).
+`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	aws.AwsOnce.Do(func() {
+		aws.InitAWS(ctx)
+	})
+	if _, err := config.Get(ctx); err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+	store := db.Postgres{}
+	if err := store.Ready(ctx); err != nil {
+		log.Fatalf("ERROR database: %v", err)
+	}
+
+	if err := run(ctx, store, os.Args[1], os.Args[2:], os.Stdout); err != nil {
+		log.Fatalf("ERROR %s: %v", os.Args[1], err)
+	}
+}
+
+// channelStore is what the commands need: the channels, and the senders they
+// are bound to.
+type channelStore interface {
+	db.ChannelStore
+	db.SenderStore
+}
+
+func run(ctx context.Context, store channelStore, cmd string, args []string, out io.Writer) error {
+	switch cmd {
+	case "set":
+		flags := flag.NewFlagSet("set", flag.ExitOnError)
+		auth := flags.String("auth", models.ChannelAuthAny, "credentials accepted: any, secret or signature")
+		methods := flags.String("methods", http.MethodPost, "comma-separated HTTP methods")
+		senders := flags.String("senders", "", "comma-separated names of the senders it accepts")
+		maxBytes := flags.Int("max-bytes", 1<<20, "largest request body in bytes")
+		schema := flags.String("schema", "", "JSON Schema, inline or a file path")
+		processor := flags.String("processor", "", "worker processor for the channel's messages")
+		_ = flags.Parse(args)
+		if flags.NArg() != 1 {
+			return fmt.Errorf("set takes exactly one NAME")
+		}
+		c := models.Channel{Name: flags.Arg(0), Auth: *auth, MaxPayloadBytes: *maxBytes, Processor: *processor}
+		if !channelNamePattern.MatchString(c.Name) {
+			return fmt.Errorf("channel name must match %s", channelNamePattern)
+		}
+		switch c.Auth {
+		case models.ChannelAuthAny, models.ChannelAuthSecret, models.ChannelAuthSignature:
+		default:
+			return fmt.Errorf("auth must be %s, %s or %s", models.ChannelAuthAny, models.ChannelAuthSecret, models.ChannelAuthSignature)
+		}
+		if c.Processor != "" && !processing.IsProcessorName(c.Processor) {
+			return fmt.Errorf("processor must be %s or %s", processing.ProcessorNotificationRules, processing.ProcessorNone)
+		}
+		if c.MaxPayloadBytes <= 0 || c.MaxPayloadBytes > maxPayloadLimit {
+			return fmt.Errorf("max-bytes must be between 1 and %d", maxPayloadLimit)
+		}
+		var err error
+		if c.Methods, err = splitMethods(*methods); err != nil {
+			return err
+		}
+		if c.Senders, err = boundSenders(ctx, store, *senders); err != nil {
+			return err
+		}
+		if c.JSONSchema, err = readSchema(*schema); err != nil {
+			return err
+		}
+		c, err = store.PutChannel(ctx, c)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "channel %s (id %d, %s) accepts %s from %s with %s credentials, up to %d bytes\n",
+			c.Name, c.ID, c.Status, strings.Join(c.Methods, ","), strings.Join(c.Senders, ","), c.Auth, c.MaxPayloadBytes)
+		fmt.Fprintf(out, "Send its requests to .../webhook/%s.\n", c.Name)
+		return nil
+	case "list":
+		channels, err := store.ListChannels(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSTATUS\tAUTH\tMETHODS\tSENDERS\tMAX BYTES\tSCHEMA\tPROCESSOR")
+		for _, c := range channels {
+			schema, processor := "no", c.Processor
+			if len(c.JSONSchema) > 0 {
+				schema = "yes"
+			}
+			if processor == "" {
+				processor = "(routes)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", c.ID, c.Name, c.Status, c.Auth,
+				strings.Join(c.Methods, ","), strings.Join(c.Senders, ","), c.MaxPayloadBytes, schema, processor)
+		}
+		return w.Flush()
+	case "disable", "enable":
+		if len(args) != 1 {
+			return fmt.Errorf("%s takes exactly one NAME", cmd)
+		}
+		status := models.ChannelActive
+		if cmd == "disable" {
+			status = models.ChannelDisabled
+		}
+		c, err := store.SetChannelStatus(ctx, args[0], status)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "channel %s is %s\n", c.Name, c.Status)
+		return nil
+	}
+	return fmt.Errorf("unknown command\n\n%s", usage)
+}
+
+func splitMethods(s string) ([]string, error) {
+	var methods []string
+	for _, m := range strings.Split(s, ",") {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m == "" {
+			continue
+		}
+		if !channelMethods[m] {
+			return nil, fmt.Errorf("method %s not allowed; use POST, PUT, PATCH or DELETE", m)
+		}
+		methods = append(methods, m)
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("a channel needs at least one method")
+	}
+	return methods, nil
+}
+
+// boundSenders splits a comma-separated list of sender names, checking
+// that each is registered.
+func boundSenders(ctx context.Context, store db.SenderStore, s string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if _, err := store.GetSenderByName(ctx, name); err != nil {
+			return nil, fmt.Errorf("sender %s: %w", name, err)
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("a channel needs at least one sender")
+	}
+	return names, nil
+}
+
+// readSchema reads an inline JSON schema or the file it names, and checks
+// that it compiles; "" is no schema.
+func readSchema(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data := []byte(s)
+	if !strings.HasPrefix(strings.TrimSpace(s), "{") {
+		var err error
+		if data, err = os.ReadFile(s); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := jsonschema.Compile(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
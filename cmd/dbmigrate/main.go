@@ -2,17 +2,44 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
 
 	integrationdbmigrate "github.com/Pennsieve/integration-service/internal/dbmigrate"
 	dbmigrateconfig "github.com/pennsieve/dbmigrate-go/pkg/config"
-	"github.com/pennsieve/dbmigrate-go/pkg/dbmigrate"
 )
 
 var logger = slog.Default()
 
+const usage = `usage: integration-service-dbmigrate [-dry-run] [command]
+
+commands:
+  up             apply all pending migrations (default)
+  down N         roll back the N most recent migrations
+  goto VERSION   migrate up or down to VERSION
+  force VERSION  mark VERSION as applied and clean without running anything
+                 (-1 marks no migration applied); use after repairing a
+                 half-applied migration by hand
+  status         print the current version, dirty flag and pending migrations
+
+-dry-run prints the migrations up, down or goto would run without running them.
+`
+
 func main() {
+	flags := flag.NewFlagSet("integration-service-dbmigrate", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(flags.Output(), usage) }
+	dryRun := flags.Bool("dry-run", false, "print the migrations that would run without running them")
+	_ = flags.Parse(os.Args[1:])
+
+	cmd, err := parseCommand(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n%s", err, usage)
+		os.Exit(2)
+	}
+
 	ctx := context.Background()
 
 	migrateConfig, err := dbmigrateconfig.LoadConfig(integrationdbmigrate.ConfigDefaults())
@@ -28,6 +55,8 @@ func main() {
 
 	logger.
 		With(slog.Bool("verboseLogging", migrateConfig.VerboseLogging),
+			slog.String("command", cmd.name),
+			slog.Bool("dryRun", *dryRun),
 			slog.Group("postgres",
 				slog.String("host", migrateConfig.PostgresDB.Host),
 				slog.Int("port", migrateConfig.PostgresDB.Port),
@@ -43,17 +72,120 @@ func main() {
 		os.Exit(1)
 	}
 
-	m, err := dbmigrate.NewLocalMigrator(ctx, migrateConfig, migrationsSource)
+	m, err := integrationdbmigrate.NewMigrator(ctx, migrateConfig, migrationsSource)
 	if err != nil {
-		logger.Error("error creating DatabaseMigrator", slog.Any("error", err))
+		logger.Error("error creating Migrator", slog.Any("error", err))
 		os.Exit(1)
 	}
-	defer m.CloseAndLogError()
+	defer m.Close()
 
-	if err := m.Up(); err != nil {
-		logger.Error("error running 'up' migrations", slog.Any("error", err))
+	if err := run(m, cmd, *dryRun); err != nil {
+		logger.Error(fmt.Sprintf("error running %q", cmd.name), slog.Any("error", err))
+		m.Close()
 		os.Exit(1)
 	}
 
 	logger.Info("integration-service DB schema migration complete")
 }
+
+type command struct {
+	name string
+	arg  int
+}
+
+func parseCommand(args []string) (command, error) {
+	if len(args) == 0 {
+		return command{name: "up"}, nil
+	}
+	cmd := command{name: args[0]}
+	switch cmd.name {
+	case "up", "status":
+		if len(args) != 1 {
+			return cmd, fmt.Errorf("%s takes no arguments", cmd.name)
+		}
+	case "down", "goto", "force":
+		if len(args) != 2 {
+			return cmd, fmt.Errorf("%s takes exactly one argument", cmd.name)
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return cmd, fmt.Errorf("%s: invalid number %q", cmd.name, args[1])
+		}
+		switch {
+		case cmd.name == "down" && n <= 0:
+			return cmd, fmt.Errorf("down: N must be positive")
+		case cmd.name == "goto" && n < 0:
+			return cmd, fmt.Errorf("goto: VERSION must not be negative")
+		case cmd.name == "force" && n < -1:
+			return cmd, fmt.Errorf("force: VERSION must be -1 or a migration version")
+		}
+		cmd.arg = n
+	default:
+		return cmd, fmt.Errorf("unknown command %q", cmd.name)
+	}
+	return cmd, nil
+}
+
+func run(m *integrationdbmigrate.Migrator, cmd command, dryRun bool) error {
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	logger.Info("current version",
+		slog.Bool("applied", status.Applied),
+		slog.Uint64("version", uint64(status.Version)),
+		slog.Bool("dirty", status.Dirty))
+
+	var plan []integrationdbmigrate.Step
+	switch cmd.name {
+	case "status":
+		pending, err := m.Pending()
+		if err != nil {
+			return err
+		}
+		printSteps("pending", pending)
+		return nil
+	case "force":
+		if dryRun {
+			logger.Info("dry run: would force version", slog.Int("version", cmd.arg))
+			return nil
+		}
+		return m.Force(cmd.arg)
+	case "up":
+		plan, err = m.Pending()
+	case "down":
+		plan, err = m.PlanDown(cmd.arg)
+	case "goto":
+		plan, err = m.PlanGoto(uint(cmd.arg))
+	}
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		printSteps("dry run: would run", plan)
+		return nil
+	}
+	if status.Dirty {
+		return fmt.Errorf("database is dirty at version %d; repair it and run force first", status.Version)
+	}
+	printSteps("running", plan)
+	switch cmd.name {
+	case "up":
+		return m.Up()
+	case "down":
+		return m.Down(cmd.arg)
+	default:
+		return m.Goto(uint(cmd.arg))
+	}
+}
+
+func printSteps(label string, steps []integrationdbmigrate.Step) {
+	if len(steps) == 0 {
+		logger.Info(label + ": none")
+		return
+	}
+	for _, s := range steps {
+		logger.Info(label, slog.String("migration", s.String()))
+	}
+}
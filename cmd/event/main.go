@@ -1,10 +1,23 @@
 package main
 
 import (
+	"context"
+	"log"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/config"
 	"github.com/Pennsieve/integration-service/internal/handler"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
 func main() {
+	ctx := context.Background()
+	aws.AwsOnce.Do(func() {
+		aws.InitAWS(ctx)
+	})
+	if _, err := config.Get(ctx); err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+
 	lambda.Start(handler.Handler)
 }
@@ -1,10 +1,24 @@
 package main
 
 import (
+	"context"
+	"log"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/config"
+	"github.com/Pennsieve/integration-service/internal/db"
 	"github.com/Pennsieve/integration-service/internal/handler"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
 func main() {
-	lambda.Start(handler.NotificationHandler)
+	ctx := context.Background()
+	aws.AwsOnce.Do(func() {
+		aws.InitAWS(ctx)
+	})
+	if _, err := config.Get(ctx); err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+
+	lambda.Start(handler.NewNotificationHandler(db.Postgres{}))
 }
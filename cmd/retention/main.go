@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/config"
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/retention"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// batchPause spaces out batches so a large backlog purge doesn't compete
+// with the receiver for the database for the whole run.
+const batchPause = 100 * time.Millisecond
+
+// Runs as a scheduled Lambda, or once from the command line when started
+// outside the Lambda runtime (e.g. to work through a backlog by hand).
+func main() {
+	ctx := context.Background()
+	aws.AwsOnce.Do(func() {
+		aws.InitAWS(ctx)
+	})
+	cfg, err := config.Get(ctx)
+	if err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+	settings, err := cfg.Retention(ctx)
+	if err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+
+	var archiver retention.Archiver
+	if settings.ArchiveBucket != "" {
+		awsCfg, err := aws.Config()
+		if err != nil {
+			log.Fatalf("ERROR aws configuration: %v", err)
+		}
+		archiver = retention.NewS3Archiver(s3.NewFromConfig(awsCfg), settings.ArchiveBucket, settings.ArchivePrefix)
+	}
+
+	purger := retention.NewPurger(db.Postgres{}, archiver, retention.Policy{
+		MessagesRetention:  settings.MessagesRetention,
+		RateLimitRetention: settings.RateLimitRetention,
+		BatchSize:          settings.BatchSize,
+		BatchPause:         batchPause,
+	})
+
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+		lambda.Start(func(ctx context.Context, _ events.CloudWatchEvent) (retention.Result, error) {
+			return purger.Run(ctx)
+		})
+		return
+	}
+
+	res, err := purger.Run(ctx)
+	if err != nil {
+		log.Fatalf("ERROR retention: %v", err)
+	}
+	out, _ := json.MarshalIndent(res, "", "  ")
+	os.Stdout.Write(append(out, '\n'))
+}
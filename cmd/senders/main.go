@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/challenge"
+	"github.com/Pennsieve/integration-service/internal/config"
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/Pennsieve/integration-service/internal/sender_auth"
+	"github.com/Pennsieve/integration-service/internal/signature"
+)
+
+// defaultOverlap is how long a rotated-out secret stays accepted, long
+// enough for a sender to deploy the new one.
+const defaultOverlap = 24 * time.Hour
+
+const usage = `usage: integration-service-senders command [arguments]
+
+commands:
+  add [-scopes s1,s2] NAME  register a sender and print its secret (shown once)
+  list                      list senders with their status and scopes
+  disable NAME              reject the sender's requests from now on
+  enable NAME               accept the sender's requests again
+  rotate [-overlap D] NAME  issue a new secret and print it (shown once); the
+                            old one keeps working for D (default 24h, 0 revokes it)
+  rotations                 list senders whose old secret is still accepted
+                            and whether they still use it, and the callers
+                            still on the previous webhook shared secret
+  rotate-shared [-overlap D]
+                            replace the deprecated webhook shared secret in
+                            SSM and print the new value (shown once); the old
+                            one keeps working for D (default 24h, 0 revokes it)
+  sign [-scheme S] NAME     verify the sender's requests by HMAC signature;
+                            S is pennsieve (default), github, slack or JSON
+  sign -none NAME           stop accepting signed requests from the sender
+  challenge -responder R NAME
+                            answer the handshake the sender's provider verifies
+                            the endpoint with; R is slack, msgraph, websub or JSON
+  challenge -none NAME      stop answering the sender's handshakes
+
+Configuration is read like the lambdas' (CONFIG_SOURCES, ENV).
+`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	aws.AwsOnce.Do(func() {
+		aws.InitAWS(ctx)
+	})
+	cfg, err := config.Get(ctx)
+	if err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+	store := db.Postgres{}
+	if err := store.Ready(ctx); err != nil {
+		log.Fatalf("ERROR database: %v", err)
+	}
+
+	if err := run(ctx, cfg, store, os.Args[1], os.Args[2:], os.Stdout); err != nil {
+		log.Fatalf("ERROR %s: %v", os.Args[1], err)
+	}
+}
+
+func run(ctx context.Context, cfg *config.Config, store db.SenderStore, cmd string, args []string, out io.Writer) error {
+	switch cmd {
+	case "add":
+		flags := flag.NewFlagSet("add", flag.ExitOnError)
+		scopes := flags.String("scopes", strings.Join(sender_auth.DefaultScopes, ","), "comma-separated scopes")
+		_ = flags.Parse(args)
+		if flags.NArg() != 1 {
+			return fmt.Errorf("add takes exactly one NAME")
+		}
+		secret, err := sender_auth.NewSecret()
+		if err != nil {
+			return err
+		}
+		s, err := store.CreateSender(ctx, flags.Arg(0), sender_auth.HashSecret(secret), splitScopes(*scopes))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "created sender %s (id %d)\nsecret: %s\n", s.Name, s.ID, secret)
+		fmt.Fprintln(out, "Store the secret now; only its hash is kept.")
+		return nil
+	case "list":
+		senders, err := store.ListSenders(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSTATUS\tSCOPES\tCREATED")
+		for _, s := range senders {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", s.ID, s.Name, s.Status, strings.Join(s.Scopes, ","), s.CreatedAt.Format("2006-01-02"))
+		}
+		return w.Flush()
+	case "disable", "enable":
+		if len(args) != 1 {
+			return fmt.Errorf("%s takes exactly one NAME", cmd)
+		}
+		status := models.SenderActive
+		if cmd == "disable" {
+			status = models.SenderDisabled
+		}
+		s, err := store.SetSenderStatus(ctx, args[0], status)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "sender %s is %s\n", s.Name, s.Status)
+		return nil
+	case "rotate":
+		flags := flag.NewFlagSet("rotate", flag.ExitOnError)
+		overlap := flags.Duration("overlap", defaultOverlap, "how long the old secret stays accepted")
+		_ = flags.Parse(args)
+		if flags.NArg() != 1 {
+			return fmt.Errorf("rotate takes exactly one NAME")
+		}
+		if *overlap < 0 {
+			return fmt.Errorf("overlap must not be negative, got %s", *overlap)
+		}
+		secret, err := sender_auth.NewSecret()
+		if err != nil {
+			return err
+		}
+		expires := time.Now().Add(*overlap)
+		s, err := store.RotateSenderSecret(ctx, flags.Arg(0), sender_auth.HashSecret(secret), expires)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "rotated secret of sender %s\nsecret: %s\n", s.Name, secret)
+		if *overlap > 0 {
+			fmt.Fprintf(out, "The old secret is accepted until %s; run \"rotations\" to see if it is still used.\n", expires.Format(time.RFC3339))
+		} else {
+			fmt.Fprintln(out, "The old secret is no longer accepted.")
+		}
+		return nil
+	case "rotations":
+		senders, err := store.ListSenders(ctx)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tROTATED\tOLD SECRET ACCEPTED UNTIL\tOLD SECRET LAST USED")
+		for _, s := range senders {
+			if !s.InRotation(now) {
+				continue
+			}
+			lastUsed := "never"
+			if s.PreviousSecretUsedAt != nil {
+				lastUsed = s.PreviousSecretUsedAt.Format(time.RFC3339) + "  (still on old secret)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, s.SecretRotatedAt.Format(time.RFC3339),
+				s.PreviousSecretExpiresAt.Format(time.RFC3339), lastUsed)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		return sharedRotation(ctx, cfg, store, now, out)
+	case "rotate-shared":
+		flags := flag.NewFlagSet("rotate-shared", flag.ExitOnError)
+		overlap := flags.Duration("overlap", defaultOverlap, "how long the old shared secret stays accepted")
+		_ = flags.Parse(args)
+		if flags.NArg() != 0 {
+			return fmt.Errorf("rotate-shared takes no arguments")
+		}
+		if *overlap < 0 {
+			return fmt.Errorf("overlap must not be negative, got %s", *overlap)
+		}
+		secret, err := sender_auth.NewSecret()
+		if err != nil {
+			return err
+		}
+		// Uses recorded from here on are of the value being replaced.
+		if err := store.ClearSharedSecretUses(ctx); err != nil {
+			return err
+		}
+		previous, err := cfg.RotateWebhookSharedSecret(ctx, aws.PutSSMParam, secret, *overlap, func(d time.Duration) {
+			fmt.Fprintf(out, "Waiting %s for the lambdas to accept the previous value...\n", d)
+			time.Sleep(d)
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "rotated %s\nsecret: %s\n", config.KeyWebhookSharedSecret, secret)
+		if previous.Value != "" {
+			fmt.Fprintf(out, "The old value is accepted until %s; run \"rotations\" to see who still uses it.\n", previous.Expires.Format(time.RFC3339))
+		} else {
+			fmt.Fprintln(out, "The old value is no longer accepted.")
+		}
+		return nil
+	case "sign":
+		flags := flag.NewFlagSet("sign", flag.ExitOnError)
+		preset := flags.String("scheme", "pennsieve", "preset name or JSON scheme")
+		none := flags.Bool("none", false, "remove the sender's signature scheme")
+		_ = flags.Parse(args)
+		if flags.NArg() != 1 {
+			return fmt.Errorf("sign takes exactly one NAME")
+		}
+		name := flags.Arg(0)
+		if *none {
+			if _, err := store.SetSenderSignatureScheme(ctx, name, nil); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "sender %s no longer signs requests\n", name)
+			return nil
+		}
+		scheme, err := signature.Parse(*preset)
+		if err != nil {
+			return err
+		}
+		// Store the resolved scheme so later preset changes don't alter
+		// what existing senders are verified against.
+		b, err := json.Marshal(scheme)
+		if err != nil {
+			return err
+		}
+		if _, err := store.SetSenderSignatureScheme(ctx, name, b); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "sender %s signs requests with %s\n", name, b)
+		fmt.Fprintf(out, "Put its signing secret in configuration key %s%s and send requests to ?sender=%s.\n",
+			config.KeySenderSigningSecretPrefix, name, name)
+		return nil
+	case "challenge":
+		flags := flag.NewFlagSet("challenge", flag.ExitOnError)
+		preset := flags.String("responder", "", "preset name or JSON responder")
+		none := flags.Bool("none", false, "remove the sender's challenge responder")
+		_ = flags.Parse(args)
+		if flags.NArg() != 1 {
+			return fmt.Errorf("challenge takes exactly one NAME")
+		}
+		name := flags.Arg(0)
+		if *none {
+			if _, err := store.SetSenderChallenge(ctx, name, nil); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "sender %s no longer has its handshakes answered\n", name)
+			return nil
+		}
+		if *preset == "" {
+			return fmt.Errorf("challenge needs -responder or -none")
+		}
+		responder, err := challenge.Parse(*preset)
+		if err != nil {
+			return err
+		}
+		// Store the resolved responder, like sign stores its scheme.
+		b, err := json.Marshal(responder)
+		if err != nil {
+			return err
+		}
+		if _, err := store.SetSenderChallenge(ctx, name, b); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "sender %s has handshakes answered with %s\n", name, b)
+		fmt.Fprintf(out, "Register the endpoint with the provider as ...?sender=%s.\n", name)
+		return nil
+	}
+	return fmt.Errorf("unknown command\n\n%s", usage)
+}
+
+// sharedRotation reports the previous webhook shared secret while it is
+// still accepted, with the callers that have presented it since.
+func sharedRotation(ctx context.Context, cfg *config.Config, store db.SenderStore, now time.Time, out io.Writer) error {
+	secrets, err := cfg.WebhookSharedSecrets(ctx)
+	if err != nil {
+		return err
+	}
+	var previous config.SharedSecret
+	for _, s := range secrets {
+		if s.Previous && now.Before(s.Expires) {
+			previous = s
+		}
+	}
+	if previous.Value == "" {
+		return nil
+	}
+	uses, err := store.ListSharedSecretUses(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "\nThe previous %s is accepted until %s", config.KeyWebhookSharedSecret, previous.Expires.Format(time.RFC3339))
+	if len(uses) == 0 {
+		fmt.Fprintln(out, " and hasn't been used since the rotation.")
+		return nil
+	}
+	fmt.Fprintln(out, "; still used by:")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE IP\tUSER AGENT\tUSES\tFIRST USED\tLAST USED")
+	for _, u := range uses {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", u.SourceIP, u.UserAgent, u.Uses,
+			u.FirstSeenAt.Format(time.RFC3339), u.LastSeenAt.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func splitScopes(s string) []string {
+	scopes := []string{}
+	for _, sc := range strings.Split(s, ",") {
+		if sc = strings.TrimSpace(sc); sc != "" {
+			scopes = append(scopes, sc)
+		}
+	}
+	return scopes
+}
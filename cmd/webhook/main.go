@@ -1,10 +1,35 @@
 package main
 
 import (
+	"context"
+	"log"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/config"
+	"github.com/Pennsieve/integration-service/internal/db"
 	"github.com/Pennsieve/integration-service/internal/handler"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
 func main() {
-	lambda.Start(handler.WebhookHandler)
+	ctx := context.Background()
+	aws.AwsOnce.Do(func() {
+		aws.InitAWS(ctx)
+	})
+	cfg, err := config.Get(ctx)
+	if err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+	opts := handler.DefaultWebhookOptions()
+	if opts.RateLimit, err = cfg.RateLimit(ctx); err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+	if opts.IdempotencyWindow, err = cfg.IdempotencyWindow(ctx); err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+	if opts.RedactHeaders, err = cfg.RedactHeaders(ctx); err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+
+	lambda.Start(handler.NewWebhookHandler(db.Postgres{}, opts))
 }
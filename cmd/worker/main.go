@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/config"
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/processing"
+	"github.com/Pennsieve/integration-service/internal/rules"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// lease is how long a claimed message is held. It outlasts the Lambda
+// timeout, so a message is only reclaimed once the run that held it is
+// gone.
+const lease = 20 * time.Minute
+
+// Runs as a scheduled Lambda, or once from the command line when started
+// outside the Lambda runtime (e.g. to work through a backlog by hand).
+func main() {
+	ctx := context.Background()
+	aws.AwsOnce.Do(func() {
+		aws.InitAWS(ctx)
+	})
+	cfg, err := config.Get(ctx)
+	if err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+	settings, err := cfg.Processing(ctx)
+	if err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+
+	ruleJSON, err := cfg.NotificationRules(ctx)
+	if err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+	notificationRules, err := rules.Parse(ruleJSON)
+	if err != nil {
+		log.Fatalf("ERROR configuration: %v", err)
+	}
+
+	// The notification rules are the catch-all, so a processor registered
+	// for a more specific route takes its messages instead. Channels can
+	// also name them, or none to only store their messages.
+	registry := processing.NewRegistry()
+	if len(notificationRules) > 0 {
+		engine := rules.NewEngine(db.Postgres{}, notificationRules)
+		registry.Register(processing.Route{}, engine)
+		registry.RegisterNamed(processing.ProcessorNotificationRules, engine)
+	}
+	registry.RegisterNamed(processing.ProcessorNone, processing.ProcessorFunc(func(context.Context, processing.Message) error {
+		return nil
+	}))
+
+	worker := processing.NewWorker(db.Postgres{}, registry, processing.Policy{
+		BatchSize:   settings.BatchSize,
+		MaxAttempts: settings.MaxAttempts,
+		Backoff:     settings.Backoff,
+		MaxBackoff:  settings.MaxBackoff,
+		Lease:       lease,
+	})
+
+	if os.Getenv("AWS_LAMBDA_RUNTIME_API") != "" {
+		lambda.Start(func(ctx context.Context, _ events.CloudWatchEvent) (processing.Result, error) {
+			return worker.Run(ctx)
+		})
+		return
+	}
+
+	res, err := worker.Run(ctx)
+	if err != nil {
+		log.Fatalf("ERROR processing: %v", err)
+	}
+	out, _ := json.MarshalIndent(res, "", "  ")
+	os.Stdout.Write(append(out, '\n'))
+}
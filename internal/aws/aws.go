@@ -5,12 +5,22 @@ import (
 	"fmt"
 	"sync"
 
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
 )
 
+// SSMAPI is the subset of the SSM client used by this package; FakeSSM
+// implements it for tests.
+type SSMAPI interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+	PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+}
+
 var (
-	ssmClient  *ssm.Client
+	sdkConfig  awssdk.Config
+	ssmClient  SSMAPI
 	AwsOnce    sync.Once
 	awsInitErr error
 )
@@ -21,9 +31,30 @@ func InitAWS(ctx context.Context) {
 		awsInitErr = fmt.Errorf("unable to load SDK config: %w", err)
 		return
 	}
+	sdkConfig = cfg
 	ssmClient = ssm.NewFromConfig(cfg)
 }
 
+// SetSSMClientForTest replaces the SSM client and marks AWS as initialized,
+// bypassing InitAWS. Mirrors db.SetPoolForTest.
+func SetSSMClientForTest(client SSMAPI) {
+	AwsOnce.Do(func() {})
+	awsInitErr = nil
+	ssmClient = client
+}
+
+// Config returns the SDK configuration loaded by InitAWS, for callers that
+// need the region or credentials directly (e.g. RDS IAM auth tokens).
+func Config() (awssdk.Config, error) {
+	if awsInitErr != nil {
+		return awssdk.Config{}, awsInitErr
+	}
+	if ssmClient == nil {
+		return awssdk.Config{}, fmt.Errorf("uninitialized AWS config")
+	}
+	return sdkConfig, nil
+}
+
 func GetSSMParam(ctx context.Context, name string, decrypt bool) (string, error) {
 	if awsInitErr != nil {
 		return "", awsInitErr
@@ -44,3 +75,30 @@ func GetSSMParam(ctx context.Context, name string, decrypt bool) (string, error)
 	}
 	return *output.Parameter.Value, nil
 }
+
+// PutSSMParam creates or overwrites a parameter, as a SecureString when
+// secure.
+func PutSSMParam(ctx context.Context, name, value string, secure bool) error {
+	if awsInitErr != nil {
+		return awsInitErr
+	}
+	if ssmClient == nil {
+		return fmt.Errorf("uninitialized SSM client")
+	}
+
+	paramType := types.ParameterTypeString
+	if secure {
+		paramType = types.ParameterTypeSecureString
+	}
+	overwrite := true
+	_, err := ssmClient.PutParameter(ctx, &ssm.PutParameterInput{
+		Name:      &name,
+		Value:     &value,
+		Type:      paramType,
+		Overwrite: &overwrite,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write SSM parameter %s: %w", name, err)
+	}
+	return nil
+}
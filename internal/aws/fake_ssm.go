@@ -0,0 +1,84 @@
+package aws
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// FakeSSM is an in-memory SSMAPI for tests. Unknown names fail with
+// *types.ParameterNotFound, as the real service does.
+type FakeSSM struct {
+	mu     sync.Mutex
+	params map[string]string
+	errs   map[string]error
+	calls  map[string]int
+}
+
+// NewFakeSSM returns a FakeSSM holding params.
+func NewFakeSSM(params map[string]string) *FakeSSM {
+	f := &FakeSSM{
+		params: make(map[string]string),
+		errs:   make(map[string]error),
+		calls:  make(map[string]int),
+	}
+	for k, v := range params {
+		f.params[k] = v
+	}
+	return f
+}
+
+// Set creates or rotates a parameter.
+func (f *FakeSSM) Set(name, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.params[name] = value
+	delete(f.errs, name)
+}
+
+// Fail makes every read of name return err until the next Set.
+func (f *FakeSSM) Fail(name string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errs[name] = err
+}
+
+// Calls reports how many times name was read.
+func (f *FakeSSM) Calls(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[name]
+}
+
+// Get returns a parameter's value, as last set or put.
+func (f *FakeSSM) Get(name string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.params[name]
+	return v, ok
+}
+
+func (f *FakeSSM) PutParameter(_ context.Context, in *ssm.PutParameterInput, _ ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.params[*in.Name] = *in.Value
+	delete(f.errs, *in.Name)
+	return &ssm.PutParameterOutput{}, nil
+}
+
+func (f *FakeSSM) GetParameter(_ context.Context, in *ssm.GetParameterInput, _ ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := *in.Name
+	f.calls[name]++
+	if err := f.errs[name]; err != nil {
+		return nil, err
+	}
+	v, ok := f.params[name]
+	if !ok {
+		return nil, &types.ParameterNotFound{}
+	}
+	return &ssm.GetParameterOutput{Parameter: &types.Parameter{Name: &name, Value: &v}}, nil
+}
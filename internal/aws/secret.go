@@ -0,0 +1,92 @@
+package aws
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// CachedSecret caches a secret value for a TTL so a rotated value reaches
+// warm Lambdas without a redeploy, while a steady state costs one fetch
+// per TTL. Safe for concurrent use.
+type CachedSecret struct {
+	fetch func(ctx context.Context) (string, error)
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu        sync.Mutex
+	value     string
+	fetchedAt time.Time
+	valid     bool
+}
+
+// NewCachedSecret caches the result of fetch for ttl. A ttl <= 0 caches
+// until Invalidate or Refresh.
+func NewCachedSecret(fetch func(ctx context.Context) (string, error), ttl time.Duration) *CachedSecret {
+	return &CachedSecret{fetch: fetch, ttl: ttl, now: time.Now}
+}
+
+// NewSSMSecret caches a SecureString SSM parameter.
+func NewSSMSecret(name string, ttl time.Duration) *CachedSecret {
+	return NewCachedSecret(func(ctx context.Context) (string, error) {
+		return GetSSMParam(ctx, name, true)
+	}, ttl)
+}
+
+// StaticSecret never refetches; for values from static sources and tests.
+func StaticSecret(value string) *CachedSecret {
+	s := NewCachedSecret(func(context.Context) (string, error) { return value, nil }, 0)
+	s.Set(value)
+	return s
+}
+
+// Get returns the cached value, fetching it if there is none or it is
+// older than the TTL. If a refetch fails, the previous value is returned
+// (and the failure logged): an SSM blip must not take down a Lambda whose
+// credentials still work.
+func (s *CachedSecret) Get(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.valid && (s.ttl <= 0 || s.now().Sub(s.fetchedAt) < s.ttl) {
+		return s.value, nil
+	}
+	v, err := s.fetch(ctx)
+	if err != nil {
+		if s.valid {
+			log.Printf("WARN secret refresh failed, using cached value: %v", err)
+			return s.value, nil
+		}
+		return "", err
+	}
+	s.value, s.fetchedAt, s.valid = v, s.now(), true
+	return v, nil
+}
+
+// Refresh refetches unconditionally, e.g. after the backing service
+// rejected the cached value. Unlike Get it reports a failed fetch, keeping
+// the previous value cached.
+func (s *CachedSecret) Refresh(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	s.value, s.fetchedAt, s.valid = v, s.now(), true
+	return v, nil
+}
+
+// Set primes the cache with a value fetched elsewhere.
+func (s *CachedSecret) Set(value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value, s.fetchedAt, s.valid = value, s.now(), true
+}
+
+// Invalidate forces the next Get to fetch.
+func (s *CachedSecret) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.valid = false
+}
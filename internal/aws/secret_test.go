@@ -0,0 +1,82 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testParam = "/test/integration-service/webhook-shared-secret"
+
+func TestCachedSecret_RefetchesAfterTTL(t *testing.T) {
+	fake := NewFakeSSM(map[string]string{testParam: "v1"})
+	SetSSMClientForTest(fake)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewSSMSecret(testParam, time.Minute)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	v, err := s.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", v)
+
+	fake.Set(testParam, "v2")
+	v, _ = s.Get(ctx)
+	assert.Equal(t, "v1", v, "cached within the TTL")
+	assert.Equal(t, 1, fake.Calls(testParam))
+
+	now = now.Add(time.Minute)
+	v, _ = s.Get(ctx)
+	assert.Equal(t, "v2", v, "rotated value picked up after the TTL")
+}
+
+func TestCachedSecret_ServesStaleWhenRefetchFails(t *testing.T) {
+	fake := NewFakeSSM(map[string]string{testParam: "v1"})
+	SetSSMClientForTest(fake)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewSSMSecret(testParam, time.Minute)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+	_, err := s.Get(ctx)
+	require.NoError(t, err)
+
+	fake.Fail(testParam, errors.New("throttled"))
+	now = now.Add(time.Hour)
+	v, err := s.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", v)
+
+	_, err = s.Refresh(ctx)
+	assert.ErrorContains(t, err, "throttled", "Refresh reports the failure")
+	v, _ = s.Get(ctx)
+	assert.Equal(t, "v1", v)
+}
+
+func TestCachedSecret_FirstFetchErrorIsReturned(t *testing.T) {
+	SetSSMClientForTest(NewFakeSSM(nil))
+	_, err := NewSSMSecret(testParam, time.Minute).Get(context.Background())
+	assert.ErrorContains(t, err, testParam)
+}
+
+func TestCachedSecret_InvalidateAndStatic(t *testing.T) {
+	fetches := 0
+	s := NewCachedSecret(func(context.Context) (string, error) {
+		fetches++
+		return "v", nil
+	}, 0)
+	ctx := context.Background()
+	_, _ = s.Get(ctx)
+	_, _ = s.Get(ctx)
+	assert.Equal(t, 1, fetches, "ttl <= 0 caches until invalidated")
+	s.Invalidate()
+	_, _ = s.Get(ctx)
+	assert.Equal(t, 2, fetches)
+
+	v, err := StaticSecret("fixed").Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "fixed", v)
+}
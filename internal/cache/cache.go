@@ -3,7 +3,6 @@ package cache
 import (
 	"context"
 	"fmt"
-	"log"
 	"regexp"
 	"sync"
 	"time"
@@ -25,8 +24,8 @@ var (
 
 // webhookQuery is the verbatim port of the Python refresh_webhook_cache query.
 // The schema name is interpolated (it is a Postgres identifier, not a value, so
-// it cannot be parameterized), which is why orgID is validated against
-// orgIDPattern before we ever build this string. Column order here must match
+// it cannot be parameterized), which is why it is only ever a schema returned
+// by ResolveSchema, never the raw incoming org id. Column order here must match
 // the rows.Scan order in db.Query: api_url, event_name, dataset_id.
 const webhookQuery = `SELECT wh.api_url, wet.event_name, wi.dataset_id
 FROM "%[1]s".webhooks AS wh
@@ -51,18 +50,19 @@ func Set(orgID string, entry models.WebhookCache) {
 	webhookCache[orgID] = entry
 }
 
-func RefreshWebhookCache(ctx context.Context, orgID string) {
-	if !orgIDPattern.MatchString(orgID) {
-		log.Printf("invalid org id: %q\n", orgID)
-		return
+// RefreshWebhookCache reloads the org's webhook entry. On failure the
+// existing entry, if any, is left untouched so callers can keep serving it.
+func RefreshWebhookCache(ctx context.Context, orgID string) error {
+	schema, err := ResolveSchema(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("resolve schema for org %q: %w", orgID, err)
 	}
 
-	command := fmt.Sprintf(webhookQuery, orgID)
+	command := fmt.Sprintf(webhookQuery, schema)
 
 	results, err := db.Query(ctx, command)
 	if err != nil {
-		log.Printf("SQL error: %v\n", err)
-		return
+		return fmt.Errorf("refresh webhook cache for org %q: %w", orgID, err)
 	}
 
 	cacheMutex.Lock()
@@ -71,4 +71,5 @@ func RefreshWebhookCache(ctx context.Context, orgID string) {
 		Webhooks: results,
 	}
 	cacheMutex.Unlock()
+	return nil
 }
@@ -2,11 +2,15 @@ package cache
 
 import (
 	"context"
+	"regexp"
 	"testing"
 	"time"
 
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Pennsieve/integration-service/internal/db"
 	"github.com/Pennsieve/integration-service/internal/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGetSet_RoundTrips(t *testing.T) {
@@ -35,8 +39,8 @@ func TestRefreshWebhookCache_RejectsInvalidOrgID(t *testing.T) {
 		"org-with-dashes",
 		"",
 	} {
-		// Must not panic or attempt a query; just logs and returns.
-		RefreshWebhookCache(context.Background(), bad)
+		// Must not panic or attempt a query; just returns an error.
+		assert.ErrorIs(t, RefreshWebhookCache(context.Background(), bad), ErrInvalidOrgID)
 		_, ok := Get(bad)
 		assert.False(t, ok, "invalid orgID %q must not produce a cache entry", bad)
 	}
@@ -47,3 +51,79 @@ func TestOrgIDPattern_AcceptsValid(t *testing.T) {
 		assert.True(t, orgIDPattern.MatchString(good), "expected %q to be valid", good)
 	}
 }
+
+func TestGetSetDatasets_RoundTrips(t *testing.T) {
+	entry := models.DatasetCache{
+		Updated:  time.Now(),
+		Datasets: map[int]models.DatasetRecord{1: {ID: 1, NodeID: "N:dataset:1", Name: "one"}},
+	}
+	SetDatasets("orgRoundTrip", entry)
+
+	got, ok := GetDatasets("orgRoundTrip")
+	assert.True(t, ok)
+	assert.Equal(t, entry.Datasets, got.Datasets)
+}
+
+func TestResolveSchema_KnownOrg(t *testing.T) {
+	resetCaches()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pennsieve.organizations")).
+		WithArgs("45").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(45)))
+
+	schema, err := ResolveSchema(context.Background(), "45")
+	require.NoError(t, err)
+	assert.Equal(t, "45", schema)
+
+	// Second call is served from the cache; no further query is expected.
+	schema, err = ResolveSchema(context.Background(), "45")
+	require.NoError(t, err)
+	assert.Equal(t, "45", schema)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResolveSchema_UnknownOrgIsRejectedAndCached(t *testing.T) {
+	resetCaches()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pennsieve.organizations")).
+		WithArgs("9999").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	for i := 0; i < 2; i++ {
+		_, err := ResolveSchema(context.Background(), "9999")
+		assert.ErrorIs(t, err, ErrUnknownOrg)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// resetCaches empties every package-level cache so tests that expect a miss
+// don't depend on run order or -count.
+func resetCaches() {
+	cacheMutex.Lock()
+	webhookCache = make(map[string]models.WebhookCache)
+	cacheMutex.Unlock()
+
+	datasetCacheMutex.Lock()
+	datasetCache = make(map[string]models.DatasetCache)
+	datasetCacheMutex.Unlock()
+
+	schemaCacheMutex.Lock()
+	schemaCache = make(map[string]schemaEntry)
+	schemaCacheMutex.Unlock()
+
+	orgSizesMutex.Lock()
+	orgSizes = make(map[string]orgSize)
+	orgSizesMutex.Unlock()
+
+	lazyCacheMutex.Lock()
+	lazyCache = make(map[string]map[int]lazyEntry)
+	lazyCacheMutex.Unlock()
+}
@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+// The dataset cache sits alongside the webhook cache and follows the same
+// shape: one map per org, one mutex, refreshed as a whole.
+var (
+	datasetCache      = make(map[string]models.DatasetCache)
+	datasetCacheMutex sync.RWMutex
+)
+
+// datasetQuery loads only datasets that have at least one webhook enabled,
+// since those are the only datasets whose events are ever delivered. Same
+// interpolation rules as webhookQuery. Column order must match the
+// rows.Scan order in db.QueryDatasets: id, node_id, name.
+const datasetQuery = `SELECT d.id, d.node_id, d.name
+FROM "%[1]s".datasets AS d
+WHERE d.id IN (SELECT wi.dataset_id FROM "%[1]s".dataset_integrations AS wi)`
+
+// GetDatasets returns the cached dataset entry for an org and whether it
+// exists.
+func GetDatasets(orgID string) (models.DatasetCache, bool) {
+	datasetCacheMutex.RLock()
+	defer datasetCacheMutex.RUnlock()
+	entry, ok := datasetCache[orgID]
+	return entry, ok
+}
+
+// SetDatasets replaces the cached dataset entry for an org. Test seam, like Set.
+func SetDatasets(orgID string, entry models.DatasetCache) {
+	datasetCacheMutex.Lock()
+	defer datasetCacheMutex.Unlock()
+	datasetCache[orgID] = entry
+}
+
+// RefreshDatasetCache reloads the org's dataset entry. On failure the
+// existing entry, if any, is left untouched so callers can keep serving it.
+func RefreshDatasetCache(ctx context.Context, orgID string) error {
+	schema, err := ResolveSchema(ctx, orgID)
+	if err != nil {
+		return fmt.Errorf("resolve schema for org %q: %w", orgID, err)
+	}
+
+	command := fmt.Sprintf(datasetQuery, schema)
+
+	results, err := db.QueryDatasets(ctx, command)
+	if err != nil {
+		return fmt.Errorf("refresh dataset cache for org %q: %w", orgID, err)
+	}
+
+	datasets := make(map[int]models.DatasetRecord, len(results))
+	for _, d := range results {
+		datasets[d.ID] = d
+	}
+
+	datasetCacheMutex.Lock()
+	datasetCache[orgID] = models.DatasetCache{
+		Updated:  time.Now(),
+		Datasets: datasets,
+	}
+	datasetCacheMutex.Unlock()
+	return nil
+}
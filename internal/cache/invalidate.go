@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+// datasetWebhookQuery is webhookQuery narrowed to one dataset, used to patch
+// a single dataset into an org's entry without reloading the whole org.
+const datasetWebhookQuery = webhookQuery + `
+WHERE wi.dataset_id = $1`
+
+// singleDatasetQuery is datasetQuery narrowed to one dataset. It doesn't
+// require a dataset_integrations row: the dataset's webhooks are patched in
+// separately, and an unused row costs nothing.
+const singleDatasetQuery = `SELECT d.id, d.node_id, d.name
+FROM "%[1]s".datasets AS d
+WHERE d.id = $1`
+
+// Invalidate applies a cache invalidation.
+//
+// An org-wide invalidation marks the org's entry expired, so the next Lookup
+// reloads it synchronously while still being able to fall back to it if
+// that reload fails.
+//
+// A dataset-scoped invalidation reloads just that dataset's webhooks (and
+// its dataset row) into the existing entries, leaving the rest of the org
+// and its expiry untouched. If the org has no entry yet there is nothing to
+// invalidate: the next Lookup loads it in full anyway. If the patch fails,
+// or the entry was refreshed concurrently, it degrades to an org-wide
+// invalidation.
+//
+// Orgs using the per-dataset strategy simply forget the affected datasets.
+func Invalidate(ctx context.Context, inv models.CacheInvalidation) {
+	counters.invalidations.Add(1)
+	forgetLazy(inv)
+
+	if inv.DatasetID == 0 {
+		expire(inv.OrgID)
+		return
+	}
+
+	if err := patchDataset(ctx, inv.OrgID, inv.DatasetID); err != nil {
+		log.Printf("Invalidating all of org %s after dataset %d patch failed: %v\n", inv.OrgID, inv.DatasetID, err)
+		expire(inv.OrgID)
+	}
+}
+
+// expire zeroes an entry's timestamp so the next Lookup treats it as
+// expired, without discarding the data it may need to fall back on.
+func expire(orgID string) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	if entry, ok := webhookCache[orgID]; ok {
+		entry.Updated = time.Time{}
+		webhookCache[orgID] = entry
+	}
+}
+
+func patchDataset(ctx context.Context, orgID string, datasetID int) error {
+	before, ok := Get(orgID)
+	if !ok {
+		return nil
+	}
+
+	schema, err := ResolveSchema(ctx, orgID)
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := db.Query(ctx, fmt.Sprintf(datasetWebhookQuery, schema), datasetID)
+	if err != nil {
+		return fmt.Errorf("reload webhooks for dataset %d: %w", datasetID, err)
+	}
+	datasets, err := db.QueryDatasets(ctx, fmt.Sprintf(singleDatasetQuery, schema), datasetID)
+	if err != nil {
+		return fmt.Errorf("reload dataset %d: %w", datasetID, err)
+	}
+
+	cacheMutex.Lock()
+	current := webhookCache[orgID]
+	if !current.Updated.Equal(before.Updated) {
+		cacheMutex.Unlock()
+		return fmt.Errorf("entry changed while patching dataset %d", datasetID)
+	}
+	patched := make([]models.WebhookRecord, 0, len(current.Webhooks)+len(webhooks))
+	for _, w := range current.Webhooks {
+		if w.DatasetID != datasetID {
+			patched = append(patched, w)
+		}
+	}
+	current.Webhooks = append(patched, webhooks...)
+	webhookCache[orgID] = current
+	cacheMutex.Unlock()
+
+	datasetCacheMutex.Lock()
+	defer datasetCacheMutex.Unlock()
+	entry := datasetCache[orgID]
+	all := make(map[int]models.DatasetRecord, len(entry.Datasets)+1)
+	for id, d := range entry.Datasets {
+		all[id] = d
+	}
+	delete(all, datasetID)
+	for _, d := range datasets {
+		all[d.ID] = d
+	}
+	entry.Datasets = all
+	if entry.Updated.IsZero() {
+		entry.Updated = time.Now()
+	}
+	datasetCache[orgID] = entry
+	return nil
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidate_OrgWideExpiresButKeepsEntry(t *testing.T) {
+	updated := time.Now()
+	Set("invOrg", models.WebhookCache{Updated: updated, Webhooks: []models.WebhookRecord{{APIURL: "https://x.example", DatasetID: 1}}})
+
+	Invalidate(context.Background(), models.CacheInvalidation{OrgID: "invOrg"})
+
+	entry, ok := Get("invOrg")
+	require.True(t, ok)
+	assert.True(t, entry.Updated.IsZero())
+	assert.Len(t, entry.Webhooks, 1, "expired entry must remain available as a stale fallback")
+}
+
+func TestInvalidate_DatasetPatchesOnlyThatDataset(t *testing.T) {
+	resetCaches()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	updated := time.Now().Add(-time.Minute)
+	SetSchema("71", "71")
+	Set("71", models.WebhookCache{Updated: updated, Webhooks: []models.WebhookRecord{
+		{APIURL: "https://keep.example", EventName: "FILES", DatasetID: 1},
+		{APIURL: "https://old.example", EventName: "FILES", DatasetID: 2},
+	}})
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "71".webhooks`)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"api_url", "event_name", "dataset_id"}).
+			AddRow("https://new.example", "METADATA", 2))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "71".datasets`)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "node_id", "name"}).AddRow(2, "N:dataset:2", "two"))
+
+	Invalidate(context.Background(), models.CacheInvalidation{OrgID: "71", DatasetID: 2})
+
+	entry, _ := Get("71")
+	assert.Equal(t, updated, entry.Updated, "a dataset patch must not extend the org's expiry")
+	assert.ElementsMatch(t, []models.WebhookRecord{
+		{APIURL: "https://keep.example", EventName: "FILES", DatasetID: 1},
+		{APIURL: "https://new.example", EventName: "METADATA", DatasetID: 2},
+	}, entry.Webhooks)
+	datasets, _ := GetDatasets("71")
+	assert.Equal(t, "N:dataset:2", datasets.Datasets[2].NodeID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInvalidate_DatasetPatchFailureExpiresOrg(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	SetSchema("72", "72")
+	Set("72", models.WebhookCache{Updated: time.Now(), Webhooks: []models.WebhookRecord{{APIURL: "https://x.example", DatasetID: 1}}})
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "72".webhooks`)).WillReturnError(errors.New("connection reset"))
+
+	Invalidate(context.Background(), models.CacheInvalidation{OrgID: "72", DatasetID: 1})
+
+	entry, _ := Get("72")
+	assert.True(t, entry.Updated.IsZero())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestInvalidate_DatasetWithoutEntryIsNoop(t *testing.T) {
+	resetCaches()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	Invalidate(context.Background(), models.CacheInvalidation{OrgID: "73", DatasetID: 1})
+
+	_, ok := Get("73")
+	assert.False(t, ok)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/lib/pq"
+)
+
+const (
+	// lazyLookupThreshold is the number of dataset_integrations rows above
+	// which an org's webhooks are looked up per dataset instead of loading
+	// the whole four-way join. An org with a default-enabled webhook has
+	// roughly one row per dataset per webhook, so this is reached by orgs
+	// with a few thousand datasets. See BenchmarkLookup* for the trade-off.
+	lazyLookupThreshold = 5000
+
+	// orgSizeExpiration is how long an org's strategy is kept before its
+	// dataset_integrations rows are counted again.
+	orgSizeExpiration = time.Hour
+
+	// orgSizeRetryAfter is how long a strategy chosen because the count
+	// failed is kept, so a failing count isn't re-run on every event.
+	orgSizeRetryAfter = time.Minute
+)
+
+// integrationCountQuery sizes an org for strategy selection.
+const integrationCountQuery = `SELECT count(*) FROM "%[1]s".dataset_integrations`
+
+// datasetsWebhookQuery is webhookQuery narrowed to a set of datasets.
+const datasetsWebhookQuery = webhookQuery + `
+WHERE wi.dataset_id = ANY($1)`
+
+// datasetsQuery is datasetQuery's per-dataset counterpart for lazy orgs.
+const datasetsQuery = `SELECT d.id, d.node_id, d.name
+FROM "%[1]s".datasets AS d
+WHERE d.id = ANY($1)`
+
+type orgSize struct {
+	lazy    bool
+	expires time.Time
+}
+
+// lazyEntry is what a lazy org caches for one dataset: its webhooks (empty
+// for a dataset with none, which is cached as a negative entry too).
+type lazyEntry struct {
+	webhooks []models.WebhookRecord
+	updated  time.Time
+}
+
+var (
+	orgSizes      = make(map[string]orgSize)
+	orgSizesMutex sync.RWMutex
+
+	lazyCache      = make(map[string]map[int]lazyEntry)
+	lazyCacheMutex sync.RWMutex
+)
+
+// LookupDatasets returns the webhooks that apply to datasetIDs in an org,
+// choosing a strategy by org size: small orgs go through Lookup and cache
+// the whole org, orgs above lazyLookupThreshold query and cache only the
+// datasets actually seen in events. Either way the dataset cache is filled
+// for those datasets so events can be enriched. The returned entry may hold
+// webhooks for datasets beyond datasetIDs.
+//
+// Sizing costs a count query, so it is only done when the org's size isn't
+// cached and its whole-org entry (if any) is due for a refresh anyway.
+func LookupDatasets(ctx context.Context, orgID string, datasetIDs []int) (models.WebhookCache, error) {
+	orgSizesMutex.RLock()
+	size, known := orgSizes[orgID]
+	orgSizesMutex.RUnlock()
+
+	if !known || time.Now().After(size.expires) {
+		if entry, ok := Get(orgID); ok && time.Since(entry.Updated) <= refreshAhead {
+			return Lookup(ctx, orgID)
+		}
+		lazy, err := sizeOrg(ctx, orgID, size.lazy, known)
+		if err != nil {
+			return models.WebhookCache{}, err
+		}
+		size.lazy = lazy
+	}
+
+	if !size.lazy {
+		return Lookup(ctx, orgID)
+	}
+	return lookupLazy(ctx, orgID, datasetIDs)
+}
+
+// SetOrgSize pre-seeds the strategy for an org. Test seam, like Set.
+func SetOrgSize(orgID string, lazy bool) {
+	orgSizesMutex.Lock()
+	defer orgSizesMutex.Unlock()
+	orgSizes[orgID] = orgSize{lazy: lazy, expires: time.Now().Add(orgSizeExpiration)}
+}
+
+// sizeOrg counts the org's dataset_integrations rows and records which
+// strategy it should use. A failed count keeps the previous strategy if
+// the org had one, or else uses lazy lookups, which stay cheap however
+// large the org turns out to be, rather than failing the org outright.
+// That choice is recorded for orgSizeRetryAfter before counting again.
+func sizeOrg(ctx context.Context, orgID string, previous, known bool) (bool, error) {
+	schema, err := ResolveSchema(ctx, orgID)
+	if err != nil {
+		return false, fmt.Errorf("resolve schema for org %q: %w", orgID, err)
+	}
+	lazy, ttl := previous || !known, orgSizeRetryAfter
+	count, err := db.QueryCount(ctx, fmt.Sprintf(integrationCountQuery, schema))
+	if err != nil {
+		log.Printf("Sizing org %s failed, using lazy=%v for %s: %v\n", orgID, lazy, ttl, err)
+	} else {
+		lazy, ttl = count > lazyLookupThreshold, orgSizeExpiration
+	}
+
+	orgSizesMutex.Lock()
+	orgSizes[orgID] = orgSize{lazy: lazy, expires: time.Now().Add(ttl)}
+	orgSizesMutex.Unlock()
+
+	// Don't hold on to the entries of the strategy the org has left: the
+	// whole-org entry of one that has outgrown it, or the per-dataset
+	// entries of one that has shrunk back under the threshold.
+	switch {
+	case err != nil:
+	case lazy:
+		cacheMutex.Lock()
+		delete(webhookCache, orgID)
+		cacheMutex.Unlock()
+	default:
+		lazyCacheMutex.Lock()
+		delete(lazyCache, orgID)
+		lazyCacheMutex.Unlock()
+	}
+	return lazy, nil
+}
+
+func lookupLazy(ctx context.Context, orgID string, datasetIDs []int) (models.WebhookCache, error) {
+	ids := uniqueSorted(datasetIDs)
+
+	lazyCacheMutex.RLock()
+	cached := lazyCache[orgID]
+	var missing []int
+	complete := true
+	for _, id := range ids {
+		e, ok := cached[id]
+		if !ok {
+			complete = false
+		}
+		if !ok || time.Since(e.updated) > webhookExpiration {
+			missing = append(missing, id)
+		}
+	}
+	lazyCacheMutex.RUnlock()
+
+	if len(missing) == 0 {
+		counters.hits.Add(1)
+	} else {
+		counters.misses.Add(1)
+		if err := refreshLazy(ctx, orgID, missing); err != nil {
+			if !complete {
+				return models.WebhookCache{}, err
+			}
+			counters.staleServed.Add(1)
+			log.Printf("Serving stale webhooks for %d datasets in org %s: %v\n", len(missing), orgID, err)
+		}
+	}
+
+	lazyCacheMutex.RLock()
+	defer lazyCacheMutex.RUnlock()
+	result := models.WebhookCache{Updated: time.Now()}
+	for _, id := range ids {
+		e := lazyCache[orgID][id]
+		if e.updated.Before(result.Updated) {
+			result.Updated = e.updated
+		}
+		result.Webhooks = append(result.Webhooks, e.webhooks...)
+	}
+	return result, nil
+}
+
+// refreshLazy loads webhooks and dataset rows for ids. Concurrent refreshes
+// of the same set of datasets share one query.
+func refreshLazy(ctx context.Context, orgID string, ids []int) error {
+	_, err, _ := refreshGroup.Do(lazyKey(orgID, ids), func() (interface{}, error) {
+		counters.refreshes.Add(1)
+		schema, err := ResolveSchema(ctx, orgID)
+		if err != nil {
+			counters.refreshErrors.Add(1)
+			return nil, fmt.Errorf("resolve schema for org %q: %w", orgID, err)
+		}
+
+		arg := make([]int64, len(ids))
+		for i, id := range ids {
+			arg[i] = int64(id)
+		}
+
+		webhooks, err := db.Query(ctx, fmt.Sprintf(datasetsWebhookQuery, schema), pq.Array(arg))
+		if err != nil {
+			counters.refreshErrors.Add(1)
+			return nil, fmt.Errorf("refresh webhooks for %d datasets in org %q: %w", len(ids), orgID, err)
+		}
+
+		now := time.Now()
+		byDataset := make(map[int]lazyEntry, len(ids))
+		for _, id := range ids {
+			byDataset[id] = lazyEntry{updated: now}
+		}
+		for _, w := range webhooks {
+			e := byDataset[w.DatasetID]
+			e.webhooks = append(e.webhooks, w)
+			byDataset[w.DatasetID] = e
+		}
+
+		lazyCacheMutex.Lock()
+		if lazyCache[orgID] == nil {
+			lazyCache[orgID] = make(map[int]lazyEntry)
+		}
+		for id, e := range byDataset {
+			lazyCache[orgID][id] = e
+		}
+		lazyCacheMutex.Unlock()
+
+		// Enrichment is best effort, as in refresh.
+		datasets, err := db.QueryDatasets(ctx, fmt.Sprintf(datasetsQuery, schema), pq.Array(arg))
+		if err != nil {
+			log.Printf("Dataset refresh failed for org %s, using cached datasets: %v\n", orgID, err)
+			return nil, nil
+		}
+		mergeDatasets(orgID, datasets)
+		return nil, nil
+	})
+	return err
+}
+
+// forgetLazy drops lazily cached datasets covered by inv, so they are
+// reloaded on their next event.
+func forgetLazy(inv models.CacheInvalidation) {
+	lazyCacheMutex.Lock()
+	defer lazyCacheMutex.Unlock()
+	if inv.DatasetID == 0 {
+		delete(lazyCache, inv.OrgID)
+		return
+	}
+	delete(lazyCache[inv.OrgID], inv.DatasetID)
+}
+
+// mergeDatasets adds datasets to the org's dataset entry without dropping
+// the ones already there.
+func mergeDatasets(orgID string, datasets []models.DatasetRecord) {
+	datasetCacheMutex.Lock()
+	defer datasetCacheMutex.Unlock()
+	entry := datasetCache[orgID]
+	merged := make(map[int]models.DatasetRecord, len(entry.Datasets)+len(datasets))
+	for id, d := range entry.Datasets {
+		merged[id] = d
+	}
+	for _, d := range datasets {
+		merged[d.ID] = d
+	}
+	entry.Datasets = merged
+	entry.Updated = time.Now()
+	datasetCache[orgID] = entry
+}
+
+func uniqueSorted(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	out := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	sort.Ints(out)
+	return out
+}
+
+func lazyKey(orgID string, ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return "lazy:" + orgID + ":" + strings.Join(parts, ",")
+}
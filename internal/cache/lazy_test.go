@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func expectOrgSize(mock sqlmock.Sqlmock, schema string, count int) {
+	mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf(`SELECT count(*) FROM "%s".dataset_integrations`, schema))).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(count))
+}
+
+func TestLookupDatasets_SmallOrgLoadsWholeOrg(t *testing.T) {
+	resetCaches()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	SetSchema("81", "81")
+	expectOrgSize(mock, "81", 10)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "81".webhooks`)).WillReturnRows(webhookRows())
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "81".datasets`)).WillReturnRows(datasetRows())
+
+	entry, err := LookupDatasets(context.Background(), "81", []int{1})
+	require.NoError(t, err)
+	assert.Len(t, entry.Webhooks, 1)
+	_, ok := Get("81")
+	assert.True(t, ok, "small orgs use the whole-org entry")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLookupDatasets_LargeOrgQueriesOnlyBatchDatasets(t *testing.T) {
+	resetCaches()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	SetSchema("82", "82")
+	expectOrgSize(mock, "82", lazyLookupThreshold+1)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "82".webhooks`) + `.*ANY`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"api_url", "event_name", "dataset_id"}).
+			AddRow("https://a.example/hook", "FILES", 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "82".datasets`) + `.*ANY`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "node_id", "name"}).
+			AddRow(1, "N:dataset:1", "one").
+			AddRow(2, "N:dataset:2", "two"))
+
+	entry, err := LookupDatasets(context.Background(), "82", []int{2, 1, 1})
+	require.NoError(t, err)
+	assert.Equal(t, []models.WebhookRecord{{APIURL: "https://a.example/hook", EventName: "FILES", DatasetID: 1}}, entry.Webhooks)
+	_, ok := Get("82")
+	assert.False(t, ok, "large orgs never build a whole-org entry")
+	datasets, _ := GetDatasets("82")
+	assert.Equal(t, "N:dataset:2", datasets.Datasets[2].NodeID)
+
+	// Both datasets, including the one without webhooks, are now cached.
+	entry, err = LookupDatasets(context.Background(), "82", []int{1, 2})
+	require.NoError(t, err)
+	assert.Len(t, entry.Webhooks, 1)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLookupDatasets_OrgBackUnderThresholdDropsLazyEntries(t *testing.T) {
+	resetCaches()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	SetSchema("85", "85")
+	lazyCache["85"] = map[int]lazyEntry{1: {updated: time.Now()}, 2: {updated: time.Now()}}
+	orgSizes["85"] = orgSize{lazy: true, expires: time.Now().Add(-time.Minute)}
+	expectOrgSize(mock, "85", 10)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "85".webhooks`)).WillReturnRows(webhookRows())
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "85".datasets`)).WillReturnRows(datasetRows())
+
+	_, err = LookupDatasets(context.Background(), "85", []int{1})
+	require.NoError(t, err)
+	_, ok := Get("85")
+	assert.True(t, ok, "the org is loaded whole again")
+	lazyCacheMutex.RLock()
+	_, ok = lazyCache["85"]
+	lazyCacheMutex.RUnlock()
+	assert.False(t, ok, "its per-dataset entries are dropped")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLookupDatasets_FailedSizingIsCachedBriefly(t *testing.T) {
+	resetCaches()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	SetSchema("84", "84")
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "84".dataset_integrations`)).
+		WillReturnError(fmt.Errorf("statement timeout"))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "84".webhooks`) + `.*ANY`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"api_url", "event_name", "dataset_id"}).
+			AddRow("https://a.example/hook", "FILES", 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "84".datasets`) + `.*ANY`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "node_id", "name"}).AddRow(1, "N:dataset:1", "one"))
+
+	// An org that was never sized falls back to lazy lookups, and the
+	// second event neither counts again nor queries again.
+	for i := 0; i < 2; i++ {
+		entry, err := LookupDatasets(context.Background(), "84", []int{1})
+		require.NoError(t, err)
+		assert.Len(t, entry.Webhooks, 1)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	orgSizesMutex.RLock()
+	size := orgSizes["84"]
+	orgSizesMutex.RUnlock()
+	assert.True(t, size.lazy)
+	assert.WithinDuration(t, time.Now().Add(orgSizeRetryAfter), size.expires, 5*time.Second)
+}
+
+func TestInvalidate_ForgetsLazyDataset(t *testing.T) {
+	resetCaches()
+	lazyCache["83"] = map[int]lazyEntry{
+		1: {updated: time.Now()},
+		2: {updated: time.Now()},
+	}
+
+	Invalidate(context.Background(), models.CacheInvalidation{OrgID: "83", DatasetID: 1})
+
+	assert.NotContains(t, lazyCache["83"], 1)
+	assert.Contains(t, lazyCache["83"], 2)
+}
+
+// The benchmarks below compare the two strategies for a large org: loading
+// every webhook×subscription×dataset_integration row versus loading only the
+// datasets in one SQS batch. Rows come from sqlmock, so they measure the
+// scanning and memory the lambda itself pays (see allocs/op and B/op), not
+// Postgres time, which only widens the gap.
+const (
+	benchOrgIntegrations = 20000
+	benchBatchSize       = 50
+)
+
+func BenchmarkLookup_WholeOrg(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		mock := benchSetup(b, "91")
+		rows := sqlmock.NewRows([]string{"api_url", "event_name", "dataset_id"})
+		for d := 1; d <= benchOrgIntegrations; d++ {
+			rows.AddRow("https://a.example/hook", "FILES", d)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(`FROM "91".webhooks`)).WillReturnRows(rows)
+		mock.ExpectQuery(regexp.QuoteMeta(`FROM "91".datasets`)).WillReturnRows(benchDatasetRows(benchOrgIntegrations))
+		b.StartTimer()
+
+		if _, err := Lookup(context.Background(), "91"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLookupDatasets_Lazy(b *testing.B) {
+	ids := make([]int, benchBatchSize)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		mock := benchSetup(b, "92")
+		SetOrgSize("92", true)
+		rows := sqlmock.NewRows([]string{"api_url", "event_name", "dataset_id"})
+		for _, d := range ids {
+			rows.AddRow("https://a.example/hook", "FILES", d)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(`FROM "92".webhooks`)).WithArgs(sqlmock.AnyArg()).WillReturnRows(rows)
+		mock.ExpectQuery(regexp.QuoteMeta(`FROM "92".datasets`)).WithArgs(sqlmock.AnyArg()).WillReturnRows(benchDatasetRows(benchBatchSize))
+		b.StartTimer()
+
+		if _, err := LookupDatasets(context.Background(), "92", ids); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchSetup(b *testing.B, schema string) sqlmock.Sqlmock {
+	resetCaches()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { mockDB.Close() })
+	db.SetPoolForTest(mockDB)
+	SetSchema(schema, schema)
+	return mock
+}
+
+func benchDatasetRows(n int) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "node_id", "name"})
+	for d := 1; d <= n; d++ {
+		rows.AddRow(d, fmt.Sprintf("N:dataset:%d", d), fmt.Sprintf("dataset %d", d))
+	}
+	return rows
+}
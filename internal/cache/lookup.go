@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/metrics"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// webhookExpiration is how long an org's entry is served without a
+	// synchronous refresh.
+	webhookExpiration = 10 * time.Minute
+
+	// refreshAhead is the age past which a hit also kicks off a background
+	// refresh, so a busy org's entry is renewed before it ever expires and
+	// no event has to wait on the four-way join.
+	refreshAhead = 8 * time.Minute
+
+	// backgroundRefreshTimeout bounds a refresh that outlives the request
+	// that triggered it.
+	backgroundRefreshTimeout = 30 * time.Second
+)
+
+// refreshGroup collapses concurrent refreshes of the same org, whether
+// triggered synchronously or in the background, into one set of queries.
+var refreshGroup singleflight.Group
+
+// background tracks the refreshes Lookup runs ahead of expiry. Lambda
+// freezes the process once an invocation returns, which would stall one
+// mid-query, so the handler waits for them with WaitForRefreshes.
+var background sync.WaitGroup
+
+// counters are accumulated per process and emitted by FlushStats.
+var counters struct {
+	hits, negativeHits, misses, staleServed, refreshes, refreshErrors, invalidations atomic.Int64
+}
+
+// Lookup returns the org's webhooks, serving the cached entry while it is
+// fresh and refreshing it (webhooks and datasets together) when it is
+// missing or expired. If a refresh fails but an older entry exists, the
+// older entry is served rather than losing the org's events; otherwise the
+// refresh error is returned.
+//
+// An org with no webhooks is cached like any other (a negative entry) so
+// orgs without integrations cost one query per expiry, not one per batch.
+// Changes that should be visible sooner go through Invalidate.
+func Lookup(ctx context.Context, orgID string) (models.WebhookCache, error) {
+	entry, exists := Get(orgID)
+	age := time.Since(entry.Updated)
+
+	if exists && age <= webhookExpiration {
+		if len(entry.Webhooks) == 0 {
+			counters.negativeHits.Add(1)
+		} else {
+			counters.hits.Add(1)
+		}
+		if age > refreshAhead {
+			background.Add(1)
+			go func() {
+				defer background.Done()
+				refreshInBackground(ctx, orgID)
+			}()
+		}
+		return entry, nil
+	}
+
+	counters.misses.Add(1)
+	err := refresh(ctx, orgID)
+	switch {
+	case err == nil:
+		entry, _ = Get(orgID)
+		return entry, nil
+	case exists && !errors.Is(err, ErrInvalidOrgID) && !errors.Is(err, ErrUnknownOrg):
+		counters.staleServed.Add(1)
+		log.Printf("Serving stale webhooks for org %s (updated %s): %v\n", orgID, entry.Updated.Format(time.RFC3339), err)
+		return entry, nil
+	default:
+		return models.WebhookCache{}, err
+	}
+}
+
+// refresh reloads the org's webhook entry and, if it has any webhooks, its
+// dataset entry too, so a newly enabled dataset shows up in both at once. A
+// failed dataset refresh only costs enrichment, so it is logged, not
+// returned.
+func refresh(ctx context.Context, orgID string) error {
+	_, err, _ := refreshGroup.Do(orgID, func() (interface{}, error) {
+		counters.refreshes.Add(1)
+		if err := RefreshWebhookCache(ctx, orgID); err != nil {
+			counters.refreshErrors.Add(1)
+			return nil, err
+		}
+		if entry, _ := Get(orgID); len(entry.Webhooks) == 0 {
+			return nil, nil
+		}
+		if err := RefreshDatasetCache(ctx, orgID); err != nil {
+			log.Printf("Dataset refresh failed for org %s, using cached datasets: %v\n", orgID, err)
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// refreshInBackground runs refresh detached from the caller's cancellation,
+// since the triggering request has already been answered from the cache.
+func refreshInBackground(parent context.Context, orgID string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), backgroundRefreshTimeout)
+	defer cancel()
+	if err := refresh(ctx, orgID); err != nil {
+		log.Printf("Background refresh failed for org %s: %v\n", orgID, err)
+	}
+}
+
+// WaitForRefreshes blocks until the background refreshes Lookup started
+// have finished. Events were already answered from the cache, so this only
+// delays the end of the invocation, by at most backgroundRefreshTimeout.
+func WaitForRefreshes() {
+	background.Wait()
+}
+
+// FlushStats emits the counters accumulated since the previous flush as
+// CloudWatch metrics and resets them. Called once per invocation.
+func FlushStats() {
+	metrics.Emit(nonZero(map[string]float64{
+		"WebhookCacheHit":          float64(counters.hits.Swap(0)),
+		"WebhookCacheNegativeHit":  float64(counters.negativeHits.Swap(0)),
+		"WebhookCacheMiss":         float64(counters.misses.Swap(0)),
+		"WebhookCacheStaleServed":  float64(counters.staleServed.Swap(0)),
+		"WebhookCacheRefresh":      float64(counters.refreshes.Swap(0)),
+		"WebhookCacheRefreshError": float64(counters.refreshErrors.Swap(0)),
+		"WebhookCacheInvalidation": float64(counters.invalidations.Swap(0)),
+	}), nil)
+}
+
+func nonZero(values map[string]float64) map[string]float64 {
+	for k, v := range values {
+		if v == 0 {
+			delete(values, k)
+		}
+	}
+	return values
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func webhookRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"api_url", "event_name", "dataset_id"}).
+		AddRow("https://a.example/hook", "FILES", 1)
+}
+
+func datasetRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "node_id", "name"}).
+		AddRow(1, "N:dataset:1", "one")
+}
+
+func TestLookup_FreshEntryIsAHit(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	Set("lookupFresh", models.WebhookCache{Updated: time.Now(), Webhooks: []models.WebhookRecord{{APIURL: "https://x.example"}}})
+	before := counters.hits.Load()
+
+	entry, err := Lookup(context.Background(), "lookupFresh")
+	require.NoError(t, err)
+	assert.Len(t, entry.Webhooks, 1)
+	assert.Equal(t, before+1, counters.hits.Load())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLookup_ConcurrentMissesShareOneRefresh(t *testing.T) {
+	resetCaches()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	SetSchema("61", "61")
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "61".webhooks`)).
+		WillDelayFor(50 * time.Millisecond).
+		WillReturnRows(webhookRows())
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "61".datasets`)).WillReturnRows(datasetRows())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry, err := Lookup(context.Background(), "61")
+			assert.NoError(t, err)
+			assert.Len(t, entry.Webhooks, 1)
+		}()
+	}
+	wg.Wait()
+
+	datasets, ok := GetDatasets("61")
+	require.True(t, ok)
+	assert.Equal(t, "N:dataset:1", datasets.Datasets[1].NodeID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLookup_NegativeEntryIsCached(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	Set("lookupNegative", models.WebhookCache{Updated: time.Now()})
+	before := counters.negativeHits.Load()
+
+	entry, err := Lookup(context.Background(), "lookupNegative")
+	require.NoError(t, err)
+	assert.Empty(t, entry.Webhooks)
+	assert.Equal(t, before+1, counters.negativeHits.Load())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLookup_RefreshesAheadOfExpiryInBackground(t *testing.T) {
+	resetCaches()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	SetSchema("62", "62")
+	aging := time.Now().Add(-(refreshAhead + time.Minute))
+	Set("62", models.WebhookCache{Updated: aging, Webhooks: []models.WebhookRecord{{APIURL: "https://old.example"}}})
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "62".webhooks`)).WillReturnRows(webhookRows())
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "62".datasets`)).WillReturnRows(datasetRows())
+
+	// The caller is answered from the aging entry without waiting.
+	entry, err := Lookup(context.Background(), "62")
+	require.NoError(t, err)
+	assert.Equal(t, "https://old.example", entry.Webhooks[0].APIURL)
+
+	WaitForRefreshes()
+	_, ok := GetDatasets("62")
+	assert.True(t, ok)
+	e, _ := Get("62")
+	assert.True(t, e.Updated.After(aging))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/metrics"
+)
+
+var (
+	// ErrInvalidOrgID is returned by ResolveSchema when the org id fails
+	// orgIDPattern.
+	ErrInvalidOrgID = errors.New("invalid org id")
+
+	// ErrUnknownOrg is returned by ResolveSchema when the org id is
+	// well-formed but has no row in pennsieve.organizations.
+	ErrUnknownOrg = errors.New("unknown organization")
+)
+
+const (
+	// Orgs are effectively never renumbered, so a resolved schema can be
+	// kept for a long time. Unknown orgs are cached briefly so a burst of
+	// events for a bad id costs one lookup, while a just-created org is
+	// still picked up quickly.
+	schemaExpiration        = time.Hour
+	unknownSchemaExpiration = time.Minute
+)
+
+type schemaEntry struct {
+	schema  string
+	known   bool
+	updated time.Time
+}
+
+var (
+	schemaCache      = make(map[string]schemaEntry)
+	schemaCacheMutex sync.RWMutex
+)
+
+// ResolveSchema maps an incoming org id to its Postgres schema name via
+// pennsieve.organizations, so the webhook and dataset queries only ever run
+// against a schema that exists. The org id is checked against orgIDPattern
+// before any DB call.
+func ResolveSchema(ctx context.Context, orgID string) (string, error) {
+	if !orgIDPattern.MatchString(orgID) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidOrgID, orgID)
+	}
+
+	schemaCacheMutex.RLock()
+	entry, ok := schemaCache[orgID]
+	schemaCacheMutex.RUnlock()
+
+	if !ok || time.Since(entry.updated) > entry.expiration() {
+		schema, known, err := db.LookupOrgSchema(ctx, orgID)
+		if err != nil {
+			return "", err
+		}
+		entry = schemaEntry{schema: schema, known: known, updated: time.Now()}
+
+		schemaCacheMutex.Lock()
+		schemaCache[orgID] = entry
+		schemaCacheMutex.Unlock()
+	}
+
+	if !entry.known {
+		metrics.Count("UnknownOrganization", nil)
+		return "", fmt.Errorf("%w: %q", ErrUnknownOrg, orgID)
+	}
+	// Defensive: the schema is interpolated as an identifier, so it must
+	// pass the same allowlist as the incoming id.
+	if !orgIDPattern.MatchString(entry.schema) {
+		return "", fmt.Errorf("invalid schema %q for org %q", entry.schema, orgID)
+	}
+	return entry.schema, nil
+}
+
+// SetSchema pre-seeds the org-to-schema mapping. Test seam, like Set.
+func SetSchema(orgID, schema string) {
+	schemaCacheMutex.Lock()
+	defer schemaCacheMutex.Unlock()
+	schemaCache[orgID] = schemaEntry{schema: schema, known: true, updated: time.Now()}
+}
+
+func (e schemaEntry) expiration() time.Duration {
+	if e.known {
+		return schemaExpiration
+	}
+	return unknownSchemaExpiration
+}
@@ -0,0 +1,162 @@
+// Package challenge answers the handshakes providers send to verify a
+// webhook endpoint before delivering events to it, such as Slack's
+// url_verification event or Microsoft Graph's validationToken. A handshake
+// is answered by echoing the challenge value it carries.
+package challenge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Where a Responder reads a handshake from.
+const (
+	InQuery = "query"
+	InBody  = "body"
+)
+
+// How a Responder returns the challenge.
+const (
+	ReplyText = "text"
+	ReplyJSON = "json"
+)
+
+// Request is the part of an incoming request handshakes are recognized by.
+type Request struct {
+	Query map[string]string
+	Body  []byte
+}
+
+// Response answers a handshake.
+type Response struct {
+	StatusCode  int
+	ContentType string
+	Body        string
+}
+
+// Responder recognizes one kind of handshake. It is stored as JSON on the
+// sender.
+type Responder struct {
+	// In is where the handshake's fields are: InQuery (query parameters)
+	// or InBody (top-level fields of a JSON body).
+	In string `json:"in"`
+	// Match lists fields that must have these values for the request to
+	// be a handshake.
+	Match map[string]string `json:"match,omitempty"`
+	// Echo is the field holding the challenge; a request without it isn't
+	// a handshake.
+	Echo string `json:"echo"`
+	// Reply is ReplyText for the bare challenge or ReplyJSON for
+	// {"<echo>": challenge}.
+	Reply string `json:"reply,omitempty"`
+}
+
+// Presets are the handshakes of common providers, selectable by name.
+var Presets = map[string]Responder{
+	"slack": {
+		In:    InBody,
+		Match: map[string]string{"type": "url_verification"},
+		Echo:  "challenge",
+		Reply: ReplyJSON,
+	},
+	"msgraph": {
+		In:   InQuery,
+		Echo: "validationToken",
+	},
+	// WebSub hubs and registries modelled on them (Facebook, Strava)
+	// verify with GET ?hub.mode=subscribe&hub.challenge=...
+	"websub": {
+		In:    InQuery,
+		Match: map[string]string{"hub.mode": "subscribe"},
+		Echo:  "hub.challenge",
+	},
+}
+
+// Parse reads a responder from a preset name or a JSON object and
+// validates it.
+func Parse(s string) (Responder, error) {
+	if p, ok := Presets[s]; ok {
+		return p.withDefaults(), nil
+	}
+	var r Responder
+	if err := json.Unmarshal([]byte(s), &r); err != nil {
+		return Responder{}, fmt.Errorf("challenge responder must be a preset (%s) or JSON: %w", presetNames(), err)
+	}
+	r = r.withDefaults()
+	return r, r.Validate()
+}
+
+func presetNames() string {
+	names := make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func (r Responder) withDefaults() Responder {
+	if r.Reply == "" {
+		r.Reply = ReplyText
+	}
+	return r
+}
+
+// Validate reports whether r is complete.
+func (r Responder) Validate() error {
+	switch {
+	case r.In != InQuery && r.In != InBody:
+		return fmt.Errorf("challenge responder in must be %q or %q", InQuery, InBody)
+	case r.Echo == "":
+		return errors.New("challenge responder needs an echo field")
+	case r.Reply != ReplyText && r.Reply != ReplyJSON:
+		return fmt.Errorf("challenge responder reply must be %q or %q", ReplyText, ReplyJSON)
+	}
+	return nil
+}
+
+// Respond answers req if it is r's handshake.
+func (r Responder) Respond(req Request) (Response, bool) {
+	fields, ok := r.fields(req)
+	if !ok {
+		return Response{}, false
+	}
+	for k, want := range r.Match {
+		if fields[k] != want {
+			return Response{}, false
+		}
+	}
+	value := fields[r.Echo]
+	if value == "" {
+		return Response{}, false
+	}
+
+	if r.Reply == ReplyJSON {
+		b, _ := json.Marshal(map[string]string{r.Echo: value})
+		return Response{StatusCode: http.StatusOK, ContentType: "application/json", Body: string(b)}, true
+	}
+	return Response{StatusCode: http.StatusOK, ContentType: "text/plain", Body: value}, true
+}
+
+// fields returns the handshake fields of req: its query parameters, or
+// the string fields of its JSON object body.
+func (r Responder) fields(req Request) (map[string]string, bool) {
+	if r.In == InQuery {
+		return req.Query, true
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		return nil, false
+	}
+	fields := make(map[string]string, len(body))
+	for k, v := range body {
+		if s, ok := v.(string); ok {
+			fields[k] = s
+		}
+	}
+	return fields, true
+}
@@ -0,0 +1,78 @@
+package challenge
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresets(t *testing.T) {
+	for name, tc := range map[string]struct {
+		req  Request
+		want Response
+	}{
+		"slack": {
+			Request{Body: []byte(`{"token":"t","challenge":"3eZbrw1a","type":"url_verification"}`)},
+			Response{StatusCode: http.StatusOK, ContentType: "application/json", Body: `{"challenge":"3eZbrw1a"}`},
+		},
+		"msgraph": {
+			Request{Query: map[string]string{"validationToken": "Validation: Token 1"}},
+			Response{StatusCode: http.StatusOK, ContentType: "text/plain", Body: "Validation: Token 1"},
+		},
+		"websub": {
+			Request{Query: map[string]string{"hub.mode": "subscribe", "hub.challenge": "1158201444", "hub.verify_token": "x"}},
+			Response{StatusCode: http.StatusOK, ContentType: "text/plain", Body: "1158201444"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r, err := Parse(name)
+			require.NoError(t, err)
+			got, ok := r.Respond(tc.req)
+			require.True(t, ok)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestRespond_IgnoresOrdinaryRequests(t *testing.T) {
+	slack, err := Parse("slack")
+	require.NoError(t, err)
+	graph, err := Parse("msgraph")
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		r   Responder
+		req Request
+	}{
+		"slack event":           {slack, Request{Body: []byte(`{"type":"event_callback","challenge":"x"}`)}},
+		"slack without value":   {slack, Request{Body: []byte(`{"type":"url_verification"}`)}},
+		"slack non-JSON body":   {slack, Request{Body: []byte(`type=url_verification&challenge=x`)}},
+		"slack non-string":      {slack, Request{Body: []byte(`{"type":"url_verification","challenge":7}`)}},
+		"graph notification":    {graph, Request{Body: []byte(`{"value":[]}`)}},
+		"graph empty parameter": {graph, Request{Query: map[string]string{"validationToken": ""}}},
+	} {
+		_, ok := tc.r.Respond(tc.req)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestParse_JSON(t *testing.T) {
+	r, err := Parse(`{"in": "body", "match": {"event": "verify"}, "echo": "code"}`)
+	require.NoError(t, err)
+	assert.Equal(t, ReplyText, r.Reply)
+	got, ok := r.Respond(Request{Body: []byte(`{"event":"verify","code":"abc"}`)})
+	require.True(t, ok)
+	assert.Equal(t, "abc", got.Body)
+
+	for _, s := range []string{
+		`discord`,
+		`{"in": "header", "echo": "x"}`,
+		`{"in": "query"}`,
+		`{"in": "query", "echo": "x", "reply": "xml"}`,
+	} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
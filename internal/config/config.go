@@ -0,0 +1,732 @@
+// Package config loads the service configuration from a chain of providers
+// (environment variables, a local file, SSM Parameter Store, Secrets
+// Manager) into a single typed struct, once per cold start.
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/idempotency"
+	"github.com/Pennsieve/integration-service/internal/ratelimit"
+	"github.com/Pennsieve/integration-service/internal/redact"
+)
+
+// Configuration keys. A key's SSM parameter is
+// /{ENV}/integration-service/{key}; its environment variable is the key
+// upper-cased with dashes turned into underscores.
+const (
+	KeyPostgresHost        = "integrations-postgres-host"
+	KeyPostgresDB          = "integrations-postgres-db"
+	KeyPostgresUser        = "integrations-postgres-user"
+	KeyPostgresPassword    = "integrations-postgres-password"
+	KeyDBAuthMode          = "db-auth-mode"
+	KeyDBPort              = "db-port"
+	KeyDBSSLRootCert       = "db-ssl-root-cert"
+	KeyWebhookSharedSecret = "webhook-shared-secret"
+	KeySecretTTL           = "secret-ttl"
+)
+
+const (
+	// AuthModePassword connects with the static Postgres password.
+	AuthModePassword = "password"
+	// AuthModeIAM connects with RDS IAM auth tokens.
+	AuthModeIAM = "iam"
+
+	defaultDBPort = 5432
+
+	// defaultSecretTTL bounds how long a warm Lambda keeps using a secret
+	// after it is rotated at the source.
+	defaultSecretTTL = 5 * time.Minute
+)
+
+// keys lists every key Load looks up. Secret keys are fetched decrypted
+// from SSM, never logged, and only exposed through Secret so they can be
+// refreshed after rotation.
+var keys = []struct {
+	name   string
+	secret bool
+}{
+	{KeyPostgresHost, false},
+	{KeyPostgresDB, false},
+	{KeyPostgresUser, false},
+	{KeyPostgresPassword, true},
+	{KeyDBAuthMode, false},
+	{KeyDBPort, false},
+	{KeyDBSSLRootCert, false},
+	{KeyWebhookSharedSecret, true},
+	{KeySecretTTL, false},
+}
+
+// Config is the typed service configuration.
+type Config struct {
+	// Env is the deployment environment (ENV), used to build SSM names.
+	Env string
+
+	Postgres Postgres
+
+	// SecretTTL is how long Secret accessors cache a value.
+	SecretTTL time.Duration
+
+	found     map[string]bool
+	secrets   map[string]*aws.CachedSecret
+	lazy      *secretCache
+	sources   []string
+	providers []Provider
+}
+
+// secretCache holds secrets whose keys are only known at request time.
+type secretCache struct {
+	mu      sync.Mutex
+	secrets map[string]*aws.CachedSecret
+}
+
+// Postgres holds the database connection settings. The password is a
+// secret; see Secret(KeyPostgresPassword).
+type Postgres struct {
+	Host string
+	Name string
+	User string
+
+	// AuthMode is AuthModePassword (default) or AuthModeIAM.
+	AuthMode string
+	// Port defaults to 5432.
+	Port int
+	// SSLRootCert is a CA bundle path; when set the server certificate is
+	// verified.
+	SSLRootCert string
+}
+
+// MissingKeysError lists required keys no provider supplied.
+type MissingKeysError struct {
+	Keys    []string
+	Sources []string
+}
+
+func (e *MissingKeysError) Error() string {
+	return fmt.Sprintf("missing configuration keys %s (looked in: %s)",
+		strings.Join(e.Keys, ", "), strings.Join(e.Sources, ", "))
+}
+
+// Require returns a *MissingKeysError naming every key in names that no
+// provider supplied. Load already requires the Postgres keys; callers use
+// Require for keys only they depend on.
+func (c *Config) Require(names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if !c.found[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return &MissingKeysError{Keys: missing, Sources: c.sources}
+}
+
+// Secret returns the cached accessor for a secret key (the Postgres
+// password or the webhook shared secret). Get refetches from the provider
+// chain once the value is older than SecretTTL; Refresh refetches now. For a
+// key no provider supplied, every read fails with a *MissingKeysError.
+func (c *Config) Secret(key string) *aws.CachedSecret {
+	if s, ok := c.secrets[key]; ok {
+		return s
+	}
+	err := c.Require(key)
+	if err == nil {
+		err = fmt.Errorf("%s is not a secret key", key)
+	}
+	return aws.NewCachedSecret(func(context.Context) (string, error) { return "", err }, 0)
+}
+
+// Load looks every key up in providers, in order, first match wins. It
+// fails with a *MissingKeysError if any Postgres key the configured auth
+// mode needs is missing, and with a plain error for invalid values or a
+// provider failure other than "not found".
+func Load(ctx context.Context, env string, providers []Provider) (*Config, error) {
+	cfg := &Config{Env: env, found: make(map[string]bool), lazy: newSecretCache(), providers: providers}
+	for _, p := range providers {
+		cfg.sources = append(cfg.sources, p.Name())
+	}
+
+	values := make(map[string]string)
+	for _, k := range keys {
+		v, ok, err := lookup(ctx, providers, k.name, k.secret)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			values[k.name] = v
+			cfg.found[k.name] = true
+		}
+	}
+
+	cfg.Postgres = Postgres{
+		Host:        values[KeyPostgresHost],
+		Name:        values[KeyPostgresDB],
+		User:        values[KeyPostgresUser],
+		AuthMode:    values[KeyDBAuthMode],
+		Port:        defaultDBPort,
+		SSLRootCert: values[KeyDBSSLRootCert],
+	}
+
+	if cfg.Postgres.AuthMode == "" {
+		cfg.Postgres.AuthMode = AuthModePassword
+	}
+	if cfg.Postgres.AuthMode != AuthModePassword && cfg.Postgres.AuthMode != AuthModeIAM {
+		return nil, fmt.Errorf("unsupported %s %q (want %q or %q)", KeyDBAuthMode, cfg.Postgres.AuthMode, AuthModePassword, AuthModeIAM)
+	}
+	if p, ok := values[KeyDBPort]; ok {
+		port, err := strconv.Atoi(p)
+		if err != nil || port <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", KeyDBPort, p)
+		}
+		cfg.Postgres.Port = port
+	}
+	cfg.SecretTTL = defaultSecretTTL
+	if ttl, ok := values[KeySecretTTL]; ok {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", KeySecretTTL, ttl)
+		}
+		cfg.SecretTTL = d
+	}
+
+	cfg.secrets = make(map[string]*aws.CachedSecret)
+	for _, k := range keys {
+		if !k.secret || !cfg.found[k.name] {
+			continue
+		}
+		s := aws.NewCachedSecret(refetch(providers, k.name), cfg.SecretTTL)
+		s.Set(values[k.name])
+		cfg.secrets[k.name] = s
+	}
+
+	required := []string{KeyPostgresHost, KeyPostgresDB, KeyPostgresUser}
+	if cfg.Postgres.AuthMode == AuthModePassword {
+		required = append(required, KeyPostgresPassword)
+	}
+	if err := cfg.Require(required...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// KeySenderSigningSecretPrefix prefixes the key holding a sender's HMAC
+// signing secret: sender-signing-secret-{sender name}.
+const KeySenderSigningSecretPrefix = "sender-signing-secret-"
+
+// SenderSigningSecret returns the cached accessor for the named sender's
+// signing secret. The key is looked up on first use, since senders are
+// registered at runtime, and then refetched like any other secret. For a
+// sender with no secret configured, every read fails.
+func (c *Config) SenderSigningSecret(name string) *aws.CachedSecret {
+	key := KeySenderSigningSecretPrefix + name
+	if s, ok := c.secrets[key]; ok {
+		return s
+	}
+	return c.lazySecret(key, refetch(c.providers, key))
+}
+
+// lazySecret returns the accessor for key cached in c.lazy, creating it
+// with fetch on first use.
+func (c *Config) lazySecret(key string, fetch func(context.Context) (string, error)) *aws.CachedSecret {
+	if c.lazy == nil {
+		return aws.NewCachedSecret(fetch, c.SecretTTL)
+	}
+	c.lazy.mu.Lock()
+	defer c.lazy.mu.Unlock()
+	s, ok := c.lazy.secrets[key]
+	if !ok {
+		s = aws.NewCachedSecret(fetch, c.SecretTTL)
+		c.lazy.secrets[key] = s
+	}
+	return s
+}
+
+// Keys rotating the deprecated webhook shared secret, read through
+// Config.WebhookSharedSecrets.
+const (
+	KeyWebhookSharedSecretExpires         = "webhook-shared-secret-expires"
+	KeyWebhookSharedSecretPrevious        = "webhook-shared-secret-previous"
+	KeyWebhookSharedSecretPreviousExpires = "webhook-shared-secret-previous-expires"
+)
+
+// SharedSecret is an accepted value of the deprecated webhook shared
+// secret.
+type SharedSecret struct {
+	Value string
+	// Expires ends its acceptance; zero never does.
+	Expires time.Time
+	// Previous marks the value replaced by the last rotation.
+	Previous bool
+}
+
+// WebhookSharedSecrets returns the deprecated webhook shared secret and,
+// while it is being rotated, the previous one, each with its expiry
+// (RFC 3339). The previous secret must have an expiry so the overlap
+// always ends. Each key is looked up on first use and refetched every
+// SecretTTL, so a rotation reaches warm Lambdas without a redeploy.
+func (c *Config) WebhookSharedSecrets(ctx context.Context) ([]SharedSecret, error) {
+	var res []SharedSecret
+	for _, k := range []struct {
+		value, expires string
+		previous       bool
+	}{
+		{KeyWebhookSharedSecret, KeyWebhookSharedSecretExpires, false},
+		{KeyWebhookSharedSecretPrevious, KeyWebhookSharedSecretPreviousExpires, true},
+	} {
+		v, err := c.optional(k.value, true).Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if v == "" {
+			continue
+		}
+		s := SharedSecret{Value: v, Previous: k.previous}
+		exp, err := c.optional(k.expires, false).Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case exp != "":
+			if s.Expires, err = time.Parse(time.RFC3339, exp); err != nil {
+				return nil, fmt.Errorf("invalid %s %q", k.expires, exp)
+			}
+		case k.previous:
+			return nil, fmt.Errorf("%s needs %s", k.value, k.expires)
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// RotateWebhookSharedSecret replaces the deprecated webhook shared secret
+// in SSM with value. For overlap, the replaced value is kept as the
+// previous secret, its expiry capped at the shared secret's own; it is
+// written first and then wait is given SecretTTL, so warm Lambdas accept
+// it before any of them sees the new value. Overlap 0 revokes the old
+// value at once. Returns the previous secret, the zero SharedSecret
+// without overlap.
+func (c *Config) RotateWebhookSharedSecret(ctx context.Context, put SSMPutter, value string, overlap time.Duration, wait func(time.Duration)) (SharedSecret, error) {
+	if err := c.fromSSM(ctx, KeyWebhookSharedSecret); err != nil {
+		return SharedSecret{}, err
+	}
+	secrets, err := c.WebhookSharedSecrets(ctx)
+	if err != nil {
+		return SharedSecret{}, err
+	}
+	var current SharedSecret
+	for _, s := range secrets {
+		if !s.Previous {
+			current = s
+		}
+	}
+	if current.Value == "" {
+		return SharedSecret{}, fmt.Errorf("%s is not set; there is nothing to rotate", KeyWebhookSharedSecret)
+	}
+
+	prefix := SSMPrefix(c.Env)
+	var previous SharedSecret
+	if overlap > 0 {
+		previous = SharedSecret{Value: current.Value, Expires: time.Now().Add(overlap).UTC().Truncate(time.Second), Previous: true}
+		if !current.Expires.IsZero() && current.Expires.Before(previous.Expires) {
+			previous.Expires = current.Expires
+		}
+		// The expiry goes first: a previous secret without one is refused.
+		if err := put(ctx, prefix+KeyWebhookSharedSecretPreviousExpires, previous.Expires.Format(time.RFC3339), false); err != nil {
+			return SharedSecret{}, err
+		}
+		if err := put(ctx, prefix+KeyWebhookSharedSecretPrevious, previous.Value, true); err != nil {
+			return SharedSecret{}, err
+		}
+		wait(c.SecretTTL)
+	}
+	if err := put(ctx, prefix+KeyWebhookSharedSecret, value, true); err != nil {
+		return SharedSecret{}, err
+	}
+	return previous, nil
+}
+
+// fromSSM checks that key is read from SSM, so writing its parameter
+// changes what the Lambdas see.
+func (c *Config) fromSSM(ctx context.Context, key string) error {
+	if c.Env == "" {
+		return fmt.Errorf("%s can only be written to SSM, which needs ENV", key)
+	}
+	for _, p := range c.providers {
+		if _, ok, err := p.Lookup(ctx, key, true); err != nil {
+			return err
+		} else if ok && p.Name() != SourceSSM {
+			return fmt.Errorf("%s is read from %s, not ssm; change it there", key, p.Name())
+		} else if ok {
+			return nil
+		}
+	}
+	for _, p := range c.providers {
+		if p.Name() == SourceSSM {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s can only be written to SSM; add ssm to CONFIG_SOURCES", key)
+}
+
+// optional returns the cached accessor for a key that may be set, changed
+// or removed at its source while a Lambda is warm; it reads "" while
+// unset. Keys Load or NewForTest already hold are served from there.
+func (c *Config) optional(key string, secret bool) *aws.CachedSecret {
+	if s, ok := c.secrets[key]; ok {
+		return s
+	}
+	return c.lazySecret(key, func(ctx context.Context) (string, error) {
+		invalidate(c.providers)
+		v, _, err := lookup(ctx, c.providers, key, secret)
+		return v, err
+	})
+}
+
+func newSecretCache() *secretCache {
+	return &secretCache{secrets: make(map[string]*aws.CachedSecret)}
+}
+
+// Keys read only by the retention job, through Config.Retention, so the
+// other Lambdas don't pay for looking them up on every cold start.
+const (
+	KeyRetentionMessages      = "retention-messages"
+	KeyRetentionRateLimits    = "retention-rate-limits"
+	KeyRetentionBatchSize     = "retention-batch-size"
+	KeyRetentionArchiveBucket = "retention-archive-bucket"
+	KeyRetentionArchivePrefix = "retention-archive-prefix"
+
+	defaultMessagesRetention  = 30 * 24 * time.Hour
+	defaultRateLimitRetention = 24 * time.Hour
+	defaultRetentionBatchSize = 1000
+)
+
+// Retention configures the retention job. A zero retention disables
+// purging that table.
+type Retention struct {
+	MessagesRetention  time.Duration
+	RateLimitRetention time.Duration
+	BatchSize          int
+	// ArchiveBucket, when set, receives every purged message as gzipped
+	// NDJSON before it is deleted.
+	ArchiveBucket string
+	ArchivePrefix string
+}
+
+// Retention looks the retention keys up in the same providers as Load.
+func (c *Config) Retention(ctx context.Context) (Retention, error) {
+	r := Retention{
+		MessagesRetention:  defaultMessagesRetention,
+		RateLimitRetention: defaultRateLimitRetention,
+		BatchSize:          defaultRetentionBatchSize,
+	}
+	durations := map[string]*time.Duration{
+		KeyRetentionMessages:   &r.MessagesRetention,
+		KeyRetentionRateLimits: &r.RateLimitRetention,
+	}
+	for key, dst := range durations {
+		v, ok, err := lookup(ctx, c.providers, key, false)
+		if err != nil {
+			return r, err
+		}
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return r, fmt.Errorf("invalid %s %q", key, v)
+		}
+		*dst = d
+	}
+	if v, ok, err := lookup(ctx, c.providers, KeyRetentionBatchSize, false); err != nil {
+		return r, err
+	} else if ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return r, fmt.Errorf("invalid %s %q", KeyRetentionBatchSize, v)
+		}
+		r.BatchSize = n
+	}
+	for key, dst := range map[string]*string{
+		KeyRetentionArchiveBucket: &r.ArchiveBucket,
+		KeyRetentionArchivePrefix: &r.ArchivePrefix,
+	} {
+		v, _, err := lookup(ctx, c.providers, key, false)
+		if err != nil {
+			return r, err
+		}
+		*dst = v
+	}
+	return r, nil
+}
+
+// Keys read only by the processing worker, through Config.Processing and
+// Config.NotificationRules.
+const (
+	KeyProcessingBatchSize   = "processing-batch-size"
+	KeyProcessingMaxAttempts = "processing-max-attempts"
+	KeyProcessingBackoff     = "processing-backoff"
+	KeyProcessingMaxBackoff  = "processing-max-backoff"
+	KeyNotificationRules     = "notification-rules"
+
+	defaultProcessingBatchSize   = 100
+	defaultProcessingMaxAttempts = 5
+	defaultProcessingBackoff     = 30 * time.Second
+	defaultProcessingMaxBackoff  = time.Hour
+)
+
+// Processing configures the worker that processes stored messages.
+type Processing struct {
+	BatchSize   int
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// Processing looks the processing keys up in the same providers as Load.
+func (c *Config) Processing(ctx context.Context) (Processing, error) {
+	p := Processing{
+		BatchSize:   defaultProcessingBatchSize,
+		MaxAttempts: defaultProcessingMaxAttempts,
+		Backoff:     defaultProcessingBackoff,
+		MaxBackoff:  defaultProcessingMaxBackoff,
+	}
+	for key, dst := range map[string]*int{
+		KeyProcessingBatchSize:   &p.BatchSize,
+		KeyProcessingMaxAttempts: &p.MaxAttempts,
+	} {
+		v, ok, err := lookup(ctx, c.providers, key, false)
+		if err != nil {
+			return p, err
+		}
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return p, fmt.Errorf("invalid %s %q", key, v)
+		}
+		*dst = n
+	}
+	for key, dst := range map[string]*time.Duration{
+		KeyProcessingBackoff:    &p.Backoff,
+		KeyProcessingMaxBackoff: &p.MaxBackoff,
+	} {
+		v, ok, err := lookup(ctx, c.providers, key, false)
+		if err != nil {
+			return p, err
+		}
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return p, fmt.Errorf("invalid %s %q", key, v)
+		}
+		*dst = d
+	}
+	return p, nil
+}
+
+// NotificationRules returns the JSON array of rules that turn stored
+// messages into notifications, nil if none are configured. The rules
+// package parses it.
+func (c *Config) NotificationRules(ctx context.Context) ([]byte, error) {
+	v, ok, err := lookup(ctx, c.providers, KeyNotificationRules, false)
+	if err != nil || !ok || strings.TrimSpace(v) == "" {
+		return nil, err
+	}
+	return []byte(v), nil
+}
+
+// Keys read only by the webhook receiver, through Config.RateLimit,
+// Config.IdempotencyWindow and Config.RedactHeaders.
+const (
+	KeyWebhookRateLimit          = "webhook-rate-limit"
+	KeyWebhookRateLimitPreAuth   = "webhook-rate-limit-pre-auth"
+	KeyWebhookRateLimitKey       = "webhook-rate-limit-key"
+	KeyWebhookRateLimitOverrides = "webhook-rate-limit-overrides"
+	KeyWebhookIdempotencyWindow  = "webhook-idempotency-window"
+	KeyWebhookRedactHeaders      = "webhook-redact-headers"
+)
+
+// RateLimit returns the receiver's rate-limit policy: the default and
+// pre-authentication quotas ("<limit>/<period>"), what buckets are keyed
+// on, and a JSON object of per-key quotas such as
+// {"ip:203.0.113.7": "600/1m"}.
+func (c *Config) RateLimit(ctx context.Context) (ratelimit.Policy, error) {
+	p := ratelimit.DefaultPolicy()
+	for key, dst := range map[string]*ratelimit.Quota{
+		KeyWebhookRateLimit:        &p.Default,
+		KeyWebhookRateLimitPreAuth: &p.PreAuth,
+	} {
+		v, ok, err := lookup(ctx, c.providers, key, false)
+		if err != nil {
+			return p, err
+		}
+		if !ok {
+			continue
+		}
+		q, err := ratelimit.ParseQuota(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		*dst = q
+	}
+	if v, ok, err := lookup(ctx, c.providers, KeyWebhookRateLimitKey, false); err != nil {
+		return p, err
+	} else if ok {
+		by, err := ratelimit.ParseKeyBy(v)
+		if err != nil {
+			return p, fmt.Errorf("invalid %s: %w", KeyWebhookRateLimitKey, err)
+		}
+		p.By = by
+	}
+	if v, ok, err := lookup(ctx, c.providers, KeyWebhookRateLimitOverrides, false); err != nil {
+		return p, err
+	} else if ok {
+		var raw map[string]string
+		if err := json.Unmarshal([]byte(v), &raw); err != nil {
+			return p, fmt.Errorf("invalid %s: %w", KeyWebhookRateLimitOverrides, err)
+		}
+		p.Overrides = make(map[string]ratelimit.Quota, len(raw))
+		for key, quota := range raw {
+			q, err := ratelimit.ParseQuota(quota)
+			if err != nil {
+				return p, fmt.Errorf("invalid %s for %s: %w", KeyWebhookRateLimitOverrides, key, err)
+			}
+			p.Overrides[key] = q
+		}
+	}
+	return p, nil
+}
+
+// IdempotencyWindow returns how long the receiver remembers an
+// Idempotency-Key. 0 turns idempotency off.
+func (c *Config) IdempotencyWindow(ctx context.Context) (time.Duration, error) {
+	v, ok, err := lookup(ctx, c.providers, KeyWebhookIdempotencyWindow, false)
+	if err != nil || !ok {
+		return idempotency.DefaultWindow, err
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return idempotency.DefaultWindow, fmt.Errorf("invalid %s %q", KeyWebhookIdempotencyWindow, v)
+	}
+	return d, nil
+}
+
+// RedactHeaders returns the comma-separated header names the receiver
+// redacts before storing a request, on top of redact.DefaultHeaders.
+func (c *Config) RedactHeaders(ctx context.Context) ([]string, error) {
+	v, _, err := lookup(ctx, c.providers, KeyWebhookRedactHeaders, false)
+	if err != nil {
+		return nil, err
+	}
+	return redact.ParseList(v), nil
+}
+
+// lookup returns the value of key from the first provider that has it.
+func lookup(ctx context.Context, providers []Provider, key string, secret bool) (string, bool, error) {
+	for _, p := range providers {
+		v, ok, err := p.Lookup(ctx, key, secret)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read %s from %s: %w", key, p.Name(), err)
+		}
+		if ok {
+			return v, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// invalidator is implemented by providers that cache what they fetch, so
+// a secret refetch sees the current value at the source.
+type invalidator interface {
+	Invalidate()
+}
+
+// invalidate drops what providers cached, so the next lookup reads the
+// source.
+func invalidate(providers []Provider) {
+	for _, p := range providers {
+		if inv, ok := p.(invalidator); ok {
+			inv.Invalidate()
+		}
+	}
+}
+
+func refetch(providers []Provider, key string) func(context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		invalidate(providers)
+		v, ok, err := lookup(ctx, providers, key, true)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", fmt.Errorf("%s is no longer configured", key)
+		}
+		return v, nil
+	}
+}
+
+var (
+	loadOnce sync.Once
+	loaded   *Config
+	loadErr  error
+)
+
+// Get loads the configuration from the providers selected by the
+// environment (see ProvidersFromEnv) on first use and returns the same
+// result for the life of the execution environment. aws.InitAWS must have
+// run first if the SSM or Secrets Manager providers are selected.
+func Get(ctx context.Context) (*Config, error) {
+	loadOnce.Do(func() {
+		env := os.Getenv("ENV")
+		providers, err := ProvidersFromEnv(ctx, env, os.Getenv)
+		if err != nil {
+			loadErr = err
+			return
+		}
+		loaded, loadErr = Load(ctx, env, providers)
+	})
+	return loaded, loadErr
+}
+
+// SetForTest replaces the loaded configuration. Mirrors db.SetPoolForTest.
+func SetForTest(cfg *Config) {
+	loadOnce = sync.Once{}
+	loadOnce.Do(func() {
+		loaded, loadErr = cfg, nil
+	})
+}
+
+// NewForTest builds a Config whose Require treats every non-empty field
+// and every key in secrets as supplied. Secrets never refetch.
+func NewForTest(cfg Config, secrets map[string]string) *Config {
+	cfg.found = map[string]bool{
+		KeyPostgresHost:  cfg.Postgres.Host != "",
+		KeyPostgresDB:    cfg.Postgres.Name != "",
+		KeyPostgresUser:  cfg.Postgres.User != "",
+		KeyDBAuthMode:    cfg.Postgres.AuthMode != "",
+		KeyDBSSLRootCert: cfg.Postgres.SSLRootCert != "",
+	}
+	cfg.secrets = make(map[string]*aws.CachedSecret)
+	for k, v := range secrets {
+		cfg.found[k] = true
+		cfg.secrets[k] = aws.StaticSecret(v)
+	}
+	cfg.lazy = newSecretCache()
+	cfg.sources = []string{"test"}
+	return &cfg
+}
@@ -0,0 +1,446 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/ratelimit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapProvider serves values from a map.
+type mapProvider struct {
+	name   string
+	values map[string]string
+	err    error
+}
+
+func (p mapProvider) Name() string { return p.name }
+
+func (p mapProvider) Lookup(_ context.Context, key string, _ bool) (string, bool, error) {
+	if p.err != nil {
+		return "", false, p.err
+	}
+	v, ok := p.values[key]
+	return v, ok, nil
+}
+
+var completePostgres = map[string]string{
+	KeyPostgresHost:     "db.example.com",
+	KeyPostgresDB:       "pennsieve",
+	KeyPostgresUser:     "svc",
+	KeyPostgresPassword: "pw",
+}
+
+func TestLoad_FirstProviderWins(t *testing.T) {
+	override := mapProvider{name: "env", values: map[string]string{KeyPostgresHost: "localhost", KeyDBPort: "6432"}}
+	base := mapProvider{name: "ssm", values: completePostgres}
+
+	cfg, err := Load(context.Background(), "dev", []Provider{override, base})
+	require.NoError(t, err)
+	assert.Equal(t, "dev", cfg.Env)
+	assert.Equal(t, Postgres{
+		Host:     "localhost",
+		Name:     "pennsieve",
+		User:     "svc",
+		AuthMode: AuthModePassword,
+		Port:     6432,
+	}, cfg.Postgres)
+	assert.Equal(t, defaultSecretTTL, cfg.SecretTTL)
+
+	password, err := cfg.Secret(KeyPostgresPassword).Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "pw", password)
+}
+
+func TestLoad_MissingKeysListsEveryKeyAndSource(t *testing.T) {
+	_, err := Load(context.Background(), "dev", []Provider{
+		mapProvider{name: "env", values: map[string]string{KeyPostgresHost: "localhost"}},
+		mapProvider{name: "file:local.json"},
+	})
+
+	var missing *MissingKeysError
+	require.ErrorAs(t, err, &missing)
+	assert.Equal(t, []string{KeyPostgresDB, KeyPostgresPassword, KeyPostgresUser}, missing.Keys)
+	assert.Equal(t, "missing configuration keys integrations-postgres-db, integrations-postgres-password, integrations-postgres-user (looked in: env, file:local.json)", err.Error())
+}
+
+func TestLoad_IAMModeDoesNotNeedPassword(t *testing.T) {
+	values := map[string]string{
+		KeyPostgresHost: "proxy.example.com",
+		KeyPostgresDB:   "pennsieve",
+		KeyPostgresUser: "svc",
+		KeyDBAuthMode:   AuthModeIAM,
+	}
+	cfg, err := Load(context.Background(), "dev", []Provider{mapProvider{name: "env", values: values}})
+	require.NoError(t, err)
+	assert.Equal(t, AuthModeIAM, cfg.Postgres.AuthMode)
+
+	var missing *MissingKeysError
+	_, err = cfg.Secret(KeyPostgresPassword).Get(context.Background())
+	assert.ErrorAs(t, err, &missing)
+}
+
+func TestLoad_InvalidValues(t *testing.T) {
+	for key, value := range map[string]string{KeyDBAuthMode: "kerberos", KeyDBPort: "abc", KeySecretTTL: "forever"} {
+		values := map[string]string{key: value}
+		for k, v := range completePostgres {
+			values[k] = v
+		}
+		_, err := Load(context.Background(), "dev", []Provider{mapProvider{name: "env", values: values}})
+		assert.ErrorContains(t, err, key)
+	}
+}
+
+func TestLoad_ProviderError(t *testing.T) {
+	_, err := Load(context.Background(), "dev", []Provider{mapProvider{name: "ssm", err: errors.New("throttled")}})
+	assert.ErrorContains(t, err, "from ssm: throttled")
+}
+
+func TestRequire(t *testing.T) {
+	cfg, err := Load(context.Background(), "dev", []Provider{mapProvider{name: "env", values: completePostgres}})
+	require.NoError(t, err)
+
+	var missing *MissingKeysError
+	require.ErrorAs(t, cfg.Require(KeyWebhookSharedSecret), &missing)
+	assert.Equal(t, []string{KeyWebhookSharedSecret}, missing.Keys)
+	assert.NoError(t, cfg.Require(KeyPostgresHost))
+}
+
+func TestSetForTest(t *testing.T) {
+	want := NewForTest(Config{}, map[string]string{KeyWebhookSharedSecret: "s"})
+	SetForTest(want)
+
+	got, err := Get(context.Background())
+	require.NoError(t, err)
+	assert.Same(t, want, got)
+	assert.NoError(t, got.Require(KeyWebhookSharedSecret))
+	assert.Error(t, got.Require(KeyPostgresHost))
+	secret, err := got.Secret(KeyWebhookSharedSecret).Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "s", secret)
+}
+
+func TestSecret_RefetchesFromProviderChain(t *testing.T) {
+	fake := aws.NewFakeSSM(map[string]string{
+		"/dev/integration-service/" + KeyPostgresHost:        "db",
+		"/dev/integration-service/" + KeyPostgresDB:          "pennsieve",
+		"/dev/integration-service/" + KeyPostgresUser:        "svc",
+		"/dev/integration-service/" + KeyPostgresPassword:    "pw",
+		"/dev/integration-service/" + KeyWebhookSharedSecret: "old",
+	})
+	aws.SetSSMClientForTest(fake)
+	env := mapProvider{name: "env", values: map[string]string{KeySecretTTL: "1h"}}
+	cfg, err := Load(context.Background(), "dev", []Provider{env, NewSSMProvider("/dev/integration-service/", aws.GetSSMParam)})
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, cfg.SecretTTL)
+
+	secret := cfg.Secret(KeyWebhookSharedSecret)
+	fake.Set("/dev/integration-service/"+KeyWebhookSharedSecret, "new")
+	v, err := secret.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "old", v, "served from cache within the TTL")
+
+	v, err = secret.Refresh(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "new", v)
+}
+
+func TestSenderSigningSecret(t *testing.T) {
+	values := map[string]string{KeySenderSigningSecretPrefix + "acme": "signing"}
+	for k, v := range completePostgres {
+		values[k] = v
+	}
+	cfg, err := Load(context.Background(), "dev", []Provider{mapProvider{name: "ssm", values: values}})
+	require.NoError(t, err)
+
+	secret := cfg.SenderSigningSecret("acme")
+	v, err := secret.Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "signing", v)
+	assert.Same(t, secret, cfg.SenderSigningSecret("acme"), "cached per sender")
+
+	_, err = cfg.SenderSigningSecret("beta").Get(context.Background())
+	assert.ErrorContains(t, err, KeySenderSigningSecretPrefix+"beta")
+
+	test := NewForTest(Config{}, map[string]string{KeySenderSigningSecretPrefix + "acme": "static"})
+	v, err = test.SenderSigningSecret("acme").Get(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "static", v)
+}
+
+func TestWebhookSharedSecrets(t *testing.T) {
+	ctx := context.Background()
+	values := map[string]string{
+		KeyWebhookSharedSecret:                "new",
+		KeyWebhookSharedSecretPrevious:        "old",
+		KeyWebhookSharedSecretPreviousExpires: "2026-10-20T12:00:00Z",
+	}
+	for k, v := range completePostgres {
+		values[k] = v
+	}
+	cfg, err := Load(ctx, "dev", []Provider{mapProvider{name: "ssm", values: values}})
+	require.NoError(t, err)
+	secrets, err := cfg.WebhookSharedSecrets(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []SharedSecret{
+		{Value: "new"},
+		{Value: "old", Expires: time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC), Previous: true},
+	}, secrets)
+
+	secrets, err = NewForTest(Config{}, map[string]string{
+		KeyWebhookSharedSecret:        "only",
+		KeyWebhookSharedSecretExpires: "2026-11-01T00:00:00Z",
+	}).WebhookSharedSecrets(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []SharedSecret{{Value: "only", Expires: time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)}}, secrets)
+
+	secrets, err = NewForTest(Config{}, nil).WebhookSharedSecrets(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, secrets)
+
+	for name, bad := range map[string]map[string]string{
+		"previous without expiry": {KeyWebhookSharedSecret: "new", KeyWebhookSharedSecretPrevious: "old"},
+		"bad expiry":              {KeyWebhookSharedSecret: "new", KeyWebhookSharedSecretExpires: "tomorrow"},
+	} {
+		_, err := NewForTest(Config{}, bad).WebhookSharedSecrets(ctx)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRotateWebhookSharedSecret(t *testing.T) {
+	ctx := context.Background()
+	prefix := SSMPrefix("dev")
+	fake := aws.NewFakeSSM(map[string]string{
+		prefix + KeyPostgresHost:        "db",
+		prefix + KeyPostgresDB:          "pennsieve",
+		prefix + KeyPostgresUser:        "svc",
+		prefix + KeyPostgresPassword:    "pw",
+		prefix + KeyWebhookSharedSecret: "old",
+	})
+	aws.SetSSMClientForTest(fake)
+	ssm := NewSSMProvider(prefix, aws.GetSSMParam)
+	cfg, err := Load(ctx, "dev", []Provider{ssm})
+	require.NoError(t, err)
+
+	var waited time.Duration
+	previous, err := cfg.RotateWebhookSharedSecret(ctx, aws.PutSSMParam, "new", time.Hour, func(d time.Duration) {
+		waited = d
+		v, _ := fake.Get(prefix + KeyWebhookSharedSecret)
+		assert.Equal(t, "old", v, "the new value is written after the wait")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, cfg.SecretTTL, waited)
+	assert.Equal(t, "old", previous.Value)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), previous.Expires, 5*time.Second)
+	for key, want := range map[string]string{
+		KeyWebhookSharedSecret:                "new",
+		KeyWebhookSharedSecretPrevious:        "old",
+		KeyWebhookSharedSecretPreviousExpires: previous.Expires.Format(time.RFC3339),
+	} {
+		v, ok := fake.Get(prefix + key)
+		assert.True(t, ok, key)
+		assert.Equal(t, want, v, key)
+	}
+
+	// The new config reads what was written.
+	rotated, err := Load(ctx, "dev", []Provider{ssm})
+	require.NoError(t, err)
+	secrets, err := rotated.WebhookSharedSecrets(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []SharedSecret{{Value: "new"}, previous}, secrets)
+
+	env := mapProvider{name: "env", values: map[string]string{KeyWebhookSharedSecret: "from-env"}}
+	shadowed, err := Load(ctx, "dev", []Provider{env, ssm})
+	require.NoError(t, err)
+	_, err = shadowed.RotateWebhookSharedSecret(ctx, aws.PutSSMParam, "newer", time.Hour, func(time.Duration) {})
+	assert.ErrorContains(t, err, "read from env")
+	_, err = NewForTest(Config{}, map[string]string{KeyWebhookSharedSecret: "s"}).
+		RotateWebhookSharedSecret(ctx, aws.PutSSMParam, "newer", time.Hour, func(time.Duration) {})
+	assert.ErrorContains(t, err, "needs ENV")
+}
+
+func TestRetention_DefaultsAndOverrides(t *testing.T) {
+	cfg, err := Load(context.Background(), "dev", []Provider{mapProvider{name: "ssm", values: completePostgres}})
+	require.NoError(t, err)
+	r, err := cfg.Retention(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Retention{
+		MessagesRetention:  defaultMessagesRetention,
+		RateLimitRetention: defaultRateLimitRetention,
+		BatchSize:          defaultRetentionBatchSize,
+	}, r)
+
+	override := mapProvider{name: "env", values: map[string]string{
+		KeyRetentionMessages:      "168h",
+		KeyRetentionRateLimits:    "0",
+		KeyRetentionBatchSize:     "250",
+		KeyRetentionArchiveBucket: "archive",
+		KeyRetentionArchivePrefix: "dev/",
+	}}
+	cfg, err = Load(context.Background(), "dev", []Provider{override, mapProvider{name: "ssm", values: completePostgres}})
+	require.NoError(t, err)
+	r, err = cfg.Retention(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Retention{
+		MessagesRetention:  168 * time.Hour,
+		RateLimitRetention: 0,
+		BatchSize:          250,
+		ArchiveBucket:      "archive",
+		ArchivePrefix:      "dev/",
+	}, r)
+}
+
+func TestRetention_InvalidValues(t *testing.T) {
+	for key, value := range map[string]string{
+		KeyRetentionMessages:   "a month",
+		KeyRetentionRateLimits: "-1h",
+		KeyRetentionBatchSize:  "0",
+	} {
+		override := mapProvider{name: "env", values: map[string]string{key: value}}
+		cfg, err := Load(context.Background(), "dev", []Provider{override, mapProvider{name: "ssm", values: completePostgres}})
+		require.NoError(t, err)
+		_, err = cfg.Retention(context.Background())
+		assert.ErrorContains(t, err, key)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	cfg, err := Load(context.Background(), "dev", []Provider{mapProvider{name: "ssm", values: completePostgres}})
+	require.NoError(t, err)
+	p, err := cfg.RateLimit(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, ratelimit.DefaultPolicy(), p)
+
+	override := mapProvider{name: "env", values: map[string]string{
+		KeyWebhookRateLimit:          "100/1h",
+		KeyWebhookRateLimitPreAuth:   "1000/1m",
+		KeyWebhookRateLimitKey:       "secret",
+		KeyWebhookRateLimitOverrides: `{"secret:0123456789abcdef": "1000/1h"}`,
+	}}
+	cfg, err = Load(context.Background(), "dev", []Provider{override, mapProvider{name: "ssm", values: completePostgres}})
+	require.NoError(t, err)
+	p, err = cfg.RateLimit(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, ratelimit.Policy{
+		By:        ratelimit.KeyBySecret,
+		Default:   ratelimit.Quota{Limit: 100, Period: time.Hour},
+		PreAuth:   ratelimit.Quota{Limit: 1000, Period: time.Minute},
+		Overrides: map[string]ratelimit.Quota{"secret:0123456789abcdef": {Limit: 1000, Period: time.Hour}},
+	}, p)
+}
+
+func TestRateLimit_InvalidValues(t *testing.T) {
+	for key, value := range map[string]string{
+		KeyWebhookRateLimit:          "60 per minute",
+		KeyWebhookRateLimitPreAuth:   "0/1m",
+		KeyWebhookRateLimitKey:       "header",
+		KeyWebhookRateLimitOverrides: `{"ip:10.0.0.1": "0/1m"}`,
+	} {
+		override := mapProvider{name: "env", values: map[string]string{key: value}}
+		cfg, err := Load(context.Background(), "dev", []Provider{override, mapProvider{name: "ssm", values: completePostgres}})
+		require.NoError(t, err)
+		_, err = cfg.RateLimit(context.Background())
+		assert.ErrorContains(t, err, key)
+	}
+}
+
+func TestIdempotencyWindow(t *testing.T) {
+	ssm := mapProvider{name: "ssm", values: completePostgres}
+	cfg, err := Load(context.Background(), "dev", []Provider{ssm})
+	require.NoError(t, err)
+	w, err := cfg.IdempotencyWindow(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, w)
+
+	for value, want := range map[string]time.Duration{"1h": time.Hour, "0": 0} {
+		env := mapProvider{name: "env", values: map[string]string{KeyWebhookIdempotencyWindow: value}}
+		cfg, err := Load(context.Background(), "dev", []Provider{env, ssm})
+		require.NoError(t, err)
+		w, err := cfg.IdempotencyWindow(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, want, w)
+	}
+
+	env := mapProvider{name: "env", values: map[string]string{KeyWebhookIdempotencyWindow: "-1h"}}
+	cfg, err = Load(context.Background(), "dev", []Provider{env, ssm})
+	require.NoError(t, err)
+	_, err = cfg.IdempotencyWindow(context.Background())
+	assert.ErrorContains(t, err, KeyWebhookIdempotencyWindow)
+}
+
+func TestRedactHeaders(t *testing.T) {
+	ssm := mapProvider{name: "ssm", values: completePostgres}
+	cfg, err := Load(context.Background(), "dev", []Provider{ssm})
+	require.NoError(t, err)
+	names, err := cfg.RedactHeaders(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	env := mapProvider{name: "env", values: map[string]string{KeyWebhookRedactHeaders: "X-Internal-Key, x-partner-auth"}}
+	cfg, err = Load(context.Background(), "dev", []Provider{env, ssm})
+	require.NoError(t, err)
+	names, err = cfg.RedactHeaders(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"x-internal-key", "x-partner-auth"}, names)
+}
+
+func TestProcessing_DefaultsAndOverrides(t *testing.T) {
+	cfg, err := Load(context.Background(), "dev", []Provider{mapProvider{name: "ssm", values: completePostgres}})
+	require.NoError(t, err)
+	p, err := cfg.Processing(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Processing{
+		BatchSize:   defaultProcessingBatchSize,
+		MaxAttempts: defaultProcessingMaxAttempts,
+		Backoff:     defaultProcessingBackoff,
+		MaxBackoff:  defaultProcessingMaxBackoff,
+	}, p)
+
+	override := mapProvider{name: "env", values: map[string]string{
+		KeyProcessingBatchSize:   "25",
+		KeyProcessingMaxAttempts: "3",
+		KeyProcessingBackoff:     "1m",
+		KeyProcessingMaxBackoff:  "10m",
+	}}
+	cfg, err = Load(context.Background(), "dev", []Provider{override, mapProvider{name: "ssm", values: completePostgres}})
+	require.NoError(t, err)
+	p, err = cfg.Processing(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Processing{BatchSize: 25, MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: 10 * time.Minute}, p)
+}
+
+func TestProcessing_InvalidValues(t *testing.T) {
+	for key, value := range map[string]string{
+		KeyProcessingBatchSize:   "0",
+		KeyProcessingMaxAttempts: "many",
+		KeyProcessingBackoff:     "-1s",
+		KeyProcessingMaxBackoff:  "an hour",
+	} {
+		override := mapProvider{name: "env", values: map[string]string{key: value}}
+		cfg, err := Load(context.Background(), "dev", []Provider{override, mapProvider{name: "ssm", values: completePostgres}})
+		require.NoError(t, err)
+		_, err = cfg.Processing(context.Background())
+		assert.Error(t, err, key)
+	}
+}
+
+func TestNotificationRules(t *testing.T) {
+	cfg, err := Load(context.Background(), "dev", []Provider{mapProvider{name: "ssm", values: completePostgres}})
+	require.NoError(t, err)
+	rules, err := cfg.NotificationRules(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, rules)
+
+	override := mapProvider{name: "env", values: map[string]string{KeyNotificationRules: `[{"name": "x"}]`}}
+	cfg, err = Load(context.Background(), "dev", []Provider{override, mapProvider{name: "ssm", values: completePostgres}})
+	require.NoError(t, err)
+	rules, err = cfg.NotificationRules(context.Background())
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"name": "x"}]`, string(rules))
+}
@@ -0,0 +1,226 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Provider is one source of configuration values. Lookup reports ok=false
+// when the source simply doesn't have the key, so the next provider is
+// tried; an error aborts loading.
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, key string, secret bool) (value string, ok bool, err error)
+}
+
+// Source names accepted in CONFIG_SOURCES.
+const (
+	SourceEnv            = "env"
+	SourceFile           = "file"
+	SourceSSM            = "ssm"
+	SourceSecretsManager = "secretsmanager"
+
+	defaultSources = SourceEnv + "," + SourceSSM
+)
+
+// ProvidersFromEnv builds the provider chain named by CONFIG_SOURCES
+// (comma-separated, default "env,ssm"):
+//
+//   - env: INTEGRATIONS_POSTGRES_HOST, DB_AUTH_MODE, ...
+//   - file: the JSON object at CONFIG_FILE, keyed by configuration key
+//   - ssm: /{ENV}/integration-service/{key}
+//   - secretsmanager: the JSON secret CONFIG_SECRET_ID
+//     (default {ENV}/integration-service), keyed by configuration key
+//
+// Running locally without AWS only needs CONFIG_SOURCES=env or
+// CONFIG_SOURCES=env,file.
+func ProvidersFromEnv(ctx context.Context, env string, getenv func(string) string) ([]Provider, error) {
+	sources := getenv("CONFIG_SOURCES")
+	if sources == "" {
+		sources = defaultSources
+	}
+
+	var providers []Provider
+	for _, source := range strings.Split(sources, ",") {
+		switch source = strings.TrimSpace(source); source {
+		case SourceEnv:
+			providers = append(providers, NewEnvProvider(getenv))
+		case SourceFile:
+			path := getenv("CONFIG_FILE")
+			if path == "" {
+				return nil, fmt.Errorf("config source %q requires CONFIG_FILE", source)
+			}
+			p, err := NewFileProvider(path)
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, p)
+		case SourceSSM:
+			if env == "" {
+				return nil, fmt.Errorf("config source %q requires ENV", source)
+			}
+			providers = append(providers, NewSSMProvider(SSMPrefix(env), aws.GetSSMParam))
+		case SourceSecretsManager:
+			secretID := getenv("CONFIG_SECRET_ID")
+			if secretID == "" {
+				if env == "" {
+					return nil, fmt.Errorf("config source %q requires CONFIG_SECRET_ID or ENV", source)
+				}
+				secretID = fmt.Sprintf("%s/integration-service", env)
+			}
+			cfg, err := aws.Config()
+			if err != nil {
+				return nil, fmt.Errorf("config source %q: %w", source, err)
+			}
+			providers = append(providers, NewSecretsManagerProvider(secretID, secretsmanager.NewFromConfig(cfg)))
+		default:
+			return nil, fmt.Errorf("unknown config source %q in CONFIG_SOURCES", source)
+		}
+	}
+	return providers, nil
+}
+
+// EnvName is the environment variable a key is read from.
+func EnvName(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+type envProvider struct {
+	getenv func(string) string
+}
+
+// NewEnvProvider reads keys from environment variables (see EnvName).
+// Empty variables count as unset.
+func NewEnvProvider(getenv func(string) string) Provider {
+	return envProvider{getenv: getenv}
+}
+
+func (envProvider) Name() string { return SourceEnv }
+
+func (p envProvider) Lookup(_ context.Context, key string, _ bool) (string, bool, error) {
+	v := p.getenv(EnvName(key))
+	return v, v != "", nil
+}
+
+type fileProvider struct {
+	path   string
+	values map[string]string
+}
+
+// NewFileProvider reads a flat JSON object of key to string value, e.g.
+// {"integrations-postgres-host": "localhost"}.
+func NewFileProvider(path string) (Provider, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var values map[string]string
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("config file %s must be a JSON object of strings: %w", path, err)
+	}
+	return fileProvider{path: path, values: values}, nil
+}
+
+func (p fileProvider) Name() string { return SourceFile + ":" + p.path }
+
+func (p fileProvider) Lookup(_ context.Context, key string, _ bool) (string, bool, error) {
+	v, ok := p.values[key]
+	return v, ok, nil
+}
+
+// SSMGetter matches aws.GetSSMParam.
+type SSMGetter func(ctx context.Context, name string, decrypt bool) (string, error)
+
+// SSMPutter matches aws.PutSSMParam.
+type SSMPutter func(ctx context.Context, name, value string, secure bool) error
+
+// SSMPrefix is what a key's SSM parameter name is under in env.
+func SSMPrefix(env string) string {
+	return fmt.Sprintf("/%s/integration-service/", env)
+}
+
+type ssmProvider struct {
+	prefix string
+	get    SSMGetter
+}
+
+// NewSSMProvider reads prefix+key from SSM Parameter Store, decrypting
+// secret keys.
+func NewSSMProvider(prefix string, get SSMGetter) Provider {
+	return ssmProvider{prefix: prefix, get: get}
+}
+
+func (ssmProvider) Name() string { return SourceSSM }
+
+func (p ssmProvider) Lookup(ctx context.Context, key string, secret bool) (string, bool, error) {
+	v, err := p.get(ctx, p.prefix+key, secret)
+	if err != nil {
+		var notFound *ssmtypes.ParameterNotFound
+		if errors.As(err, &notFound) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+// SecretsManagerAPI is the subset of the Secrets Manager client used here.
+type SecretsManagerAPI interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+type secretsManagerProvider struct {
+	secretID string
+	client   SecretsManagerAPI
+	raw      *aws.CachedSecret
+}
+
+// NewSecretsManagerProvider reads keys from a single JSON secret, fetched
+// on first lookup and again after a secret refetch invalidates it. A
+// secret that doesn't exist supplies no keys.
+func NewSecretsManagerProvider(secretID string, client SecretsManagerAPI) Provider {
+	p := &secretsManagerProvider{secretID: secretID, client: client}
+	p.raw = aws.NewCachedSecret(p.fetch, 0)
+	return p
+}
+
+func (p *secretsManagerProvider) Name() string { return SourceSecretsManager }
+
+func (p *secretsManagerProvider) Invalidate() { p.raw.Invalidate() }
+
+func (p *secretsManagerProvider) Lookup(ctx context.Context, key string, _ bool) (string, bool, error) {
+	raw, err := p.raw.Get(ctx)
+	if err != nil || raw == "" {
+		return "", false, err
+	}
+	var values map[string]string
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return "", false, fmt.Errorf("secret %s must be a JSON object of strings: %w", p.secretID, err)
+	}
+	v, ok := values[key]
+	return v, ok, nil
+}
+
+func (p *secretsManagerProvider) fetch(ctx context.Context) (string, error) {
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: &p.secretID})
+	if err != nil {
+		var notFound *smtypes.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to fetch secret %s: %w", p.secretID, err)
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", p.secretID)
+	}
+	return *out.SecretString, nil
+}
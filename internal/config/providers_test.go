@@ -0,0 +1,152 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getenvMap(vars map[string]string) func(string) string {
+	return func(k string) string { return vars[k] }
+}
+
+func TestEnvProvider(t *testing.T) {
+	assert.Equal(t, "INTEGRATIONS_POSTGRES_HOST", EnvName(KeyPostgresHost))
+
+	p := NewEnvProvider(getenvMap(map[string]string{"DB_AUTH_MODE": "iam", "DB_PORT": ""}))
+	v, ok, err := p.Lookup(context.Background(), KeyDBAuthMode, false)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "iam", v)
+
+	_, ok, _ = p.Lookup(context.Background(), KeyDBPort, false)
+	assert.False(t, ok, "empty variables count as unset")
+}
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "local.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"integrations-postgres-host":"localhost"}`), 0o600))
+
+	p, err := NewFileProvider(path)
+	require.NoError(t, err)
+	v, ok, err := p.Lookup(context.Background(), KeyPostgresHost, false)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "localhost", v)
+	_, ok, _ = p.Lookup(context.Background(), KeyPostgresDB, false)
+	assert.False(t, ok)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"db-port":5432}`), 0o600))
+	_, err = NewFileProvider(path)
+	assert.ErrorContains(t, err, "JSON object of strings")
+
+	_, err = NewFileProvider(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestSSMProvider(t *testing.T) {
+	var requested []string
+	p := NewSSMProvider("/dev/integration-service/", func(_ context.Context, name string, decrypt bool) (string, error) {
+		requested = append(requested, name)
+		switch name {
+		case "/dev/integration-service/" + KeyPostgresPassword:
+			assert.True(t, decrypt)
+			return "pw", nil
+		case "/dev/integration-service/" + KeyDBPort:
+			return "", &ssmtypes.ParameterNotFound{}
+		default:
+			return "", errors.New("access denied")
+		}
+	})
+
+	v, ok, err := p.Lookup(context.Background(), KeyPostgresPassword, true)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "pw", v)
+
+	_, ok, err = p.Lookup(context.Background(), KeyDBPort, false)
+	require.NoError(t, err)
+	assert.False(t, ok, "a missing parameter falls through to the next provider")
+
+	_, _, err = p.Lookup(context.Background(), KeyPostgresHost, false)
+	assert.ErrorContains(t, err, "access denied")
+}
+
+type fakeSecretsManager struct {
+	calls  int
+	secret *string
+	err    error
+}
+
+func (f *fakeSecretsManager) GetSecretValue(_ context.Context, in *secretsmanager.GetSecretValueInput, _ ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: f.secret}, nil
+}
+
+func TestSecretsManagerProvider_FetchesOnce(t *testing.T) {
+	secret := `{"integrations-postgres-password":"pw"}`
+	client := &fakeSecretsManager{secret: &secret}
+	p := NewSecretsManagerProvider("dev/integration-service", client)
+
+	v, ok, err := p.Lookup(context.Background(), KeyPostgresPassword, true)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "pw", v)
+	_, ok, _ = p.Lookup(context.Background(), KeyPostgresHost, false)
+	assert.False(t, ok)
+	assert.Equal(t, 1, client.calls)
+
+	secret = `{"integrations-postgres-password":"rotated"}`
+	p.(invalidator).Invalidate()
+	v, _, err = p.Lookup(context.Background(), KeyPostgresPassword, true)
+	require.NoError(t, err)
+	assert.Equal(t, "rotated", v)
+	assert.Equal(t, 2, client.calls)
+}
+
+func TestSecretsManagerProvider_MissingSecretSuppliesNothing(t *testing.T) {
+	p := NewSecretsManagerProvider("dev/integration-service", &fakeSecretsManager{err: &smtypes.ResourceNotFoundException{}})
+	_, ok, err := p.Lookup(context.Background(), KeyPostgresHost, false)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	p = NewSecretsManagerProvider("dev/integration-service", &fakeSecretsManager{err: errors.New("denied")})
+	_, _, err = p.Lookup(context.Background(), KeyPostgresHost, false)
+	assert.ErrorContains(t, err, "denied")
+}
+
+func TestProvidersFromEnv(t *testing.T) {
+	ctx := context.Background()
+
+	providers, err := ProvidersFromEnv(ctx, "dev", getenvMap(nil))
+	require.NoError(t, err)
+	require.Len(t, providers, 2)
+	assert.Equal(t, SourceEnv, providers[0].Name())
+	assert.Equal(t, SourceSSM, providers[1].Name())
+
+	path := filepath.Join(t.TempDir(), "local.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{}`), 0o600))
+	providers, err = ProvidersFromEnv(ctx, "", getenvMap(map[string]string{"CONFIG_SOURCES": "env, file", "CONFIG_FILE": path}))
+	require.NoError(t, err)
+	assert.Len(t, providers, 2)
+
+	for sources, want := range map[string]string{
+		"file":   "CONFIG_FILE",
+		"ssm":    "requires ENV",
+		"consul": "unknown config source",
+	} {
+		_, err := ProvidersFromEnv(ctx, "", getenvMap(map[string]string{"CONFIG_SOURCES": sources}))
+		assert.ErrorContains(t, err, want, sources)
+	}
+}
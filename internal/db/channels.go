@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrChannelNotFound is returned when no channel has a name.
+var ErrChannelNotFound = errors.New("channel not found")
+
+const channelColumns = `channel_id, name, status, auth, methods, senders, max_payload_bytes, json_schema,
+	processor, created_at, updated_at`
+
+// GetChannelByName returns the channel called name, whatever its status.
+func GetChannelByName(ctx context.Context, name string) (models.Channel, error) {
+	q := `SELECT ` + channelColumns + ` FROM webhooks.channels WHERE name = $1`
+
+	c, err := scanChannel(dbPool.QueryRowContext(ctx, q, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Channel{}, ErrChannelNotFound
+	}
+	if err != nil {
+		return models.Channel{}, fmt.Errorf("get channel: %w", err)
+	}
+	return c, nil
+}
+
+// ListChannels returns every channel ordered by name.
+func ListChannels(ctx context.Context) ([]models.Channel, error) {
+	q := `SELECT ` + channelColumns + ` FROM webhooks.channels ORDER BY name`
+
+	rows, err := dbPool.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("list channels: %w", err)
+	}
+	defer rows.Close()
+
+	res := []models.Channel{}
+	for rows.Next() {
+		c, err := scanChannel(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan channel: %w", err)
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
+
+// PutChannel creates an active channel called c.Name, or replaces the
+// policy of the existing one, keeping its status.
+func PutChannel(ctx context.Context, c models.Channel) (models.Channel, error) {
+	q := `
+		INSERT INTO webhooks.channels (name, auth, methods, senders, max_payload_bytes, json_schema, processor)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (name) DO UPDATE SET
+			auth = EXCLUDED.auth,
+			methods = EXCLUDED.methods,
+			senders = EXCLUDED.senders,
+			max_payload_bytes = EXCLUDED.max_payload_bytes,
+			json_schema = EXCLUDED.json_schema,
+			processor = EXCLUDED.processor,
+			updated_at = now()
+		RETURNING ` + channelColumns
+
+	var schema []byte
+	if len(c.JSONSchema) > 0 {
+		schema = c.JSONSchema
+	}
+	res, err := scanChannel(dbPool.QueryRowContext(ctx, q, c.Name, c.Auth, pq.Array(nonNil(c.Methods)),
+		pq.Array(nonNil(c.Senders)), c.MaxPayloadBytes, schema, nullableString(c.Processor)))
+	if err != nil {
+		return models.Channel{}, fmt.Errorf("put channel: %w", err)
+	}
+	return res, nil
+}
+
+// SetChannelStatus enables or disables a channel by name. A disabled
+// channel answers 404 from its next request.
+func SetChannelStatus(ctx context.Context, name, status string) (models.Channel, error) {
+	q := `
+		UPDATE webhooks.channels SET status = $2, updated_at = now()
+		WHERE name = $1
+		RETURNING ` + channelColumns
+
+	c, err := scanChannel(dbPool.QueryRowContext(ctx, q, name, status))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Channel{}, ErrChannelNotFound
+	}
+	if err != nil {
+		return models.Channel{}, fmt.Errorf("set channel status: %w", err)
+	}
+	return c, nil
+}
+
+// channelScanner abstracts over *sql.Row and *sql.Rows like
+// senderScanner.
+type channelScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanChannel scans a row selected with channelColumns.
+func scanChannel(row channelScanner) (models.Channel, error) {
+	var (
+		c         models.Channel
+		schema    []byte
+		processor sql.NullString
+	)
+	err := row.Scan(&c.ID, &c.Name, &c.Status, &c.Auth, pq.Array(&c.Methods), pq.Array(&c.Senders),
+		&c.MaxPayloadBytes, &schema, &processor, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return models.Channel{}, err
+	}
+	c.Methods = nonNil(c.Methods)
+	c.Senders = nonNil(c.Senders)
+	if schema != nil {
+		c.JSONSchema = schema
+	}
+	c.Processor = processor.String
+	return c, nil
+}
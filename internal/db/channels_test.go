@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var channelRowColumns = []string{"channel_id", "name", "status", "auth", "methods", "senders", "max_payload_bytes",
+	"json_schema", "processor", "created_at", "updated_at"}
+
+func TestGetChannelByName(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhooks.channels WHERE name = $1")).
+		WithArgs("lims").
+		WillReturnRows(sqlmock.NewRows(channelRowColumns).
+			AddRow(int64(2), "lims", "active", "secret", "{POST,PUT}", "{acme}", 4096, []byte(`{"type":"object"}`), "lims-runs", now, now))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhooks.channels WHERE name = $1")).
+		WithArgs("nope").
+		WillReturnRows(sqlmock.NewRows(channelRowColumns))
+
+	c, err := GetChannelByName(context.Background(), "lims")
+	require.NoError(t, err)
+	assert.Equal(t, models.Channel{
+		ID: 2, Name: "lims", Status: "active", Auth: "secret", Methods: []string{"POST", "PUT"},
+		Senders: []string{"acme"}, MaxPayloadBytes: 4096, JSONSchema: []byte(`{"type":"object"}`), Processor: "lims-runs",
+		CreatedAt: now, UpdatedAt: now,
+	}, c)
+
+	_, err = GetChannelByName(context.Background(), "nope")
+	assert.ErrorIs(t, err, ErrChannelNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPutChannel(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("ON CONFLICT (name) DO UPDATE SET")).
+		WithArgs("github", "signature", pq.Array([]string{"POST"}), pq.Array([]string{"ci"}), 1<<20, []byte(nil), sql.NullString{}).
+		WillReturnRows(sqlmock.NewRows(channelRowColumns).
+			AddRow(int64(1), "github", "active", "signature", "{POST}", "{ci}", 1<<20, nil, nil, now, now))
+
+	c, err := PutChannel(context.Background(), models.Channel{
+		Name: "github", Auth: "signature", Methods: []string{"POST"}, Senders: []string{"ci"}, MaxPayloadBytes: 1 << 20,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), c.ID)
+	assert.Equal(t, []string{"ci"}, c.Senders)
+	assert.Nil(t, c.JSONSchema)
+	assert.Empty(t, c.Processor)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetChannelStatus(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE webhooks.channels SET status = $2")).
+		WithArgs("lims", "disabled").
+		WillReturnRows(sqlmock.NewRows(channelRowColumns).
+			AddRow(int64(2), "lims", "disabled", "any", "{}", "{}", 4096, nil, nil, now, now))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE webhooks.channels SET status = $2")).
+		WithArgs("nope", "disabled").
+		WillReturnError(sql.ErrNoRows)
+
+	c, err := SetChannelStatus(context.Background(), "lims", models.ChannelDisabled)
+	require.NoError(t, err)
+	assert.Equal(t, models.ChannelDisabled, c.Status)
+	assert.Equal(t, []string{}, c.Methods)
+
+	_, err = SetChannelStatus(context.Background(), "nope", models.ChannelDisabled)
+	assert.ErrorIs(t, err, ErrChannelNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"log"
+
+	"github.com/Pennsieve/integration-service/internal/config"
+	"github.com/lib/pq"
+)
+
+// credential supplies the password a new connection authenticates with:
+// the Postgres password (*aws.CachedSecret) or an IAM auth token
+// (*iamToken).
+type credential interface {
+	Get(ctx context.Context) (string, error)
+	Refresh(ctx context.Context) (string, error)
+}
+
+// connector is the driver.Connector behind dbPool. Every new connection
+// reads the current credential, and a connection rejected for bad
+// credentials is retried once with a refetched one, so a rotated password
+// is picked up by warm Lambdas as soon as Postgres stops accepting the old
+// one rather than when the cache expires. Established connections are
+// unaffected by rotation.
+type connector struct {
+	settings   connSettings
+	credential credential
+	dial       func(ctx context.Context, dsn string) (driver.Conn, error)
+}
+
+func newConnector(settings connSettings, cred credential) *connector {
+	return &connector{settings: settings, credential: cred, dial: pqDial}
+}
+
+func pqDial(ctx context.Context, dsn string) (driver.Conn, error) {
+	c, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(ctx)
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	secret, err := c.credential.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := c.dial(ctx, c.settings.dsn(secret))
+	if err == nil || !isAuthFailure(err) {
+		return conn, err
+	}
+
+	log.Printf("WARN database rejected credentials (auth mode %s), refetching: %v", c.settings.authMode, err)
+	fresh, rerr := c.credential.Refresh(ctx)
+	if rerr != nil {
+		log.Printf("ERROR credential refresh: %v", rerr)
+		return nil, err
+	}
+	if fresh == secret && c.settings.authMode != config.AuthModeIAM {
+		// Same password as before: retrying can only fail the same way.
+		return nil, err
+	}
+	return c.dial(ctx, c.settings.dsn(fresh))
+}
+
+func (c *connector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// isAuthFailure reports whether Postgres rejected the login itself
+// (SQLSTATE class 28: invalid_authorization_specification,
+// invalid_password).
+func isAuthFailure(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code.Class() == "28"
+}
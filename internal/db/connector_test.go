@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/config"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const passwordParam = "/test/integration-service/integrations-postgres-password"
+
+type fakeConn struct {
+	driver.Conn
+}
+
+// fakeDialer accepts only DSNs built with the current password.
+type fakeDialer struct {
+	accept string
+	dials  []string
+}
+
+func (d *fakeDialer) dial(_ context.Context, dsn string) (driver.Conn, error) {
+	d.dials = append(d.dials, dsn)
+	if dsn == testSettings.dsn(d.accept) {
+		return fakeConn{}, nil
+	}
+	return nil, &pq.Error{Code: "28P01", Message: "password authentication failed"}
+}
+
+var testSettings = connSettings{host: "db.example.com", port: 5432, name: "pennsieve", user: "svc", authMode: config.AuthModePassword}
+
+func TestConnector_RefetchesRotatedPassword(t *testing.T) {
+	ssm := aws.NewFakeSSM(map[string]string{passwordParam: "old"})
+	aws.SetSSMClientForTest(ssm)
+	password := aws.NewSSMSecret(passwordParam, 0)
+	_, err := password.Get(context.Background())
+	require.NoError(t, err)
+
+	dialer := &fakeDialer{accept: "new"}
+	c := newConnector(testSettings, password)
+	c.dial = dialer.dial
+	ssm.Set(passwordParam, "new")
+
+	conn, err := c.Connect(context.Background())
+	require.NoError(t, err)
+	assert.NotNil(t, conn)
+	assert.Len(t, dialer.dials, 2, "rejected once, retried with the refetched password")
+	assert.Equal(t, 2, ssm.Calls(passwordParam))
+
+	_, err = c.Connect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, ssm.Calls(passwordParam), "the new password is cached")
+}
+
+func TestConnector_UnchangedPasswordIsNotRetried(t *testing.T) {
+	ssm := aws.NewFakeSSM(map[string]string{passwordParam: "wrong"})
+	aws.SetSSMClientForTest(ssm)
+
+	dialer := &fakeDialer{accept: "right"}
+	c := newConnector(testSettings, aws.NewSSMSecret(passwordParam, 0))
+	c.dial = dialer.dial
+
+	_, err := c.Connect(context.Background())
+	assert.True(t, isAuthFailure(err))
+	assert.Len(t, dialer.dials, 1)
+}
+
+func TestConnector_OtherErrorsAreNotRetried(t *testing.T) {
+	dials := 0
+	c := newConnector(testSettings, aws.StaticSecret("pw"))
+	c.dial = func(context.Context, string) (driver.Conn, error) {
+		dials++
+		return nil, errors.New("connection refused")
+	}
+
+	_, err := c.Connect(context.Background())
+	assert.ErrorContains(t, err, "connection refused")
+	assert.Equal(t, 1, dials)
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	assert.True(t, isAuthFailure(&pq.Error{Code: "28P01"}))
+	assert.True(t, isAuthFailure(&pq.Error{Code: "28000"}))
+	assert.False(t, isAuthFailure(&pq.Error{Code: "53300"}))
+	assert.False(t, isAuthFailure(errors.New("timeout")))
+}
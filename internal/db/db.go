@@ -4,22 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/config"
 	"github.com/Pennsieve/integration-service/internal/models"
-
-	// Registers the "postgres" driver with database/sql via its init().
-	// database/sql is only an abstraction layer; without a concrete driver
-	// imported for its side-effect, sql.Open("postgres", ...) fails at runtime
-	// with: sql: unknown driver "postgres" (forgotten import?).
-	_ "github.com/lib/pq"
 )
 
 var (
-	env       = os.Getenv("ENV")
 	dbPool    *sql.DB
 	dbOnce    sync.Once
 	dbInitErr error
@@ -32,37 +25,33 @@ const (
 )
 
 func initDB(ctx context.Context) error {
-	dbname, dberr := aws.GetSSMParam(ctx, fmt.Sprintf("/%s/integration-service/integrations-postgres-db", env), false)
-	if dberr != nil {
-		return fmt.Errorf("failed to get DB name: %w", dberr)
-	}
-	dbusername, usererr := aws.GetSSMParam(ctx, fmt.Sprintf("/%s/integration-service/integrations-postgres-user", env), false)
-	if usererr != nil {
-		return fmt.Errorf("failed to get DB username: %w", usererr)
-	}
-	dbpassword, pwerr := aws.GetSSMParam(ctx, fmt.Sprintf("/%s/integration-service/integrations-postgres-password", env), true)
-	if pwerr != nil {
-		return fmt.Errorf("failed to get DB password: %w", pwerr)
+	cfg, err := config.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
 	}
-	dbhostname, hosterr := aws.GetSSMParam(ctx, fmt.Sprintf("/%s/integration-service/integrations-postgres-host", env), false)
-	if hosterr != nil {
-		return fmt.Errorf("failed to get DB hostname: %w", hosterr)
+	settings := newConnSettings(cfg.Postgres)
+
+	var cred credential
+	switch settings.authMode {
+	case config.AuthModeIAM:
+		awsCfg, err := aws.Config()
+		if err != nil {
+			return fmt.Errorf("failed to load AWS config for IAM auth: %w", err)
+		}
+		cred = newIAMToken(settings, awsCfg)
+	default:
+		cred = cfg.Secret(config.KeyPostgresPassword)
 	}
 
-	connectionStr := fmt.Sprintf("host=%s user=%s password=%s dbname=%s sslmode=require",
-		dbhostname, dbusername, dbpassword, dbname)
-
-	db, err := sql.Open("postgres", connectionStr)
-	if err != nil {
-		return fmt.Errorf("failed to open database connection: %w", err)
-	}
+	db := sql.OpenDB(newConnector(settings, cred))
 
 	db.SetMaxOpenConns(dbMaxOpenConns)
 	db.SetMaxIdleConns(dbMaxIdleConns)
 	db.SetConnMaxLifetime(dbConnMaxLifetime)
 
 	if err := db.PingContext(ctx); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+		db.Close()
+		return fmt.Errorf("failed to ping database (auth mode %s): %w", settings.authMode, err)
 	}
 
 	dbPool = db
@@ -81,8 +70,8 @@ func EnsureDB(ctx context.Context) error {
 	return dbInitErr
 }
 
-func Query(ctx context.Context, command string) ([]models.WebhookRecord, error) {
-	rows, err := dbPool.QueryContext(ctx, command)
+func Query(ctx context.Context, command string, args ...interface{}) ([]models.WebhookRecord, error) {
+	rows, err := dbPool.QueryContext(ctx, command, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -99,3 +88,33 @@ func Query(ctx context.Context, command string) ([]models.WebhookRecord, error)
 
 	return res, rows.Err()
 }
+
+// QueryDatasets runs a dataset lookup query. Column order must be
+// id, node_id, name.
+func QueryDatasets(ctx context.Context, command string, args ...interface{}) ([]models.DatasetRecord, error) {
+	rows, err := dbPool.QueryContext(ctx, command, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []models.DatasetRecord
+	for rows.Next() {
+		var r models.DatasetRecord
+		if err := rows.Scan(&r.ID, &r.NodeID, &r.Name); err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+
+	return res, rows.Err()
+}
+
+// QueryCount runs a query returning a single count(*) column.
+func QueryCount(ctx context.Context, command string, args ...interface{}) (int, error) {
+	var count int
+	if err := dbPool.QueryRowContext(ctx, command, args...).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/config"
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+)
+
+const (
+	// defaultRDSCABundle is where the Makefile packages the RDS global CA
+	// bundle inside each Lambda ZIP (/var/task is the Lambda task root).
+	defaultRDSCABundle = "/var/task/rds-global-bundle.pem"
+
+	// RDS IAM auth tokens are valid for 15 minutes. Only the connect
+	// handshake needs a valid token, so a cached one is reused for new
+	// connections until it is close to expiry.
+	iamTokenRefreshAfter = 10 * time.Minute
+)
+
+// connSettings is everything needed to open a connection, independent of
+// how the credentials are obtained.
+type connSettings struct {
+	host        string
+	port        int
+	name        string
+	user        string
+	authMode    string
+	sslRootCert string
+}
+
+// endpoint is host:port as RDS IAM token signing expects it.
+func (s connSettings) endpoint() string {
+	return net.JoinHostPort(s.host, strconv.Itoa(s.port))
+}
+
+// dsn builds a lib/pq key/value connection string. With a CA bundle the
+// server certificate and hostname are verified; without one the connection
+// is encrypted but unverified, as it always has been for password auth.
+func (s connSettings) dsn(password string) string {
+	params := []string{
+		"host=" + dsnValue(s.host),
+		"port=" + strconv.Itoa(s.port),
+		"user=" + dsnValue(s.user),
+		"password=" + dsnValue(password),
+		"dbname=" + dsnValue(s.name),
+	}
+	if s.sslRootCert != "" {
+		params = append(params, "sslmode=verify-full", "sslrootcert="+dsnValue(s.sslRootCert))
+	} else {
+		params = append(params, "sslmode=require")
+	}
+	return strings.Join(params, " ")
+}
+
+// dsnValue quotes a connection string value. IAM tokens are URL query
+// strings full of '=' and '&', and passwords may contain spaces.
+func dsnValue(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// newConnSettings converts the loaded configuration. IAM mode always
+// verifies the server certificate, falling back to the packaged RDS CA
+// bundle.
+func newConnSettings(pg config.Postgres) connSettings {
+	s := connSettings{
+		host:        pg.Host,
+		port:        pg.Port,
+		name:        pg.Name,
+		user:        pg.User,
+		authMode:    pg.AuthMode,
+		sslRootCert: pg.SSLRootCert,
+	}
+	if s.sslRootCert == "" && s.authMode == config.AuthModeIAM {
+		s.sslRootCert = defaultRDSCABundle
+	}
+	return s
+}
+
+// buildTokenFunc matches auth.BuildAuthToken; swapped out in tests.
+type buildTokenFunc func(ctx context.Context, endpoint, region, dbUser string, creds awssdk.CredentialsProvider, optFns ...func(*auth.BuildAuthTokenOptions)) (string, error)
+
+// iamToken is a credential that signs a fresh IAM auth token whenever the
+// cached one is near expiry, so a long-lived *sql.DB keeps opening
+// connections after the first token has lapsed.
+type iamToken struct {
+	settings   connSettings
+	region     string
+	creds      awssdk.CredentialsProvider
+	buildToken buildTokenFunc
+	now        func() time.Time
+
+	mu       sync.Mutex
+	token    string
+	signedAt time.Time
+}
+
+func newIAMToken(settings connSettings, cfg awssdk.Config) *iamToken {
+	return &iamToken{
+		settings:   settings,
+		region:     cfg.Region,
+		creds:      cfg.Credentials,
+		buildToken: auth.BuildAuthToken,
+		now:        time.Now,
+	}
+}
+
+func (t *iamToken) Get(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token != "" && t.now().Sub(t.signedAt) < iamTokenRefreshAfter {
+		return t.token, nil
+	}
+	return t.sign(ctx)
+}
+
+// Refresh re-signs even if the cached token looks fresh, e.g. after the
+// proxy rejected it because the role's credentials were rotated.
+func (t *iamToken) Refresh(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sign(ctx)
+}
+
+func (t *iamToken) sign(ctx context.Context) (string, error) {
+	token, err := t.buildToken(ctx, t.settings.endpoint(), t.region, t.settings.user, t.creds)
+	if err != nil {
+		return "", fmt.Errorf("failed to build RDS IAM auth token: %w", err)
+	}
+	t.token, t.signedAt = token, t.now()
+	return token, nil
+}
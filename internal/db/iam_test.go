@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/config"
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/rds/auth"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConnSettings_IAMVerifiesWithBundledCA(t *testing.T) {
+	s := newConnSettings(config.Postgres{Host: "db.example.com", Port: 5432, AuthMode: config.AuthModePassword})
+	assert.Empty(t, s.sslRootCert, "password mode keeps sslmode=require unless a bundle is configured")
+
+	s = newConnSettings(config.Postgres{Host: "proxy.example.com", Port: 6432, AuthMode: config.AuthModeIAM})
+	assert.Equal(t, defaultRDSCABundle, s.sslRootCert)
+	assert.Equal(t, "proxy.example.com:6432", s.endpoint())
+
+	s = newConnSettings(config.Postgres{AuthMode: config.AuthModeIAM, SSLRootCert: "/tmp/ca.pem"})
+	assert.Equal(t, "/tmp/ca.pem", s.sslRootCert)
+}
+
+func TestConnSettingsDSN_ParsesWithTokenCharacters(t *testing.T) {
+	s := connSettings{host: "proxy.example.com", port: 5432, name: "pennsieve", user: "svc", sslRootCert: "/var/task/ca.pem"}
+	token := "proxy.example.com:5432/?Action=connect&DBUser=svc&X-Amz-Signature=abc'def ghi"
+
+	dsn := s.dsn(token)
+	assert.Contains(t, dsn, "sslmode=verify-full")
+	assert.Contains(t, dsn, "sslrootcert='/var/task/ca.pem'")
+
+	// pq.NewConnector parses the DSN without dialing; a quoting mistake
+	// surfaces here as a parse error.
+	_, err := pq.NewConnector(dsn)
+	require.NoError(t, err)
+
+	s.sslRootCert = ""
+	assert.Contains(t, s.dsn("pw"), "sslmode=require")
+}
+
+func TestIAMToken_CachesTokenUntilRefresh(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	calls := 0
+	c := newIAMToken(connSettings{host: "proxy.example.com", port: 5432, user: "svc"}, awssdk.Config{Region: "us-east-1"})
+	c.now = func() time.Time { return now }
+	c.buildToken = func(_ context.Context, endpoint, region, user string, _ awssdk.CredentialsProvider, _ ...func(*auth.BuildAuthTokenOptions)) (string, error) {
+		calls++
+		assert.Equal(t, "proxy.example.com:5432", endpoint)
+		assert.Equal(t, "us-east-1", region)
+		assert.Equal(t, "svc", user)
+		return "token", nil
+	}
+
+	ctx := context.Background()
+	_, err := c.Get(ctx)
+	require.NoError(t, err)
+	now = now.Add(iamTokenRefreshAfter - time.Second)
+	_, err = c.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+
+	now = now.Add(time.Second)
+	_, err = c.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls, "token is re-signed before it expires")
+
+	_, err = c.Refresh(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls, "Refresh re-signs a fresh token")
+}
+
+func TestIAMToken_SigningError(t *testing.T) {
+	settings := connSettings{host: "proxy.example.com", port: 5432, user: "svc"}
+	token := newIAMToken(settings, awssdk.Config{})
+	token.buildToken = func(context.Context, string, string, string, awssdk.CredentialsProvider, ...func(*auth.BuildAuthTokenOptions)) (string, error) {
+		return "", errors.New("no credentials")
+	}
+
+	_, err := newConnector(settings, token).Connect(context.Background())
+	assert.ErrorContains(t, err, "RDS IAM auth token")
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+const idempotencyColumns = `sender_id, key, body_hash, request_id, status_code, received_at, expires_at`
+
+// ReserveIdempotencyKey claims key for a sender's request until expiresAt.
+// If the key is already held and not expired, it returns the existing
+// record and reserved=false; a record with StatusCode 0 is a request still
+// in flight, which is also reported when a concurrent request claimed the
+// key a moment earlier.
+func ReserveIdempotencyKey(ctx context.Context, senderID int64, key, bodyHash string, expiresAt time.Time) (rec models.IdempotencyRecord, reserved bool, err error) {
+	q := `
+		WITH reserved AS (
+			INSERT INTO webhooks.idempotency_keys (sender_id, key, body_hash, expires_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (sender_id, key) DO UPDATE SET
+				body_hash = EXCLUDED.body_hash,
+				request_id = NULL,
+				status_code = NULL,
+				received_at = NULL,
+				expires_at = EXCLUDED.expires_at
+			WHERE webhooks.idempotency_keys.expires_at <= now()
+			RETURNING ` + idempotencyColumns + `, true AS reserved
+		)
+		SELECT * FROM reserved
+		UNION ALL
+		SELECT ` + idempotencyColumns + `, false FROM webhooks.idempotency_keys
+		WHERE sender_id = $1 AND key = $2 AND NOT EXISTS (SELECT 1 FROM reserved)`
+
+	var (
+		requestID  sql.NullString
+		statusCode sql.NullInt64
+		receivedAt sql.NullTime
+	)
+	err = dbPool.QueryRowContext(ctx, q, senderID, key, bodyHash, expiresAt).Scan(
+		&rec.SenderID, &rec.Key, &rec.BodyHash, &requestID, &statusCode, &receivedAt, &rec.ExpiresAt, &reserved)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The conflicting row was committed after this statement's
+		// snapshot was taken: its request is in flight.
+		return models.IdempotencyRecord{SenderID: senderID, Key: key}, false, nil
+	}
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("reserve idempotency key: %w", err)
+	}
+	rec.RequestID = requestID.String
+	rec.StatusCode = int(statusCode.Int64)
+	rec.ReceivedAt = receivedAt.Time
+	return rec, reserved, nil
+}
+
+// CompleteIdempotencyKey records the outcome of the request holding key,
+// which later requests with the key are answered with.
+func CompleteIdempotencyKey(ctx context.Context, senderID int64, key, requestID string, statusCode int, receivedAt time.Time) error {
+	const q = `
+		UPDATE webhooks.idempotency_keys SET request_id = $3, status_code = $4, received_at = $5
+		WHERE sender_id = $1 AND key = $2`
+
+	if _, err := dbPool.ExecContext(ctx, q, senderID, key, requestID, statusCode, receivedAt); err != nil {
+		return fmt.Errorf("complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets key, so a request that failed can be
+// retried with it.
+func ReleaseIdempotencyKey(ctx context.Context, senderID int64, key string) error {
+	const q = `DELETE FROM webhooks.idempotency_keys WHERE sender_id = $1 AND key = $2`
+
+	if _, err := dbPool.ExecContext(ctx, q, senderID, key); err != nil {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return nil
+}
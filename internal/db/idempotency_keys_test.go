@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var idempotencyRowColumns = []string{"sender_id", "key", "body_hash", "request_id", "status_code", "received_at", "expires_at", "reserved"}
+
+func TestReserveIdempotencyKey(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	expires := now.Add(time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.idempotency_keys")).
+		WithArgs(int64(3), "k-1", "hash", expires).
+		WillReturnRows(sqlmock.NewRows(idempotencyRowColumns).
+			AddRow(int64(3), "k-1", "hash", nil, nil, nil, expires, true))
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.idempotency_keys")).
+		WithArgs(int64(3), "k-1", "hash", expires).
+		WillReturnRows(sqlmock.NewRows(idempotencyRowColumns).
+			AddRow(int64(3), "k-1", "hash", "req-1", 202, now, expires, false))
+
+	rec, reserved, err := ReserveIdempotencyKey(context.Background(), 3, "k-1", "hash", expires)
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	assert.Equal(t, 0, rec.StatusCode)
+
+	rec, reserved, err = ReserveIdempotencyKey(context.Background(), 3, "k-1", "hash", expires)
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, models.IdempotencyRecord{
+		SenderID: 3, Key: "k-1", BodyHash: "hash", RequestID: "req-1", StatusCode: 202, ReceivedAt: now, ExpiresAt: expires,
+	}, rec)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReserveIdempotencyKey_ConcurrentlyClaimed(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.idempotency_keys")).
+		WillReturnRows(sqlmock.NewRows(idempotencyRowColumns))
+
+	rec, reserved, err := ReserveIdempotencyKey(context.Background(), 3, "k-1", "hash", time.Now())
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, 0, rec.StatusCode, "reported as in flight")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCompleteAndReleaseIdempotencyKey(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE webhooks.idempotency_keys SET request_id = $3")).
+		WithArgs(int64(3), "k-1", "req-1", 202, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhooks.idempotency_keys")).
+		WithArgs(int64(3), "k-2").
+		WillReturnError(assert.AnError)
+
+	require.NoError(t, CompleteIdempotencyKey(context.Background(), 3, "k-1", "req-1", 202, now))
+	assert.ErrorIs(t, ReleaseIdempotencyKey(context.Background(), 3, "k-2"), assert.AnError)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,843 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+// Memory is an in-memory implementation of every store, for behavioral
+// tests of the handlers and for running them locally without Postgres. It
+// mirrors the constraints the Postgres schema enforces (unique
+// subscriptions, topic foreign keys, per-user scoping) but not its
+// concurrency semantics beyond a single mutex.
+type Memory struct {
+	mu sync.Mutex
+
+	now func() time.Time
+
+	messages      []models.IncomingWebhook
+	rateLimits    map[string]*memoryBucket
+	senders       []memorySender
+	channels      []models.Channel
+	nonces        map[memoryKey]time.Time
+	sharedUses    []models.SharedSecretUse
+	idempotency   map[memoryKey]models.IdempotencyRecord
+	topics        []models.Topic
+	subscriptions []models.Subscription
+	notifications []models.Notification
+	nextID        int64
+}
+
+type memorySender struct {
+	models.Sender
+	secretHash         string
+	previousSecretHash string
+}
+
+// memoryKey identifies a nonce or idempotency key, both scoped per sender.
+type memoryKey struct {
+	senderID int64
+	key      string
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+var (
+	_ WebhookStore      = (*Memory)(nil)
+	_ RateLimitStore    = (*Memory)(nil)
+	_ SenderStore       = (*Memory)(nil)
+	_ ChannelStore      = (*Memory)(nil)
+	_ ReplayStore       = (*Memory)(nil)
+	_ ReceiverStore     = (*Memory)(nil)
+	_ MessageStore      = (*Memory)(nil)
+	_ ProcessingStore   = (*Memory)(nil)
+	_ NotificationStore = (*Memory)(nil)
+	_ RuleStore         = (*Memory)(nil)
+	_ RetentionStore    = (*Memory)(nil)
+)
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		now:         time.Now,
+		rateLimits:  make(map[string]*memoryBucket),
+		nonces:      make(map[memoryKey]time.Time),
+		idempotency: make(map[memoryKey]models.IdempotencyRecord),
+	}
+}
+
+// SetNow replaces the clock used to stamp rows, e.g. to seed old messages.
+func (m *Memory) SetNow(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = now
+}
+
+// RateLimitKeys returns the keys that have a rate-limit bucket.
+func (m *Memory) RateLimitKeys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for k := range m.rateLimits {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *Memory) Ready(context.Context) error {
+	return nil
+}
+
+func (m *Memory) id() int64 {
+	m.nextID++
+	return m.nextID
+}
+
+// Messages returns a copy of every stored inbound webhook message.
+func (m *Memory) Messages() []models.IncomingWebhook {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]models.IncomingWebhook(nil), m.messages...)
+}
+
+func (m *Memory) InsertWebhookMessage(_ context.Context, msg models.IncomingWebhook) (models.IncomingWebhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec := msg
+	rec.ID = m.id()
+	rec.Payload = append([]byte(nil), msg.Payload...)
+	if msg.RawBody != nil {
+		rec.RawBody = append([]byte(nil), msg.RawBody...)
+	}
+	rec.ReceivedAt = m.now()
+	due := rec.ReceivedAt
+	rec.Processing = models.ProcessingState{Status: models.MessageReceived, NextAttemptAt: &due}
+	if msg.Request.Headers != nil {
+		rec.Request.Headers = make(map[string]string, len(msg.Request.Headers))
+		for k, v := range msg.Request.Headers {
+			rec.Request.Headers[k] = v
+		}
+	}
+	m.messages = append(m.messages, rec)
+	return rec, nil
+}
+
+func (m *Memory) ListWebhookMessages(_ context.Context, f models.MessageFilter) ([]models.IncomingWebhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := []models.IncomingWebhook{}
+	for i := len(m.messages) - 1; i >= 0 && len(res) < f.Limit; i-- {
+		rec := m.messages[i]
+		if !f.Since.IsZero() && rec.ReceivedAt.Before(f.Since) ||
+			!f.Until.IsZero() && !rec.ReceivedAt.Before(f.Until) ||
+			f.SenderID != 0 && rec.SenderID != f.SenderID ||
+			f.ChannelID != 0 && rec.ChannelID != f.ChannelID ||
+			f.Method != "" && rec.Request.Method != f.Method ||
+			f.Status != "" && rec.Processing.Status != f.Status ||
+			f.BeforeID != 0 && rec.ID >= f.BeforeID {
+			continue
+		}
+		matched := true
+		for _, p := range f.Payload {
+			matched = matched && p.Match(rec.Payload)
+		}
+		if matched {
+			rec.Payload, rec.RawBody = nil, nil
+			res = append(res, rec)
+		}
+	}
+	return res, nil
+}
+
+func (m *Memory) GetWebhookMessage(_ context.Context, requestID string) (models.IncomingWebhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, rec := range m.messages {
+		if rec.RequestID == requestID {
+			return rec, nil
+		}
+	}
+	return models.IncomingWebhook{}, ErrMessageNotFound
+}
+
+func (m *Memory) ClaimWebhookMessages(_ context.Context, limit int, lease time.Duration, maxAttempts int) ([]models.IncomingWebhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var due []int
+	for i, rec := range m.messages {
+		if abandoned(rec.Processing, now, maxAttempts) {
+			continue
+		}
+		if next := rec.Processing.NextAttemptAt; next != nil && !next.After(now) {
+			due = append(due, i)
+		}
+	}
+	sort.SliceStable(due, func(a, b int) bool {
+		return m.messages[due[a]].Processing.NextAttemptAt.Before(*m.messages[due[b]].Processing.NextAttemptAt)
+	})
+	var res []models.IncomingWebhook
+	for _, i := range due {
+		if len(res) == limit {
+			break
+		}
+		expires := now.Add(lease)
+		p := &m.messages[i].Processing
+		p.Status = models.MessageProcessing
+		p.Attempts++
+		p.NextAttemptAt = &expires
+		res = append(res, m.messages[i])
+	}
+	return res, nil
+}
+
+func (m *Memory) FailAbandonedWebhookMessages(_ context.Context, maxAttempts int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var n int64
+	for i := range m.messages {
+		p := &m.messages[i].Processing
+		if abandoned(*p, now, maxAttempts) {
+			p.Status = models.MessageFailed
+			p.LastError = AbandonedError
+			p.NextAttemptAt = nil
+			n++
+		}
+	}
+	return n, nil
+}
+
+// abandoned reports whether p's last attempt's claim has expired.
+func abandoned(p models.ProcessingState, now time.Time, maxAttempts int) bool {
+	return p.Status == models.MessageProcessing && p.NextAttemptAt != nil && !p.NextAttemptAt.After(now) && p.Attempts >= maxAttempts
+}
+
+func (m *Memory) MarkWebhookMessageProcessed(_ context.Context, id int64, attempt int) error {
+	return m.finishAttempt(id, attempt, func(p *models.ProcessingState) {
+		now := m.now()
+		*p = models.ProcessingState{Status: models.MessageProcessed, Attempts: p.Attempts, ProcessedAt: &now}
+	})
+}
+
+func (m *Memory) MarkWebhookMessageFailed(_ context.Context, id int64, attempt int, errMsg string, retryAt *time.Time) error {
+	return m.finishAttempt(id, attempt, func(p *models.ProcessingState) {
+		p.Status = models.MessageFailed
+		p.LastError = errMsg
+		p.NextAttemptAt = retryAt
+	})
+}
+
+func (m *Memory) finishAttempt(id int64, attempt int, update func(*models.ProcessingState)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.messages {
+		p := &m.messages[i].Processing
+		if m.messages[i].ID == id && p.Attempts == attempt && p.Status == models.MessageProcessing {
+			update(p)
+			return nil
+		}
+	}
+	return fmt.Errorf("message %d: %w", id, ErrClaimLost)
+}
+
+func (m *Memory) GetSenderBySecretHash(_ context.Context, secretHash string) (models.Sender, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.senders {
+		if s.secretHash == secretHash {
+			return s.Sender, false, nil
+		}
+		if s.previousSecretHash == secretHash && s.InRotation(m.now()) {
+			return s.Sender, true, nil
+		}
+	}
+	return models.Sender{}, false, ErrSenderNotFound
+}
+
+func (m *Memory) GetSenderByName(_ context.Context, name string) (models.Sender, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.senders {
+		if s.Name == name {
+			return s.Sender, nil
+		}
+	}
+	return models.Sender{}, ErrSenderNotFound
+}
+
+func (m *Memory) CreateSender(_ context.Context, name, secretHash string, scopes []string) (models.Sender, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.senders {
+		if s.Name == name || s.secretHash == secretHash {
+			return models.Sender{}, ErrSenderExists
+		}
+	}
+	now := m.now()
+	s := models.Sender{
+		ID:        m.id(),
+		Name:      name,
+		Status:    models.SenderActive,
+		Scopes:    append([]string{}, scopes...),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.senders = append(m.senders, memorySender{Sender: s, secretHash: secretHash})
+	return s, nil
+}
+
+func (m *Memory) ListSenders(context.Context) ([]models.Sender, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := []models.Sender{}
+	for _, s := range m.senders {
+		res = append(res, s.Sender)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func (m *Memory) SetSenderStatus(_ context.Context, name, status string) (models.Sender, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.senders {
+		if m.senders[i].Name == name {
+			m.senders[i].Status = status
+			m.senders[i].UpdatedAt = m.now()
+			return m.senders[i].Sender, nil
+		}
+	}
+	return models.Sender{}, ErrSenderNotFound
+}
+
+func (m *Memory) SetSenderSignatureScheme(_ context.Context, name string, scheme []byte) (models.Sender, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.senders {
+		if m.senders[i].Name == name {
+			m.senders[i].SignatureScheme = json.RawMessage(scheme)
+			m.senders[i].UpdatedAt = m.now()
+			return m.senders[i].Sender, nil
+		}
+	}
+	return models.Sender{}, ErrSenderNotFound
+}
+
+func (m *Memory) SetSenderChallenge(_ context.Context, name string, responder []byte) (models.Sender, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.senders {
+		if m.senders[i].Name == name {
+			m.senders[i].Challenge = json.RawMessage(responder)
+			m.senders[i].UpdatedAt = m.now()
+			return m.senders[i].Sender, nil
+		}
+	}
+	return models.Sender{}, ErrSenderNotFound
+}
+
+func (m *Memory) GetChannelByName(_ context.Context, name string) (models.Channel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.channels {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return models.Channel{}, ErrChannelNotFound
+}
+
+func (m *Memory) ListChannels(context.Context) ([]models.Channel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := append([]models.Channel{}, m.channels...)
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func (m *Memory) PutChannel(_ context.Context, c models.Channel) (models.Channel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	c.Methods = append([]string{}, c.Methods...)
+	c.Senders = append([]string{}, c.Senders...)
+	c.UpdatedAt = now
+	for i := range m.channels {
+		if m.channels[i].Name == c.Name {
+			c.ID, c.Status, c.CreatedAt = m.channels[i].ID, m.channels[i].Status, m.channels[i].CreatedAt
+			m.channels[i] = c
+			return c, nil
+		}
+	}
+	c.ID, c.Status, c.CreatedAt = m.id(), models.ChannelActive, now
+	m.channels = append(m.channels, c)
+	return c, nil
+}
+
+func (m *Memory) SetChannelStatus(_ context.Context, name, status string) (models.Channel, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.channels {
+		if m.channels[i].Name == name {
+			m.channels[i].Status = status
+			m.channels[i].UpdatedAt = m.now()
+			return m.channels[i], nil
+		}
+	}
+	return models.Channel{}, ErrChannelNotFound
+}
+
+func (m *Memory) RotateSenderSecret(_ context.Context, name, secretHash string, previousExpiresAt time.Time) (models.Sender, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.senders {
+		if m.senders[i].Name != name {
+			continue
+		}
+		now := m.now()
+		s := &m.senders[i]
+		s.previousSecretHash, s.secretHash = s.secretHash, secretHash
+		s.PreviousSecretExpiresAt = &previousExpiresAt
+		s.PreviousSecretUsedAt = nil
+		s.SecretRotatedAt = &now
+		s.UpdatedAt = now
+		return s.Sender, nil
+	}
+	return models.Sender{}, ErrSenderNotFound
+}
+
+func (m *Memory) MarkPreviousSecretUsed(_ context.Context, senderID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.senders {
+		if m.senders[i].ID == senderID {
+			now := m.now()
+			m.senders[i].PreviousSecretUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RecordSharedSecretUse(_ context.Context, sourceIP, userAgent string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	userAgent = truncateUserAgent(userAgent)
+	for i := range m.sharedUses {
+		if u := &m.sharedUses[i]; u.SourceIP == sourceIP && u.UserAgent == userAgent {
+			u.Uses++
+			u.LastSeenAt = now
+			return nil
+		}
+	}
+	m.sharedUses = append(m.sharedUses, models.SharedSecretUse{
+		SourceIP: sourceIP, UserAgent: userAgent, Uses: 1, FirstSeenAt: now, LastSeenAt: now,
+	})
+	return nil
+}
+
+func (m *Memory) ListSharedSecretUses(context.Context) ([]models.SharedSecretUse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := append([]models.SharedSecretUse{}, m.sharedUses...)
+	sort.SliceStable(res, func(i, j int) bool { return res[i].LastSeenAt.After(res[j].LastSeenAt) })
+	return res, nil
+}
+
+func (m *Memory) ClearSharedSecretUses(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sharedUses = nil
+	return nil
+}
+
+func (m *Memory) RecordNonce(_ context.Context, senderID int64, nonce string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memoryKey{senderID, nonce}
+	if exp, ok := m.nonces[key]; ok && exp.After(m.now()) {
+		return false, nil
+	}
+	m.nonces[key] = expiresAt
+	return true, nil
+}
+
+func (m *Memory) ReleaseNonce(_ context.Context, senderID int64, nonce string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.nonces, memoryKey{senderID, nonce})
+	return nil
+}
+
+func (m *Memory) ReserveIdempotencyKey(_ context.Context, senderID int64, key, bodyHash string, expiresAt time.Time) (models.IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := memoryKey{senderID, key}
+	if rec, ok := m.idempotency[k]; ok && rec.ExpiresAt.After(m.now()) {
+		return rec, false, nil
+	}
+	rec := models.IdempotencyRecord{SenderID: senderID, Key: key, BodyHash: bodyHash, ExpiresAt: expiresAt}
+	m.idempotency[k] = rec
+	return rec, true, nil
+}
+
+func (m *Memory) CompleteIdempotencyKey(_ context.Context, senderID int64, key, requestID string, statusCode int, receivedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := memoryKey{senderID, key}
+	if rec, ok := m.idempotency[k]; ok {
+		rec.RequestID, rec.StatusCode, rec.ReceivedAt = requestID, statusCode, receivedAt
+		m.idempotency[k] = rec
+	}
+	return nil
+}
+
+func (m *Memory) ReleaseIdempotencyKey(_ context.Context, senderID int64, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.idempotency, memoryKey{senderID, key})
+	return nil
+}
+
+// TakeRateLimitToken applies the same token-bucket rule as the Postgres
+// upsert.
+func (m *Memory) TakeRateLimitToken(_ context.Context, key string, capacity int, refillPerSecond float64) (float64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	b, ok := m.rateLimits[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(capacity)}
+	} else {
+		b.tokens = math.Min(float64(capacity), b.tokens+now.Sub(b.updated).Seconds()*refillPerSecond)
+	}
+	b.updated = now
+	m.rateLimits[key] = b
+	if b.tokens < 1 {
+		return b.tokens, false, nil
+	}
+	b.tokens--
+	return b.tokens, true, nil
+}
+
+// AddTopic seeds a topic and returns it.
+func (m *Memory) AddTopic(name, description string) models.Topic {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := models.Topic{TopicID: m.id(), Name: name, Description: description, CreatedAt: m.now()}
+	m.topics = append(m.topics, t)
+	return t
+}
+
+// AddNotification seeds a notification for an existing subscription.
+func (m *Memory) AddNotification(subscriptionID int64, title, message string, metadata json.RawMessage) models.Notification {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := models.Notification{
+		NotificationID: m.id(),
+		SubscriptionID: subscriptionID,
+		Title:          title,
+		Message:        message,
+		Metadata:       metadata,
+		CreatedAt:      m.now(),
+	}
+	m.notifications = append(m.notifications, n)
+	return n
+}
+
+func (m *Memory) GetTopics(context.Context) ([]models.Topic, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	topics := append([]models.Topic(nil), m.topics...)
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+	return topics, nil
+}
+
+func (m *Memory) GetUserSubscriptions(_ context.Context, userID int64) ([]models.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var subs []models.Subscription
+	for i := len(m.subscriptions) - 1; i >= 0; i-- {
+		if m.subscriptions[i].UserID == userID {
+			subs = append(subs, m.subscriptions[i])
+		}
+	}
+	return subs, nil
+}
+
+func (m *Memory) CreateSubscription(_ context.Context, userID, topicID int64, subscriptionContext []byte) (models.Subscription, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.topicExists(topicID) {
+		return models.Subscription{}, false, ErrTopicNotFound
+	}
+	ctxJSON := defaultJSON(subscriptionContext)
+	for _, s := range m.subscriptions {
+		if s.UserID == userID && s.TopicID == topicID && jsonEqual(s.Context, ctxJSON) {
+			return s, false, nil
+		}
+	}
+	s := models.Subscription{
+		SubscriptionID: m.id(),
+		UserID:         userID,
+		TopicID:        topicID,
+		Context:        append(json.RawMessage(nil), ctxJSON...),
+		CreatedAt:      m.now(),
+	}
+	m.subscriptions = append(m.subscriptions, s)
+	return s, true, nil
+}
+
+func (m *Memory) DeleteSubscription(_ context.Context, subscriptionID, userID int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, s := range m.subscriptions {
+		if s.SubscriptionID == subscriptionID && s.UserID == userID {
+			m.subscriptions = append(m.subscriptions[:i], m.subscriptions[i+1:]...)
+			// Mirror ON DELETE CASCADE.
+			kept := m.notifications[:0]
+			for _, n := range m.notifications {
+				if n.SubscriptionID != subscriptionID {
+					kept = append(kept, n)
+				}
+			}
+			m.notifications = kept
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *Memory) TopicExists(_ context.Context, topicID int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.topicExists(topicID), nil
+}
+
+func (m *Memory) topicExists(topicID int64) bool {
+	for _, t := range m.topics {
+		if t.TopicID == topicID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) GetTopicNotifications(_ context.Context, topicID, userID int64, limit, offset int) ([]models.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	owned := make(map[int64]bool)
+	for _, s := range m.subscriptions {
+		if s.TopicID == topicID && s.UserID == userID {
+			owned[s.SubscriptionID] = true
+		}
+	}
+	var matched []models.Notification
+	for i := len(m.notifications) - 1; i >= 0; i-- {
+		if owned[m.notifications[i].SubscriptionID] {
+			matched = append(matched, m.notifications[i])
+		}
+	}
+	if offset >= len(matched) {
+		return nil, nil
+	}
+	matched = matched[offset:]
+	if len(matched) > limit {
+		matched = matched[:limit]
+	}
+	return matched, nil
+}
+
+func (m *Memory) CreateNotifications(_ context.Context, drafts []models.NotificationDraft) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var created int64
+	for _, d := range drafts {
+		var topicID int64
+		for _, t := range m.topics {
+			if t.Name == d.Topic {
+				topicID = t.TopicID
+			}
+		}
+		for _, s := range m.subscriptions {
+			if topicID == 0 || s.TopicID != topicID || !jsonContains(defaultJSON(d.Context), s.Context) {
+				continue
+			}
+			m.notifications = append(m.notifications, models.Notification{
+				NotificationID: m.id(),
+				SubscriptionID: s.SubscriptionID,
+				Title:          d.Title,
+				Message:        d.Message,
+				Metadata:       d.Metadata,
+				CreatedAt:      m.now(),
+			})
+			created++
+		}
+	}
+	return created, nil
+}
+
+func (m *Memory) ExpiredWebhookMessages(_ context.Context, before time.Time, limit int) ([]models.IncomingWebhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var res []models.IncomingWebhook
+	for _, msg := range m.messages {
+		if len(res) == limit {
+			break
+		}
+		if msg.ReceivedAt.Before(before) {
+			res = append(res, msg)
+		}
+	}
+	return res, nil
+}
+
+func (m *Memory) DeleteWebhookMessages(_ context.Context, ids []int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	drop := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+	return m.deleteMessages(func(msg models.IncomingWebhook) bool { return drop[msg.ID] }, -1), nil
+}
+
+func (m *Memory) DeleteExpiredWebhookMessages(_ context.Context, before time.Time, limit int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.deleteMessages(func(msg models.IncomingWebhook) bool { return msg.ReceivedAt.Before(before) }, limit), nil
+}
+
+// deleteMessages removes up to limit (-1 for all) matching messages.
+func (m *Memory) deleteMessages(match func(models.IncomingWebhook) bool, limit int) int64 {
+	var deleted int64
+	kept := m.messages[:0]
+	for _, msg := range m.messages {
+		if match(msg) && (limit < 0 || deleted < int64(limit)) {
+			deleted++
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	m.messages = kept
+	return deleted
+}
+
+func (m *Memory) DeleteIdleRateLimitBuckets(_ context.Context, before time.Time, limit int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	for k, b := range m.rateLimits {
+		if deleted == int64(limit) {
+			break
+		}
+		if b.updated.Before(before) {
+			delete(m.rateLimits, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *Memory) DeleteExpiredNonces(_ context.Context, before time.Time, limit int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	for k, exp := range m.nonces {
+		if deleted == int64(limit) {
+			break
+		}
+		if exp.Before(before) {
+			delete(m.nonces, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *Memory) DeleteExpiredIdempotencyKeys(_ context.Context, before time.Time, limit int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted int64
+	for k, rec := range m.idempotency {
+		if deleted == int64(limit) {
+			break
+		}
+		if rec.ExpiresAt.Before(before) {
+			delete(m.idempotency, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// jsonEqual compares two JSON documents the way JSONB equality does:
+// ignoring whitespace and key order.
+func jsonEqual(a, b []byte) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return bytes.Equal(a, b)
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return bytes.Equal(ja, jb)
+}
+
+// jsonContains is Postgres's container @> contained for the JSON documents
+// the store holds.
+func jsonContains(container, contained []byte) bool {
+	var a, b interface{}
+	if json.Unmarshal(container, &a) != nil || json.Unmarshal(contained, &b) != nil {
+		return false
+	}
+	return valueContains(a, b)
+}
+
+func valueContains(a, b interface{}) bool {
+	switch bv := b.(type) {
+	case map[string]interface{}:
+		av, ok := a.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for k, v := range bv {
+			if w, ok := av[k]; !ok || !valueContains(w, v) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		av, ok := a.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, v := range bv {
+			found := false
+			for _, w := range av {
+				if valueContains(w, v) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,443 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemory_InsertWebhookMessage(t *testing.T) {
+	m := NewMemory()
+	headers := map[string]string{"user-agent": "curl/8"}
+	rec, err := m.InsertWebhookMessage(context.Background(), models.IncomingWebhook{
+		RequestID: "req-1",
+		SenderID:  7,
+		Payload:   []byte(`{"a":1}`),
+		Request:   models.RequestMetadata{Method: "PUT", Headers: headers},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "req-1", rec.RequestID)
+	assert.Equal(t, int64(7), rec.SenderID)
+	assert.NotZero(t, rec.ID)
+	assert.False(t, rec.ReceivedAt.IsZero())
+	require.Len(t, m.Messages(), 1)
+	assert.JSONEq(t, `{"a":1}`, string(m.Messages()[0].Payload))
+	assert.Equal(t, "PUT", m.Messages()[0].Request.Method)
+
+	headers["user-agent"] = "changed"
+	assert.Equal(t, "curl/8", m.Messages()[0].Request.Headers["user-agent"], "headers are copied")
+}
+
+func TestMemory_TakeRateLimitToken_TokenBucket(t *testing.T) {
+	m := NewMemory()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// Capacity 3, one token every 10 seconds.
+	take := func(key string) (float64, bool) {
+		tokens, allowed, err := m.TakeRateLimitToken(ctx, key, 3, 0.1)
+		require.NoError(t, err)
+		return tokens, allowed
+	}
+	for want := 2.0; want >= 0; want-- {
+		tokens, allowed := take("ip:10.0.0.1")
+		assert.True(t, allowed)
+		assert.Equal(t, want, tokens)
+	}
+	_, allowed := take("ip:10.0.0.1")
+	assert.False(t, allowed, "an empty bucket rejects")
+	_, allowed = take("ip:10.0.0.2")
+	assert.True(t, allowed, "keys have independent buckets")
+
+	now = now.Add(10 * time.Second)
+	tokens, allowed := take("ip:10.0.0.1")
+	assert.True(t, allowed, "one token refills after 10 seconds")
+	assert.InDelta(t, 0, tokens, 1e-9)
+
+	now = now.Add(time.Hour)
+	tokens, _ = take("ip:10.0.0.1")
+	assert.InDelta(t, 2, tokens, 1e-9, "refill is capped at capacity")
+}
+
+func TestMemory_Senders(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+
+	s, err := m.CreateSender(ctx, "acme", "hash-1", []string{"webhooks:write"})
+	require.NoError(t, err)
+	assert.Equal(t, models.SenderActive, s.Status)
+	_, err = m.CreateSender(ctx, "acme", "hash-2", nil)
+	assert.ErrorIs(t, err, ErrSenderExists)
+	_, err = m.CreateSender(ctx, "beta", "hash-1", nil)
+	assert.ErrorIs(t, err, ErrSenderExists)
+
+	got, previous, err := m.GetSenderBySecretHash(ctx, "hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, s, got)
+	assert.False(t, previous)
+	_, _, err = m.GetSenderBySecretHash(ctx, "nope")
+	assert.ErrorIs(t, err, ErrSenderNotFound)
+
+	disabled, err := m.SetSenderStatus(ctx, "acme", models.SenderDisabled)
+	require.NoError(t, err)
+	assert.Equal(t, models.SenderDisabled, disabled.Status)
+	_, err = m.SetSenderStatus(ctx, "nope", models.SenderDisabled)
+	assert.ErrorIs(t, err, ErrSenderNotFound)
+
+	all, err := m.ListSenders(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []models.Sender{disabled}, all)
+
+	signed, err := m.SetSenderSignatureScheme(ctx, "acme", []byte(`"github"`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `"github"`, string(signed.SignatureScheme))
+	byName, err := m.GetSenderByName(ctx, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, signed, byName)
+	_, err = m.GetSenderByName(ctx, "nope")
+	assert.ErrorIs(t, err, ErrSenderNotFound)
+
+	answering, err := m.SetSenderChallenge(ctx, "acme", []byte(`"slack"`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `"slack"`, string(answering.Challenge))
+	_, err = m.SetSenderChallenge(ctx, "nope", nil)
+	assert.ErrorIs(t, err, ErrSenderNotFound)
+}
+
+func TestMemory_RotateSenderSecret(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	m.SetNow(func() time.Time { return now })
+	s, err := m.CreateSender(ctx, "acme", "old", nil)
+	require.NoError(t, err)
+
+	rotated, err := m.RotateSenderSecret(ctx, "acme", "new", now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, rotated.InRotation(now))
+	_, err = m.RotateSenderSecret(ctx, "nope", "x", now)
+	assert.ErrorIs(t, err, ErrSenderNotFound)
+
+	for hash, wantPrevious := range map[string]bool{"new": false, "old": true} {
+		got, previous, err := m.GetSenderBySecretHash(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, s.ID, got.ID)
+		assert.Equal(t, wantPrevious, previous, hash)
+	}
+
+	require.NoError(t, m.MarkPreviousSecretUsed(ctx, s.ID))
+	got, err := m.GetSenderByName(ctx, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, &now, got.PreviousSecretUsedAt)
+
+	now = now.Add(time.Hour)
+	_, _, err = m.GetSenderBySecretHash(ctx, "old")
+	assert.ErrorIs(t, err, ErrSenderNotFound, "the previous secret expires")
+}
+
+func TestMemory_SharedSecretUses(t *testing.T) {
+	m := NewMemory()
+	now := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	m.SetNow(func() time.Time { return now })
+	ctx := context.Background()
+
+	require.NoError(t, m.RecordSharedSecretUse(ctx, "203.0.113.10", "lims/2.1"))
+	now = now.Add(time.Minute)
+	require.NoError(t, m.RecordSharedSecretUse(ctx, "198.51.100.7", "cron"))
+	now = now.Add(time.Minute)
+	require.NoError(t, m.RecordSharedSecretUse(ctx, "203.0.113.10", "lims/2.1"))
+
+	uses, err := m.ListSharedSecretUses(ctx)
+	require.NoError(t, err)
+	require.Len(t, uses, 2)
+	assert.Equal(t, models.SharedSecretUse{
+		SourceIP: "203.0.113.10", UserAgent: "lims/2.1", Uses: 2,
+		FirstSeenAt: now.Add(-2 * time.Minute), LastSeenAt: now,
+	}, uses[0], "most recently seen first")
+
+	require.NoError(t, m.ClearSharedSecretUses(ctx))
+	uses, err = m.ListSharedSecretUses(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, uses)
+}
+
+func TestMemory_Channels(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+
+	created, err := m.PutChannel(ctx, models.Channel{Name: "lims", Auth: models.ChannelAuthSecret, Methods: []string{"POST"}, Senders: []string{"acme"}, MaxPayloadBytes: 4096})
+	require.NoError(t, err)
+	assert.Equal(t, models.ChannelActive, created.Status)
+	assert.True(t, created.AcceptsSender("acme"))
+	assert.False(t, created.AcceptsSender("ci"))
+	_, err = m.SetChannelStatus(ctx, "lims", models.ChannelDisabled)
+	require.NoError(t, err)
+
+	updated, err := m.PutChannel(ctx, models.Channel{Name: "lims", Auth: models.ChannelAuthAny, Methods: []string{"PUT"}, MaxPayloadBytes: 10})
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, updated.ID)
+	assert.Equal(t, models.ChannelDisabled, updated.Status, "replacing the policy keeps the status")
+	assert.Equal(t, []string{"PUT"}, updated.Methods)
+
+	byName, err := m.GetChannelByName(ctx, "lims")
+	require.NoError(t, err)
+	assert.Equal(t, updated, byName)
+	_, err = m.GetChannelByName(ctx, "nope")
+	assert.ErrorIs(t, err, ErrChannelNotFound)
+	_, err = m.SetChannelStatus(ctx, "nope", models.ChannelActive)
+	assert.ErrorIs(t, err, ErrChannelNotFound)
+
+	_, err = m.PutChannel(ctx, models.Channel{Name: "github", Auth: models.ChannelAuthSignature, Methods: []string{"POST"}, MaxPayloadBytes: 10})
+	require.NoError(t, err)
+	all, err := m.ListChannels(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "github", all[0].Name)
+}
+
+func TestMemory_IdempotencyKeys(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	m.SetNow(func() time.Time { return now })
+
+	_, reserved, err := m.ReserveIdempotencyKey(ctx, 1, "k", "h", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+	rec, reserved, err := m.ReserveIdempotencyKey(ctx, 1, "k", "h", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, 0, rec.StatusCode, "in flight")
+
+	require.NoError(t, m.CompleteIdempotencyKey(ctx, 1, "k", "req-1", 202, now))
+	rec, _, err = m.ReserveIdempotencyKey(ctx, 1, "k", "h", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "req-1", rec.RequestID)
+	assert.Equal(t, 202, rec.StatusCode)
+
+	_, reserved, err = m.ReserveIdempotencyKey(ctx, 2, "k", "h", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, reserved, "keys are per sender")
+
+	require.NoError(t, m.ReleaseIdempotencyKey(ctx, 1, "k"))
+	_, reserved, err = m.ReserveIdempotencyKey(ctx, 1, "k", "h", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, reserved, "a released key can be used again")
+}
+
+func TestMemory_RecordNonce(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	m.SetNow(func() time.Time { return now })
+
+	fresh, err := m.RecordNonce(ctx, 1, "n", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, err = m.RecordNonce(ctx, 1, "n", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, fresh, "replay within the expiry")
+	fresh, err = m.RecordNonce(ctx, 2, "n", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, fresh, "nonces are per sender")
+
+	require.NoError(t, m.ReleaseNonce(ctx, 1, "n"))
+	fresh, err = m.RecordNonce(ctx, 1, "n", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, fresh, "a released nonce can be used again")
+
+	now = now.Add(2 * time.Minute)
+	fresh, err = m.RecordNonce(ctx, 1, "n", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, fresh, "an expired nonce can be used again")
+}
+
+func TestMemory_CreateSubscription(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	topic := m.AddTopic("datasets", "dataset events")
+
+	sub, created, err := m.CreateSubscription(ctx, 7, topic.TopicID, nil)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.JSONEq(t, `{}`, string(sub.Context))
+
+	again, created, err := m.CreateSubscription(ctx, 7, topic.TopicID, []byte(`{ }`))
+	require.NoError(t, err)
+	assert.False(t, created, "same user, topic and context is an upsert")
+	assert.Equal(t, sub.SubscriptionID, again.SubscriptionID)
+
+	_, created, err = m.CreateSubscription(ctx, 7, topic.TopicID, []byte(`{"datasetId":1}`))
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	_, _, err = m.CreateSubscription(ctx, 7, 9999, nil)
+	assert.ErrorIs(t, err, ErrTopicNotFound)
+}
+
+func TestMemory_DeleteSubscription_ScopedToUser(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	topic := m.AddTopic("datasets", "")
+	sub, _, err := m.CreateSubscription(ctx, 7, topic.TopicID, nil)
+	require.NoError(t, err)
+
+	deleted, err := m.DeleteSubscription(ctx, sub.SubscriptionID, 8)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	deleted, err = m.DeleteSubscription(ctx, sub.SubscriptionID, 7)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	subs, err := m.GetUserSubscriptions(ctx, 7)
+	require.NoError(t, err)
+	assert.Empty(t, subs)
+}
+
+func TestMemory_GetTopicNotifications(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	topic := m.AddTopic("datasets", "")
+	other := m.AddTopic("files", "")
+	sub, _, _ := m.CreateSubscription(ctx, 7, topic.TopicID, nil)
+	otherUser, _, _ := m.CreateSubscription(ctx, 8, topic.TopicID, nil)
+	otherTopic, _, _ := m.CreateSubscription(ctx, 7, other.TopicID, nil)
+
+	first := m.AddNotification(sub.SubscriptionID, "first", "", json.RawMessage(`{}`))
+	m.AddNotification(otherUser.SubscriptionID, "not mine", "", nil)
+	m.AddNotification(otherTopic.SubscriptionID, "other topic", "", nil)
+	second := m.AddNotification(sub.SubscriptionID, "second", "", json.RawMessage(`{}`))
+
+	got, err := m.GetTopicNotifications(ctx, topic.TopicID, 7, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, second.NotificationID, got[0].NotificationID, "newest first")
+	assert.Equal(t, first.NotificationID, got[1].NotificationID)
+
+	got, err = m.GetTopicNotifications(ctx, topic.TopicID, 7, 1, 1)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, first.NotificationID, got[0].NotificationID)
+
+	got, err = m.GetTopicNotifications(ctx, topic.TopicID, 7, 10, 5)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestMemory_CreateNotifications_MatchesSubscriptionContext(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	topic := m.AddTopic("pipelines", "")
+	all, _, _ := m.CreateSubscription(ctx, 1, topic.TopicID, nil)
+	tagged, _, _ := m.CreateSubscription(ctx, 2, topic.TopicID, []byte(`{"dataset_id": 42, "tags": ["qc"]}`))
+	m.CreateSubscription(ctx, 3, topic.TopicID, []byte(`{"dataset_id": "42"}`))
+
+	n, err := m.CreateNotifications(ctx, []models.NotificationDraft{
+		{Topic: "pipelines", Context: json.RawMessage(`{"dataset_id": 42, "tags": ["qc", "nightly"]}`), Title: "done"},
+		{Topic: "unknown", Title: "lost"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	for user, sub := range map[int64]int64{1: all.SubscriptionID, 2: tagged.SubscriptionID} {
+		got, err := m.GetTopicNotifications(ctx, topic.TopicID, user, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		assert.Equal(t, sub, got[0].SubscriptionID)
+	}
+	got, err := m.GetTopicNotifications(ctx, topic.TopicID, 3, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, got, "a string doesn't match a number")
+}
+
+func TestMemory_CreateNotifications_EmptyContext(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	topic := m.AddTopic("pipelines", "")
+	all, _, _ := m.CreateSubscription(ctx, 1, topic.TopicID, nil)
+	m.CreateSubscription(ctx, 2, topic.TopicID, []byte(`{"dataset_id": 42}`))
+
+	n, err := m.CreateNotifications(ctx, []models.NotificationDraft{{Topic: "pipelines", Title: "done"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "an empty context only contains an empty context")
+	got, err := m.GetTopicNotifications(ctx, topic.TopicID, 1, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, all.SubscriptionID, got[0].SubscriptionID)
+	got, err = m.GetTopicNotifications(ctx, topic.TopicID, 2, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestMemory_MessageProcessingLifecycle(t *testing.T) {
+	m := NewMemory()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.SetNow(func() time.Time { return now })
+	ctx := context.Background()
+
+	rec, err := m.InsertWebhookMessage(ctx, models.IncomingWebhook{RequestID: "req-1", Payload: []byte(`{}`)})
+	require.NoError(t, err)
+	assert.Equal(t, models.MessageReceived, rec.Processing.Status)
+
+	claimed, err := m.ClaimWebhookMessages(ctx, 10, time.Minute, 3)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, 1, claimed[0].Processing.Attempts)
+	claimed, err = m.ClaimWebhookMessages(ctx, 10, time.Minute, 3)
+	require.NoError(t, err)
+	assert.Empty(t, claimed, "a claimed message isn't due until its claim expires")
+
+	retryAt := now.Add(time.Hour)
+	require.NoError(t, m.MarkWebhookMessageFailed(ctx, rec.ID, 1, "boom", &retryAt))
+	assert.Equal(t, models.MessageFailed, m.Messages()[0].Processing.Status)
+
+	now = retryAt
+	claimed, err = m.ClaimWebhookMessages(ctx, 10, time.Minute, 3)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.ErrorIs(t, m.MarkWebhookMessageProcessed(ctx, rec.ID, 1), ErrClaimLost, "the first attempt's claim is gone")
+	require.NoError(t, m.MarkWebhookMessageProcessed(ctx, rec.ID, 2))
+
+	got := m.Messages()[0].Processing
+	assert.Equal(t, models.MessageProcessed, got.Status)
+	assert.Nil(t, got.NextAttemptAt)
+	assert.Empty(t, got.LastError)
+}
+
+func TestMemory_AbandonedMessagesFail(t *testing.T) {
+	m := NewMemory()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.SetNow(func() time.Time { return now })
+	ctx := context.Background()
+	_, err := m.InsertWebhookMessage(ctx, models.IncomingWebhook{RequestID: "req-1", Payload: []byte(`{}`)})
+	require.NoError(t, err)
+
+	// Each claim expires without an outcome, as if the worker crashed.
+	for attempt := 1; attempt <= 2; attempt++ {
+		n, err := m.FailAbandonedWebhookMessages(ctx, 2)
+		require.NoError(t, err)
+		assert.Zero(t, n, "attempt %d", attempt)
+		claimed, err := m.ClaimWebhookMessages(ctx, 10, time.Minute, 2)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1, "attempt %d", attempt)
+		assert.Equal(t, attempt, claimed[0].Processing.Attempts)
+		now = now.Add(time.Minute)
+	}
+
+	claimed, err := m.ClaimWebhookMessages(ctx, 10, time.Minute, 2)
+	require.NoError(t, err)
+	assert.Empty(t, claimed, "out of attempts")
+	n, err := m.FailAbandonedWebhookMessages(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	got := m.Messages()[0].Processing
+	assert.Equal(t, models.MessageFailed, got.Status)
+	assert.Equal(t, AbandonedError, got.LastError)
+	assert.Nil(t, got.NextAttemptAt)
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+// ErrClaimLost is returned when recording the outcome of a processing
+// attempt that no longer holds its message: the claim expired and the
+// message was claimed again.
+var ErrClaimLost = errors.New("message claim lost")
+
+// AbandonedError is the last_error of a message whose final attempt's
+// claim expired without an outcome.
+const AbandonedError = "claim expired: the worker stopped before recording an outcome"
+
+// ClaimWebhookMessages marks up to limit due messages as processing,
+// counting the attempt, and returns them. The claim expires after lease,
+// when the message is due again, so one whose worker died is retried
+// until it has had maxAttempts; FailAbandonedWebhookMessages fails it
+// after that. FOR UPDATE SKIP LOCKED lets concurrent workers claim
+// disjoint batches.
+func ClaimWebhookMessages(ctx context.Context, limit int, lease time.Duration, maxAttempts int) ([]models.IncomingWebhook, error) {
+	q := `
+		UPDATE webhooks.messages SET
+			status = 'processing',
+			attempts = attempts + 1,
+			next_attempt_at = now() + $2 * interval '1 second'
+		WHERE id IN (
+			SELECT id FROM webhooks.messages
+			WHERE next_attempt_at <= now() AND (status <> 'processing' OR attempts < $3)
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + messageColumns
+
+	rows, err := dbPool.QueryContext(ctx, q, limit, lease.Seconds(), maxAttempts)
+	if err != nil {
+		return nil, fmt.Errorf("claim webhook messages: %w", err)
+	}
+	defer rows.Close()
+
+	var res []models.IncomingWebhook
+	for rows.Next() {
+		rec, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook message: %w", err)
+		}
+		res = append(res, rec)
+	}
+	return res, rows.Err()
+}
+
+// FailAbandonedWebhookMessages marks failed, for good, the messages whose
+// claim expired on their last attempt: their worker died every time, so
+// claiming them again would never end. Returns how many it failed.
+func FailAbandonedWebhookMessages(ctx context.Context, maxAttempts int) (int64, error) {
+	const q = `
+		UPDATE webhooks.messages SET
+			status = 'failed', last_error = $2, next_attempt_at = NULL
+		WHERE status = 'processing' AND next_attempt_at <= now() AND attempts >= $1`
+
+	res, err := dbPool.ExecContext(ctx, q, maxAttempts, AbandonedError)
+	if err != nil {
+		return 0, fmt.Errorf("fail abandoned webhook messages: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("fail abandoned webhook messages: %w", err)
+	}
+	return n, nil
+}
+
+// MarkWebhookMessageProcessed records that attempt processed message id.
+func MarkWebhookMessageProcessed(ctx context.Context, id int64, attempt int) error {
+	const q = `
+		UPDATE webhooks.messages SET
+			status = 'processed', processed_at = now(), next_attempt_at = NULL, last_error = NULL
+		WHERE id = $1 AND attempts = $2 AND status = 'processing'`
+
+	return finishAttempt(ctx, "mark webhook message processed", q, id, attempt)
+}
+
+// MarkWebhookMessageFailed records that attempt failed with errMsg. The
+// message is retried at retryAt, or never if retryAt is nil.
+func MarkWebhookMessageFailed(ctx context.Context, id int64, attempt int, errMsg string, retryAt *time.Time) error {
+	const q = `
+		UPDATE webhooks.messages SET
+			status = 'failed', last_error = $3, next_attempt_at = $4
+		WHERE id = $1 AND attempts = $2 AND status = 'processing'`
+
+	return finishAttempt(ctx, "mark webhook message failed", q, id, attempt, errMsg, retryAt)
+}
+
+func finishAttempt(ctx context.Context, op, q string, id int64, attempt int, extra ...interface{}) error {
+	res, err := dbPool.ExecContext(ctx, q, append([]interface{}{id, attempt}, extra...)...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %d: %w", op, id, ErrClaimLost)
+	}
+	return nil
+}
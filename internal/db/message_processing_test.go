@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimWebhookMessages(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	expires := now.Add(5 * time.Minute)
+	mock.ExpectQuery(`(?s)UPDATE webhooks.messages SET.*status = 'processing'.*attempts = attempts \+ 1.*attempts < \$3.*LIMIT \$1.*FOR UPDATE SKIP LOCKED`).
+		WithArgs(10, float64(300), 5).
+		WillReturnRows(sqlmock.NewRows(messageRowColumns).
+			AddRow(int64(1), "req-1", nil, []byte(`{"a":1}`), now, "POST", nil, nil, nil, nil, nil,
+				"processing", 2, "boom", expires, nil, nil, nil))
+
+	recs, err := ClaimWebhookMessages(context.Background(), 10, 5*time.Minute, 5)
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, models.MessageProcessing, recs[0].Processing.Status)
+	assert.Equal(t, 2, recs[0].Processing.Attempts)
+	assert.Equal(t, expires, *recs[0].Processing.NextAttemptAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFailAbandonedWebhookMessages(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectExec(`(?s)status = 'failed'.*next_attempt_at = NULL.*status = 'processing' AND next_attempt_at <= now\(\) AND attempts >= \$1`).
+		WithArgs(5, AbandonedError).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	n, err := FailAbandonedWebhookMessages(context.Background(), 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkWebhookMessageProcessed(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectExec(regexp.QuoteMeta("status = 'processed'")).
+		WithArgs(int64(1), 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("status = 'processed'")).
+		WithArgs(int64(1), 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, MarkWebhookMessageProcessed(context.Background(), 1, 2))
+	assert.ErrorIs(t, MarkWebhookMessageProcessed(context.Background(), 1, 2), ErrClaimLost)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkWebhookMessageFailed(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	retryAt := time.Now().Add(time.Minute)
+	mock.ExpectExec(regexp.QuoteMeta("status = 'failed'")).
+		WithArgs(int64(1), 1, "boom", &retryAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, MarkWebhookMessageFailed(context.Background(), 1, 1, "boom", &retryAt))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
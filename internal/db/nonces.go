@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RecordNonce remembers a signed request's nonce until expiresAt and
+// reports whether it was new. A nonce whose earlier use has expired (but
+// not yet been purged) counts as new. The insert is atomic, so of two
+// concurrent deliveries of the same request only one sees fresh.
+func RecordNonce(ctx context.Context, senderID int64, nonce string, expiresAt time.Time) (bool, error) {
+	const q = `
+		INSERT INTO webhooks.nonces (sender_id, nonce, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (sender_id, nonce) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		WHERE webhooks.nonces.expires_at <= now()`
+
+	res, err := dbPool.ExecContext(ctx, q, senderID, nonce, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("record nonce: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("record nonce: %w", err)
+	}
+	return n == 1, nil
+}
+
+// ReleaseNonce forgets a nonce, so a request that was accepted but could
+// not be stored can be redelivered.
+func ReleaseNonce(ctx context.Context, senderID int64, nonce string) error {
+	const q = `DELETE FROM webhooks.nonces WHERE sender_id = $1 AND nonce = $2`
+
+	if _, err := dbPool.ExecContext(ctx, q, senderID, nonce); err != nil {
+		return fmt.Errorf("release nonce: %w", err)
+	}
+	return nil
+}
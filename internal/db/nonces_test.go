@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordNonce(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	expires := time.Now().Add(10 * time.Minute)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhooks.nonces")).
+		WithArgs(int64(3), "n-1", expires).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhooks.nonces")).
+		WithArgs(int64(3), "n-1", expires).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	fresh, err := RecordNonce(context.Background(), 3, "n-1", expires)
+	require.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, err = RecordNonce(context.Background(), 3, "n-1", expires)
+	require.NoError(t, err)
+	assert.False(t, fresh, "a nonce seen before is a replay")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReleaseNonce(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhooks.nonces")).
+		WithArgs(int64(3), "n-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, ReleaseNonce(context.Background(), 3, "n-1"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -186,6 +186,56 @@ func GetTopicNotifications(ctx context.Context, topicID, userID int64, limit, of
 	return notifications, rows.Err()
 }
 
+// CreateNotifications delivers drafts, all or none: each becomes a
+// notifications.notifications row for every subscription to its topic
+// whose context it contains, with an unread notifications.user_notifications
+// row for the subscriber. Returns how many notifications were created; a
+// draft for an unknown topic or without subscribers creates none.
+func CreateNotifications(ctx context.Context, drafts []models.NotificationDraft) (int64, error) {
+	tx, err := dbPool.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("create notifications: %w", err)
+	}
+	defer tx.Rollback()
+
+	const q = `
+		WITH targets AS (
+			SELECT s.subscription_id, s.user_id
+			FROM notifications.subscriptions s
+			JOIN notifications.topics t ON t.topic_id = s.topic_id
+			WHERE t.name = $1 AND s.context <@ $2::jsonb
+		), created AS (
+			INSERT INTO notifications.notifications (subscription_id, title, message, metadata)
+			SELECT subscription_id, $3, $4, $5 FROM targets
+			RETURNING notification_id, subscription_id
+		)
+		INSERT INTO notifications.user_notifications (user_id, notification_id)
+		SELECT t.user_id, c.notification_id
+		FROM created c JOIN targets t ON t.subscription_id = c.subscription_id`
+
+	var total int64
+	for _, d := range drafts {
+		var metadata interface{}
+		if len(d.Metadata) > 0 {
+			metadata = []byte(d.Metadata)
+		}
+		res, err := tx.ExecContext(ctx, q, d.Topic, defaultJSON(d.Context), d.Title, d.Message, metadata)
+		if err != nil {
+			return 0, fmt.Errorf("create notifications for topic %q: %w", d.Topic, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("create notifications for topic %q: %w", d.Topic, err)
+		}
+		total += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("create notifications: %w", err)
+	}
+	return total, nil
+}
+
 // subscriptionScanner abstracts over *sql.Row and *sql.Rows so
 // scanSubscription can be shared by single-row and multi-row queries.
 type subscriptionScanner interface {
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Pennsieve/integration-service/internal/models"
 	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -214,3 +215,48 @@ func TestGetTopicNotifications(t *testing.T) {
 	assert.Nil(t, notifications[1].Metadata)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestCreateNotifications_DeliversAllDraftsInOneTransaction(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO notifications.user_notifications")).
+		WithArgs("pipelines", []byte(`{"dataset_id":42}`), "Pipeline finished", "qc finished", []byte(`{"url":"u"}`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO notifications.user_notifications")).
+		WithArgs("alerts", []byte("{}"), "Alert", "qc failed", nil).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	n, err := CreateNotifications(context.Background(), []models.NotificationDraft{
+		{Topic: "pipelines", Context: []byte(`{"dataset_id":42}`), Title: "Pipeline finished", Message: "qc finished", Metadata: []byte(`{"url":"u"}`)},
+		{Topic: "alerts", Title: "Alert", Message: "qc failed"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateNotifications_RollsBackOnError(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO notifications.user_notifications")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO notifications.user_notifications")).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	_, err = CreateNotifications(context.Background(), []models.NotificationDraft{
+		{Topic: "pipelines", Title: "a", Message: "a"},
+		{Topic: "pipelines", Title: "b", Message: "b"},
+	})
+	require.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
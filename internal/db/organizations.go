@@ -0,0 +1,29 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// LookupOrgSchema resolves an incoming organizationId to the name of the
+// org's Postgres schema. Pennsieve names each org schema after the org's
+// integer id, so the schema is the canonical id as found in
+// pennsieve.organizations. The comparison is done on the text form so a
+// non-numeric orgID is simply not found instead of erroring. Returns false
+// if no such org exists.
+func LookupOrgSchema(ctx context.Context, orgID string) (string, bool, error) {
+	const q = `SELECT id FROM pennsieve.organizations WHERE id::text = $1`
+
+	var id int64
+	err := dbPool.QueryRowContext(ctx, q, orgID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("lookup org schema: %w", err)
+	}
+	return strconv.FormatInt(id, 10), true, nil
+}
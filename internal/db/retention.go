@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/lib/pq"
+)
+
+// The retention queries each touch at most limit rows in their own
+// autocommitted statement, so a purge of millions of rows never holds
+// locks for longer than one batch. SKIP LOCKED lets a batch pass over rows
+// the receiver is writing at the same moment instead of waiting on them.
+
+// ExpiredWebhookMessages returns up to limit messages received before
+// before, oldest id first, for archiving ahead of DeleteWebhookMessages.
+func ExpiredWebhookMessages(ctx context.Context, before time.Time, limit int) ([]models.IncomingWebhook, error) {
+	q := `
+		SELECT ` + messageColumns + `
+		FROM webhooks.messages
+		WHERE received_at < $1
+		ORDER BY id
+		LIMIT $2`
+
+	rows, err := dbPool.QueryContext(ctx, q, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select expired webhook messages: %w", err)
+	}
+	defer rows.Close()
+
+	var res []models.IncomingWebhook
+	for rows.Next() {
+		rec, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook message: %w", err)
+		}
+		res = append(res, rec)
+	}
+	return res, rows.Err()
+}
+
+// DeleteWebhookMessages deletes messages by id and returns how many went.
+func DeleteWebhookMessages(ctx context.Context, ids []int64) (int64, error) {
+	const q = `DELETE FROM webhooks.messages WHERE id = ANY($1)`
+
+	res, err := dbPool.ExecContext(ctx, q, pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("delete webhook messages: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// DeleteExpiredWebhookMessages deletes up to limit messages received
+// before before, without reading their payloads.
+func DeleteExpiredWebhookMessages(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const q = `
+		DELETE FROM webhooks.messages
+		WHERE id IN (
+			SELECT id FROM webhooks.messages
+			WHERE received_at < $1
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)`
+
+	res, err := dbPool.ExecContext(ctx, q, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired webhook messages: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// DeleteIdleRateLimitBuckets deletes up to limit rate-limit buckets last
+// drawn from before before. A bucket idle for longer than its quota period
+// has refilled completely, so deleting it changes nothing for the sender.
+func DeleteIdleRateLimitBuckets(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const q = `
+		DELETE FROM webhooks.rate_limit_buckets
+		WHERE key IN (
+			SELECT key FROM webhooks.rate_limit_buckets
+			WHERE updated_at < $1
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)`
+
+	res, err := dbPool.ExecContext(ctx, q, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("delete idle rate limit buckets: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// DeleteExpiredNonces deletes up to limit replay-protection nonces that
+// expired before before.
+func DeleteExpiredNonces(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const q = `
+		DELETE FROM webhooks.nonces
+		WHERE (sender_id, nonce) IN (
+			SELECT sender_id, nonce FROM webhooks.nonces
+			WHERE expires_at < $1
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)`
+
+	res, err := dbPool.ExecContext(ctx, q, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired nonces: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// DeleteExpiredIdempotencyKeys deletes up to limit Idempotency-Key records
+// that expired before before.
+func DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const q = `
+		DELETE FROM webhooks.idempotency_keys
+		WHERE (sender_id, key) IN (
+			SELECT sender_id, key FROM webhooks.idempotency_keys
+			WHERE expires_at < $1
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)`
+
+	res, err := dbPool.ExecContext(ctx, q, before, limit)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired idempotency keys: %w", err)
+	}
+	return res.RowsAffected()
+}
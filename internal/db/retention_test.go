@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiredWebhookMessages(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	cutoff := time.Now().Add(-time.Hour)
+	old := cutoff.Add(-time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhooks.messages")).
+		WithArgs(cutoff, 2).
+		WillReturnRows(sqlmock.NewRows(messageRowColumns).
+			AddRow(int64(1), "req-1", nil, []byte(`{"a":1}`), old, nil, nil, nil, nil, nil, nil, "processed", 0, nil, nil, nil, nil, nil).
+			AddRow(int64(2), "req-2", int64(7), []byte(`{"a":2}`), old,
+				"POST", []byte(`{"content-type":"application/json"}`), "203.0.113.7", "curl/8", "application/json", "",
+				"received", 0, nil, old, nil, nil, nil))
+
+	msgs, err := ExpiredWebhookMessages(context.Background(), cutoff, 2)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "req-1", msgs[0].RequestID)
+	assert.Equal(t, int64(0), msgs[0].SenderID)
+	assert.Equal(t, int64(7), msgs[1].SenderID)
+	assert.JSONEq(t, `{"a":2}`, string(msgs[1].Payload))
+	assert.Equal(t, models.RequestMetadata{}, msgs[0].Request)
+	assert.Equal(t, "POST", msgs[1].Request.Method)
+	assert.Equal(t, "application/json", msgs[1].Request.Headers["content-type"])
+	assert.Equal(t, "203.0.113.7", msgs[1].Request.SourceIP)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteWebhookMessages(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhooks.messages WHERE id = ANY($1)")).
+		WithArgs(pq.Array([]int64{1, 2})).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	n, err := DeleteWebhookMessages(context.Background(), []int64{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteExpiredWebhookMessages_BoundedBatch(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	cutoff := time.Now()
+	mock.ExpectExec(`(?s)DELETE FROM webhooks.messages.*LIMIT \$2.*FOR UPDATE SKIP LOCKED`).
+		WithArgs(cutoff, 500).
+		WillReturnResult(sqlmock.NewResult(0, 500))
+
+	n, err := DeleteExpiredWebhookMessages(context.Background(), cutoff, 500)
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteIdleRateLimitBuckets(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	cutoff := time.Now()
+	mock.ExpectExec(`(?s)DELETE FROM webhooks.rate_limit_buckets.*FOR UPDATE SKIP LOCKED`).
+		WithArgs(cutoff, 100).
+		WillReturnError(assert.AnError)
+
+	_, err = DeleteIdleRateLimitBuckets(context.Background(), cutoff, 100)
+	assert.ErrorIs(t, err, assert.AnError)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteExpiredNonces(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	cutoff := time.Now()
+	mock.ExpectExec(`(?s)DELETE FROM webhooks.nonces.*FOR UPDATE SKIP LOCKED`).
+		WithArgs(cutoff, 100).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	n, err := DeleteExpiredNonces(context.Background(), cutoff, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteExpiredIdempotencyKeys(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	cutoff := time.Now()
+	mock.ExpectExec(`(?s)DELETE FROM webhooks.idempotency_keys.*FOR UPDATE SKIP LOCKED`).
+		WithArgs(cutoff, 100).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	n, err := DeleteExpiredIdempotencyKeys(context.Background(), cutoff, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,238 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/lib/pq"
+)
+
+// ErrSenderNotFound is returned when no sender matches a name or secret.
+var ErrSenderNotFound = errors.New("sender not found")
+
+// ErrSenderExists is returned when creating a sender whose name or secret
+// is already taken.
+var ErrSenderExists = errors.New("sender already exists")
+
+// pqUniqueViolation is the error code Postgres reports when a unique
+// constraint blocks an insert/update.
+const pqUniqueViolation = "23505"
+
+const senderColumns = `sender_id, name, status, scopes, signature_scheme, challenge,
+	secret_rotated_at, previous_secret_expires_at, previous_secret_used_at, created_at, updated_at`
+
+// GetSenderBySecretHash returns the sender whose secret, or whose previous
+// secret while it is still accepted, hashes to secretHash, whatever its
+// status. previous reports that the previous secret matched.
+func GetSenderBySecretHash(ctx context.Context, secretHash string) (s models.Sender, previous bool, err error) {
+	q := `
+		SELECT ` + senderColumns + `, secret_hash <> $1
+		FROM webhooks.senders
+		WHERE secret_hash = $1
+		   OR (previous_secret_hash = $1 AND previous_secret_expires_at > now())`
+
+	s, err = scanSender(dbPool.QueryRowContext(ctx, q, secretHash), &previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Sender{}, false, ErrSenderNotFound
+	}
+	if err != nil {
+		return models.Sender{}, false, fmt.Errorf("get sender: %w", err)
+	}
+	return s, previous, nil
+}
+
+// GetSenderByName returns the sender called name, whatever its status.
+func GetSenderByName(ctx context.Context, name string) (models.Sender, error) {
+	q := `SELECT ` + senderColumns + ` FROM webhooks.senders WHERE name = $1`
+
+	s, err := scanSender(dbPool.QueryRowContext(ctx, q, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Sender{}, ErrSenderNotFound
+	}
+	if err != nil {
+		return models.Sender{}, fmt.Errorf("get sender: %w", err)
+	}
+	return s, nil
+}
+
+// CreateSender inserts an active sender.
+func CreateSender(ctx context.Context, name, secretHash string, scopes []string) (models.Sender, error) {
+	q := `
+		INSERT INTO webhooks.senders (name, secret_hash, scopes)
+		VALUES ($1, $2, $3)
+		RETURNING ` + senderColumns
+
+	s, err := scanSender(dbPool.QueryRowContext(ctx, q, name, secretHash, pq.Array(nonNil(scopes))))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+			return models.Sender{}, ErrSenderExists
+		}
+		return models.Sender{}, fmt.Errorf("create sender: %w", err)
+	}
+	return s, nil
+}
+
+// ListSenders returns every sender ordered by name.
+func ListSenders(ctx context.Context) ([]models.Sender, error) {
+	q := `SELECT ` + senderColumns + ` FROM webhooks.senders ORDER BY name`
+
+	rows, err := dbPool.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("list senders: %w", err)
+	}
+	defer rows.Close()
+
+	res := []models.Sender{}
+	for rows.Next() {
+		s, err := scanSender(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan sender: %w", err)
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+// SetSenderStatus enables or disables a sender by name. A disabled sender
+// is rejected on its next request.
+func SetSenderStatus(ctx context.Context, name, status string) (models.Sender, error) {
+	q := `
+		UPDATE webhooks.senders SET status = $2, updated_at = now()
+		WHERE name = $1
+		RETURNING ` + senderColumns
+
+	s, err := scanSender(dbPool.QueryRowContext(ctx, q, name, status))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Sender{}, ErrSenderNotFound
+	}
+	if err != nil {
+		return models.Sender{}, fmt.Errorf("set sender status: %w", err)
+	}
+	return s, nil
+}
+
+// SetSenderSignatureScheme sets (or with nil, clears) the JSON signature
+// scheme a sender signs requests with.
+func SetSenderSignatureScheme(ctx context.Context, name string, scheme []byte) (models.Sender, error) {
+	q := `
+		UPDATE webhooks.senders SET signature_scheme = $2, updated_at = now()
+		WHERE name = $1
+		RETURNING ` + senderColumns
+
+	s, err := scanSender(dbPool.QueryRowContext(ctx, q, name, scheme))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Sender{}, ErrSenderNotFound
+	}
+	if err != nil {
+		return models.Sender{}, fmt.Errorf("set sender signature scheme: %w", err)
+	}
+	return s, nil
+}
+
+// SetSenderChallenge sets (or with nil, clears) the JSON challenge
+// responder answering a sender's endpoint handshakes.
+func SetSenderChallenge(ctx context.Context, name string, responder []byte) (models.Sender, error) {
+	q := `
+		UPDATE webhooks.senders SET challenge = $2, updated_at = now()
+		WHERE name = $1
+		RETURNING ` + senderColumns
+
+	s, err := scanSender(dbPool.QueryRowContext(ctx, q, name, responder))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Sender{}, ErrSenderNotFound
+	}
+	if err != nil {
+		return models.Sender{}, fmt.Errorf("set sender challenge: %w", err)
+	}
+	return s, nil
+}
+
+// RotateSenderSecret replaces a sender's secret with the one hashing to
+// secretHash. The old secret stays accepted until previousExpiresAt; a
+// time not in the future revokes it at once.
+func RotateSenderSecret(ctx context.Context, name, secretHash string, previousExpiresAt time.Time) (models.Sender, error) {
+	q := `
+		UPDATE webhooks.senders SET
+			previous_secret_hash = secret_hash,
+			secret_hash = $2,
+			previous_secret_expires_at = $3,
+			previous_secret_used_at = NULL,
+			secret_rotated_at = now(),
+			updated_at = now()
+		WHERE name = $1
+		RETURNING ` + senderColumns
+
+	s, err := scanSender(dbPool.QueryRowContext(ctx, q, name, secretHash, previousExpiresAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Sender{}, ErrSenderNotFound
+	}
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+			return models.Sender{}, ErrSenderExists
+		}
+		return models.Sender{}, fmt.Errorf("rotate sender secret: %w", err)
+	}
+	return s, nil
+}
+
+// MarkPreviousSecretUsed records that a sender presented its previous
+// secret.
+func MarkPreviousSecretUsed(ctx context.Context, senderID int64) error {
+	const q = `UPDATE webhooks.senders SET previous_secret_used_at = now() WHERE sender_id = $1`
+
+	if _, err := dbPool.ExecContext(ctx, q, senderID); err != nil {
+		return fmt.Errorf("mark previous secret used: %w", err)
+	}
+	return nil
+}
+
+// senderScanner abstracts over *sql.Row and *sql.Rows like
+// subscriptionScanner.
+type senderScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSender scans senderColumns, then any extra columns into extra.
+func scanSender(row senderScanner, extra ...interface{}) (models.Sender, error) {
+	var (
+		s                        models.Sender
+		scheme, challenge        []byte
+		rotated, expires, usedAt sql.NullTime
+	)
+	dest := []interface{}{&s.ID, &s.Name, &s.Status, pq.Array(&s.Scopes), &scheme, &challenge,
+		&rotated, &expires, &usedAt, &s.CreatedAt, &s.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return models.Sender{}, err
+	}
+	s.SecretRotatedAt = timePtr(rotated)
+	s.PreviousSecretExpiresAt = timePtr(expires)
+	s.PreviousSecretUsedAt = timePtr(usedAt)
+	s.Scopes = nonNil(s.Scopes)
+	if scheme != nil {
+		s.SignatureScheme = scheme
+	}
+	if challenge != nil {
+		s.Challenge = challenge
+	}
+	return s, nil
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
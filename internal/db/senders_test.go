@@ -0,0 +1,172 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var senderRowColumns = []string{"sender_id", "name", "status", "scopes", "signature_scheme", "challenge",
+	"secret_rotated_at", "previous_secret_expires_at", "previous_secret_used_at", "created_at", "updated_at"}
+
+func TestGetSenderBySecretHash(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE secret_hash = $1")).
+		WithArgs("abc").
+		WillReturnRows(sqlmock.NewRows(append(senderRowColumns, "previous")).
+			AddRow(int64(3), "acme", "active", "{webhooks:write}", nil, nil, nil, nil, nil, now, now, false))
+
+	s, previous, err := GetSenderBySecretHash(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.False(t, previous)
+	assert.Equal(t, models.Sender{ID: 3, Name: "acme", Status: "active", Scopes: []string{"webhooks:write"}, CreatedAt: now, UpdatedAt: now}, s)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetSenderBySecretHash_PreviousSecret(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	expires := now.Add(time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta("OR (previous_secret_hash = $1 AND previous_secret_expires_at > now())")).
+		WithArgs("old").
+		WillReturnRows(sqlmock.NewRows(append(senderRowColumns, "previous")).
+			AddRow(int64(3), "acme", "active", "{}", nil, nil, now, expires, nil, now, now, true))
+
+	s, previous, err := GetSenderBySecretHash(context.Background(), "old")
+	require.NoError(t, err)
+	assert.True(t, previous)
+	assert.Equal(t, &expires, s.PreviousSecretExpiresAt)
+	assert.Nil(t, s.PreviousSecretUsedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetSenderBySecretHash_NotFound(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhooks.senders")).
+		WillReturnRows(sqlmock.NewRows(senderRowColumns))
+
+	_, _, err = GetSenderBySecretHash(context.Background(), "abc")
+	assert.ErrorIs(t, err, ErrSenderNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateSender_Duplicate(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.senders")).
+		WithArgs("acme", "abc", pq.Array([]string{})).
+		WillReturnError(&pq.Error{Code: pqUniqueViolation})
+
+	_, err = CreateSender(context.Background(), "acme", "abc", nil)
+	assert.ErrorIs(t, err, ErrSenderExists)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetSenderStatus(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE webhooks.senders SET status = $2")).
+		WithArgs("acme", "disabled").
+		WillReturnRows(sqlmock.NewRows(senderRowColumns).
+			AddRow(int64(3), "acme", "disabled", "{}", []byte(`{"signature_header":"X-Sig"}`), nil, nil, nil, nil, now, now))
+
+	s, err := SetSenderStatus(context.Background(), "acme", models.SenderDisabled)
+	require.NoError(t, err)
+	assert.Equal(t, models.SenderDisabled, s.Status)
+	assert.Equal(t, []string{}, s.Scopes)
+	assert.JSONEq(t, `{"signature_header":"X-Sig"}`, string(s.SignatureScheme))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetSenderChallenge(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	responder := []byte(`{"in":"query","echo":"validationToken","reply":"text"}`)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE webhooks.senders SET challenge = $2")).
+		WithArgs("acme", responder).
+		WillReturnRows(sqlmock.NewRows(senderRowColumns).
+			AddRow(int64(3), "acme", "active", "{}", nil, responder, nil, nil, nil, now, now))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE webhooks.senders SET challenge = $2")).
+		WithArgs("nope", sqlmock.AnyArg()).
+		WillReturnError(sql.ErrNoRows)
+
+	s, err := SetSenderChallenge(context.Background(), "acme", responder)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(responder), string(s.Challenge))
+	assert.Nil(t, s.SignatureScheme)
+
+	_, err = SetSenderChallenge(context.Background(), "nope", nil)
+	assert.ErrorIs(t, err, ErrSenderNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRotateSenderSecret(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	expires := now.Add(24 * time.Hour)
+	mock.ExpectQuery(`(?s)previous_secret_hash = secret_hash,\s+secret_hash = \$2`).
+		WithArgs("acme", "new", expires).
+		WillReturnRows(sqlmock.NewRows(senderRowColumns).
+			AddRow(int64(3), "acme", "active", "{}", nil, nil, now, expires, nil, now, now))
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE webhooks.senders")).
+		WithArgs("nope", "new", expires).
+		WillReturnRows(sqlmock.NewRows(senderRowColumns))
+
+	s, err := RotateSenderSecret(context.Background(), "acme", "new", expires)
+	require.NoError(t, err)
+	assert.Equal(t, &now, s.SecretRotatedAt)
+	assert.Equal(t, &expires, s.PreviousSecretExpiresAt)
+	_, err = RotateSenderSecret(context.Background(), "nope", "new", expires)
+	assert.ErrorIs(t, err, ErrSenderNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkPreviousSecretUsed(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectExec(regexp.QuoteMeta("SET previous_secret_used_at = now() WHERE sender_id = $1")).
+		WithArgs(int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, MarkPreviousSecretUsed(context.Background(), 3))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+// maxUserAgentLength bounds the User-Agent recorded per shared secret use.
+const maxUserAgentLength = 256
+
+// RecordSharedSecretUse records that a request from sourceIP with
+// userAgent presented the previous webhook shared secret.
+func RecordSharedSecretUse(ctx context.Context, sourceIP, userAgent string) error {
+	const q = `
+		INSERT INTO webhooks.shared_secret_uses (source_ip, user_agent)
+		VALUES ($1, $2)
+		ON CONFLICT (source_ip, user_agent) DO UPDATE SET
+			uses = webhooks.shared_secret_uses.uses + 1,
+			last_seen_at = now()`
+
+	if _, err := dbPool.ExecContext(ctx, q, sourceIP, truncateUserAgent(userAgent)); err != nil {
+		return fmt.Errorf("record shared secret use: %w", err)
+	}
+	return nil
+}
+
+// ListSharedSecretUses returns the callers recorded since the last
+// ClearSharedSecretUses, most recently seen first.
+func ListSharedSecretUses(ctx context.Context) ([]models.SharedSecretUse, error) {
+	const q = `
+		SELECT source_ip, user_agent, uses, first_seen_at, last_seen_at
+		FROM webhooks.shared_secret_uses
+		ORDER BY last_seen_at DESC, source_ip, user_agent`
+
+	rows, err := dbPool.QueryContext(ctx, q)
+	if err != nil {
+		return nil, fmt.Errorf("list shared secret uses: %w", err)
+	}
+	defer rows.Close()
+
+	res := []models.SharedSecretUse{}
+	for rows.Next() {
+		var u models.SharedSecretUse
+		if err := rows.Scan(&u.SourceIP, &u.UserAgent, &u.Uses, &u.FirstSeenAt, &u.LastSeenAt); err != nil {
+			return nil, fmt.Errorf("scan shared secret use: %w", err)
+		}
+		res = append(res, u)
+	}
+	return res, rows.Err()
+}
+
+// ClearSharedSecretUses forgets every recorded use, when the shared secret
+// is rotated again.
+func ClearSharedSecretUses(ctx context.Context) error {
+	if _, err := dbPool.ExecContext(ctx, `DELETE FROM webhooks.shared_secret_uses`); err != nil {
+		return fmt.Errorf("clear shared secret uses: %w", err)
+	}
+	return nil
+}
+
+func truncateUserAgent(ua string) string {
+	if len(ua) > maxUserAgentLength {
+		return strings.ToValidUTF8(ua[:maxUserAgentLength], "")
+	}
+	return ua
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordSharedSecretUse(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectExec(regexp.QuoteMeta("ON CONFLICT (source_ip, user_agent) DO UPDATE SET")).
+		WithArgs("203.0.113.10", "lims/2.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhooks.shared_secret_uses")).
+		WithArgs("203.0.113.10", strings.Repeat("x", maxUserAgentLength)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, RecordSharedSecretUse(context.Background(), "203.0.113.10", "lims/2.1"))
+	require.NoError(t, RecordSharedSecretUse(context.Background(), "203.0.113.10", strings.Repeat("x", 1000)))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAndClearSharedSecretUses(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhooks.shared_secret_uses")).
+		WillReturnRows(sqlmock.NewRows([]string{"source_ip", "user_agent", "uses", "first_seen_at", "last_seen_at"}).
+			AddRow("203.0.113.10", "lims/2.1", int64(4), now.Add(-time.Hour), now))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhooks.shared_secret_uses")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	uses, err := ListSharedSecretUses(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []models.SharedSecretUse{{
+		SourceIP: "203.0.113.10", UserAgent: "lims/2.1", Uses: 4, FirstSeenAt: now.Add(-time.Hour), LastSeenAt: now,
+	}}, uses)
+	require.NoError(t, ClearSharedSecretUses(context.Background()))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,322 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+// Store is embedded in every store interface. Ready connects on first use
+// and reports whether the backing database is usable; handlers call it
+// before any other method so an outage is reported as such rather than as
+// the failure of whichever query happened to run first.
+type Store interface {
+	Ready(ctx context.Context) error
+}
+
+// WebhookStore persists messages received by the inbound webhook receiver.
+type WebhookStore interface {
+	Store
+	InsertWebhookMessage(ctx context.Context, msg models.IncomingWebhook) (models.IncomingWebhook, error)
+}
+
+// SenderStore holds the named senders allowed to call the receiver.
+type SenderStore interface {
+	Store
+	GetSenderBySecretHash(ctx context.Context, secretHash string) (s models.Sender, previous bool, err error)
+	GetSenderByName(ctx context.Context, name string) (models.Sender, error)
+	CreateSender(ctx context.Context, name, secretHash string, scopes []string) (models.Sender, error)
+	ListSenders(ctx context.Context) ([]models.Sender, error)
+	SetSenderStatus(ctx context.Context, name, status string) (models.Sender, error)
+	SetSenderSignatureScheme(ctx context.Context, name string, scheme []byte) (models.Sender, error)
+	SetSenderChallenge(ctx context.Context, name string, responder []byte) (models.Sender, error)
+	RotateSenderSecret(ctx context.Context, name, secretHash string, previousExpiresAt time.Time) (models.Sender, error)
+	MarkPreviousSecretUsed(ctx context.Context, senderID int64) error
+	RecordSharedSecretUse(ctx context.Context, sourceIP, userAgent string) error
+	ListSharedSecretUses(ctx context.Context) ([]models.SharedSecretUse, error)
+	ClearSharedSecretUses(ctx context.Context) error
+}
+
+// ChannelStore holds the receiver's routed channels.
+type ChannelStore interface {
+	Store
+	GetChannelByName(ctx context.Context, name string) (models.Channel, error)
+	ListChannels(ctx context.Context) ([]models.Channel, error)
+	PutChannel(ctx context.Context, c models.Channel) (models.Channel, error)
+	SetChannelStatus(ctx context.Context, name, status string) (models.Channel, error)
+}
+
+// IdempotencyStore remembers the Idempotency-Key values senders used.
+type IdempotencyStore interface {
+	Store
+	ReserveIdempotencyKey(ctx context.Context, senderID int64, key, bodyHash string, expiresAt time.Time) (rec models.IdempotencyRecord, reserved bool, err error)
+	CompleteIdempotencyKey(ctx context.Context, senderID int64, key, requestID string, statusCode int, receivedAt time.Time) error
+	ReleaseIdempotencyKey(ctx context.Context, senderID int64, key string) error
+}
+
+// ReceiverStore is everything the webhook receiver stores.
+type ReceiverStore interface {
+	WebhookStore
+	RateLimitStore
+	SenderStore
+	ChannelStore
+	ReplayStore
+	IdempotencyStore
+}
+
+// ReplayStore remembers the nonces of signed requests.
+type ReplayStore interface {
+	Store
+	RecordNonce(ctx context.Context, senderID int64, nonce string, expiresAt time.Time) (fresh bool, err error)
+	ReleaseNonce(ctx context.Context, senderID int64, nonce string) error
+}
+
+// MessageStore backs the message API, which reads what the receiver
+// stored. ListSenders and ListChannels resolve sender and channel names.
+type MessageStore interface {
+	Store
+	ListWebhookMessages(ctx context.Context, f models.MessageFilter) ([]models.IncomingWebhook, error)
+	GetWebhookMessage(ctx context.Context, requestID string) (models.IncomingWebhook, error)
+	ListSenders(ctx context.Context) ([]models.Sender, error)
+	ListChannels(ctx context.Context) ([]models.Channel, error)
+}
+
+// ProcessingStore backs the worker that processes stored messages.
+// ListSenders and ListChannels resolve sender and channel names for
+// routing.
+type ProcessingStore interface {
+	Store
+	ClaimWebhookMessages(ctx context.Context, limit int, lease time.Duration, maxAttempts int) ([]models.IncomingWebhook, error)
+	FailAbandonedWebhookMessages(ctx context.Context, maxAttempts int) (int64, error)
+	MarkWebhookMessageProcessed(ctx context.Context, id int64, attempt int) error
+	MarkWebhookMessageFailed(ctx context.Context, id int64, attempt int, errMsg string, retryAt *time.Time) error
+	ListSenders(ctx context.Context) ([]models.Sender, error)
+	ListChannels(ctx context.Context) ([]models.Channel, error)
+}
+
+// RateLimitStore holds the receiver's token buckets.
+type RateLimitStore interface {
+	Store
+	TakeRateLimitToken(ctx context.Context, key string, capacity int, refillPerSecond float64) (tokens float64, allowed bool, err error)
+}
+
+// NotificationStore backs the subscription and notification API.
+type NotificationStore interface {
+	Store
+	GetTopics(ctx context.Context) ([]models.Topic, error)
+	GetUserSubscriptions(ctx context.Context, userID int64) ([]models.Subscription, error)
+	CreateSubscription(ctx context.Context, userID, topicID int64, subscriptionContext []byte) (models.Subscription, bool, error)
+	DeleteSubscription(ctx context.Context, subscriptionID, userID int64) (bool, error)
+	TopicExists(ctx context.Context, topicID int64) (bool, error)
+	GetTopicNotifications(ctx context.Context, topicID, userID int64, limit, offset int) ([]models.Notification, error)
+}
+
+// RuleStore backs the rules that turn stored messages into notifications.
+type RuleStore interface {
+	Store
+	CreateNotifications(ctx context.Context, drafts []models.NotificationDraft) (int64, error)
+}
+
+// RetentionStore deletes expired rows for the retention job, one bounded
+// batch per call.
+type RetentionStore interface {
+	Store
+	ExpiredWebhookMessages(ctx context.Context, before time.Time, limit int) ([]models.IncomingWebhook, error)
+	DeleteWebhookMessages(ctx context.Context, ids []int64) (int64, error)
+	DeleteExpiredWebhookMessages(ctx context.Context, before time.Time, limit int) (int64, error)
+	DeleteIdleRateLimitBuckets(ctx context.Context, before time.Time, limit int) (int64, error)
+	DeleteExpiredNonces(ctx context.Context, before time.Time, limit int) (int64, error)
+	DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+// Postgres implements every store over the package's shared connection
+// pool, initialized by EnsureDB. Its methods are thin wrappers around the
+// package-level query functions, which remain the place the SQL lives.
+type Postgres struct{}
+
+var (
+	_ WebhookStore      = Postgres{}
+	_ RateLimitStore    = Postgres{}
+	_ SenderStore       = Postgres{}
+	_ ChannelStore      = Postgres{}
+	_ ReplayStore       = Postgres{}
+	_ ReceiverStore     = Postgres{}
+	_ MessageStore      = Postgres{}
+	_ ProcessingStore   = Postgres{}
+	_ NotificationStore = Postgres{}
+	_ RuleStore         = Postgres{}
+	_ RetentionStore    = Postgres{}
+)
+
+func (Postgres) Ready(ctx context.Context) error {
+	return EnsureDB(ctx)
+}
+
+func (Postgres) InsertWebhookMessage(ctx context.Context, msg models.IncomingWebhook) (models.IncomingWebhook, error) {
+	return InsertWebhookMessage(ctx, msg)
+}
+
+func (Postgres) ListWebhookMessages(ctx context.Context, f models.MessageFilter) ([]models.IncomingWebhook, error) {
+	return ListWebhookMessages(ctx, f)
+}
+
+func (Postgres) GetWebhookMessage(ctx context.Context, requestID string) (models.IncomingWebhook, error) {
+	return GetWebhookMessage(ctx, requestID)
+}
+
+func (Postgres) ClaimWebhookMessages(ctx context.Context, limit int, lease time.Duration, maxAttempts int) ([]models.IncomingWebhook, error) {
+	return ClaimWebhookMessages(ctx, limit, lease, maxAttempts)
+}
+
+func (Postgres) FailAbandonedWebhookMessages(ctx context.Context, maxAttempts int) (int64, error) {
+	return FailAbandonedWebhookMessages(ctx, maxAttempts)
+}
+
+func (Postgres) MarkWebhookMessageProcessed(ctx context.Context, id int64, attempt int) error {
+	return MarkWebhookMessageProcessed(ctx, id, attempt)
+}
+
+func (Postgres) MarkWebhookMessageFailed(ctx context.Context, id int64, attempt int, errMsg string, retryAt *time.Time) error {
+	return MarkWebhookMessageFailed(ctx, id, attempt, errMsg, retryAt)
+}
+
+func (Postgres) GetSenderBySecretHash(ctx context.Context, secretHash string) (models.Sender, bool, error) {
+	return GetSenderBySecretHash(ctx, secretHash)
+}
+
+func (Postgres) GetSenderByName(ctx context.Context, name string) (models.Sender, error) {
+	return GetSenderByName(ctx, name)
+}
+
+func (Postgres) SetSenderSignatureScheme(ctx context.Context, name string, scheme []byte) (models.Sender, error) {
+	return SetSenderSignatureScheme(ctx, name, scheme)
+}
+
+func (Postgres) SetSenderChallenge(ctx context.Context, name string, responder []byte) (models.Sender, error) {
+	return SetSenderChallenge(ctx, name, responder)
+}
+
+func (Postgres) GetChannelByName(ctx context.Context, name string) (models.Channel, error) {
+	return GetChannelByName(ctx, name)
+}
+
+func (Postgres) ListChannels(ctx context.Context) ([]models.Channel, error) {
+	return ListChannels(ctx)
+}
+
+func (Postgres) PutChannel(ctx context.Context, c models.Channel) (models.Channel, error) {
+	return PutChannel(ctx, c)
+}
+
+func (Postgres) SetChannelStatus(ctx context.Context, name, status string) (models.Channel, error) {
+	return SetChannelStatus(ctx, name, status)
+}
+
+func (Postgres) RotateSenderSecret(ctx context.Context, name, secretHash string, previousExpiresAt time.Time) (models.Sender, error) {
+	return RotateSenderSecret(ctx, name, secretHash, previousExpiresAt)
+}
+
+func (Postgres) MarkPreviousSecretUsed(ctx context.Context, senderID int64) error {
+	return MarkPreviousSecretUsed(ctx, senderID)
+}
+
+func (Postgres) RecordSharedSecretUse(ctx context.Context, sourceIP, userAgent string) error {
+	return RecordSharedSecretUse(ctx, sourceIP, userAgent)
+}
+
+func (Postgres) ListSharedSecretUses(ctx context.Context) ([]models.SharedSecretUse, error) {
+	return ListSharedSecretUses(ctx)
+}
+
+func (Postgres) ClearSharedSecretUses(ctx context.Context) error {
+	return ClearSharedSecretUses(ctx)
+}
+
+func (Postgres) RecordNonce(ctx context.Context, senderID int64, nonce string, expiresAt time.Time) (bool, error) {
+	return RecordNonce(ctx, senderID, nonce, expiresAt)
+}
+
+func (Postgres) ReleaseNonce(ctx context.Context, senderID int64, nonce string) error {
+	return ReleaseNonce(ctx, senderID, nonce)
+}
+
+func (Postgres) CreateSender(ctx context.Context, name, secretHash string, scopes []string) (models.Sender, error) {
+	return CreateSender(ctx, name, secretHash, scopes)
+}
+
+func (Postgres) ListSenders(ctx context.Context) ([]models.Sender, error) {
+	return ListSenders(ctx)
+}
+
+func (Postgres) SetSenderStatus(ctx context.Context, name, status string) (models.Sender, error) {
+	return SetSenderStatus(ctx, name, status)
+}
+
+func (Postgres) TakeRateLimitToken(ctx context.Context, key string, capacity int, refillPerSecond float64) (float64, bool, error) {
+	return TakeRateLimitToken(ctx, key, capacity, refillPerSecond)
+}
+
+func (Postgres) GetTopics(ctx context.Context) ([]models.Topic, error) {
+	return GetTopics(ctx)
+}
+
+func (Postgres) GetUserSubscriptions(ctx context.Context, userID int64) ([]models.Subscription, error) {
+	return GetUserSubscriptions(ctx, userID)
+}
+
+func (Postgres) CreateSubscription(ctx context.Context, userID, topicID int64, subscriptionContext []byte) (models.Subscription, bool, error) {
+	return CreateSubscription(ctx, userID, topicID, subscriptionContext)
+}
+
+func (Postgres) DeleteSubscription(ctx context.Context, subscriptionID, userID int64) (bool, error) {
+	return DeleteSubscription(ctx, subscriptionID, userID)
+}
+
+func (Postgres) TopicExists(ctx context.Context, topicID int64) (bool, error) {
+	return TopicExists(ctx, topicID)
+}
+
+func (Postgres) GetTopicNotifications(ctx context.Context, topicID, userID int64, limit, offset int) ([]models.Notification, error) {
+	return GetTopicNotifications(ctx, topicID, userID, limit, offset)
+}
+
+func (Postgres) CreateNotifications(ctx context.Context, drafts []models.NotificationDraft) (int64, error) {
+	return CreateNotifications(ctx, drafts)
+}
+
+func (Postgres) ExpiredWebhookMessages(ctx context.Context, before time.Time, limit int) ([]models.IncomingWebhook, error) {
+	return ExpiredWebhookMessages(ctx, before, limit)
+}
+
+func (Postgres) DeleteWebhookMessages(ctx context.Context, ids []int64) (int64, error) {
+	return DeleteWebhookMessages(ctx, ids)
+}
+
+func (Postgres) DeleteExpiredWebhookMessages(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return DeleteExpiredWebhookMessages(ctx, before, limit)
+}
+
+func (Postgres) DeleteIdleRateLimitBuckets(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return DeleteIdleRateLimitBuckets(ctx, before, limit)
+}
+
+func (Postgres) DeleteExpiredNonces(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return DeleteExpiredNonces(ctx, before, limit)
+}
+
+func (Postgres) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time, limit int) (int64, error) {
+	return DeleteExpiredIdempotencyKeys(ctx, before, limit)
+}
+
+func (Postgres) ReserveIdempotencyKey(ctx context.Context, senderID int64, key, bodyHash string, expiresAt time.Time) (models.IdempotencyRecord, bool, error) {
+	return ReserveIdempotencyKey(ctx, senderID, key, bodyHash, expiresAt)
+}
+
+func (Postgres) CompleteIdempotencyKey(ctx context.Context, senderID int64, key, requestID string, statusCode int, receivedAt time.Time) error {
+	return CompleteIdempotencyKey(ctx, senderID, key, requestID, statusCode, receivedAt)
+}
+
+func (Postgres) ReleaseIdempotencyKey(ctx context.Context, senderID int64, key string) error {
+	return ReleaseIdempotencyKey(ctx, senderID, key)
+}
@@ -2,59 +2,213 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"time"
+	"strings"
 
 	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/lib/pq"
 )
 
-// InsertWebhookMessage persists an incoming webhook payload into
-// webhooks.messages and returns the assigned serial id.
-func InsertWebhookMessage(ctx context.Context, requestID string, payload []byte) (models.IncomingWebhook, error) {
-	const q = `
-		INSERT INTO webhooks.messages (request_id, payload)
-		VALUES ($1, $2)
-		RETURNING id, request_id, payload, received_at`
-
-	var rec models.IncomingWebhook
-	err := dbPool.QueryRowContext(ctx, q, requestID, payload).Scan(
-		&rec.ID,
-		&rec.RequestID,
-		&rec.Payload,
-		&rec.ReceivedAt,
+// ErrMessageNotFound is returned when no stored message has the request id.
+var ErrMessageNotFound = errors.New("message not found")
+
+// messageColumns are the webhooks.messages columns scanMessage reads.
+const messageColumns = `id, request_id, sender_id, payload, received_at, ` + messageDetailColumns + `, raw_body, channel_id`
+
+// messageSummaryColumns read like messageColumns without the payload and
+// raw body.
+const messageSummaryColumns = `id, request_id, sender_id, NULL::jsonb, received_at, ` + messageDetailColumns + `, NULL::bytea, channel_id`
+
+// messageDetailColumns are the request metadata and processing columns.
+const messageDetailColumns = `method, headers, source_ip, user_agent, content_type, query_string,
+	status, attempts, last_error, next_attempt_at, processed_at`
+
+// messageScanner abstracts over *sql.Row and *sql.Rows like
+// senderScanner.
+type messageScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage scans a row selected with messageColumns.
+func scanMessage(row messageScanner) (models.IncomingWebhook, error) {
+	var (
+		rec                                       models.IncomingWebhook
+		senderID, channelID                       sql.NullInt64
+		headers                                   []byte
+		method, sourceIP, userAgent, ctype, query sql.NullString
+		lastError                                 sql.NullString
+		nextAttempt, processed                    sql.NullTime
 	)
+	err := row.Scan(&rec.ID, &rec.RequestID, &senderID, &rec.Payload, &rec.ReceivedAt,
+		&method, &headers, &sourceIP, &userAgent, &ctype, &query,
+		&rec.Processing.Status, &rec.Processing.Attempts, &lastError, &nextAttempt, &processed, &rec.RawBody, &channelID)
+	if err != nil {
+		return models.IncomingWebhook{}, err
+	}
+	rec.SenderID = senderID.Int64
+	rec.ChannelID = channelID.Int64
+	rec.Processing.LastError = lastError.String
+	rec.Processing.NextAttemptAt = timePtr(nextAttempt)
+	rec.Processing.ProcessedAt = timePtr(processed)
+	rec.Request = models.RequestMetadata{
+		Method:      method.String,
+		SourceIP:    sourceIP.String,
+		UserAgent:   userAgent.String,
+		ContentType: ctype.String,
+		QueryString: query.String,
+	}
+	if headers != nil {
+		if err := json.Unmarshal(headers, &rec.Request.Headers); err != nil {
+			return models.IncomingWebhook{}, fmt.Errorf("message %d headers: %w", rec.ID, err)
+		}
+	}
+	return rec, nil
+}
+
+// InsertWebhookMessage persists msg's payload, raw body and request metadata into
+// webhooks.messages, attributed to msg.SenderID and msg.ChannelID (0 for
+// none), and returns the stored record with its assigned serial id.
+func InsertWebhookMessage(ctx context.Context, msg models.IncomingWebhook) (models.IncomingWebhook, error) {
+	q := `
+		INSERT INTO webhooks.messages (request_id, sender_id, payload,
+			method, headers, source_ip, user_agent, content_type, query_string, raw_body, channel_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING ` + messageColumns
+
+	var headers []byte
+	if msg.Request.Headers != nil {
+		b, err := json.Marshal(msg.Request.Headers)
+		if err != nil {
+			return models.IncomingWebhook{}, fmt.Errorf("insert webhook message: %w", err)
+		}
+		headers = b
+	}
+	meta := msg.Request
+	rec, err := scanMessage(dbPool.QueryRowContext(ctx, q, msg.RequestID, nullableID(msg.SenderID), msg.Payload,
+		nullableString(meta.Method), headers, nullableString(meta.SourceIP), nullableString(meta.UserAgent),
+		nullableString(meta.ContentType), nullableString(meta.QueryString), msg.RawBody, nullableID(msg.ChannelID)))
 	if err != nil {
 		return models.IncomingWebhook{}, fmt.Errorf("insert webhook message: %w", err)
 	}
 	return rec, nil
 }
 
-// RecordSenderRequest increments the fixed-window request counter for
-// senderIP and returns the count after recording this request. The window
-// resets (count goes back to 1) once it's older than window. The upsert is
-// a single atomic statement so concurrent Lambda invocations for the same
-// sender can't race past each other and both see a stale count.
-func RecordSenderRequest(ctx context.Context, senderIP string, window time.Duration) (int, error) {
+// GetWebhookMessage returns the message stored for requestID, or
+// ErrMessageNotFound.
+func GetWebhookMessage(ctx context.Context, requestID string) (models.IncomingWebhook, error) {
+	q := `SELECT ` + messageColumns + ` FROM webhooks.messages WHERE request_id = $1`
+
+	rec, err := scanMessage(dbPool.QueryRowContext(ctx, q, requestID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.IncomingWebhook{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return models.IncomingWebhook{}, fmt.Errorf("get webhook message: %w", err)
+	}
+	return rec, nil
+}
+
+// ListWebhookMessages returns the messages f selects, newest first and
+// without their payloads.
+func ListWebhookMessages(ctx context.Context, f models.MessageFilter) ([]models.IncomingWebhook, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	cond := func(format string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, v := range values {
+			args = append(args, v)
+			placeholders[i] = len(args)
+		}
+		where = append(where, fmt.Sprintf(format, placeholders...))
+	}
+	if !f.Since.IsZero() {
+		cond("received_at >= $%d", f.Since)
+	}
+	if !f.Until.IsZero() {
+		cond("received_at < $%d", f.Until)
+	}
+	if f.SenderID != 0 {
+		cond("sender_id = $%d", f.SenderID)
+	}
+	if f.ChannelID != 0 {
+		cond("channel_id = $%d", f.ChannelID)
+	}
+	if f.Method != "" {
+		cond("method = $%d", f.Method)
+	}
+	if f.Status != "" {
+		cond("status = $%d", f.Status)
+	}
+	for _, p := range f.Payload {
+		cond("payload #>> $%d = $%d", pq.Array(p.Path), p.Value)
+	}
+	if f.BeforeID != 0 {
+		cond("id < $%d", f.BeforeID)
+	}
+
+	q := `SELECT ` + messageSummaryColumns + ` FROM webhooks.messages`
+	if len(where) > 0 {
+		q += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	args = append(args, f.Limit)
+	q += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	rows, err := dbPool.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook messages: %w", err)
+	}
+	defer rows.Close()
+
+	res := []models.IncomingWebhook{}
+	for rows.Next() {
+		rec, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook message: %w", err)
+		}
+		res = append(res, rec)
+	}
+	return res, rows.Err()
+}
+
+// nullableString maps the empty string to NULL.
+func nullableString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullableID maps the zero id to NULL.
+func nullableID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// TakeRateLimitToken draws one token from the bucket for key, creating a
+// full bucket of capacity tokens on first use, and reports the tokens left
+// and whether a token was available. The bucket refills continuously at
+// refillPerSecond, computed from updated_at at draw time, so nothing has
+// to run between requests. It is a single atomic upsert so concurrent
+// Lambda invocations for the same key can't both spend the last token.
+func TakeRateLimitToken(ctx context.Context, key string, capacity int, refillPerSecond float64) (float64, bool, error) {
 	const q = `
-		INSERT INTO webhooks.sender_rate_limits (sender_ip, window_start, request_count)
-		VALUES ($1, now(), 1)
-		ON CONFLICT (sender_ip) DO UPDATE SET
-			window_start = CASE
-				WHEN webhooks.sender_rate_limits.window_start <= now() - ($2 * interval '1 second')
-				THEN now()
-				ELSE webhooks.sender_rate_limits.window_start
-			END,
-			request_count = CASE
-				WHEN webhooks.sender_rate_limits.window_start <= now() - ($2 * interval '1 second')
-				THEN 1
-				ELSE webhooks.sender_rate_limits.request_count + 1
-			END
-		RETURNING request_count`
-
-	var count int
-	err := dbPool.QueryRowContext(ctx, q, senderIP, window.Seconds()).Scan(&count)
+		INSERT INTO webhooks.rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+		VALUES ($1, $2 - 1, true, now())
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = LEAST($2, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3)
+				- CASE WHEN LEAST($2, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3) >= 1 THEN 1 ELSE 0 END,
+			allowed = LEAST($2, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3) >= 1,
+			updated_at = now()
+		RETURNING tokens, allowed`
+
+	var (
+		tokens  float64
+		allowed bool
+	)
+	err := dbPool.QueryRowContext(ctx, q, key, capacity, refillPerSecond).Scan(&tokens, &allowed)
 	if err != nil {
-		return 0, fmt.Errorf("record sender request: %w", err)
+		return 0, false, fmt.Errorf("take rate limit token: %w", err)
 	}
-	return count, nil
+	return tokens, allowed, nil
 }
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var messageRowColumns = []string{"id", "request_id", "sender_id", "payload", "received_at",
+	"method", "headers", "source_ip", "user_agent", "content_type", "query_string",
+	"status", "attempts", "last_error", "next_attempt_at", "processed_at", "raw_body", "channel_id"}
+
+func TestInsertWebhookMessage(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.messages")).
+		WithArgs("req-1", sql.NullInt64{Int64: 7, Valid: true}, []byte(`{"a":1}`),
+			sql.NullString{String: "PATCH", Valid: true}, []byte(`{"user-agent":"curl/8"}`),
+			sql.NullString{String: "203.0.113.7", Valid: true}, sql.NullString{String: "curl/8", Valid: true},
+			sql.NullString{}, sql.NullString{String: "sender=acme", Valid: true}, []byte(nil),
+			sql.NullInt64{Int64: 2, Valid: true}).
+		WillReturnRows(sqlmock.NewRows(messageRowColumns).
+			AddRow(int64(1), "req-1", int64(7), []byte(`{"a":1}`), now,
+				"PATCH", []byte(`{"user-agent":"curl/8"}`), "203.0.113.7", "curl/8", nil, "sender=acme",
+				"received", 0, nil, now, nil, nil, int64(2)))
+
+	rec, err := InsertWebhookMessage(context.Background(), models.IncomingWebhook{
+		RequestID: "req-1",
+		SenderID:  7,
+		ChannelID: 2,
+		Payload:   []byte(`{"a":1}`),
+		Request: models.RequestMetadata{
+			Method:      "PATCH",
+			Headers:     map[string]string{"user-agent": "curl/8"},
+			SourceIP:    "203.0.113.7",
+			UserAgent:   "curl/8",
+			QueryString: "sender=acme",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), rec.ID)
+	assert.Equal(t, int64(7), rec.SenderID)
+	assert.Equal(t, int64(2), rec.ChannelID)
+	assert.Equal(t, "PATCH", rec.Request.Method)
+	assert.Equal(t, map[string]string{"user-agent": "curl/8"}, rec.Request.Headers)
+	assert.Empty(t, rec.Request.ContentType)
+	assert.Equal(t, models.MessageReceived, rec.Processing.Status)
+	require.NotNil(t, rec.Processing.NextAttemptAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetWebhookMessage(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhooks.messages WHERE request_id = $1")).
+		WithArgs("req-1").
+		WillReturnRows(sqlmock.NewRows(messageRowColumns).
+			AddRow(int64(1), "req-1", nil, []byte(`{"a":1}`), time.Now(), nil, nil, nil, nil, nil, nil,
+				"processed", 1, nil, nil, time.Now(), []byte("a=1"), int64(4)))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhooks.messages WHERE request_id = $1")).
+		WithArgs("req-2").
+		WillReturnRows(sqlmock.NewRows(messageRowColumns))
+
+	rec, err := GetWebhookMessage(context.Background(), "req-1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":1}`, string(rec.Payload))
+	assert.Equal(t, []byte("a=1"), rec.RawBody)
+	assert.Equal(t, int64(4), rec.ChannelID)
+
+	_, err = GetWebhookMessage(context.Background(), "req-2")
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListWebhookMessages_Filters(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	since := time.Now().Add(-time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT `+messageSummaryColumns+
+		` FROM webhooks.messages WHERE received_at >= $1 AND sender_id = $2 AND channel_id = $3 AND method = $4`+
+		` AND status = $5 AND payload #>> $6 = $7 AND id < $8 ORDER BY id DESC LIMIT $9`)).
+		WithArgs(since, int64(7), int64(3), "PUT", "failed", pq.Array([]string{"repo", "name"}), "r1", int64(100), 2).
+		WillReturnRows(sqlmock.NewRows(messageRowColumns).
+			AddRow(int64(99), "req-99", int64(7), nil, since, "PUT", nil, nil, nil, nil, nil,
+				"failed", 2, "boom", nil, nil, nil, int64(3)))
+
+	recs, err := ListWebhookMessages(context.Background(), models.MessageFilter{
+		Since:     since,
+		SenderID:  7,
+		ChannelID: 3,
+		Method:    "PUT",
+		Status:    models.MessageFailed,
+		Payload:   []models.PayloadPredicate{{Path: []string{"repo", "name"}, Value: "r1"}},
+		BeforeID:  100,
+		Limit:     2,
+	})
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, int64(99), recs[0].ID)
+	assert.Nil(t, recs[0].Payload)
+	assert.Equal(t, models.ProcessingState{Status: models.MessageFailed, Attempts: 2, LastError: "boom"}, recs[0].Processing)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListWebhookMessages_Unfiltered(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	SetPoolForTest(mockDB)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM webhooks.messages ORDER BY id DESC LIMIT $1`)).
+		WithArgs(50).
+		WillReturnRows(sqlmock.NewRows(messageRowColumns))
+
+	recs, err := ListWebhookMessages(context.Background(), models.MessageFilter{Limit: 50})
+	require.NoError(t, err)
+	assert.Empty(t, recs)
+	assert.NotNil(t, recs)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
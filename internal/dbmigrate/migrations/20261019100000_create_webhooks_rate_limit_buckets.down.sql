@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS webhooks.rate_limit_buckets;
+
+CREATE TABLE IF NOT EXISTS webhooks.sender_rate_limits (
+    sender_ip     TEXT        PRIMARY KEY,
+    window_start  TIMESTAMPTZ NOT NULL,
+    request_count INTEGER     NOT NULL
+);
@@ -0,0 +1,12 @@
+-- Token buckets replace the fixed-window counters in sender_rate_limits.
+-- Keys are prefixed with what they identify, e.g. "ip:203.0.113.7".
+CREATE TABLE IF NOT EXISTS webhooks.rate_limit_buckets (
+    key        TEXT             PRIMARY KEY,
+    tokens     DOUBLE PRECISION NOT NULL,
+    allowed    BOOLEAN          NOT NULL,
+    updated_at TIMESTAMPTZ      NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_rate_limit_buckets_updated_at ON webhooks.rate_limit_buckets (updated_at);
+
+DROP TABLE IF EXISTS webhooks.sender_rate_limits;
@@ -0,0 +1,18 @@
+-- Named senders of inbound webhooks. Only a SHA-256 hash of each secret is
+-- stored; secrets are random 256-bit tokens, so a fast hash is enough and
+-- lets the receiver look a sender up by the hash of what it presents.
+CREATE TABLE IF NOT EXISTS webhooks.senders (
+    sender_id   SERIAL      PRIMARY KEY,
+    name        TEXT        NOT NULL UNIQUE,
+    secret_hash TEXT        NOT NULL UNIQUE,
+    status      TEXT        NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'disabled')),
+    scopes      TEXT[]      NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- NULL for messages received before senders existed or through the legacy
+-- shared secret.
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS sender_id INTEGER REFERENCES webhooks.senders (sender_id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_messages_sender_id ON webhooks.messages (sender_id);
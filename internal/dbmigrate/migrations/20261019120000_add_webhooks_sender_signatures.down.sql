@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS webhooks.nonces;
+ALTER TABLE webhooks.senders DROP COLUMN IF EXISTS signature_scheme;
@@ -0,0 +1,14 @@
+-- How a sender signs requests (see internal/signature), NULL for senders
+-- that only present their secret.
+ALTER TABLE webhooks.senders ADD COLUMN IF NOT EXISTS signature_scheme JSONB;
+
+-- Nonces of accepted signed requests, kept until a replay would fail the
+-- timestamp check anyway.
+CREATE TABLE IF NOT EXISTS webhooks.nonces (
+    sender_id  INTEGER     NOT NULL REFERENCES webhooks.senders (sender_id) ON DELETE CASCADE,
+    nonce      TEXT        NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (sender_id, nonce)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_nonces_expires_at ON webhooks.nonces (expires_at);
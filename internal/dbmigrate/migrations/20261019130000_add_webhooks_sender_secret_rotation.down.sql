@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS webhooks.idx_webhooks_senders_previous_secret_hash;
+ALTER TABLE webhooks.senders DROP COLUMN IF EXISTS secret_rotated_at;
+ALTER TABLE webhooks.senders DROP COLUMN IF EXISTS previous_secret_used_at;
+ALTER TABLE webhooks.senders DROP COLUMN IF EXISTS previous_secret_expires_at;
+ALTER TABLE webhooks.senders DROP COLUMN IF EXISTS previous_secret_hash;
@@ -0,0 +1,10 @@
+-- During a secret rotation the replaced secret keeps working until
+-- previous_secret_expires_at. previous_secret_used_at records its last use
+-- so operators can see who hasn't switched yet.
+ALTER TABLE webhooks.senders ADD COLUMN IF NOT EXISTS previous_secret_hash TEXT;
+ALTER TABLE webhooks.senders ADD COLUMN IF NOT EXISTS previous_secret_expires_at TIMESTAMPTZ;
+ALTER TABLE webhooks.senders ADD COLUMN IF NOT EXISTS previous_secret_used_at TIMESTAMPTZ;
+ALTER TABLE webhooks.senders ADD COLUMN IF NOT EXISTS secret_rotated_at TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhooks_senders_previous_secret_hash
+    ON webhooks.senders (previous_secret_hash);
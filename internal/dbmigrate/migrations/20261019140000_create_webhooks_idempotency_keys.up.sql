@@ -0,0 +1,16 @@
+-- Idempotency-Key values seen by the receiver, per sender, with the
+-- response of the request that first used them. sender_id is 0 for the
+-- legacy shared secret, so it has no foreign key. request_id, status_code
+-- and received_at are NULL while that request is still being stored.
+CREATE TABLE IF NOT EXISTS webhooks.idempotency_keys (
+    sender_id   INTEGER     NOT NULL,
+    key         TEXT        NOT NULL,
+    body_hash   TEXT        NOT NULL,
+    request_id  TEXT,
+    status_code INTEGER,
+    received_at TIMESTAMPTZ,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (sender_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_idempotency_keys_expires_at ON webhooks.idempotency_keys (expires_at);
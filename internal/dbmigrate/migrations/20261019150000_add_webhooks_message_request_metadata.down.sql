@@ -0,0 +1,6 @@
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS query_string;
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS content_type;
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS user_agent;
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS source_ip;
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS headers;
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS method;
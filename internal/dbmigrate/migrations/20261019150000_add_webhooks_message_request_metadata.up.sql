@@ -0,0 +1,9 @@
+-- The HTTP request a message arrived in, for auditing and replay. NULL on
+-- messages stored before these columns existed. Credential-bearing headers
+-- are redacted by the receiver before they reach headers.
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS method TEXT;
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS headers JSONB;
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS source_ip TEXT;
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS user_agent TEXT;
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS content_type TEXT;
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS query_string TEXT;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS webhooks.idx_webhooks_messages_next_attempt_at;
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS processed_at;
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS next_attempt_at;
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS last_error;
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS attempts;
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS status;
@@ -0,0 +1,18 @@
+-- Processing lifecycle: received -> processing -> processed or failed. A
+-- message is due for the worker while next_attempt_at is set and has
+-- passed; while processing it holds the claim's expiry, so a message whose
+-- worker died is claimed again. It is cleared once the message is
+-- processed or out of attempts.
+--
+-- Messages stored before processing existed are marked processed, so the
+-- worker doesn't start by working through the whole table.
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'processed';
+ALTER TABLE webhooks.messages ALTER COLUMN status SET DEFAULT 'received';
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS last_error TEXT;
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ;
+ALTER TABLE webhooks.messages ALTER COLUMN next_attempt_at SET DEFAULT now();
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS processed_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_messages_next_attempt_at
+    ON webhooks.messages (next_attempt_at) WHERE next_attempt_at IS NOT NULL;
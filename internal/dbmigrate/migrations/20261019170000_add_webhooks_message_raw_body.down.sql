@@ -0,0 +1 @@
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS raw_body;
@@ -0,0 +1,4 @@
+-- The body a payload was converted from, for messages posted as form data,
+-- XML or plain text (decompressed if it was gzipped). NULL for JSON bodies,
+-- which payload holds as they arrived.
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS raw_body BYTEA;
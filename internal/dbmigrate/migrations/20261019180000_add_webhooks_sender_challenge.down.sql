@@ -0,0 +1 @@
+ALTER TABLE webhooks.senders DROP COLUMN IF EXISTS challenge;
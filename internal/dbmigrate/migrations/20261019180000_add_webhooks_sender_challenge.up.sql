@@ -0,0 +1,3 @@
+-- The JSON challenge.Responder answering the handshake a sender's provider
+-- verifies the endpoint with, if any.
+ALTER TABLE webhooks.senders ADD COLUMN IF NOT EXISTS challenge JSONB;
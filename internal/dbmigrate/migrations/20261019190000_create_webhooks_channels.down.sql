@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS webhooks.idx_webhooks_messages_channel_id;
+ALTER TABLE webhooks.messages DROP COLUMN IF EXISTS channel_id;
+DROP TABLE IF EXISTS webhooks.channels;
@@ -0,0 +1,20 @@
+-- Routed channels of the webhook receiver, reached at /webhook/{name}, each
+-- with its own credentials, methods, size limit, payload schema and
+-- processor.
+CREATE TABLE IF NOT EXISTS webhooks.channels (
+    channel_id        SERIAL      PRIMARY KEY,
+    name              TEXT        NOT NULL UNIQUE,
+    status            TEXT        NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'disabled')),
+    auth              TEXT        NOT NULL DEFAULT 'any' CHECK (auth IN ('any', 'secret', 'signature')),
+    methods           TEXT[]      NOT NULL DEFAULT '{POST}',
+    max_payload_bytes INTEGER     NOT NULL DEFAULT 1048576 CHECK (max_payload_bytes > 0),
+    json_schema       JSONB,
+    processor         TEXT,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- NULL for messages received at /webhook rather than a channel.
+ALTER TABLE webhooks.messages ADD COLUMN IF NOT EXISTS channel_id INTEGER REFERENCES webhooks.channels (channel_id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_messages_channel_id ON webhooks.messages (channel_id);
@@ -0,0 +1 @@
+ALTER TABLE webhooks.channels DROP COLUMN IF EXISTS senders;
@@ -0,0 +1,3 @@
+-- The senders a channel accepts, by name. A channel with none accepts no
+-- requests, so bind senders to existing channels with cmd/channels set.
+ALTER TABLE webhooks.channels ADD COLUMN IF NOT EXISTS senders TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS webhooks.shared_secret_uses;
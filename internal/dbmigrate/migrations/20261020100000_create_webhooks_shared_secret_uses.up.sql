@@ -0,0 +1,11 @@
+-- Callers still presenting the previous value of the deprecated webhook
+-- shared secret after a rotation, one row per source IP and User-Agent.
+-- cmd/senders rotate-shared clears it; rotations lists it.
+CREATE TABLE IF NOT EXISTS webhooks.shared_secret_uses (
+    source_ip     TEXT        NOT NULL,
+    user_agent    TEXT        NOT NULL,
+    uses          BIGINT      NOT NULL DEFAULT 1,
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (source_ip, user_agent)
+);
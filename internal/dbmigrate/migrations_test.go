@@ -0,0 +1,127 @@
+package dbmigrate
+
+import (
+	"io"
+	"io/fs"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var migrationFileName = regexp.MustCompile(`^(\d{14})_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// TestMigrations_FilesArePaired checks every file is named the way
+// golang-migrate and generate-migration-files.sh expect and every up has
+// a non-empty down.
+func TestMigrations_FilesArePaired(t *testing.T) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	require.NoError(t, err)
+
+	ups, downs := map[string]bool{}, map[string]bool{}
+	for _, e := range entries {
+		m := migrationFileName.FindStringSubmatch(e.Name())
+		require.NotNil(t, m, "badly named migration file %s", e.Name())
+		key := m[1] + "_" + m[2]
+		if m[3] == "up" {
+			ups[key] = true
+		} else {
+			downs[key] = true
+		}
+	}
+	assert.Equal(t, ups, downs, "every up migration needs a down with the same version and name")
+
+	src, err := MigrationsSource()
+	require.NoError(t, err)
+	all, err := available(src)
+	require.NoError(t, err)
+	require.Len(t, all, len(ups))
+	for _, m := range all {
+		up := readMigration(t, m.version, true)
+		down := readMigration(t, m.version, false)
+		assert.NotEmpty(t, strings.TrimSpace(stripComments(up)), "%d up is empty", m.version)
+		assert.NotEmpty(t, strings.TrimSpace(stripComments(down)), "%d down is empty", m.version)
+	}
+}
+
+var (
+	createObject = regexp.MustCompile(`(?i)CREATE\s+(?:OR\s+REPLACE\s+)?(?:UNIQUE\s+)?(TABLE|SCHEMA|TYPE|FUNCTION|SEQUENCE|VIEW|TRIGGER)\s+(?:IF\s+NOT\s+EXISTS\s+)?([\w."]+)`)
+	createIndex  = regexp.MustCompile(`(?i)CREATE\s+(?:UNIQUE\s+)?INDEX\s+(?:CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?([\w"]+)\s+ON\s+([\w."]+)`)
+	addColumn    = regexp.MustCompile(`(?i)ALTER\s+TABLE\s+(?:IF\s+EXISTS\s+)?([\w."]+)\s+ADD\s+COLUMN\s+(?:IF\s+NOT\s+EXISTS\s+)?([\w"]+)`)
+)
+
+// TestMigrations_DownReversesUp checks that each down drops what its up
+// creates: tables, schemas, types, functions, sequences, views, triggers,
+// added columns, and indexes (directly or by dropping their table). It
+// can't prove a down restores the exact prior state, but it catches the
+// usual mistake of adding DDL to an up and forgetting the down.
+func TestMigrations_DownReversesUp(t *testing.T) {
+	src, err := MigrationsSource()
+	require.NoError(t, err)
+	all, err := available(src)
+	require.NoError(t, err)
+
+	for _, m := range all {
+		up := stripComments(readMigration(t, m.version, true))
+		down := strings.ToLower(stripComments(readMigration(t, m.version, false)))
+
+		drops := func(kind, name string) bool {
+			name = strings.ToLower(strings.Trim(name, `"`))
+			return regexp.MustCompile(`drop\s+` + kind + `\s+(if\s+exists\s+)?[\w."]*\b` + regexp.QuoteMeta(name) + `\b`).MatchString(down)
+		}
+
+		for _, c := range createObject.FindAllStringSubmatch(up, -1) {
+			kind, name := strings.ToLower(c[1]), c[2]
+			if kind == "schema" && strings.EqualFold(name, migrationSchema()) {
+				// The migrator creates this schema and keeps its own
+				// schema_migrations table in it; a down must not drop it.
+				// Shipped migrations aren't edited, so the baseline's
+				// down keeps its DROP SCHEMA IF EXISTS.
+				if m.version != baselineVersion {
+					assert.False(t, drops("schema", name), "%d down drops the migrations schema %s", m.version, name)
+				}
+				continue
+			}
+			assert.True(t, drops(kind, name), "%d creates %s %s but its down doesn't drop it", m.version, kind, name)
+		}
+		for _, c := range createIndex.FindAllStringSubmatch(up, -1) {
+			index, table := c[1], c[2]
+			assert.True(t, drops("index", index) || drops("table", table),
+				"%d creates index %s but its down drops neither it nor %s", m.version, index, table)
+		}
+		for _, c := range addColumn.FindAllStringSubmatch(up, -1) {
+			table, column := c[1], c[2]
+			assert.True(t, drops("column", column) || drops("table", table),
+				"%d adds column %s.%s but its down doesn't drop it", m.version, table, column)
+		}
+	}
+}
+
+func migrationSchema() string {
+	return ConfigDefaults()[config.PostgresSchemaKey]
+}
+
+func readMigration(t *testing.T, version uint, up bool) string {
+	t.Helper()
+	src, err := MigrationsSource()
+	require.NoError(t, err)
+	read := src.ReadDown
+	if up {
+		read = src.ReadUp
+	}
+	r, _, err := read(version)
+	require.NoError(t, err, "version %d up=%v", version, up)
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(b)
+}
+
+var sqlComment = regexp.MustCompile(`--[^\n]*`)
+
+func stripComments(sql string) string {
+	return sqlComment.ReplaceAllString(sql, "")
+}
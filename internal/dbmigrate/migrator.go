@@ -0,0 +1,170 @@
+package dbmigrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/pennsieve/dbmigrate-go/pkg/config"
+
+	// Registers the "pgx" database/sql driver.
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Migrator exposes the golang-migrate operations that
+// dbmigrate.DatabaseMigrator hides (version, steps, force), for inspecting
+// and repairing an environment where a migration half-applied. It connects
+// the same way as dbmigrate.NewLocalMigrator.
+type Migrator struct {
+	m   *migrate.Migrate
+	src source.Driver
+}
+
+// Status is the schema_migrations state.
+type Status struct {
+	Version uint
+	// Applied is false when no migration has ever run.
+	Applied bool
+	// Dirty means the migration at Version failed part-way; fix the schema
+	// by hand, then Force the version it is actually at.
+	Dirty bool
+}
+
+// NewMigrator opens a connection with the configured password.
+func NewMigrator(ctx context.Context, cfg config.Config, src source.Driver) (*Migrator, error) {
+	pg := cfg.PostgresDB
+	if pg.Password == nil {
+		return nil, fmt.Errorf("password cannot be nil for Migrator")
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(pg.User, *pg.Password),
+		Host:     net.JoinHostPort(pg.Host, strconv.Itoa(pg.Port)),
+		Path:     pg.Database,
+		RawQuery: "search_path=" + pg.Schema,
+	}
+	db, err := sql.Open("pgx", dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+	// pgx.WithInstance creates the migrations table, so its schema must
+	// exist first.
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %q", pg.Schema)); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating schema %q: %w", pg.Schema, err)
+	}
+	driver, err := pgx.WithInstance(db, &pgx.Config{SchemaName: pg.Schema})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating migration database.Driver: %w", err)
+	}
+	m, err := migrate.NewWithInstance("migration source", src, "postgres", driver)
+	if err != nil {
+		driver.Close()
+		return nil, fmt.Errorf("error creating Migrate instance: %w", err)
+	}
+	m.Log = migrateLogger{verbose: cfg.VerboseLogging}
+	return &Migrator{m: m, src: src}, nil
+}
+
+// Status reads the current version.
+func (mg *Migrator) Status() (Status, error) {
+	v, dirty, err := mg.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return Status{}, nil
+	}
+	if err != nil {
+		return Status{}, err
+	}
+	return Status{Version: v, Applied: true, Dirty: dirty}, nil
+}
+
+// Pending lists up migrations not yet applied.
+func (mg *Migrator) Pending() ([]Step, error) {
+	st, err := mg.Status()
+	if err != nil {
+		return nil, err
+	}
+	return PlanUp(mg.src, st.Version, st.Applied)
+}
+
+// PlanDown lists what Down(n) would run.
+func (mg *Migrator) PlanDown(n int) ([]Step, error) {
+	st, err := mg.Status()
+	if err != nil {
+		return nil, err
+	}
+	return PlanDown(mg.src, st.Version, st.Applied, n)
+}
+
+// PlanGoto lists what Goto(version) would run.
+func (mg *Migrator) PlanGoto(version uint) ([]Step, error) {
+	st, err := mg.Status()
+	if err != nil {
+		return nil, err
+	}
+	return PlanGoto(mg.src, st.Version, st.Applied, version)
+}
+
+// Up applies every pending migration.
+func (mg *Migrator) Up() error {
+	return noChange(mg.m.Up())
+}
+
+// Down rolls back the n most recent migrations.
+func (mg *Migrator) Down(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("down needs a positive number of migrations, got %d", n)
+	}
+	return noChange(mg.m.Steps(-n))
+}
+
+// Goto migrates up or down to version.
+func (mg *Migrator) Goto(version uint) error {
+	return noChange(mg.m.Migrate(version))
+}
+
+// Force records version as applied and clean without running anything;
+// -1 records that no migration is applied.
+func (mg *Migrator) Force(version int) error {
+	return mg.m.Force(version)
+}
+
+// Close releases the source and the database connection.
+func (mg *Migrator) Close() {
+	srcErr, dbErr := mg.m.Close()
+	if srcErr != nil {
+		log.Printf("warning: source error closing Migrator: %v", srcErr)
+	}
+	if dbErr != nil {
+		log.Printf("warning: database error closing Migrator: %v", dbErr)
+	}
+}
+
+func noChange(err error) error {
+	if errors.Is(err, migrate.ErrNoChange) {
+		log.Printf("no changes")
+		return nil
+	}
+	return err
+}
+
+type migrateLogger struct {
+	verbose bool
+}
+
+func (l migrateLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+func (l migrateLogger) Verbose() bool {
+	return l.verbose
+}
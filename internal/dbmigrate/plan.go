@@ -0,0 +1,143 @@
+package dbmigrate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4/source"
+)
+
+// baselineVersion is the first migration. Its down drops the webhooks
+// schema, which also holds schema_migrations, so it always fails; shipped
+// migrations aren't edited, so plans refuse to run it instead.
+const baselineVersion = 20260630000000
+
+// Step is one migration file a command would run.
+type Step struct {
+	Version    uint
+	Identifier string
+	Up         bool
+}
+
+func (s Step) String() string {
+	direction := "down"
+	if s.Up {
+		direction = "up"
+	}
+	return fmt.Sprintf("%d_%s.%s.sql", s.Version, s.Identifier, direction)
+}
+
+// migration is a version available in the source.
+type migration struct {
+	version    uint
+	identifier string
+}
+
+// Available lists every version in the source, oldest first.
+func available(src source.Driver) ([]migration, error) {
+	var all []migration
+	v, err := src.First()
+	for err == nil {
+		r, identifier, rerr := src.ReadUp(v)
+		if rerr != nil {
+			return nil, fmt.Errorf("error reading up migration %d: %w", v, rerr)
+		}
+		r.Close()
+		all = append(all, migration{version: v, identifier: identifier})
+		v, err = src.Next(v)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return all, nil
+}
+
+// position returns the index of the applied version in all, or -1 when
+// nothing has been applied.
+func position(all []migration, current uint, applied bool) (int, error) {
+	if !applied {
+		return -1, nil
+	}
+	for i, m := range all {
+		if m.version == current {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("database is at version %d, which is not in the migrations source", current)
+}
+
+// PlanUp lists the up migrations after the current version.
+func PlanUp(src source.Driver, current uint, applied bool) ([]Step, error) {
+	all, err := available(src)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := position(all, current, applied)
+	if err != nil {
+		return nil, err
+	}
+	var steps []Step
+	for _, m := range all[pos+1:] {
+		steps = append(steps, Step{Version: m.version, Identifier: m.identifier, Up: true})
+	}
+	return steps, nil
+}
+
+// PlanDown lists the down migrations that rolling back n versions runs,
+// newest first.
+func PlanDown(src source.Driver, current uint, applied bool, n int) ([]Step, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("down needs a positive number of migrations, got %d", n)
+	}
+	all, err := available(src)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := position(all, current, applied)
+	if err != nil {
+		return nil, err
+	}
+	if n > pos+1 {
+		return nil, fmt.Errorf("cannot roll back %d migrations, only %d applied", n, pos+1)
+	}
+	var steps []Step
+	for i := pos; i > pos-n; i-- {
+		steps = append(steps, Step{Version: all[i].version, Identifier: all[i].identifier})
+	}
+	return steps, checkBaseline(steps)
+}
+
+// PlanGoto lists the migrations that moving to target runs, up or down.
+func PlanGoto(src source.Driver, current uint, applied bool, target uint) ([]Step, error) {
+	all, err := available(src)
+	if err != nil {
+		return nil, err
+	}
+	pos, err := position(all, current, applied)
+	if err != nil {
+		return nil, err
+	}
+	targetPos, err := position(all, target, true)
+	if err != nil {
+		return nil, fmt.Errorf("version %d is not in the migrations source", target)
+	}
+	var steps []Step
+	for i := pos + 1; i <= targetPos; i++ {
+		steps = append(steps, Step{Version: all[i].version, Identifier: all[i].identifier, Up: true})
+	}
+	for i := pos; i > targetPos; i-- {
+		steps = append(steps, Step{Version: all[i].version, Identifier: all[i].identifier})
+	}
+	return steps, checkBaseline(steps)
+}
+
+// checkBaseline refuses a plan that rolls back the baseline migration.
+func checkBaseline(steps []Step) error {
+	for _, s := range steps {
+		if !s.Up && s.Version == baselineVersion {
+			return fmt.Errorf("cannot roll back the baseline migration %d; use goto %d to undo everything after it", baselineVersion, baselineVersion)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package dbmigrate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fixtureSource(t *testing.T) source.Driver {
+	t.Helper()
+	fsys := fstest.MapFS{}
+	for _, name := range []string{"1_a", "2_b", "3_c"} {
+		fsys["m/"+name+".up.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+		fsys["m/"+name+".down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	}
+	src, err := iofs.New(fsys, "m")
+	require.NoError(t, err)
+	return src
+}
+
+func names(steps []Step) []string {
+	var out []string
+	for _, s := range steps {
+		out = append(out, s.String())
+	}
+	return out
+}
+
+func TestPlanUp(t *testing.T) {
+	src := fixtureSource(t)
+
+	steps, err := PlanUp(src, 0, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1_a.up.sql", "2_b.up.sql", "3_c.up.sql"}, names(steps))
+
+	steps, err = PlanUp(src, 2, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3_c.up.sql"}, names(steps))
+
+	steps, err = PlanUp(src, 3, true)
+	require.NoError(t, err)
+	assert.Empty(t, steps)
+
+	_, err = PlanUp(src, 7, true)
+	assert.ErrorContains(t, err, "not in the migrations source")
+}
+
+func TestPlanDown(t *testing.T) {
+	src := fixtureSource(t)
+
+	steps, err := PlanDown(src, 3, true, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3_c.down.sql", "2_b.down.sql"}, names(steps))
+
+	steps, err = PlanDown(src, 3, true, 3)
+	require.NoError(t, err)
+	assert.Len(t, steps, 3)
+
+	_, err = PlanDown(src, 1, true, 2)
+	assert.ErrorContains(t, err, "only 1 applied")
+	_, err = PlanDown(src, 0, false, 1)
+	assert.Error(t, err)
+	_, err = PlanDown(src, 3, true, 0)
+	assert.Error(t, err)
+}
+
+func TestPlanGoto(t *testing.T) {
+	src := fixtureSource(t)
+
+	steps, err := PlanGoto(src, 0, false, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1_a.up.sql", "2_b.up.sql"}, names(steps))
+
+	steps, err = PlanGoto(src, 3, true, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3_c.down.sql", "2_b.down.sql"}, names(steps))
+
+	steps, err = PlanGoto(src, 2, true, 2)
+	require.NoError(t, err)
+	assert.Empty(t, steps)
+
+	_, err = PlanGoto(src, 2, true, 5)
+	assert.ErrorContains(t, err, "version 5")
+}
+
+func TestPlanDown_RefusesBaseline(t *testing.T) {
+	src, err := MigrationsSource()
+	require.NoError(t, err)
+	all, err := available(src)
+	require.NoError(t, err)
+	latest := all[len(all)-1].version
+
+	steps, err := PlanDown(src, latest, true, len(all)-1)
+	require.NoError(t, err)
+	assert.Equal(t, all[1].version, steps[len(steps)-1].Version)
+
+	_, err = PlanDown(src, latest, true, len(all))
+	assert.ErrorContains(t, err, "goto 20260630000000")
+	_, err = PlanDown(src, baselineVersion, true, 1)
+	assert.ErrorContains(t, err, "cannot roll back the baseline migration")
+
+	steps, err = PlanGoto(src, latest, true, baselineVersion)
+	require.NoError(t, err)
+	assert.Len(t, steps, len(all)-1)
+}
+
+func TestPlanUp_EmbeddedMigrations(t *testing.T) {
+	src, err := MigrationsSource()
+	require.NoError(t, err)
+	steps, err := PlanUp(src, 0, false)
+	require.NoError(t, err)
+	require.NotEmpty(t, steps)
+	assert.Equal(t, "20260630000000_create_webhooks_messages.up.sql", steps[0].String())
+}
@@ -3,54 +3,101 @@ package event_parser
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 
 	"github.com/Pennsieve/integration-service/internal/models"
 )
 
-func MapEvents(events map[string]interface{}) (map[string][]models.EventMessage, bool, error) {
+// MapEvents groups the deliverable events in an SQS batch by org and
+// collects the webhook cache invalidations the batch implies, both from
+// explicit invalidation messages and from events that change which
+// webhooks apply (see invalidatingEventTypes). Records that can't be
+// parsed are logged and skipped; only a malformed batch is an error.
+func MapEvents(events map[string]interface{}) (map[string][]models.EventMessage, []models.CacheInvalidation, error) {
 	mapped := make(map[string][]models.EventMessage)
-	forceRefresh := false
+	var invalidations []models.CacheInvalidation
+	seen := make(map[models.CacheInvalidation]bool)
+	invalidate := func(inv models.CacheInvalidation) {
+		if !seen[inv] {
+			seen[inv] = true
+			invalidations = append(invalidations, inv)
+		}
+	}
 
 	records, ok := events["Records"].([]interface{})
 	if !ok {
-		return nil, false, fmt.Errorf("invalid event format: records field missing or wrong type")
+		return nil, nil, fmt.Errorf("invalid event format: records field missing or wrong type")
 	}
 	for _, r := range records {
-		//TODO: We want per-record skip-and-log.
-		rec, ok := r.(map[string]interface{})
-		if !ok {
-			return nil, false, fmt.Errorf("record not an object")
-		}
-		rawBody, ok := rec["body"]
-		if !ok {
-			return nil, false, fmt.Errorf("record.body missing")
-		}
-		body, ok := rawBody.(string)
-		if !ok {
-			return nil, false, fmt.Errorf("record.body not a string")
-		}
-
-		var bodyJSON map[string]interface{}
-		err := json.Unmarshal([]byte(body), &bodyJSON)
+		msg, inv, isEvent, err := parseRecord(r)
 		if err != nil {
-			return nil, false, err
-		}
-		msgStr, ok := bodyJSON["Message"].(string)
-		if !ok {
-			return nil, false, fmt.Errorf("record.body.Message not a string")
+			// Retrying can't fix a malformed record, and failing the batch
+			// would redeliver every valid record with it until it reached
+			// the DLQ.
+			log.Printf("WARN skipping SQS record %s: %v", recordID(r), err)
+			continue
 		}
-		var msg models.EventMessage
-		err = json.Unmarshal([]byte(msgStr), &msg)
-		if err != nil {
-			return nil, false, err
+		if !isEvent {
+			invalidate(inv)
+			continue
 		}
 
 		mapped[msg.OrgID] = append(mapped[msg.OrgID], msg)
 
-		if msg.Type == "CREATE_DATASET" {
-			forceRefresh = true
+		if inv, ok := invalidationFor(msg); ok {
+			invalidate(inv)
 		}
 	}
 
-	return mapped, forceRefresh, nil
+	return mapped, invalidations, nil
+}
+
+// parseRecord parses one SQS record into an event, or into the
+// invalidation it carries when isEvent is false.
+func parseRecord(r interface{}) (msg models.EventMessage, inv models.CacheInvalidation, isEvent bool, err error) {
+	rec, ok := r.(map[string]interface{})
+	if !ok {
+		return msg, inv, false, fmt.Errorf("record not an object")
+	}
+	rawBody, ok := rec["body"]
+	if !ok {
+		return msg, inv, false, fmt.Errorf("record.body missing")
+	}
+	body, ok := rawBody.(string)
+	if !ok {
+		return msg, inv, false, fmt.Errorf("record.body not a string")
+	}
+
+	var bodyJSON map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &bodyJSON); err != nil {
+		return msg, inv, false, err
+	}
+	msgStr, ok := bodyJSON["Message"].(string)
+	if !ok {
+		return msg, inv, false, fmt.Errorf("record.body.Message not a string")
+	}
+
+	if isInvalidationMessage([]byte(msgStr)) {
+		inv, err = ParseInvalidation([]byte(msgStr))
+		return msg, inv, false, err
+	}
+
+	msg, err = ParseEventMessage([]byte(msgStr))
+	if err != nil {
+		return msg, inv, false, err
+	}
+	// messageId is only needed to report partial batch failures, so a
+	// record without one is still processed.
+	msg.MessageID, _ = rec["messageId"].(string)
+	return msg, inv, true, nil
+}
+
+// recordID names a record in logs by its SQS message id, if it has one.
+func recordID(r interface{}) string {
+	if rec, ok := r.(map[string]interface{}); ok {
+		if id, ok := rec["messageId"].(string); ok && id != "" {
+			return id
+		}
+	}
+	return "(no messageId)"
 }
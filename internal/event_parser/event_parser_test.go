@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/Pennsieve/integration-service/internal/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -25,29 +26,56 @@ func TestMapEvents_GroupsByOrg(t *testing.T) {
 		map[string]interface{}{"organizationId": "org2", "datasetId": 3, "eventCategory": "FILES", "eventType": "UPLOAD"},
 	)
 
-	mapped, forceRefresh, err := MapEvents(events)
+	mapped, invalidations, err := MapEvents(events)
 	require.NoError(t, err)
-	assert.False(t, forceRefresh)
+	assert.Empty(t, invalidations)
 	assert.Len(t, mapped["org1"], 2)
 	assert.Len(t, mapped["org2"], 1)
 	assert.Equal(t, 1, mapped["org1"][0].DataID)
 }
 
-func TestMapEvents_ForceRefreshOnCreateDataset(t *testing.T) {
+func TestMapEvents_CreateDatasetInvalidatesThatDataset(t *testing.T) {
 	events := sqsEvent(
-		map[string]interface{}{"organizationId": "org1", "datasetId": 1, "eventCategory": "DATASET", "eventType": "CREATE_DATASET"},
+		map[string]interface{}{"organizationId": "org1", "datasetId": 1, "eventCategory": "METADATA", "eventType": "CREATE_DATASET"},
 	)
 
-	_, forceRefresh, err := MapEvents(events)
+	mapped, invalidations, err := MapEvents(events)
 	require.NoError(t, err)
-	assert.True(t, forceRefresh, "CREATE_DATASET must force a cache refresh")
+	assert.Equal(t, []models.CacheInvalidation{{OrgID: "org1", DatasetID: 1}}, invalidations,
+		"CREATE_DATASET must invalidate only its own dataset")
+	assert.Len(t, mapped["org1"], 1, "CREATE_DATASET is still delivered")
+}
+
+func TestMapEvents_OtherEventsDontInvalidate(t *testing.T) {
+	events := sqsEvent(
+		map[string]interface{}{"organizationId": "45", "datasetId": 123, "datasetNodeId": "N:dataset:1", "datasetName": "My Dataset",
+			"eventCategory": "PUBLISHING", "eventType": "REQUEST_PUBLICATION"},
+		map[string]interface{}{"organizationId": "45", "datasetId": 123, "datasetNodeId": "N:dataset:1", "datasetName": "My Dataset",
+			"eventCategory": "PERMISSIONS", "eventType": "UPDATE_PERMISSION"},
+	)
+
+	mapped, invalidations, err := MapEvents(events)
+	require.NoError(t, err)
+	assert.Empty(t, invalidations)
+	assert.Len(t, mapped["45"], 2)
+}
+
+func TestMapEvents_ExplicitInvalidationIsNotDelivered(t *testing.T) {
+	events := sqsEvent(
+		map[string]interface{}{"messageType": InvalidationMessageType, "organizationId": "org1", "datasetId": 7},
+		map[string]interface{}{"messageType": InvalidationMessageType, "organizationId": "org2"},
+	)
+
+	mapped, invalidations, err := MapEvents(events)
+	require.NoError(t, err)
+	assert.Empty(t, mapped)
+	assert.Equal(t, []models.CacheInvalidation{{OrgID: "org1", DatasetID: 7}, {OrgID: "org2"}}, invalidations)
 }
 
 func TestMapEvents_RejectsMalformedEnvelope(t *testing.T) {
 	cases := map[string]map[string]interface{}{
 		"missing Records":    {"NotRecords": []interface{}{}},
 		"records wrong type": {"Records": "nope"},
-		"body not a string":  {"Records": []interface{}{map[string]interface{}{"body": 123}}},
 	}
 	for name, ev := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -56,3 +84,25 @@ func TestMapEvents_RejectsMalformedEnvelope(t *testing.T) {
 		})
 	}
 }
+
+func TestMapEvents_SkipsInvalidRecords(t *testing.T) {
+	events := sqsEvent(
+		map[string]interface{}{"organizationId": "org1", "datasetId": 1, "eventCategory": "FILES", "eventType": "UPLOAD"},
+		map[string]interface{}{"datasetId": 2, "eventCategory": "FILES", "eventType": "UPLOAD"},
+		map[string]interface{}{"messageType": InvalidationMessageType},
+		map[string]interface{}{"organizationId": "org2", "datasetId": 3, "eventCategory": "FILES", "eventType": "UPLOAD"},
+	)
+	records := events["Records"].([]interface{})
+	events["Records"] = append(records,
+		map[string]interface{}{"messageId": "m-body", "body": 123},
+		map[string]interface{}{"messageId": "m-json", "body": "{not json"},
+		"not a record",
+	)
+
+	mapped, invalidations, err := MapEvents(events)
+	require.NoError(t, err)
+	assert.Empty(t, invalidations)
+	assert.Len(t, mapped["org1"], 1)
+	assert.Len(t, mapped["org2"], 1)
+	assert.Len(t, mapped, 2)
+}
@@ -0,0 +1,66 @@
+package event_parser
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+// InvalidationMessageType is the messageType of an explicit webhook cache
+// invalidation published to the event topic, e.g. by the webhooks API after
+// it changes a webhook:
+//
+//	{"messageType":"WEBHOOK_CACHE_INVALIDATION","organizationId":"45","datasetId":123}
+//
+// datasetId is optional; without it the whole org is invalidated. These
+// messages are never delivered to webhooks.
+const InvalidationMessageType = "WEBHOOK_CACHE_INVALIDATION"
+
+// invalidatingEventTypes are the deliverable eventTypes that also change
+// which webhooks apply, mapped to whether they affect the whole org (true)
+// or only the event's dataset (false). Only changelog events the platform
+// publishes belong here (see doc/webhooks-feature-guide.md §6). Changes to
+// webhooks themselves are not changelog events; they reach the cache
+// through InvalidationMessageType messages or its TTL.
+var invalidatingEventTypes = map[string]bool{
+	// A new dataset may have default webhooks enabled on it.
+	"CREATE_DATASET": false,
+}
+
+// invalidationFor returns the cache invalidation implied by msg, if any.
+func invalidationFor(msg models.EventMessage) (models.CacheInvalidation, bool) {
+	orgWide, ok := invalidatingEventTypes[msg.Type]
+	if !ok {
+		return models.CacheInvalidation{}, false
+	}
+	inv := models.CacheInvalidation{OrgID: msg.OrgID}
+	if !orgWide {
+		inv.DatasetID = msg.DataID
+	}
+	return inv, true
+}
+
+func isInvalidationMessage(raw []byte) bool {
+	var probe struct {
+		MessageType string `json:"messageType"`
+	}
+	return json.Unmarshal(raw, &probe) == nil && probe.MessageType == InvalidationMessageType
+}
+
+// ParseInvalidation decodes and validates an explicit invalidation message.
+func ParseInvalidation(raw []byte) (models.CacheInvalidation, error) {
+	var inv models.CacheInvalidation
+	if err := json.Unmarshal(raw, &inv); err != nil {
+		return models.CacheInvalidation{}, &ValidationError{Reason: fmt.Sprintf("malformed JSON: %v", err)}
+	}
+	switch {
+	case inv.OrgID == "":
+		return models.CacheInvalidation{}, &ValidationError{Field: "organizationId", Reason: "required"}
+	case !orgIDPattern.MatchString(inv.OrgID):
+		return models.CacheInvalidation{}, &ValidationError{Field: "organizationId", Reason: fmt.Sprintf("invalid format %q", inv.OrgID)}
+	case inv.DatasetID < 0:
+		return models.CacheInvalidation{}, &ValidationError{Field: "datasetId", Reason: "must not be negative"}
+	}
+	return inv, nil
+}
@@ -0,0 +1,28 @@
+package event_parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInvalidation_RejectsBadOrgID(t *testing.T) {
+	_, err := ParseInvalidation([]byte(`{"messageType":"WEBHOOK_CACHE_INVALIDATION","organizationId":"org; DROP"}`))
+	var vErr *ValidationError
+	require.True(t, errors.As(err, &vErr))
+	assert.Equal(t, "organizationId", vErr.Field)
+}
+
+func TestInvalidationFor_ScopesByEventType(t *testing.T) {
+	inv, ok := invalidationFor(models.EventMessage{OrgID: "45", DataID: 9, Category: "METADATA", Type: "CREATE_DATASET"})
+	require.True(t, ok)
+	assert.Equal(t, models.CacheInvalidation{OrgID: "45", DatasetID: 9}, inv)
+
+	for _, typ := range []string{"UPDATE_METADATA", "UPDATE_PERMISSION", "CREATE_PACKAGE", "CUSTOM_EVENT"} {
+		_, ok = invalidationFor(models.EventMessage{OrgID: "45", DataID: 9, Type: typ})
+		assert.False(t, ok, typ)
+	}
+}
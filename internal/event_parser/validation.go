@@ -0,0 +1,100 @@
+package event_parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+// Envelope schema versions accepted on the event queue. Messages published
+// before versioning existed carry no schemaVersion field and are treated as
+// v1; v2 adds schemaVersion and forwards eventDetail to receivers.
+const (
+	SchemaVersionV1 = 1
+	SchemaVersionV2 = 2
+)
+
+// orgIDPattern mirrors the allowlist cache.RefreshWebhookCache applies before
+// interpolating an org id into a schema name, so anything rejected there is
+// rejected here first with a clearer reason.
+var orgIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// knownCategories are the coarse eventCategory values pennsieve-api publishes
+// and the only values seeded into webhook_event_types. STATUS is subscribable
+// but never emitted; it's accepted so a future producer isn't rejected here.
+var knownCategories = map[string]bool{
+	"METADATA":           true,
+	"FILES":              true,
+	"RECORDS_AND_MODELS": true,
+	"PERMISSIONS":        true,
+	"PUBLISHING":         true,
+	"CUSTOM":             true,
+	"STATUS":             true,
+}
+
+// ValidationError reports why an event message was rejected. Field is the
+// JSON field name at fault, or empty when the message as a whole is bad.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("invalid event message: %s", e.Reason)
+	}
+	return fmt.Sprintf("invalid event message: %s: %s", e.Field, e.Reason)
+}
+
+// ParseEventMessage decodes and validates the SNS Message string of a single
+// record. A missing schemaVersion means v1. For v1 messages Detail is cleared
+// and SchemaVersion is left as sent, so the delivered body stays exactly what
+// receivers got before versioning.
+func ParseEventMessage(raw []byte) (models.EventMessage, error) {
+	var msg models.EventMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return models.EventMessage{}, &ValidationError{Reason: fmt.Sprintf("malformed JSON: %v", err)}
+	}
+
+	switch msg.SchemaVersion {
+	case 0, SchemaVersionV1:
+		msg.Detail = nil
+	case SchemaVersionV2:
+		if len(msg.Detail) > 0 && !isJSONObject(msg.Detail) {
+			return models.EventMessage{}, &ValidationError{Field: "eventDetail", Reason: "must be a JSON object"}
+		}
+	default:
+		return models.EventMessage{}, &ValidationError{Field: "schemaVersion", Reason: fmt.Sprintf("unsupported version %d", msg.SchemaVersion)}
+	}
+
+	if err := validateEventMessage(msg); err != nil {
+		return models.EventMessage{}, err
+	}
+	return msg, nil
+}
+
+// validateEventMessage applies the rules shared by every schema version.
+func validateEventMessage(msg models.EventMessage) error {
+	switch {
+	case msg.OrgID == "":
+		return &ValidationError{Field: "organizationId", Reason: "required"}
+	case !orgIDPattern.MatchString(msg.OrgID):
+		return &ValidationError{Field: "organizationId", Reason: fmt.Sprintf("invalid format %q", msg.OrgID)}
+	case msg.DataID <= 0:
+		return &ValidationError{Field: "datasetId", Reason: "must be a positive integer"}
+	case msg.Category == "":
+		return &ValidationError{Field: "eventCategory", Reason: "required"}
+	case !knownCategories[msg.Category]:
+		return &ValidationError{Field: "eventCategory", Reason: fmt.Sprintf("unknown category %q", msg.Category)}
+	case msg.Type == "":
+		return &ValidationError{Field: "eventType", Reason: "required"}
+	}
+	return nil
+}
+
+func isJSONObject(raw json.RawMessage) bool {
+	var obj map[string]json.RawMessage
+	return json.Unmarshal(raw, &obj) == nil && obj != nil
+}
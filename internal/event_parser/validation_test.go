@@ -0,0 +1,50 @@
+package event_parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEventMessage_V1WithoutVersion(t *testing.T) {
+	msg, err := ParseEventMessage([]byte(`{"organizationId":"45","datasetId":123,"eventCategory":"PUBLISHING","eventType":"REQUEST_PUBLICATION","eventDetail":{"k":"v"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, 0, msg.SchemaVersion)
+	assert.Equal(t, "45", msg.OrgID)
+	assert.Equal(t, 123, msg.DataID)
+	// v1 never forwarded eventDetail; keep the delivered body unchanged.
+	assert.Nil(t, msg.Detail)
+}
+
+func TestParseEventMessage_V2ForwardsDetail(t *testing.T) {
+	msg, err := ParseEventMessage([]byte(`{"schemaVersion":2,"organizationId":"45","datasetId":123,"eventCategory":"FILES","eventType":"CREATE_PACKAGE","eventDetail":{"packageId":"N:package:1"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersionV2, msg.SchemaVersion)
+	assert.JSONEq(t, `{"packageId":"N:package:1"}`, string(msg.Detail))
+}
+
+func TestParseEventMessage_RejectsWithPreciseReason(t *testing.T) {
+	cases := map[string]struct {
+		raw   string
+		field string
+	}{
+		"missing org id":       {`{"datasetId":1,"eventCategory":"FILES","eventType":"CREATE_PACKAGE"}`, "organizationId"},
+		"bad org id":           {`{"organizationId":"org-1","datasetId":1,"eventCategory":"FILES","eventType":"CREATE_PACKAGE"}`, "organizationId"},
+		"zero dataset id":      {`{"organizationId":"45","eventCategory":"FILES","eventType":"CREATE_PACKAGE"}`, "datasetId"},
+		"unknown category":     {`{"organizationId":"45","datasetId":1,"eventCategory":"PACKAGES","eventType":"CREATE_PACKAGE"}`, "eventCategory"},
+		"missing event type":   {`{"organizationId":"45","datasetId":1,"eventCategory":"FILES"}`, "eventType"},
+		"unsupported version":  {`{"schemaVersion":3,"organizationId":"45","datasetId":1,"eventCategory":"FILES","eventType":"CREATE_PACKAGE"}`, "schemaVersion"},
+		"v2 detail not object": {`{"schemaVersion":2,"organizationId":"45","datasetId":1,"eventCategory":"FILES","eventType":"CREATE_PACKAGE","eventDetail":[1]}`, "eventDetail"},
+		"malformed JSON":       {`{"organizationId":`, ""},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseEventMessage([]byte(tc.raw))
+			var vErr *ValidationError
+			require.True(t, errors.As(err, &vErr), "expected a ValidationError, got %v", err)
+			assert.Equal(t, tc.field, vErr.Field)
+		})
+	}
+}
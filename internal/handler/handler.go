@@ -7,30 +7,65 @@ import (
 	"time"
 
 	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/cache"
 	"github.com/Pennsieve/integration-service/internal/db"
 	"github.com/Pennsieve/integration-service/internal/event_parser"
+	"github.com/Pennsieve/integration-service/internal/models"
 	"github.com/Pennsieve/integration-service/internal/webhook_mapper"
 	"github.com/Pennsieve/integration-service/internal/webhook_sender"
+	"github.com/aws/aws-lambda-go/events"
 )
 
-func Handler(ctx context.Context, events map[string]interface{}) (map[string]interface{}, error) {
+// Handler consumes a batch from the event SQS queue. Events for orgs whose
+// webhooks couldn't be loaded are reported as batch item failures (the event
+// source mapping has ReportBatchItemFailures enabled), so SQS redelivers just
+// those records rather than the whole batch being dropped or retried.
+func Handler(ctx context.Context, sqsEvent map[string]interface{}) (events.SQSEventResponse, error) {
 	aws.AwsOnce.Do(func() {
 		aws.InitAWS(ctx)
 	})
 
 	if err := db.EnsureDB(ctx); err != nil {
-		return nil, fmt.Errorf("database initialization failed: %w", err)
+		return events.SQSEventResponse{}, fmt.Errorf("database initialization failed: %w", err)
 	}
 
 	log.Println("Lambda handler invoked at", time.Now())
 
-	mappedEvents, forceRefresh, err := event_parser.MapEvents(events)
+	mappedEvents, invalidations, err := event_parser.MapEvents(sqsEvent)
 	if err != nil {
-		return nil, fmt.Errorf("failed to map events: %w", err)
+		return events.SQSEventResponse{}, fmt.Errorf("failed to map events: %w", err)
 	}
 
-	webhookMessages := webhook_mapper.MapWebhookMessages(ctx, mappedEvents, forceRefresh)
+	defer func() {
+		cache.WaitForRefreshes()
+		cache.FlushStats()
+	}()
+
+	webhookMessages, failedOrgs := webhook_mapper.MapWebhookMessages(ctx, mappedEvents, invalidations)
 	webhook_sender.BroadcastMessages(ctx, webhookMessages)
 
-	return events, nil
+	return batchItemFailures(mappedEvents, failedOrgs)
+}
+
+// batchItemFailures lists the SQS message ids of every event belonging to a
+// failed org. If any of those events has no message id there is no way to
+// retry it selectively, so the whole batch is failed instead.
+func batchItemFailures(mapped map[string][]models.EventMessage, failedOrgs map[string]error) (events.SQSEventResponse, error) {
+	resp := events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{}}
+	seen := make(map[string]bool)
+
+	for orgID, orgErr := range failedOrgs {
+		log.Printf("ERROR webhooks unavailable for org %s, retrying %d events: %v", orgID, len(mapped[orgID]), orgErr)
+		for _, evt := range mapped[orgID] {
+			if evt.MessageID == "" {
+				return events.SQSEventResponse{}, fmt.Errorf("webhooks unavailable for org %s: %w", orgID, orgErr)
+			}
+			if seen[evt.MessageID] {
+				continue
+			}
+			seen[evt.MessageID] = true
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: evt.MessageID})
+		}
+	}
+	return resp, nil
 }
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchItemFailures_ReportsFailedOrgMessages(t *testing.T) {
+	mapped := map[string][]models.EventMessage{
+		"1": {{MessageID: "m1", OrgID: "1"}, {MessageID: "m2", OrgID: "1"}},
+		"2": {{MessageID: "m3", OrgID: "2"}},
+	}
+
+	resp, err := batchItemFailures(mapped, map[string]error{"1": errors.New("connection reset")})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []events.SQSBatchItemFailure{{ItemIdentifier: "m1"}, {ItemIdentifier: "m2"}}, resp.BatchItemFailures)
+}
+
+func TestBatchItemFailures_NoFailuresIsEmptyList(t *testing.T) {
+	resp, err := batchItemFailures(map[string][]models.EventMessage{"1": {{MessageID: "m1"}}}, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, resp.BatchItemFailures)
+	assert.Empty(t, resp.BatchItemFailures)
+}
+
+func TestBatchItemFailures_MissingMessageIDFailsBatch(t *testing.T) {
+	mapped := map[string][]models.EventMessage{"1": {{OrgID: "1"}}}
+
+	_, err := batchItemFailures(mapped, map[string]error{"1": errors.New("connection reset")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,344 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	defaultMessagesLimit = 50
+	maxMessagesLimit     = 200
+
+	// payloadFilterPrefix marks a listing query parameter as a payload
+	// predicate: ?payload.repository.name=foo.
+	payloadFilterPrefix = "payload."
+	// maxPayloadFilters bounds the payload predicates on one listing.
+	maxPayloadFilters = 10
+)
+
+// requestIDPattern matches the UUIDs the receiver assigns, so a malformed
+// id is a 404 rather than a Postgres cast error.
+var requestIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// MessageHandler is the message API wired to the shared Postgres pool.
+var MessageHandler = NewMessageHandler(db.Postgres{})
+
+type messageHandler struct {
+	store db.MessageStore
+}
+
+// NewMessageHandler serves read access to the messages the webhook
+// receiver stored: GET /messages lists them, GET /messages/{requestId}
+// returns one with its payload, GET /messages/{requestId}/payload
+// downloads the payload alone and GET /messages/{requestId}/raw the body
+// as the sender posted it.
+//
+// Callers are authenticated by the shared Pennsieve Lambda authorizer like
+// NotificationHandler's. Messages belong to no organization, so only
+// Pennsieve super-admins may read them.
+func NewMessageHandler(store db.MessageStore) func(context.Context, events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	h := &messageHandler{store: store}
+	return h.handle
+}
+
+func (h *messageHandler) handle(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	aws.AwsOnce.Do(func() {
+		aws.InitAWS(ctx)
+	})
+
+	if err := h.store.Ready(ctx); err != nil {
+		log.Printf("ERROR db init: %v", err)
+		return notifErrorResponse(http.StatusInternalServerError, "database unavailable"), nil
+	}
+
+	claim, err := authenticatedUser(req)
+	if err != nil {
+		log.Printf("ERROR auth: %v; authorizer=%+v", err, req.RequestContext.Authorizer)
+		return notifErrorResponse(http.StatusUnauthorized, "missing or invalid bearer token"), nil
+	}
+	if !claim.IsSuperAdmin {
+		log.Printf("WARN user %d denied access to webhook messages", claim.Id)
+		return notifErrorResponse(http.StatusForbidden, "webhook messages are only available to administrators"), nil
+	}
+
+	if req.RequestContext.HTTP.Method != http.MethodGet {
+		return notifErrorResponse(http.StatusNotFound, "not found"), nil
+	}
+	segments := strings.Split(strings.Trim(req.RawPath, "/"), "/")
+	switch {
+	case len(segments) == 1 && segments[0] == "messages":
+		return h.handleList(ctx, req)
+	case len(segments) == 2 && segments[0] == "messages":
+		return h.handleGet(ctx, pathParam(req, "requestId", segments[1]), "")
+	case len(segments) == 3 && segments[0] == "messages" && (segments[2] == downloadPayload || segments[2] == downloadRaw):
+		return h.handleGet(ctx, pathParam(req, "requestId", segments[1]), segments[2])
+	default:
+		return notifErrorResponse(http.StatusNotFound, "not found"), nil
+	}
+}
+
+func (h *messageHandler) handleList(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	names, err := h.names(ctx)
+	if err != nil {
+		log.Printf("ERROR resolve names: %v", err)
+		return notifErrorResponse(http.StatusInternalServerError, "failed to fetch messages"), nil
+	}
+
+	filter, err := parseMessageFilter(req.QueryStringParameters, names)
+	if err != nil {
+		return notifErrorResponse(http.StatusBadRequest, err.Error()), nil
+	}
+
+	recs, err := h.store.ListWebhookMessages(ctx, filter)
+	if err != nil {
+		log.Printf("ERROR list webhook messages: %v", err)
+		return notifErrorResponse(http.StatusInternalServerError, "failed to fetch messages"), nil
+	}
+
+	page := models.StoredMessagePage{Messages: make([]models.StoredMessage, 0, len(recs))}
+	for _, rec := range recs {
+		page.Messages = append(page.Messages, storedMessage(rec, names))
+	}
+	if len(recs) == filter.Limit {
+		page.NextCursor = encodeCursor(recs[len(recs)-1].ID)
+	}
+	return notifJSONResponse(http.StatusOK, page), nil
+}
+
+// Downloads handleGet offers instead of the message.
+const (
+	downloadPayload = "payload"
+	downloadRaw     = "raw"
+)
+
+// handleGet returns one message, or the download named by download.
+func (h *messageHandler) handleGet(ctx context.Context, requestID, download string) (events.APIGatewayV2HTTPResponse, error) {
+	if !requestIDPattern.MatchString(requestID) {
+		return notifErrorResponse(http.StatusNotFound, "message not found"), nil
+	}
+	rec, err := h.store.GetWebhookMessage(ctx, requestID)
+	if errors.Is(err, db.ErrMessageNotFound) {
+		return notifErrorResponse(http.StatusNotFound, "message not found"), nil
+	}
+	if err != nil {
+		log.Printf("ERROR get webhook message: %v", err)
+		return notifErrorResponse(http.StatusInternalServerError, "failed to fetch message"), nil
+	}
+
+	switch download {
+	case downloadPayload:
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: http.StatusOK,
+			Headers: map[string]string{
+				"Content-Type":        "application/json",
+				"Content-Disposition": fmt.Sprintf(`attachment; filename="%s.json"`, rec.RequestID),
+			},
+			Body: string(rec.Payload),
+		}, nil
+	case downloadRaw:
+		return rawBodyResponse(rec), nil
+	}
+
+	names, err := h.names(ctx)
+	if err != nil {
+		log.Printf("ERROR resolve names: %v", err)
+		return notifErrorResponse(http.StatusInternalServerError, "failed to fetch message"), nil
+	}
+	return notifJSONResponse(http.StatusOK, storedMessage(rec, names)), nil
+}
+
+// messageNames map sender and channel ids to names.
+type messageNames struct {
+	senders  map[int64]string
+	channels map[int64]string
+}
+
+func (h *messageHandler) names(ctx context.Context) (messageNames, error) {
+	senders, err := h.store.ListSenders(ctx)
+	if err != nil {
+		return messageNames{}, err
+	}
+	channels, err := h.store.ListChannels(ctx)
+	if err != nil {
+		return messageNames{}, err
+	}
+	names := messageNames{
+		senders:  make(map[int64]string, len(senders)),
+		channels: make(map[int64]string, len(channels)),
+	}
+	for _, s := range senders {
+		names.senders[s.ID] = s.Name
+	}
+	for _, c := range channels {
+		names.channels[c.ID] = c.Name
+	}
+	return names, nil
+}
+
+// idOf returns the id names maps to name, 0 if none.
+func idOf(names map[int64]string, name string) int64 {
+	for id, n := range names {
+		if n == name {
+			return id
+		}
+	}
+	return 0
+}
+
+// parseMessageFilter reads a listing's query parameters: since and until
+// (RFC 3339), sender and channel (names), method, status,
+// payload.<path>=<value> predicates, limit and cursor.
+func parseMessageFilter(params map[string]string, names messageNames) (models.MessageFilter, error) {
+	f := models.MessageFilter{Limit: defaultMessagesLimit}
+	if v, err := strconv.Atoi(params["limit"]); err == nil && v > 0 && v <= maxMessagesLimit {
+		f.Limit = v
+	}
+	for _, bound := range []struct {
+		name string
+		dest *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		v := params[bound.name]
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s: want an RFC 3339 time", bound.name)
+		}
+		*bound.dest = t
+	}
+	if name := params["sender"]; name != "" {
+		if f.SenderID = idOf(names.senders, name); f.SenderID == 0 {
+			return f, fmt.Errorf("unknown sender %q", name)
+		}
+	}
+	if name := params["channel"]; name != "" {
+		if f.ChannelID = idOf(names.channels, name); f.ChannelID == 0 {
+			return f, fmt.Errorf("unknown channel %q", name)
+		}
+	}
+	f.Method = strings.ToUpper(params["method"])
+	switch f.Status = strings.ToLower(params["status"]); f.Status {
+	case "", models.MessageReceived, models.MessageProcessing, models.MessageProcessed, models.MessageFailed:
+	default:
+		return f, fmt.Errorf("invalid status %q", params["status"])
+	}
+	if v := params["cursor"]; v != "" {
+		id, err := decodeCursor(v)
+		if err != nil {
+			return f, errors.New("invalid cursor")
+		}
+		f.BeforeID = id
+	}
+
+	var keys []string
+	for k := range params {
+		if strings.HasPrefix(k, payloadFilterPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) > maxPayloadFilters {
+		return f, fmt.Errorf("at most %d payload filters are allowed", maxPayloadFilters)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		path := strings.Split(strings.TrimPrefix(k, payloadFilterPrefix), ".")
+		for _, p := range path {
+			if p == "" {
+				return f, fmt.Errorf("invalid payload filter %q", k)
+			}
+		}
+		f.Payload = append(f.Payload, models.PayloadPredicate{Path: path, Value: params[k]})
+	}
+	return f, nil
+}
+
+// encodeCursor and decodeCursor keep listing cursors opaque, so their
+// contents can change without breaking callers that treat them as such.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return id, nil
+}
+
+func storedMessage(rec models.IncomingWebhook, names messageNames) models.StoredMessage {
+	return models.StoredMessage{
+		ID:          rec.ID,
+		RequestID:   rec.RequestID,
+		SenderID:    rec.SenderID,
+		Sender:      names.senders[rec.SenderID],
+		ChannelID:   rec.ChannelID,
+		Channel:     names.channels[rec.ChannelID],
+		ReceivedAt:  rec.ReceivedAt,
+		Method:      rec.Request.Method,
+		Headers:     rec.Request.Headers,
+		SourceIP:    rec.Request.SourceIP,
+		UserAgent:   rec.Request.UserAgent,
+		ContentType: rec.Request.ContentType,
+		QueryString: rec.Request.QueryString,
+		Status:      rec.Processing.Status,
+		Attempts:    rec.Processing.Attempts,
+		LastError:   rec.Processing.LastError,
+		ProcessedAt: rec.Processing.ProcessedAt,
+		Payload:     rec.Payload,
+	}
+}
+
+// rawBodyResponse downloads the body rec was converted from, or its
+// payload if it arrived as JSON, with the content type it was sent with.
+func rawBodyResponse(rec models.IncomingWebhook) events.APIGatewayV2HTTPResponse {
+	body, contentType := rec.RawBody, rec.Request.ContentType
+	if body == nil {
+		body = rec.Payload
+	}
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	resp := events.APIGatewayV2HTTPResponse{
+		StatusCode: http.StatusOK,
+		Headers: map[string]string{
+			"Content-Type":        contentType,
+			"Content-Disposition": fmt.Sprintf(`attachment; filename="%s"`, rec.RequestID),
+		},
+		Body: string(body),
+	}
+	if !utf8.Valid(body) {
+		resp.Body = base64.StdEncoding.EncodeToString(body)
+		resp.IsBase64Encoded = true
+	}
+	return resp
+}
+
+// pathParam reads a path parameter by key, falling back to the path
+// segment when API Gateway didn't populate PathParameters.
+func pathParam(req events.APIGatewayV2HTTPRequest, key, segment string) string {
+	if v := req.PathParameters[key]; v != "" {
+		return v
+	}
+	return segment
+}
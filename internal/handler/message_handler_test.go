@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/Pennsieve/integration-service/internal/sender_auth"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func messageReq(rawPath string, params map[string]string, superAdmin bool) events.APIGatewayV2HTTPRequest {
+	req := authedNotifReq(http.MethodGet, rawPath, nil, 9)
+	req.QueryStringParameters = params
+	req.RequestContext.Authorizer.Lambda["user_claim"].(map[string]interface{})["IsSuperAdmin"] = superAdmin
+	return req
+}
+
+// seedMessages stores count messages a minute apart from start, alternating
+// between the acme sender (push events) and no sender (ping events), with
+// every third one on the lims channel.
+func seedMessages(t *testing.T, count int, start time.Time) (*db.Memory, []models.IncomingWebhook) {
+	ctx := context.Background()
+	store := db.NewMemory()
+	acme, err := store.CreateSender(ctx, "acme", sender_auth.HashSecret("acme-secret"), sender_auth.DefaultScopes)
+	require.NoError(t, err)
+	lims, err := store.PutChannel(ctx, models.Channel{Name: "lims", Auth: models.ChannelAuthAny, Methods: []string{http.MethodPost}, MaxPayloadBytes: 1024})
+	require.NoError(t, err)
+
+	var recs []models.IncomingWebhook
+	for i := 0; i < count; i++ {
+		at := start.Add(time.Duration(i) * time.Minute)
+		store.SetNow(func() time.Time { return at })
+		msg := models.IncomingWebhook{
+			RequestID: fmt.Sprintf("00000000-0000-4000-8000-%012d", i),
+			Payload:   []byte(fmt.Sprintf(`{"event":"ping","n":%d}`, i)),
+			Request:   models.RequestMetadata{Method: http.MethodPost},
+		}
+		if i%2 == 0 {
+			msg.SenderID = acme.ID
+			msg.Payload = []byte(fmt.Sprintf(`{"event":"push","repo":{"name":"r%d"}}`, i))
+			msg.Request.Method = http.MethodPut
+		}
+		if i%3 == 0 {
+			msg.ChannelID = lims.ID
+		}
+		rec, err := store.InsertWebhookMessage(ctx, msg)
+		require.NoError(t, err)
+		recs = append(recs, rec)
+	}
+	return store, recs
+}
+
+func decodePage(t *testing.T, resp events.APIGatewayV2HTTPResponse) models.StoredMessagePage {
+	require.Equal(t, http.StatusOK, resp.StatusCode, resp.Body)
+	var page models.StoredMessagePage
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &page))
+	return page
+}
+
+func requestIDs(page models.StoredMessagePage) []string {
+	var ids []string
+	for _, m := range page.Messages {
+		ids = append(ids, m.RequestID)
+	}
+	return ids
+}
+
+func TestMessageHandler_RequiresSuperAdmin(t *testing.T) {
+	aws.AwsOnce.Do(func() {})
+	store, _ := seedMessages(t, 1, time.Now())
+	h := NewMessageHandler(store)
+
+	resp, err := h(context.Background(), unauthedNotifReq(http.MethodGet, "/messages", nil))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = h(context.Background(), messageReq("/messages", nil, false))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestMessageHandler_ListPaginates(t *testing.T) {
+	aws.AwsOnce.Do(func() {})
+	store, recs := seedMessages(t, 5, time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	h := NewMessageHandler(store)
+	ctx := context.Background()
+
+	resp, err := h(ctx, messageReq("/messages", map[string]string{"limit": "2"}, true))
+	require.NoError(t, err)
+	page := decodePage(t, resp)
+	assert.Equal(t, []string{recs[4].RequestID, recs[3].RequestID}, requestIDs(page))
+	assert.Equal(t, "acme", page.Messages[0].Sender)
+	assert.Empty(t, page.Messages[0].Channel)
+	assert.Equal(t, "lims", page.Messages[1].Channel)
+	assert.Equal(t, http.MethodPut, page.Messages[0].Method)
+	assert.Nil(t, page.Messages[0].Payload, "listings leave payloads out")
+	require.NotEmpty(t, page.NextCursor)
+
+	var seen []string
+	for page.NextCursor != "" {
+		resp, err = h(ctx, messageReq("/messages", map[string]string{"limit": "2", "cursor": page.NextCursor}, true))
+		require.NoError(t, err)
+		page = decodePage(t, resp)
+		seen = append(seen, requestIDs(page)...)
+	}
+	assert.Equal(t, []string{recs[2].RequestID, recs[1].RequestID, recs[0].RequestID}, seen)
+}
+
+func TestMessageHandler_ListFilters(t *testing.T) {
+	aws.AwsOnce.Do(func() {})
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	store, recs := seedMessages(t, 6, start)
+	h := NewMessageHandler(store)
+
+	for name, tc := range map[string]struct {
+		params map[string]string
+		want   []models.IncomingWebhook
+	}{
+		"sender":  {map[string]string{"sender": "acme"}, []models.IncomingWebhook{recs[4], recs[2], recs[0]}},
+		"method":  {map[string]string{"method": "post"}, []models.IncomingWebhook{recs[5], recs[3], recs[1]}},
+		"channel": {map[string]string{"channel": "lims"}, []models.IncomingWebhook{recs[3], recs[0]}},
+		"time range": {map[string]string{
+			"since": start.Add(2 * time.Minute).Format(time.RFC3339),
+			"until": start.Add(4 * time.Minute).Format(time.RFC3339),
+		}, []models.IncomingWebhook{recs[3], recs[2]}},
+		"status":         {map[string]string{"status": "received"}, []models.IncomingWebhook{recs[5], recs[4], recs[3], recs[2], recs[1], recs[0]}},
+		"payload":        {map[string]string{"payload.event": "ping", "payload.n": "3"}, []models.IncomingWebhook{recs[3]}},
+		"nested payload": {map[string]string{"payload.repo.name": "r2"}, []models.IncomingWebhook{recs[2]}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := h(context.Background(), messageReq("/messages", tc.params, true))
+			require.NoError(t, err)
+			var want []string
+			for _, rec := range tc.want {
+				want = append(want, rec.RequestID)
+			}
+			assert.Equal(t, want, requestIDs(decodePage(t, resp)))
+		})
+	}
+}
+
+func TestMessageHandler_ListRejectsBadFilters(t *testing.T) {
+	aws.AwsOnce.Do(func() {})
+	store, _ := seedMessages(t, 1, time.Now())
+	h := NewMessageHandler(store)
+
+	for _, params := range []map[string]string{
+		{"since": "yesterday"},
+		{"sender": "nobody"},
+		{"channel": "nowhere"},
+		{"cursor": "!!"},
+		{"status": "done"},
+		{"payload..x": "1"},
+	} {
+		resp, err := h(context.Background(), messageReq("/messages", params, true))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, params)
+	}
+}
+
+func TestMessageHandler_GetAndDownload(t *testing.T) {
+	aws.AwsOnce.Do(func() {})
+	store, recs := seedMessages(t, 2, time.Now())
+	h := NewMessageHandler(store)
+	ctx := context.Background()
+
+	resp, err := h(ctx, messageReq("/messages/"+recs[0].RequestID, nil, true))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var msg models.StoredMessage
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &msg))
+	assert.Equal(t, recs[0].RequestID, msg.RequestID)
+	assert.Equal(t, "acme", msg.Sender)
+	assert.JSONEq(t, string(recs[0].Payload), string(msg.Payload))
+
+	resp, err = h(ctx, messageReq("/messages/"+recs[1].RequestID+"/payload", nil, true))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, string(recs[1].Payload), resp.Body)
+	assert.Contains(t, resp.Headers["Content-Disposition"], recs[1].RequestID+".json")
+
+	for _, path := range []string{"/messages/00000000-0000-4000-8000-999999999999", "/messages/not-a-uuid", "/messages/x/y/z",
+		"/messages/" + recs[0].RequestID + "/other"} {
+		resp, err = h(ctx, messageReq(path, nil, true))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+}
+
+func TestMessageHandler_DownloadRawBody(t *testing.T) {
+	aws.AwsOnce.Do(func() {})
+	store, recs := seedMessages(t, 1, time.Now())
+	form, err := store.InsertWebhookMessage(context.Background(), models.IncomingWebhook{
+		RequestID: "00000000-0000-4000-8000-000000000100",
+		Payload:   []byte(`{"run": "17"}`),
+		RawBody:   []byte("run=17"),
+		Request:   models.RequestMetadata{ContentType: "application/x-www-form-urlencoded"},
+	})
+	require.NoError(t, err)
+	binary, err := store.InsertWebhookMessage(context.Background(), models.IncomingWebhook{
+		RequestID: "00000000-0000-4000-8000-000000000101",
+		Payload:   []byte(`{"text": "\ufffd"}`),
+		RawBody:   []byte{0xff},
+		Request:   models.RequestMetadata{ContentType: "text/plain"},
+	})
+	require.NoError(t, err)
+	h := NewMessageHandler(store)
+
+	for _, tc := range []struct {
+		rec         models.IncomingWebhook
+		contentType string
+		body        string
+		base64      bool
+	}{
+		{form, "application/x-www-form-urlencoded", "run=17", false},
+		{binary, "text/plain", "/w==", true},
+		{recs[0], "application/json", string(recs[0].Payload), false},
+	} {
+		resp, err := h(context.Background(), messageReq("/messages/"+tc.rec.RequestID+"/raw", nil, true))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, tc.contentType, resp.Headers["Content-Type"])
+		assert.Equal(t, tc.body, resp.Body)
+		assert.Equal(t, tc.base64, resp.IsBase64Encoded)
+	}
+}
@@ -23,7 +23,15 @@ const (
 	maxNotificationsLimit     = 200
 )
 
-// NotificationHandler serves the user subscription and notification
+// NotificationHandler is the notification API wired to the shared Postgres
+// pool.
+var NotificationHandler = NewNotificationHandler(db.Postgres{})
+
+type notificationHandler struct {
+	store db.NotificationStore
+}
+
+// NewNotificationHandler serves the user subscription and notification
 // retrieval API described in terraform/notification-service.yml.
 //
 // NOTE: unlike WebhookHandler (shared-secret, internal-only), these routes
@@ -31,12 +39,17 @@ const (
 // Pennsieve Lambda REQUEST authorizer attached to the API Gateway route,
 // surfaced here as the "user_claim" context key on
 // req.RequestContext.Authorizer.Lambda.
-func NotificationHandler(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+func NewNotificationHandler(store db.NotificationStore) func(context.Context, events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	h := &notificationHandler{store: store}
+	return h.handle
+}
+
+func (h *notificationHandler) handle(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
 	aws.AwsOnce.Do(func() {
 		aws.InitAWS(ctx)
 	})
 
-	if err := db.EnsureDB(ctx); err != nil {
+	if err := h.store.Ready(ctx); err != nil {
 		log.Printf("ERROR db init: %v", err)
 		return notifErrorResponse(http.StatusInternalServerError, "database unavailable"), nil
 	}
@@ -52,22 +65,22 @@ func NotificationHandler(ctx context.Context, req events.APIGatewayV2HTTPRequest
 
 	switch {
 	case method == http.MethodGet && path == "/notification/topics":
-		return handleGetTopics(ctx)
+		return h.handleGetTopics(ctx)
 	case method == http.MethodGet && path == "/notification/subscriptions":
-		return handleGetSubscriptions(ctx, userID)
+		return h.handleGetSubscriptions(ctx, userID)
 	case method == http.MethodPost && strings.HasPrefix(path, "/notification/subscriptions/"):
-		return handleSubscribe(ctx, userID, req)
+		return h.handleSubscribe(ctx, userID, req)
 	case method == http.MethodDelete && strings.HasPrefix(path, "/notification/subscriptions/"):
-		return handleUnsubscribe(ctx, userID, req)
+		return h.handleUnsubscribe(ctx, userID, req)
 	case method == http.MethodGet && strings.HasPrefix(path, "/notification/") && strings.HasSuffix(path, "/notifications"):
-		return handleGetTopicNotifications(ctx, userID, req)
+		return h.handleGetTopicNotifications(ctx, userID, req)
 	default:
 		return notifErrorResponse(http.StatusNotFound, "not found"), nil
 	}
 }
 
-func handleGetTopics(ctx context.Context) (events.APIGatewayV2HTTPResponse, error) {
-	topics, err := db.GetTopics(ctx)
+func (h *notificationHandler) handleGetTopics(ctx context.Context) (events.APIGatewayV2HTTPResponse, error) {
+	topics, err := h.store.GetTopics(ctx)
 	if err != nil {
 		log.Printf("ERROR get topics: %v", err)
 		return notifErrorResponse(http.StatusInternalServerError, "failed to fetch topics"), nil
@@ -75,8 +88,8 @@ func handleGetTopics(ctx context.Context) (events.APIGatewayV2HTTPResponse, erro
 	return notifJSONResponse(http.StatusOK, nonNilTopics(topics)), nil
 }
 
-func handleGetSubscriptions(ctx context.Context, userID int64) (events.APIGatewayV2HTTPResponse, error) {
-	subs, err := db.GetUserSubscriptions(ctx, userID)
+func (h *notificationHandler) handleGetSubscriptions(ctx context.Context, userID int64) (events.APIGatewayV2HTTPResponse, error) {
+	subs, err := h.store.GetUserSubscriptions(ctx, userID)
 	if err != nil {
 		log.Printf("ERROR get user subscriptions: %v", err)
 		return notifErrorResponse(http.StatusInternalServerError, "failed to fetch subscriptions"), nil
@@ -84,7 +97,7 @@ func handleGetSubscriptions(ctx context.Context, userID int64) (events.APIGatewa
 	return notifJSONResponse(http.StatusOK, nonNilSubscriptions(subs)), nil
 }
 
-func handleSubscribe(ctx context.Context, userID int64, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+func (h *notificationHandler) handleSubscribe(ctx context.Context, userID int64, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
 	topicID, err := pathParamInt64(req, "topicId", 2)
 	if err != nil {
 		return notifErrorResponse(http.StatusBadRequest, "invalid topic id"), nil
@@ -99,7 +112,7 @@ func handleSubscribe(ctx context.Context, userID int64, req events.APIGatewayV2H
 		}
 	}
 
-	sub, created, err := db.CreateSubscription(ctx, userID, topicID, body.Context)
+	sub, created, err := h.store.CreateSubscription(ctx, userID, topicID, body.Context)
 	if err != nil {
 		if errors.Is(err, db.ErrTopicNotFound) {
 			return notifErrorResponse(http.StatusNotFound, "topic not found"), nil
@@ -114,13 +127,13 @@ func handleSubscribe(ctx context.Context, userID int64, req events.APIGatewayV2H
 	return notifJSONResponse(statusCode, sub), nil
 }
 
-func handleUnsubscribe(ctx context.Context, userID int64, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+func (h *notificationHandler) handleUnsubscribe(ctx context.Context, userID int64, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
 	subscriptionID, err := pathParamInt64(req, "subscriptionId", 2)
 	if err != nil {
 		return notifErrorResponse(http.StatusBadRequest, "invalid subscription id"), nil
 	}
 
-	deleted, err := db.DeleteSubscription(ctx, subscriptionID, userID)
+	deleted, err := h.store.DeleteSubscription(ctx, subscriptionID, userID)
 	if err != nil {
 		log.Printf("ERROR delete subscription: %v", err)
 		return notifErrorResponse(http.StatusInternalServerError, "failed to delete subscription"), nil
@@ -131,13 +144,13 @@ func handleUnsubscribe(ctx context.Context, userID int64, req events.APIGatewayV
 	return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusNoContent}, nil
 }
 
-func handleGetTopicNotifications(ctx context.Context, userID int64, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+func (h *notificationHandler) handleGetTopicNotifications(ctx context.Context, userID int64, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
 	topicID, err := pathParamInt64(req, "topicId", 1)
 	if err != nil {
 		return notifErrorResponse(http.StatusBadRequest, "invalid topic id"), nil
 	}
 
-	exists, err := db.TopicExists(ctx, topicID)
+	exists, err := h.store.TopicExists(ctx, topicID)
 	if err != nil {
 		log.Printf("ERROR topic exists: %v", err)
 		return notifErrorResponse(http.StatusInternalServerError, "failed to fetch notifications"), nil
@@ -148,7 +161,7 @@ func handleGetTopicNotifications(ctx context.Context, userID int64, req events.A
 
 	limit, offset := parsePagination(req.QueryStringParameters)
 
-	notifications, err := db.GetTopicNotifications(ctx, topicID, userID, limit, offset)
+	notifications, err := h.store.GetTopicNotifications(ctx, topicID, userID, limit, offset)
 	if err != nil {
 		log.Printf("ERROR get topic notifications: %v", err)
 		return notifErrorResponse(http.StatusInternalServerError, "failed to fetch notifications"), nil
@@ -159,15 +172,25 @@ func handleGetTopicNotifications(ctx context.Context, userID int64, req events.A
 // authenticatedUserID extracts the caller's user id from the "user_claim"
 // context key attached by the shared Pennsieve Lambda authorizer.
 func authenticatedUserID(req events.APIGatewayV2HTTPRequest) (int64, error) {
+	claim, err := authenticatedUser(req)
+	if err != nil {
+		return 0, err
+	}
+	return claim.Id, nil
+}
+
+// authenticatedUser returns the caller's "user_claim", as attached by the
+// shared Pennsieve Lambda authorizer.
+func authenticatedUser(req events.APIGatewayV2HTTPRequest) (*authorizer.UserClaim, error) {
 	auth := req.RequestContext.Authorizer
 	if auth == nil || auth.Lambda == nil {
-		return 0, fmt.Errorf("no lambda authorizer context")
+		return nil, fmt.Errorf("no lambda authorizer context")
 	}
 	claims := authorizer.ParseClaims(auth.Lambda)
 	if claims == nil || claims.UserClaim == nil {
-		return 0, fmt.Errorf("missing user_claim")
+		return nil, fmt.Errorf("missing user_claim")
 	}
-	return claims.UserClaim.Id, nil
+	return claims.UserClaim, nil
 }
 
 // pathParamInt64 reads a path parameter by key, falling back to the
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"regexp"
 	"testing"
@@ -472,3 +473,55 @@ func TestNotificationHandler_NotFoundRoute(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
+
+func TestNewNotificationHandler_SubscribeAndList(t *testing.T) {
+	aws.AwsOnce.Do(func() {})
+	store := db.NewMemory()
+	topic := store.AddTopic("datasets", "dataset events")
+	h := NewNotificationHandler(store)
+	ctx := context.Background()
+	topicPath := fmt.Sprintf("/notification/subscriptions/%d", topic.TopicID)
+	params := map[string]string{"topicId": fmt.Sprint(topic.TopicID)}
+
+	resp, err := h(ctx, authedNotifReq(http.MethodPost, topicPath, params, 7))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var sub models.Subscription
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &sub))
+
+	resp, err = h(ctx, authedNotifReq(http.MethodPost, topicPath, params, 7))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "repeat subscribe is an upsert")
+
+	store.AddNotification(sub.SubscriptionID, "updated", "dataset updated", nil)
+	notifPath := fmt.Sprintf("/notification/%d/notifications", topic.TopicID)
+	resp, err = h(ctx, authedNotifReq(http.MethodGet, notifPath, params, 7))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var notifications []models.Notification
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &notifications))
+	require.Len(t, notifications, 1)
+	assert.Equal(t, "updated", notifications[0].Title)
+
+	resp, err = h(ctx, authedNotifReq(http.MethodGet, notifPath, params, 8))
+	require.NoError(t, err)
+	assert.JSONEq(t, `[]`, resp.Body, "other users see none of it")
+
+	unsubPath := fmt.Sprintf("/notification/subscriptions/%d", sub.SubscriptionID)
+	unsubParams := map[string]string{"subscriptionId": fmt.Sprint(sub.SubscriptionID)}
+	resp, err = h(ctx, authedNotifReq(http.MethodDelete, unsubPath, unsubParams, 8))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, err = h(ctx, authedNotifReq(http.MethodDelete, unsubPath, unsubParams, 7))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestNewNotificationHandler_StoreUnavailable(t *testing.T) {
+	aws.AwsOnce.Do(func() {})
+	h := NewNotificationHandler(unavailableStore{db.NewMemory()})
+
+	resp, err := h(context.Background(), authedNotifReq(http.MethodGet, "/notification/topics", nil, 7))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
@@ -2,20 +2,28 @@ package handler
 
 import (
 	"context"
-	"crypto/subtle"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/challenge"
+	"github.com/Pennsieve/integration-service/internal/config"
 	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/idempotency"
+	"github.com/Pennsieve/integration-service/internal/jsonschema"
 	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/Pennsieve/integration-service/internal/payload"
+	"github.com/Pennsieve/integration-service/internal/ratelimit"
+	"github.com/Pennsieve/integration-service/internal/redact"
+	"github.com/Pennsieve/integration-service/internal/sender_auth"
+	"github.com/Pennsieve/integration-service/internal/signature"
 	"github.com/aws/aws-lambda-go/events"
 
 	cryptorand "crypto/rand"
@@ -29,141 +37,589 @@ var allowedMethods = map[string]bool{
 	http.MethodDelete: true,
 }
 
-var env = os.Getenv("ENV")
-
 const (
-	// sharedSecretHeaderName is the HTTP header senders must set with a
-	// pre-shared secret. Requests missing it or presenting the wrong value
-	// are discarded before any DB work happens.
+	// sharedSecretHeaderName is the HTTP header senders must set with
+	// their secret. Requests missing it or presenting an unknown value are
+	// discarded before any message is stored.
 	sharedSecretHeaderName = "X-Pennsieve-Webhook-Secret"
 
+	// secretMatchHeaderName tells a sender which of its secrets matched,
+	// so it can confirm a rotation: "current", "previous" or "legacy".
+	secretMatchHeaderName = "X-Pennsieve-Secret-Match"
+
+	// senderQueryParam names the sender of a signed request, which
+	// carries no secret to identify it by.
+	senderQueryParam = "sender"
+
 	// maxPayloadBytes bounds the raw (still-possibly-base64-encoded) request
 	// body. Checked before base64 decoding so an oversized body is rejected
-	// without spending CPU/memory decoding it first.
+	// without spending CPU/memory decoding it first. It bounds the body
+	// again once decompressed. A channel sets its own limit.
 	maxPayloadBytes = 1 << 20 // 1 MiB
 
-	// maxRequestsPerSender/senderRateLimitWindow bound how often a single
-	// source IP may successfully reach the DB within a sliding window.
-	maxRequestsPerSender  = 60
-	senderRateLimitWindow = time.Minute
-)
-
-var (
-	webhookSecretOnce sync.Once
-	webhookSecret     string
-	webhookSecretErr  error
+	// channelPathSegment precedes the channel name in a routed channel's
+	// path, /webhook/{channel}.
+	channelPathSegment = "webhook"
 )
 
-// setSharedSecretForTest overrides the cached webhook shared secret,
-// bypassing SSM. Mirrors db.SetPoolForTest.
+// setSharedSecretForTest installs a configuration holding only the webhook
+// shared secret, bypassing SSM. Mirrors db.SetPoolForTest.
 func setSharedSecretForTest(secret string) {
-	webhookSecretOnce = sync.Once{}
-	webhookSecretOnce.Do(func() {
-		webhookSecret = secret
-		webhookSecretErr = nil
-	})
+	config.SetForTest(config.NewForTest(config.Config{}, map[string]string{
+		config.KeyWebhookSharedSecret: secret,
+	}))
 }
 
-// ensureWebhookSecret fetches the shared secret once per Lambda execution
-// environment and caches it, following the same pattern as db.EnsureDB.
-func ensureWebhookSecret(ctx context.Context) (string, error) {
-	webhookSecretOnce.Do(func() {
-		webhookSecret, webhookSecretErr = aws.GetSSMParam(ctx, fmt.Sprintf("/%s/integration-service/webhook-shared-secret", env), true)
-	})
-	return webhookSecret, webhookSecretErr
+// legacySharedSecrets returns the values of the deprecated global shared
+// secret: the current one and, during a rotation, the previous one, each
+// with its expiry. They are refetched from their source once the cached
+// values are older than the configured secret TTL so a rotation reaches
+// warm Lambdas without a redeploy.
+func legacySharedSecrets(ctx context.Context) ([]sender_auth.LegacySecret, error) {
+	cfg, err := config.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := cfg.WebhookSharedSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]sender_auth.LegacySecret, len(secrets))
+	for i, s := range secrets {
+		res[i] = sender_auth.LegacySecret{Value: s.Value, Expires: s.Expires, Previous: s.Previous}
+	}
+	return res, nil
 }
 
-// hasValidSharedSecret reports whether the request carries the expected
-// shared secret. Header lookup is case-insensitive since API Gateway/Lambda
-// event payloads don't guarantee a particular header key casing.
-func hasValidSharedSecret(ctx context.Context, headers map[string]string) bool {
-	expected, err := ensureWebhookSecret(ctx)
-	if err != nil || expected == "" {
-		log.Printf("ERROR webhook shared secret unavailable: %v", err)
-		return false
+// senderSigningSecret returns the named sender's HMAC signing secret,
+// cached and refetched like the shared secret.
+func senderSigningSecret(ctx context.Context, sender string) (string, error) {
+	cfg, err := config.Get(ctx)
+	if err != nil {
+		return "", err
 	}
+	return cfg.SenderSigningSecret(sender).Get(ctx)
+}
 
-	var provided string
+// headerValue looks a header up case-insensitively, since API
+// Gateway/Lambda event payloads don't guarantee a particular header key
+// casing.
+func headerValue(headers map[string]string, name string) string {
 	for k, v := range headers {
-		if strings.EqualFold(k, sharedSecretHeaderName) {
-			provided = v
-			break
+		if strings.EqualFold(k, name) {
+			return v
 		}
 	}
-	if provided == "" {
-		return false
+	return ""
+}
+
+// WebhookOptions configures the receiver.
+type WebhookOptions struct {
+	// RateLimit assigns requests to token buckets and sizes them.
+	RateLimit ratelimit.Policy
+	// IdempotencyWindow is how long an Idempotency-Key is remembered; 0
+	// ignores the header.
+	IdempotencyWindow time.Duration
+	// RedactHeaders are header names redacted from stored requests on top
+	// of redact.DefaultHeaders.
+	RedactHeaders []string
+}
+
+// DefaultWebhookOptions are the receiver's options when nothing is
+// configured.
+func DefaultWebhookOptions() WebhookOptions {
+	return WebhookOptions{RateLimit: ratelimit.DefaultPolicy(), IdempotencyWindow: idempotency.DefaultWindow}
+}
+
+// WebhookHandler is the receiver wired to the shared Postgres pool with the
+// default options.
+var WebhookHandler = NewWebhookHandler(db.Postgres{}, DefaultWebhookOptions())
+
+type webhookHandler struct {
+	stores  db.ReceiverStore
+	auth    *sender_auth.Authenticator
+	opts    WebhookOptions
+	now     func() time.Time
+	schemas schemaCache
+}
+
+// NewWebhookHandler returns the Lambda Function URL handler for the inbound
+// webhook receiver. Requests are authenticated against the senders in
+// stores, by secret (or the legacy shared secret) or by signature, drawn
+// from the token buckets opts.RateLimit assigns, and stored attributed to
+// their sender. Signed requests are accepted once per nonce, and requests
+// with an Idempotency-Key once per key and sender.
+func NewWebhookHandler(stores db.ReceiverStore, opts WebhookOptions) func(context.Context, events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	h := &webhookHandler{
+		stores: stores,
+		auth:   sender_auth.NewAuthenticator(stores, legacySharedSecrets, senderSigningSecret),
+		opts:   opts,
+		now:    time.Now,
 	}
-	return subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) == 1
+	return h.handle
 }
 
-func WebhookHandler(ctx context.Context, req events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+func (h *webhookHandler) handle(ctx context.Context, req events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
 	aws.AwsOnce.Do(func() {
 		aws.InitAWS(ctx)
 	})
 
+	// A channel's policy decides the method and size checks, so its
+	// requests pass the pre-authentication limit before they are made.
+	var channel models.Channel
+	name := channelName(req.RawPath)
+	if name != "" {
+		if resp, ok := h.preAuth(ctx, req); !ok {
+			return resp, nil
+		}
+		var (
+			resp events.LambdaFunctionURLResponse
+			ok   bool
+		)
+		if channel, resp, ok = h.lookupChannel(ctx, name); !ok {
+			return resp, nil
+		}
+	}
+
 	method := req.RequestContext.HTTP.Method
-	if !allowedMethods[method] {
+	allowed, limit := allowedMethods[method], maxPayloadBytes
+	if channel.ID != 0 {
+		allowed, limit = channel.AllowsMethod(method), channel.MaxPayloadBytes
+	}
+	// GET is only accepted for endpoint handshakes, checked below, which
+	// name their sender.
+	handshake := method == http.MethodGet && req.QueryStringParameters[senderQueryParam] != ""
+	if !allowed && !handshake {
 		return errorResponse(http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", method)), nil
 	}
 
-	if !hasValidSharedSecret(ctx, req.Headers) {
-		return errorResponse(http.StatusUnauthorized, "invalid or missing shared secret"), nil
+	if len(req.Body) > limit {
+		return errorResponse(http.StatusRequestEntityTooLarge, "payload too large"), nil
 	}
 
-	if len(req.Body) > maxPayloadBytes {
-		return errorResponse(http.StatusRequestEntityTooLarge, "payload too large"), nil
+	body := req.Body
+	if req.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return errorResponse(http.StatusBadRequest, "invalid base64 body"), nil
+		}
+		body = string(decoded)
 	}
 
-	if err := db.EnsureDB(ctx); err != nil {
-		log.Printf("ERROR db init: %v", err)
-		return errorResponse(http.StatusInternalServerError, "database unavailable"), nil
+	if name == "" {
+		if resp, ok := h.preAuth(ctx, req); !ok {
+			return resp, nil
+		}
+	}
+
+	// ?sender= names the sender of a handshake or a signed request. It is
+	// looked up once, for both.
+	signerName := req.QueryStringParameters[senderQueryParam]
+	var named models.Sender
+	if signerName != "" {
+		var err error
+		named, err = h.stores.GetSenderByName(ctx, signerName)
+		if errors.Is(err, db.ErrSenderNotFound) {
+			named = models.Sender{}
+		} else if err != nil {
+			log.Printf("ERROR sender lookup: %v", err)
+			return errorResponse(http.StatusInternalServerError, "failed to process request"), nil
+		}
+	}
+
+	if resp, ok := answerChallenge(req, named, body); ok {
+		return resp, nil
+	}
+	if !allowed {
+		return errorResponse(http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", method)), nil
+	}
+
+	secret := headerValue(req.Headers, sharedSecretHeaderName)
+	var (
+		sender   models.Sender
+		match    sender_auth.Match
+		verified signature.Verified
+		err      error
+	)
+	signed := secret == "" && signerName != ""
+	if err := channelAccepts(channel, signed); err != nil {
+		return errorResponse(http.StatusUnauthorized, err.Error()), nil
+	}
+	if signed {
+		header := func(name string) string { return headerValue(req.Headers, name) }
+		sender, verified, err = h.auth.AuthenticateSenderSignature(ctx, named, header, []byte(body), sender_auth.ScopeWebhooksWrite, h.now())
+	} else {
+		sender, match, err = h.auth.Authenticate(ctx, secret, sender_auth.ScopeWebhooksWrite)
+	}
+	switch {
+	case errors.Is(err, sender_auth.ErrInvalidCredential), isSignatureError(err):
+		return errorResponse(http.StatusUnauthorized, err.Error()), nil
+	case errors.Is(err, sender_auth.ErrSenderDisabled), errors.Is(err, sender_auth.ErrMissingScope):
+		log.Printf("WARN rejected sender %s: %v", sender.Name, err)
+		return errorResponse(http.StatusForbidden, err.Error()), nil
+	case err != nil:
+		log.Printf("ERROR sender lookup: %v", err)
+		return errorResponse(http.StatusInternalServerError, "failed to process request"), nil
+	}
+	if match.IsLegacy() && channel.ID != 0 {
+		return errorResponse(http.StatusUnauthorized, "channels don't accept the legacy shared secret"), nil
+	}
+	if channel.ID != 0 && !channel.AcceptsSender(sender.Name) {
+		log.Printf("WARN rejected sender %s on channel %s: not bound to it", sender.Name, channel.Name)
+		return errorResponse(http.StatusForbidden, fmt.Sprintf("sender %s may not use channel %s", sender.Name, channel.Name)), nil
+	}
+	if match == sender_auth.MatchPrevious {
+		log.Printf("WARN sender %s used its previous secret, accepted until %s",
+			sender.Name, sender.PreviousSecretExpiresAt.Format(time.RFC3339))
+	}
+	if match == sender_auth.MatchLegacyPrevious {
+		ip, ua := req.RequestContext.HTTP.SourceIP, userAgent(req)
+		log.Printf("WARN a request from %s (%s) used the previous webhook shared secret", ip, ua)
+		if err := h.stores.RecordSharedSecretUse(ctx, ip, ua); err != nil {
+			log.Printf("ERROR record shared secret use: %v", err)
+		}
 	}
 
-	senderIP := req.RequestContext.HTTP.SourceIP
-	count, err := db.RecordSenderRequest(ctx, senderIP, senderRateLimitWindow)
+	decision, err := h.takeToken(ctx, req, sender, secret)
 	if err != nil {
 		log.Printf("ERROR sender rate limit check: %v", err)
 		return errorResponse(http.StatusInternalServerError, "failed to process request"), nil
 	}
-	if count > maxRequestsPerSender {
-		return errorResponse(http.StatusTooManyRequests, "rate limit exceeded"), nil
+	var resp events.LambdaFunctionURLResponse
+	if decision.Allowed {
+		resp = h.admit(ctx, req, sender, channel, signed, verified, body)
+	} else {
+		resp = errorResponse(http.StatusTooManyRequests, "rate limit exceeded")
 	}
+	for k, v := range decision.Headers() {
+		resp.Headers[k] = v
+	}
+	if match != "" {
+		resp.Headers[secretMatchHeaderName] = string(match)
+	}
+	return resp, nil
+}
+
+// answerChallenge answers req if it is the endpoint handshake of sender,
+// the one it names with ?sender= (the zero Sender if none). Handshakes
+// come before the provider has any credential to present, so they are
+// answered unauthenticated, but only for an active sender with a
+// challenge responder and only with the value the request carries. They
+// draw only from the source IP's pre-authentication bucket, so naming a
+// sender can't spend its quota, and they aren't stored.
+func answerChallenge(req events.LambdaFunctionURLRequest, sender models.Sender, body string) (events.LambdaFunctionURLResponse, bool) {
+	if sender.ID == 0 || len(sender.Challenge) == 0 || sender.Status != models.SenderActive {
+		return events.LambdaFunctionURLResponse{}, false
+	}
+	responder, err := challenge.Parse(string(sender.Challenge))
+	if err != nil {
+		log.Printf("ERROR sender %s challenge responder: %v", sender.Name, err)
+		return events.LambdaFunctionURLResponse{}, false
+	}
+	answer, ok := responder.Respond(challenge.Request{Query: req.QueryStringParameters, Body: []byte(body)})
+	if !ok {
+		return events.LambdaFunctionURLResponse{}, false
+	}
+
+	log.Printf("answered endpoint handshake for sender %s", sender.Name)
+	return events.LambdaFunctionURLResponse{
+		StatusCode: answer.StatusCode,
+		Headers: map[string]string{
+			"Content-Type":           answer.ContentType,
+			"X-Content-Type-Options": "nosniff",
+		},
+		Body: answer.Body,
+	}, true
+}
+
+// channelName returns the channel a request's path routes it to, "" for
+// /webhook itself.
+func channelName(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if n := len(segments); n >= 2 && segments[n-2] == channelPathSegment {
+		return segments[n-1]
+	}
+	return ""
+}
+
+// lookupChannel returns the active channel called name, or false and the
+// response to send: 404 for a channel that doesn't exist or is disabled.
+func (h *webhookHandler) lookupChannel(ctx context.Context, name string) (models.Channel, events.LambdaFunctionURLResponse, bool) {
+	channel, err := h.stores.GetChannelByName(ctx, name)
+	if errors.Is(err, db.ErrChannelNotFound) || err == nil && channel.Status != models.ChannelActive {
+		return models.Channel{}, errorResponse(http.StatusNotFound, fmt.Sprintf("unknown channel %q", name)), false
+	}
+	if err != nil {
+		log.Printf("ERROR channel lookup: %v", err)
+		return models.Channel{}, errorResponse(http.StatusInternalServerError, "failed to process request"), false
+	}
+	return channel, events.LambdaFunctionURLResponse{}, true
+}
 
+// channelAccepts reports whether channel takes a request with the given
+// kind of credential. /webhook takes either.
+func channelAccepts(channel models.Channel, signed bool) error {
+	switch {
+	case channel.Auth == models.ChannelAuthSecret && signed:
+		return fmt.Errorf("channel %s only accepts %s", channel.Name, sharedSecretHeaderName)
+	case channel.Auth == models.ChannelAuthSignature && !signed:
+		return fmt.Errorf("channel %s only accepts signed requests", channel.Name)
+	}
+	return nil
+}
+
+// schemaCache holds compiled channel schemas for the life of the Lambda
+// container, so a channel's schema is compiled once rather than on every
+// request. An entry is reused only for the channel version it was
+// compiled from: a channel that was set again has a new UpdatedAt.
+type schemaCache struct {
+	mu      sync.Mutex
+	entries map[int64]compiledSchema
+}
+
+type compiledSchema struct {
+	updatedAt time.Time
+	schema    *jsonschema.Schema
+}
+
+// compile returns channel's compiled JSON schema.
+func (c *schemaCache) compile(channel models.Channel) (*jsonschema.Schema, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[channel.ID]; ok && e.updatedAt.Equal(channel.UpdatedAt) {
+		return e.schema, nil
+	}
+	schema, err := jsonschema.Compile(channel.JSONSchema)
+	if err != nil {
+		return nil, err
+	}
+	if c.entries == nil {
+		c.entries = map[int64]compiledSchema{}
+	}
+	c.entries[channel.ID] = compiledSchema{updatedAt: channel.UpdatedAt, schema: schema}
+	return schema, nil
+}
+
+// isSignatureError reports a request whose signature didn't verify.
+func isSignatureError(err error) bool {
+	return errors.Is(err, signature.ErrMissingSignature) ||
+		errors.Is(err, signature.ErrInvalidSignature) ||
+		errors.Is(err, signature.ErrTimestampOutOfRange)
+}
+
+// preAuth readies the store and draws a token from the source IP's
+// pre-authentication bucket, before anything looks a sender or channel
+// up, so requests with bad or no credentials can't each cost a lookup
+// without limit. It returns false and the response to send if the store
+// is unavailable or the bucket is empty.
+func (h *webhookHandler) preAuth(ctx context.Context, req events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, bool) {
+	if err := h.stores.Ready(ctx); err != nil {
+		log.Printf("ERROR db init: %v", err)
+		return errorResponse(http.StatusInternalServerError, "database unavailable"), false
+	}
+	policy := h.opts.RateLimit
+	if policy.PreAuth.Limit <= 0 {
+		return events.LambdaFunctionURLResponse{}, true
+	}
+	decision, err := h.draw(ctx, policy.PreAuthKey(req.RequestContext.HTTP.SourceIP))
+	if err != nil {
+		log.Printf("ERROR pre-authentication rate limit check: %v", err)
+		return errorResponse(http.StatusInternalServerError, "failed to process request"), false
+	}
+	if decision.Allowed {
+		return events.LambdaFunctionURLResponse{}, true
+	}
+	resp := errorResponse(http.StatusTooManyRequests, "rate limit exceeded")
+	for k, v := range decision.Headers() {
+		resp.Headers[k] = v
+	}
+	return resp, false
+}
+
+// takeToken draws a token from the bucket the policy assigns to req.
+func (h *webhookHandler) takeToken(ctx context.Context, req events.LambdaFunctionURLRequest, sender models.Sender, secret string) (ratelimit.Decision, error) {
+	rl := ratelimit.Request{SourceIP: req.RequestContext.HTTP.SourceIP, Secret: secret}
+	if sender.ID != 0 {
+		rl.Sender = sender.Name
+	}
+	return h.draw(ctx, h.opts.RateLimit.Key(rl))
+}
+
+// draw takes a token from the bucket key under its quota.
+func (h *webhookHandler) draw(ctx context.Context, key string) (ratelimit.Decision, error) {
+	quota := h.opts.RateLimit.Quota(key)
+	tokens, allowed, err := h.stores.TakeRateLimitToken(ctx, key, quota.Limit, quota.RefillPerSecond())
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+	if !allowed {
+		log.Printf("WARN rate limit exceeded for %s (%s)", key, quota)
+	}
+	return ratelimit.Decision{Allowed: allowed, Quota: quota, Tokens: tokens}, nil
+}
+
+// admit stores a request that passed authentication and the rate limit,
+// at most once per Idempotency-Key and, for signed requests, per nonce.
+func (h *webhookHandler) admit(ctx context.Context, req events.LambdaFunctionURLRequest, sender models.Sender, channel models.Channel, signed bool, verified signature.Verified, body string) events.LambdaFunctionURLResponse {
+	meta := h.requestMetadata(req)
+	encoding := headerValue(req.Headers, "Content-Encoding")
+	store := func() models.WebhookResponse { return h.store(ctx, sender, channel, meta, encoding, body) }
+	if signed {
+		store = func() models.WebhookResponse {
+			return h.storeOnce(ctx, sender, channel, verified, meta, encoding, body)
+		}
+	}
+
+	key := headerValue(req.Headers, idempotency.HeaderName)
+	if key == "" || h.opts.IdempotencyWindow <= 0 {
+		r := store()
+		return jsonResponse(r.Code, r)
+	}
+	return h.storeIdempotent(ctx, sender, key, body, store)
+}
+
+// storeIdempotent runs store unless the sender already used key within
+// the idempotency window. A repeat gets the original request's response,
+// marked as replayed; reusing a key for a different body is an error. The
+// key is released if store fails, so the sender can retry with it.
+func (h *webhookHandler) storeIdempotent(ctx context.Context, sender models.Sender, key, body string, store func() models.WebhookResponse) events.LambdaFunctionURLResponse {
+	if err := idempotency.ValidateKey(key); err != nil {
+		return errorResponse(http.StatusBadRequest, err.Error())
+	}
+	hash := idempotency.BodyHash([]byte(body))
+	rec, reserved, err := h.stores.ReserveIdempotencyKey(ctx, sender.ID, key, hash, h.now().Add(h.opts.IdempotencyWindow))
+	if err != nil {
+		log.Printf("ERROR reserve idempotency key: %v", err)
+		return errorResponse(http.StatusInternalServerError, "failed to process request")
+	}
+	if !reserved {
+		switch {
+		case rec.BodyHash != "" && rec.BodyHash != hash:
+			return errorResponse(http.StatusUnprocessableEntity, idempotency.HeaderName+" was already used with a different payload")
+		case rec.StatusCode == 0:
+			return errorResponse(http.StatusConflict, "a request with this "+idempotency.HeaderName+" is still being processed")
+		}
+		resp := jsonResponse(rec.StatusCode, models.WebhookResponse{
+			RequestID:  rec.RequestID,
+			ReceivedAt: rec.ReceivedAt,
+			Code:       rec.StatusCode,
+			Message:    "accepted",
+		})
+		resp.Headers[idempotency.ReplayedHeaderName] = "true"
+		return resp
+	}
+
+	r := store()
+	if r.Code == http.StatusAccepted {
+		// If this fails the key stays in flight until it expires: repeats
+		// get 409 rather than storing a duplicate.
+		if err := h.stores.CompleteIdempotencyKey(ctx, sender.ID, key, r.RequestID, r.Code, r.ReceivedAt); err != nil {
+			log.Printf("ERROR complete idempotency key: %v", err)
+		}
+	} else if err := h.stores.ReleaseIdempotencyKey(ctx, sender.ID, key); err != nil {
+		log.Printf("ERROR release idempotency key: %v", err)
+	}
+	return jsonResponse(r.Code, r)
+}
+
+// storeOnce stores a signed request unless its nonce was seen before. The
+// nonce is released if the request isn't stored, so the sender's retry
+// isn't mistaken for a replay.
+func (h *webhookHandler) storeOnce(ctx context.Context, sender models.Sender, channel models.Channel, verified signature.Verified, meta models.RequestMetadata, encoding, body string) models.WebhookResponse {
+	fresh, err := h.stores.RecordNonce(ctx, sender.ID, verified.Nonce, verified.NonceExpires)
+	if err != nil {
+		log.Printf("ERROR record nonce: %v", err)
+		return failure(http.StatusInternalServerError, "failed to process request")
+	}
+	if !fresh {
+		log.Printf("WARN replayed request from sender %s", sender.Name)
+		return failure(http.StatusUnauthorized, "replayed request")
+	}
+
+	r := h.store(ctx, sender, channel, meta, encoding, body)
+	if r.Code != http.StatusAccepted {
+		if err := h.stores.ReleaseNonce(ctx, sender.ID, verified.Nonce); err != nil {
+			log.Printf("ERROR release nonce: %v", err)
+		}
+	}
+	return r
+}
+
+// userAgent is req's User-Agent, as Lambda reports it or as sent.
+func userAgent(req events.LambdaFunctionURLRequest) string {
+	if ua := req.RequestContext.HTTP.UserAgent; ua != "" {
+		return ua
+	}
+	return headerValue(req.Headers, "User-Agent")
+}
+
+// requestMetadata describes req for storage, with credentials redacted.
+func (h *webhookHandler) requestMetadata(req events.LambdaFunctionURLRequest) models.RequestMetadata {
+	return models.RequestMetadata{
+		Method:      req.RequestContext.HTTP.Method,
+		Headers:     redact.Headers(req.Headers, h.opts.RedactHeaders),
+		SourceIP:    req.RequestContext.HTTP.SourceIP,
+		UserAgent:   userAgent(req),
+		ContentType: headerValue(req.Headers, "Content-Type"),
+		QueryString: redact.Query(req.RawQueryString),
+	}
+}
+
+// store decodes and persists an admitted request. Bodies are decompressed
+// and converted only now, after authentication and the rate limit, so
+// unauthenticated callers can't make the receiver inflate anything;
+// signatures and idempotency keys cover the body as sent. A channel's
+// payloads must also match its JSON schema.
+func (h *webhookHandler) store(ctx context.Context, sender models.Sender, channel models.Channel, meta models.RequestMetadata, encoding, body string) models.WebhookResponse {
 	requestID, err := newUUID()
 	if err != nil {
 		log.Printf("ERROR uuid: %v", err)
-		return errorResponse(http.StatusInternalServerError, "failed to generate request id"), nil
+		return failure(http.StatusInternalServerError, "failed to generate request id")
 	}
 
-	body := req.Body
-	if req.IsBase64Encoded {
-		decoded, err := base64.StdEncoding.DecodeString(body)
-		if err != nil {
-			return errorResponse(http.StatusBadRequest, "invalid base64 body"), nil
-		}
-		body = string(decoded)
+	limit := maxPayloadBytes
+	if channel.ID != 0 {
+		limit = channel.MaxPayloadBytes
 	}
-	if body == "" {
-		body = "{}"
+	decoded, err := payload.Decode(meta.ContentType, encoding, []byte(body), limit)
+	switch {
+	case errors.Is(err, payload.ErrUnsupported):
+		return failure(http.StatusUnsupportedMediaType, err.Error())
+	case errors.Is(err, payload.ErrTooLarge):
+		return failure(http.StatusRequestEntityTooLarge, err.Error())
+	case err != nil:
+		return failure(http.StatusBadRequest, err.Error())
 	}
-	payload := []byte(body)
-	if !json.Valid(payload) {
-		return errorResponse(http.StatusBadRequest, "payload must be valid JSON"), nil
+	if len(channel.JSONSchema) > 0 {
+		schema, err := h.schemas.compile(channel)
+		if err != nil {
+			log.Printf("ERROR channel %s schema: %v", channel.Name, err)
+			return failure(http.StatusInternalServerError, "failed to process request")
+		}
+		if err := schema.Validate(decoded.JSON); err != nil {
+			return failure(http.StatusUnprocessableEntity, err.Error())
+		}
 	}
 
-	rec, err := db.InsertWebhookMessage(ctx, requestID, payload)
+	rec, err := h.stores.InsertWebhookMessage(ctx, models.IncomingWebhook{
+		RequestID: requestID,
+		SenderID:  sender.ID,
+		ChannelID: channel.ID,
+		Payload:   decoded.JSON,
+		RawBody:   decoded.Original,
+		Request:   meta,
+	})
 	if err != nil {
 		log.Printf("ERROR insert webhook message: %v", err)
-		return errorResponse(http.StatusInternalServerError, "failed to store webhook message"), nil
+		return failure(http.StatusInternalServerError, "failed to store webhook message")
 	}
 
-	resp := models.WebhookResponse{
+	return models.WebhookResponse{
 		RequestID:  rec.RequestID,
 		ReceivedAt: rec.ReceivedAt,
 		Code:       http.StatusAccepted,
 		Message:    "accepted",
 	}
-	return jsonResponse(http.StatusAccepted, resp), nil
 }
 
 func newUUID() (string, error) {
@@ -192,9 +648,13 @@ func jsonResponse(statusCode int, body interface{}) events.LambdaFunctionURLResp
 }
 
 func errorResponse(statusCode int, message string) events.LambdaFunctionURLResponse {
-	resp := models.WebhookResponse{
+	return jsonResponse(statusCode, failure(statusCode, message))
+}
+
+// failure is the body of an error response.
+func failure(statusCode int, message string) models.WebhookResponse {
+	return models.WebhookResponse{
 		Code:    statusCode,
 		Message: message,
 	}
-	return jsonResponse(statusCode, resp)
 }
@@ -1,7 +1,10 @@
 package handler
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -13,8 +16,15 @@ import (
 
 	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/Pennsieve/integration-service/internal/aws"
+	"github.com/Pennsieve/integration-service/internal/challenge"
+	"github.com/Pennsieve/integration-service/internal/config"
 	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/idempotency"
 	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/Pennsieve/integration-service/internal/ratelimit"
+	"github.com/Pennsieve/integration-service/internal/redact"
+	"github.com/Pennsieve/integration-service/internal/sender_auth"
+	"github.com/Pennsieve/integration-service/internal/signature"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -48,12 +58,44 @@ func lambdaReqBase64(method, body string) events.LambdaFunctionURLRequest {
 	return req
 }
 
+// expectPreAuthQuery sets up the sqlmock expectation for the source IP's
+// pre-authentication token, drawn before any sender lookup.
+func expectPreAuthQuery(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.rate_limit_buckets")).
+		WithArgs("preauth:203.0.113.10", ratelimit.DefaultPreAuthQuota.Limit, ratelimit.DefaultPreAuthQuota.RefillPerSecond()).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens", "allowed"}).AddRow(599, true))
+}
+
+// expectSenderLookup sets up the sqlmock expectation for the
+// webhooks.senders lookup, finding no registered sender so the request is
+// checked against the legacy shared secret.
+func expectSenderLookup(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhooks.senders WHERE secret_hash = $1")).
+		WillReturnRows(sqlmock.NewRows([]string{"sender_id", "name", "status", "scopes", "signature_scheme", "challenge", "created_at", "updated_at"}))
+}
+
 // expectRateLimitQuery sets up the sqlmock expectation for the
-// webhooks.sender_rate_limits upsert that every request past the shared
+// webhooks.rate_limit_buckets upsert that every request past the shared
 // secret and size checks must go through.
-func expectRateLimitQuery(mock sqlmock.Sqlmock, count int) {
-	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.sender_rate_limits")).
-		WillReturnRows(sqlmock.NewRows([]string{"request_count"}).AddRow(count))
+func expectRateLimitQuery(mock sqlmock.Sqlmock, tokens float64, allowed bool) {
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.rate_limit_buckets")).
+		WithArgs("ip:203.0.113.10", ratelimit.DefaultQuota.Limit, ratelimit.DefaultQuota.RefillPerSecond()).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens", "allowed"}).AddRow(tokens, allowed))
+}
+
+// expectMessageInsert sets up the sqlmock expectation for storing payload
+// from a lambdaReq with the given method, returning it as requestID.
+func expectMessageInsert(mock sqlmock.Sqlmock, method, payload, requestID string, now time.Time) {
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.messages")).
+		WithArgs(sqlmock.AnyArg(), nil, []byte(payload),
+			sql.NullString{String: method, Valid: true}, sqlmock.AnyArg(),
+			sql.NullString{String: "203.0.113.10", Valid: true},
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "request_id", "sender_id", "payload", "received_at",
+			"method", "headers", "source_ip", "user_agent", "content_type", "query_string",
+			"status", "attempts", "last_error", "next_attempt_at", "processed_at", "raw_body", "channel_id"}).
+			AddRow(1, requestID, nil, []byte(payload), now, method, nil, "203.0.113.10", nil, nil, nil,
+				"received", 0, nil, now, nil, nil, nil))
 }
 
 func TestNewUUID(t *testing.T) {
@@ -119,7 +161,9 @@ func TestWebhookHandler_InvalidJSON(t *testing.T) {
 	defer mockDB.Close()
 	db.SetPoolForTest(mockDB)
 	markAWSReady()
-	expectRateLimitQuery(mock, 1)
+	expectPreAuthQuery(mock)
+	expectSenderLookup(mock)
+	expectRateLimitQuery(mock, 59, true)
 
 	resp, err := WebhookHandler(context.Background(), lambdaReq(http.MethodPost, "not-json"))
 	require.NoError(t, err)
@@ -138,13 +182,10 @@ func TestWebhookHandler_EmptyBody(t *testing.T) {
 	markAWSReady()
 
 	now := time.Now()
-	expectRateLimitQuery(mock, 1)
-	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.messages")).
-		WithArgs(sqlmock.AnyArg(), []byte("{}")).
-		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "request_id", "payload", "received_at"}).
-				AddRow(1, "test-uuid", []byte("{}"), now),
-		)
+	expectPreAuthQuery(mock)
+	expectSenderLookup(mock)
+	expectRateLimitQuery(mock, 59, true)
+	expectMessageInsert(mock, http.MethodPost, "{}", "test-uuid", now)
 
 	resp, err := WebhookHandler(context.Background(), lambdaReq(http.MethodPost, ""))
 	require.NoError(t, err)
@@ -171,13 +212,10 @@ func TestWebhookHandler_Success(t *testing.T) {
 			now := time.Now()
 			reqID := fmt.Sprintf("uuid-%s", method)
 
-			expectRateLimitQuery(mock, 1)
-			mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.messages")).
-				WithArgs(sqlmock.AnyArg(), []byte(payload)).
-				WillReturnRows(
-					sqlmock.NewRows([]string{"id", "request_id", "payload", "received_at"}).
-						AddRow(1, reqID, []byte(payload), now),
-				)
+			expectPreAuthQuery(mock)
+			expectSenderLookup(mock)
+			expectRateLimitQuery(mock, 59, true)
+			expectMessageInsert(mock, method, payload, reqID, now)
 
 			resp, err := WebhookHandler(context.Background(), lambdaReq(method, payload))
 			require.NoError(t, err)
@@ -206,13 +244,10 @@ func TestWebhookHandler_Base64EncodedBody(t *testing.T) {
 	encoded := base64.StdEncoding.EncodeToString([]byte(payload))
 	now := time.Now()
 
-	expectRateLimitQuery(mock, 1)
-	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.messages")).
-		WithArgs(sqlmock.AnyArg(), []byte(payload)).
-		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "request_id", "payload", "received_at"}).
-				AddRow(1, "test-uuid", []byte(payload), now),
-		)
+	expectPreAuthQuery(mock)
+	expectSenderLookup(mock)
+	expectRateLimitQuery(mock, 59, true)
+	expectMessageInsert(mock, http.MethodPost, payload, "test-uuid", now)
 
 	resp, err := WebhookHandler(context.Background(), lambdaReqBase64(http.MethodPost, encoded))
 	require.NoError(t, err)
@@ -230,7 +265,6 @@ func TestWebhookHandler_Base64EncodedBody_Invalid(t *testing.T) {
 	defer mockDB.Close()
 	db.SetPoolForTest(mockDB)
 	markAWSReady()
-	expectRateLimitQuery(mock, 1)
 
 	resp, err := WebhookHandler(context.Background(), lambdaReqBase64(http.MethodPost, "not-valid-base64!!"))
 	require.NoError(t, err)
@@ -239,6 +273,7 @@ func TestWebhookHandler_Base64EncodedBody_Invalid(t *testing.T) {
 	var body models.WebhookResponse
 	require.NoError(t, json.Unmarshal([]byte(resp.Body), &body))
 	assert.Contains(t, body.Message, "invalid base64")
+	require.NoError(t, mock.ExpectationsWereMet(), "rejected before any database access")
 }
 
 // TestWebhookHandler_DBInsertFailure verifies a 500 is returned when the DB insert fails.
@@ -249,7 +284,9 @@ func TestWebhookHandler_DBInsertFailure(t *testing.T) {
 	db.SetPoolForTest(mockDB)
 	markAWSReady()
 
-	expectRateLimitQuery(mock, 1)
+	expectPreAuthQuery(mock)
+	expectSenderLookup(mock)
+	expectRateLimitQuery(mock, 59, true)
 	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.messages")).
 		WillReturnError(fmt.Errorf("connection reset"))
 
@@ -273,6 +310,7 @@ func TestWebhookHandler_MissingSharedSecret(t *testing.T) {
 
 	req := lambdaReq(http.MethodPost, `{"k":"v"}`)
 	delete(req.Headers, sharedSecretHeaderName)
+	expectPreAuthQuery(mock)
 
 	resp, err := WebhookHandler(context.Background(), req)
 	require.NoError(t, err)
@@ -280,7 +318,7 @@ func TestWebhookHandler_MissingSharedSecret(t *testing.T) {
 
 	var body models.WebhookResponse
 	require.NoError(t, json.Unmarshal([]byte(resp.Body), &body))
-	assert.Contains(t, body.Message, "shared secret")
+	assert.Contains(t, body.Message, "webhook secret")
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -293,6 +331,8 @@ func TestWebhookHandler_InvalidSharedSecret(t *testing.T) {
 
 	req := lambdaReq(http.MethodPost, `{"k":"v"}`)
 	req.Headers[sharedSecretHeaderName] = "wrong-secret"
+	expectPreAuthQuery(mock)
+	expectSenderLookup(mock)
 
 	resp, err := WebhookHandler(context.Background(), req)
 	require.NoError(t, err)
@@ -300,7 +340,7 @@ func TestWebhookHandler_InvalidSharedSecret(t *testing.T) {
 
 	var body models.WebhookResponse
 	require.NoError(t, json.Unmarshal([]byte(resp.Body), &body))
-	assert.Contains(t, body.Message, "shared secret")
+	assert.Contains(t, body.Message, "webhook secret")
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -310,16 +350,13 @@ func TestWebhookHandler_SharedSecretHeaderIsCaseInsensitive(t *testing.T) {
 	defer mockDB.Close()
 	db.SetPoolForTest(mockDB)
 	markAWSReady()
-	expectRateLimitQuery(mock, 1)
+	expectPreAuthQuery(mock)
+	expectSenderLookup(mock)
+	expectRateLimitQuery(mock, 59, true)
 
 	payload := `{"event":"test"}`
 	now := time.Now()
-	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO webhooks.messages")).
-		WithArgs(sqlmock.AnyArg(), []byte(payload)).
-		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "request_id", "payload", "received_at"}).
-				AddRow(1, "test-uuid", []byte(payload), now),
-		)
+	expectMessageInsert(mock, http.MethodPost, payload, "test-uuid", now)
 
 	req := lambdaReq(http.MethodPost, payload)
 	delete(req.Headers, sharedSecretHeaderName)
@@ -355,14 +392,750 @@ func TestWebhookHandler_RateLimitExceeded(t *testing.T) {
 	defer mockDB.Close()
 	db.SetPoolForTest(mockDB)
 	markAWSReady()
-	expectRateLimitQuery(mock, maxRequestsPerSender+1)
+	expectPreAuthQuery(mock)
+	expectSenderLookup(mock)
+	expectRateLimitQuery(mock, 0.5, false)
 
 	resp, err := WebhookHandler(context.Background(), lambdaReq(http.MethodPost, `{"k":"v"}`))
 	require.NoError(t, err)
 	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "60", resp.Headers["RateLimit-Limit"])
+	assert.Equal(t, "0", resp.Headers["RateLimit-Remaining"])
+	assert.Equal(t, "1", resp.Headers["Retry-After"])
 
 	var body models.WebhookResponse
 	require.NoError(t, json.Unmarshal([]byte(resp.Body), &body))
 	assert.Contains(t, body.Message, "rate limit")
 	require.NoError(t, mock.ExpectationsWereMet())
 }
+
+// unavailableStore embeds a working in-memory store but reports the
+// database as unreachable.
+type unavailableStore struct {
+	*db.Memory
+}
+
+func (unavailableStore) Ready(context.Context) error {
+	return fmt.Errorf("connection refused")
+}
+
+func TestNewWebhookHandler_StoresMessage(t *testing.T) {
+	markAWSReady()
+	store := db.NewMemory()
+	h := NewWebhookHandler(store, DefaultWebhookOptions())
+
+	resp, err := h(context.Background(), lambdaReq(http.MethodPost, `{"event":"ping"}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	var body models.WebhookResponse
+	require.NoError(t, json.Unmarshal([]byte(resp.Body), &body))
+	msgs := store.Messages()
+	require.Len(t, msgs, 1)
+	assert.Equal(t, body.RequestID, msgs[0].RequestID)
+	assert.JSONEq(t, `{"event":"ping"}`, string(msgs[0].Payload))
+}
+
+func TestNewWebhookHandler_RateLimitedBySender(t *testing.T) {
+	markAWSReady()
+	store := db.NewMemory()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.SetNow(func() time.Time { return now })
+	h := NewWebhookHandler(store, WebhookOptions{RateLimit: ratelimit.Policy{By: ratelimit.KeyByIP, Default: ratelimit.Quota{Limit: 3, Period: 30 * time.Second}}})
+
+	for want := 2; want >= 0; want-- {
+		resp, err := h(context.Background(), lambdaReq(http.MethodPost, `{}`))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Equal(t, "3", resp.Headers["RateLimit-Limit"])
+		assert.Equal(t, fmt.Sprint(want), resp.Headers["RateLimit-Remaining"])
+		assert.Empty(t, resp.Headers["Retry-After"])
+	}
+	resp, err := h(context.Background(), lambdaReq(http.MethodPost, `{}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "10", resp.Headers["Retry-After"], "one token refills every 10 seconds")
+	assert.Equal(t, "30", resp.Headers["RateLimit-Reset"])
+	assert.Len(t, store.Messages(), 3)
+
+	// Another sender has its own bucket.
+	other := lambdaReq(http.MethodPost, `{}`)
+	other.RequestContext.HTTP.SourceIP = "198.51.100.1"
+	resp, err = h(context.Background(), other)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	now = now.Add(10 * time.Second)
+	resp, err = h(context.Background(), lambdaReq(http.MethodPost, `{}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+}
+
+func TestNewWebhookHandler_RateLimitKeyedBySecretWithOverride(t *testing.T) {
+	markAWSReady()
+	store := db.NewMemory()
+	key := "secret:" + ratelimit.Fingerprint(testSharedSecret)
+	h := NewWebhookHandler(store, WebhookOptions{RateLimit: ratelimit.Policy{
+		By:        ratelimit.KeyBySecret,
+		Default:   ratelimit.DefaultQuota,
+		Overrides: map[string]ratelimit.Quota{key: {Limit: 1, Period: time.Minute}},
+	}})
+
+	req := lambdaReq(http.MethodPost, `{}`)
+	resp, err := h(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	// A different source IP presenting the same secret shares the bucket.
+	req.RequestContext.HTTP.SourceIP = "198.51.100.1"
+	resp, err = h(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, []string{key}, store.RateLimitKeys())
+}
+
+func TestNewWebhookHandler_StoreUnavailable(t *testing.T) {
+	markAWSReady()
+	store := db.NewMemory()
+	h := NewWebhookHandler(unavailableStore{store}, DefaultWebhookOptions())
+
+	resp, err := h(context.Background(), lambdaReq(http.MethodPost, `{}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Contains(t, resp.Body, "database unavailable")
+	assert.Empty(t, store.Messages())
+}
+
+func TestNewWebhookHandler_RegisteredSender(t *testing.T) {
+	markAWSReady()
+	ctx := context.Background()
+	store := db.NewMemory()
+	acme, err := store.CreateSender(ctx, "acme", sender_auth.HashSecret("acme-secret"), sender_auth.DefaultScopes)
+	require.NoError(t, err)
+	h := NewWebhookHandler(store, DefaultWebhookOptions())
+
+	req := lambdaReq(http.MethodPost, `{"event":"ping"}`)
+	req.Headers[sharedSecretHeaderName] = "acme-secret"
+	resp, err := h(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	msgs := store.Messages()
+	require.Len(t, msgs, 1)
+	assert.Equal(t, acme.ID, msgs[0].SenderID)
+	assert.Equal(t, []string{"preauth:203.0.113.10", "sender:acme"}, store.RateLimitKeys())
+
+	// The legacy shared secret still works, without a sender.
+	resp, err = h(ctx, lambdaReq(http.MethodPost, `{}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, int64(0), store.Messages()[1].SenderID)
+	assert.Equal(t, []string{"ip:203.0.113.10", "preauth:203.0.113.10", "sender:acme"}, store.RateLimitKeys())
+}
+
+func TestNewWebhookHandler_StoresRedactedRequestMetadata(t *testing.T) {
+	markAWSReady()
+	ctx := context.Background()
+	store := db.NewMemory()
+	h := NewWebhookHandler(store, WebhookOptions{
+		RateLimit:     ratelimit.DefaultPolicy(),
+		RedactHeaders: []string{"X-Partner-Key"},
+	})
+
+	req := lambdaReq(http.MethodPatch, `{"event":"ping"}`)
+	req.Headers["Content-Type"] = "application/json"
+	req.Headers["Authorization"] = "Bearer abc"
+	req.Headers["X-Partner-Key"] = "pk"
+	req.Headers["X-Github-Event"] = "push"
+	req.RequestContext.HTTP.UserAgent = "GitHub-Hookshot/1"
+	req.RawQueryString = "env=prod&token=abc"
+	resp, err := h(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	msgs := store.Messages()
+	require.Len(t, msgs, 1)
+	assert.Equal(t, models.RequestMetadata{
+		Method: http.MethodPatch,
+		Headers: map[string]string{
+			"x-pennsieve-webhook-secret": redact.Placeholder,
+			"content-type":               "application/json",
+			"authorization":              redact.Placeholder,
+			"x-partner-key":              redact.Placeholder,
+			"x-github-event":             "push",
+		},
+		SourceIP:    "203.0.113.10",
+		UserAgent:   "GitHub-Hookshot/1",
+		ContentType: "application/json",
+		QueryString: "env=prod&token=%5BREDACTED%5D",
+	}, msgs[0].Request)
+}
+
+func gzipBase64(t *testing.T, body string) string {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestNewWebhookHandler_ConvertsNonJSONBodies(t *testing.T) {
+	markAWSReady()
+	store := db.NewMemory()
+	h := NewWebhookHandler(store, DefaultWebhookOptions())
+
+	form := lambdaReqBase64(http.MethodPost, gzipBase64(t, "instrument=hplc-2&run=17"))
+	form.Headers["Content-Type"] = "application/x-www-form-urlencoded"
+	form.Headers["Content-Encoding"] = "gzip"
+	xmlReq := lambdaReq(http.MethodPost, `<run id="17"><status>done</status></run>`)
+	xmlReq.Headers["Content-Type"] = "text/xml; charset=utf-8"
+	for _, req := range []events.LambdaFunctionURLRequest{form, xmlReq} {
+		resp, err := h(context.Background(), req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusAccepted, resp.StatusCode, resp.Body)
+	}
+
+	msgs := store.Messages()
+	require.Len(t, msgs, 2)
+	assert.JSONEq(t, `{"instrument": "hplc-2", "run": "17"}`, string(msgs[0].Payload))
+	assert.Equal(t, "instrument=hplc-2&run=17", string(msgs[0].RawBody))
+	assert.JSONEq(t, `{"run": {"@id": "17", "status": "done"}}`, string(msgs[1].Payload))
+	assert.Equal(t, `<run id="17"><status>done</status></run>`, string(msgs[1].RawBody))
+}
+
+func TestNewWebhookHandler_RejectsUndecodableBodies(t *testing.T) {
+	markAWSReady()
+	store := db.NewMemory()
+	h := NewWebhookHandler(store, DefaultWebhookOptions())
+
+	unsupported := lambdaReq(http.MethodPost, "\x00\x01")
+	unsupported.Headers["Content-Type"] = "application/octet-stream"
+	brotli := lambdaReq(http.MethodPost, `{}`)
+	brotli.Headers["Content-Encoding"] = "br"
+	bomb := lambdaReqBase64(http.MethodPost, gzipBase64(t, `{"a":"`+strings.Repeat("0", maxPayloadBytes)+`"}`))
+	bomb.Headers["Content-Encoding"] = "gzip"
+	for req, want := range map[*events.LambdaFunctionURLRequest]int{
+		&unsupported: http.StatusUnsupportedMediaType,
+		&brotli:      http.StatusUnsupportedMediaType,
+		&bomb:        http.StatusRequestEntityTooLarge,
+	} {
+		require.Less(t, len(req.Body), maxPayloadBytes)
+		resp, err := h(context.Background(), *req)
+		require.NoError(t, err)
+		assert.Equal(t, want, resp.StatusCode, resp.Body)
+	}
+	assert.Empty(t, store.Messages())
+}
+
+func TestNewWebhookHandler_DisabledOrUnscopedSenderForbidden(t *testing.T) {
+	markAWSReady()
+	ctx := context.Background()
+	store := db.NewMemory()
+	_, err := store.CreateSender(ctx, "revoked", sender_auth.HashSecret("revoked-secret"), sender_auth.DefaultScopes)
+	require.NoError(t, err)
+	_, err = store.SetSenderStatus(ctx, "revoked", models.SenderDisabled)
+	require.NoError(t, err)
+	_, err = store.CreateSender(ctx, "reader", sender_auth.HashSecret("reader-secret"), []string{"webhooks:read"})
+	require.NoError(t, err)
+	h := NewWebhookHandler(store, DefaultWebhookOptions())
+
+	for secret, message := range map[string]string{"revoked-secret": "disabled", "reader-secret": "scope"} {
+		req := lambdaReq(http.MethodPost, `{}`)
+		req.Headers[sharedSecretHeaderName] = secret
+		resp, err := h(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Contains(t, resp.Body, message)
+	}
+	assert.Empty(t, store.Messages())
+	assert.Equal(t, []string{"preauth:203.0.113.10"}, store.RateLimitKeys(), "no sender bucket")
+}
+
+func TestNewWebhookHandler_RateLimitedPerSender(t *testing.T) {
+	markAWSReady()
+	ctx := context.Background()
+	store := db.NewMemory()
+	for _, name := range []string{"a", "b"} {
+		_, err := store.CreateSender(ctx, name, sender_auth.HashSecret(name+"-secret"), sender_auth.DefaultScopes)
+		require.NoError(t, err)
+	}
+	h := NewWebhookHandler(store, WebhookOptions{RateLimit: ratelimit.Policy{By: ratelimit.KeyBySender, Default: ratelimit.Quota{Limit: 1, Period: time.Minute}}})
+
+	send := func(secret, ip string) int {
+		req := lambdaReq(http.MethodPost, `{}`)
+		req.Headers[sharedSecretHeaderName] = secret
+		req.RequestContext.HTTP.SourceIP = ip
+		resp, err := h(ctx, req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusAccepted, send("a-secret", "10.0.0.1"))
+	assert.Equal(t, http.StatusTooManyRequests, send("a-secret", "10.0.0.2"), "a sender's bucket follows it across IPs")
+	assert.Equal(t, http.StatusAccepted, send("b-secret", "10.0.0.1"), "senders sharing an IP don't share a bucket")
+}
+
+// failingInserts embeds a working in-memory store but fails every insert.
+// countingLookups counts sender lookups by secret.
+type countingLookups struct {
+	*db.Memory
+	lookups int
+}
+
+func (c *countingLookups) GetSenderBySecretHash(ctx context.Context, hash string) (models.Sender, bool, error) {
+	c.lookups++
+	return c.Memory.GetSenderBySecretHash(ctx, hash)
+}
+
+func TestNewWebhookHandler_PreAuthLimitBoundsSenderLookups(t *testing.T) {
+	markAWSReady()
+	ctx := context.Background()
+	store := &countingLookups{Memory: db.NewMemory()}
+	policy := ratelimit.DefaultPolicy()
+	policy.PreAuth = ratelimit.Quota{Limit: 2, Period: time.Minute}
+	h := NewWebhookHandler(store, WebhookOptions{RateLimit: policy})
+
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		req := lambdaReq(http.MethodPost, `{}`)
+		req.Headers[sharedSecretHeaderName] = "guess-" + fmt.Sprint(i)
+		resp, err := h(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, want, resp.StatusCode, i)
+	}
+	assert.Equal(t, 2, store.lookups, "the throttled request looked nothing up")
+
+	resp, err := h(ctx, lambdaReq(http.MethodPost, `{}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "valid credentials share the source IP's bucket")
+	assert.NotEmpty(t, resp.Headers["Retry-After"])
+	assert.Equal(t, []string{"preauth:203.0.113.10"}, store.RateLimitKeys())
+}
+
+type failingInserts struct {
+	*db.Memory
+}
+
+func (failingInserts) InsertWebhookMessage(context.Context, models.IncomingWebhook) (models.IncomingWebhook, error) {
+	return models.IncomingWebhook{}, fmt.Errorf("connection reset")
+}
+
+// signedReq returns a request from sender signed with the pennsieve scheme.
+func signedReq(t *testing.T, sender, secret, body, nonce string) events.LambdaFunctionURLRequest {
+	t.Helper()
+	req := lambdaReq(http.MethodPost, body)
+	req.Headers = signature.Presets["pennsieve"].Sign([]byte(secret), []byte(body), nonce, time.Now())
+	req.QueryStringParameters = map[string]string{senderQueryParam: sender}
+	return req
+}
+
+func TestNewWebhookHandler_SignedRequest(t *testing.T) {
+	aws.AwsOnce.Do(func() {})
+	config.SetForTest(config.NewForTest(config.Config{}, map[string]string{
+		config.KeySenderSigningSecretPrefix + "acme": "acme-signing",
+	}))
+	defer markAWSReady()
+	ctx := context.Background()
+	store := db.NewMemory()
+	acme, err := store.CreateSender(ctx, "acme", sender_auth.HashSecret("acme-secret"), sender_auth.DefaultScopes)
+	require.NoError(t, err)
+	scheme, err := json.Marshal(signature.Presets["pennsieve"])
+	require.NoError(t, err)
+	_, err = store.SetSenderSignatureScheme(ctx, "acme", scheme)
+	require.NoError(t, err)
+	h := NewWebhookHandler(store, DefaultWebhookOptions())
+
+	req := signedReq(t, "acme", "acme-signing", `{"event":"ping"}`, "delivery-1")
+	resp, err := h(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode, resp.Body)
+	require.Len(t, store.Messages(), 1)
+	assert.Equal(t, acme.ID, store.Messages()[0].SenderID)
+	assert.Equal(t, []string{"preauth:203.0.113.10", "sender:acme"}, store.RateLimitKeys())
+
+	resp, err = h(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, resp.Body, "replayed request")
+
+	replayed := signedReq(t, "acme", "acme-signing", `{"event":"ping"}`, "delivery-1")
+	replayed.Headers["X-Pennsieve-Nonce"] = "delivery-9"
+	resp, err = h(ctx, replayed)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "a replay with a fresh nonce")
+
+	for name, bad := range map[string]events.LambdaFunctionURLRequest{
+		"wrong secret":   signedReq(t, "acme", "wrong", `{}`, "delivery-2"),
+		"unknown sender": signedReq(t, "nobody", "acme-signing", `{}`, "delivery-3"),
+	} {
+		resp, err = h(ctx, bad)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, name)
+		assert.Contains(t, resp.Body, "invalid signature", name)
+	}
+	assert.Len(t, store.Messages(), 1)
+}
+
+func TestNewWebhookHandler_SignedRequestRetriedAfterFailure(t *testing.T) {
+	aws.AwsOnce.Do(func() {})
+	config.SetForTest(config.NewForTest(config.Config{}, map[string]string{
+		config.KeySenderSigningSecretPrefix + "acme": "acme-signing",
+	}))
+	defer markAWSReady()
+	ctx := context.Background()
+	store := db.NewMemory()
+	_, err := store.CreateSender(ctx, "acme", sender_auth.HashSecret("acme-secret"), sender_auth.DefaultScopes)
+	require.NoError(t, err)
+	scheme, err := json.Marshal(signature.Presets["pennsieve"])
+	require.NoError(t, err)
+	_, err = store.SetSenderSignatureScheme(ctx, "acme", scheme)
+	require.NoError(t, err)
+
+	req := signedReq(t, "acme", "acme-signing", `{}`, "delivery-1")
+	resp, err := NewWebhookHandler(failingInserts{store}, DefaultWebhookOptions())(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	resp, err = NewWebhookHandler(store, DefaultWebhookOptions())(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode, "the failed delivery's nonce was released")
+}
+
+func TestNewWebhookHandler_SecretRotationOverlap(t *testing.T) {
+	markAWSReady()
+	ctx := context.Background()
+	store := db.NewMemory()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	store.SetNow(func() time.Time { return now })
+	_, err := store.CreateSender(ctx, "acme", sender_auth.HashSecret("old-secret"), sender_auth.DefaultScopes)
+	require.NoError(t, err)
+	_, err = store.RotateSenderSecret(ctx, "acme", sender_auth.HashSecret("new-secret"), now.Add(time.Hour))
+	require.NoError(t, err)
+	h := NewWebhookHandler(store, DefaultWebhookOptions())
+
+	send := func(secret string) events.LambdaFunctionURLResponse {
+		req := lambdaReq(http.MethodPost, `{}`)
+		req.Headers[sharedSecretHeaderName] = secret
+		resp, err := h(ctx, req)
+		require.NoError(t, err)
+		return resp
+	}
+	for secret, match := range map[string]string{"new-secret": "current", "old-secret": "previous", testSharedSecret: "legacy"} {
+		resp := send(secret)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode, secret)
+		assert.Equal(t, match, resp.Headers[secretMatchHeaderName], secret)
+	}
+
+	now = now.Add(time.Hour)
+	resp := send("old-secret")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "the overlap window has ended")
+	assert.Empty(t, resp.Headers[secretMatchHeaderName])
+}
+
+func TestNewWebhookHandler_SharedSecretRotationOverlap(t *testing.T) {
+	aws.AwsOnce.Do(func() {})
+	config.SetForTest(config.NewForTest(config.Config{}, map[string]string{
+		config.KeyWebhookSharedSecret:                "new-shared",
+		config.KeyWebhookSharedSecretPrevious:        "old-shared",
+		config.KeyWebhookSharedSecretPreviousExpires: time.Now().Add(time.Hour).Format(time.RFC3339),
+	}))
+	defer markAWSReady()
+	ctx := context.Background()
+	store := db.NewMemory()
+	h := NewWebhookHandler(store, DefaultWebhookOptions())
+
+	for secret, match := range map[string]string{"new-shared": "legacy", "old-shared": "legacy-previous"} {
+		req := lambdaReq(http.MethodPost, `{}`)
+		req.Headers[sharedSecretHeaderName] = secret
+		req.RequestContext.HTTP.UserAgent = "lims/2.1"
+		resp, err := h(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode, secret)
+		assert.Equal(t, match, resp.Headers[secretMatchHeaderName], secret)
+	}
+	uses, err := store.ListSharedSecretUses(ctx)
+	require.NoError(t, err)
+	require.Len(t, uses, 1, "only the previous secret's callers are recorded")
+	assert.Equal(t, "203.0.113.10", uses[0].SourceIP)
+	assert.Equal(t, "lims/2.1", uses[0].UserAgent)
+
+	config.SetForTest(config.NewForTest(config.Config{}, map[string]string{
+		config.KeyWebhookSharedSecret:                "new-shared",
+		config.KeyWebhookSharedSecretPrevious:        "old-shared",
+		config.KeyWebhookSharedSecretPreviousExpires: time.Now().Add(-time.Second).Format(time.RFC3339),
+	}))
+	req := lambdaReq(http.MethodPost, `{}`)
+	req.Headers[sharedSecretHeaderName] = "old-shared"
+	resp, err := h(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "the previous secret has expired")
+}
+
+func TestNewWebhookHandler_IdempotencyKey(t *testing.T) {
+	markAWSReady()
+	ctx := context.Background()
+	store := db.NewMemory()
+	_, err := store.CreateSender(ctx, "acme", sender_auth.HashSecret("acme-secret"), sender_auth.DefaultScopes)
+	require.NoError(t, err)
+	h := NewWebhookHandler(store, DefaultWebhookOptions())
+
+	send := func(secret, key, body string) (events.LambdaFunctionURLResponse, models.WebhookResponse) {
+		req := lambdaReq(http.MethodPost, body)
+		req.Headers[sharedSecretHeaderName] = secret
+		req.Headers["idempotency-key"] = key
+		resp, err := h(ctx, req)
+		require.NoError(t, err)
+		var out models.WebhookResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &out))
+		return resp, out
+	}
+
+	resp, first := send("acme-secret", "order-1", `{"n":1}`)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Empty(t, resp.Headers["Idempotent-Replayed"])
+
+	resp, repeat := send("acme-secret", "order-1", `{"n":1}`)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "true", resp.Headers["Idempotent-Replayed"])
+	assert.Equal(t, first.RequestID, repeat.RequestID)
+	assert.True(t, first.ReceivedAt.Equal(repeat.ReceivedAt))
+	assert.Len(t, store.Messages(), 1)
+
+	resp, _ = send("acme-secret", "order-1", `{"n":2}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, "same key, different body")
+
+	resp, other := send(testSharedSecret, "order-1", `{"n":1}`)
+	require.Equal(t, http.StatusAccepted, resp.StatusCode, "keys are scoped per sender")
+	assert.NotEqual(t, first.RequestID, other.RequestID)
+
+	resp, _ = send("acme-secret", "has space", `{}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Len(t, store.Messages(), 2)
+}
+
+func TestNewWebhookHandler_IdempotencyKeyInFlightOrFailed(t *testing.T) {
+	markAWSReady()
+	ctx := context.Background()
+	store := db.NewMemory()
+	req := lambdaReq(http.MethodPost, `{}`)
+	req.Headers[idempotency.HeaderName] = "order-1"
+
+	_, _, err := store.ReserveIdempotencyKey(ctx, 0, "order-1", idempotency.BodyHash([]byte(`{}`)), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	resp, err := NewWebhookHandler(store, DefaultWebhookOptions())(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode, "the first request is still being stored")
+	require.NoError(t, store.ReleaseIdempotencyKey(ctx, 0, "order-1"))
+
+	resp, err = NewWebhookHandler(failingInserts{store}, DefaultWebhookOptions())(ctx, req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	resp, err = NewWebhookHandler(store, DefaultWebhookOptions())(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode, "a failed request's key can be retried")
+	assert.Empty(t, resp.Headers[idempotency.ReplayedHeaderName])
+}
+
+func TestNewWebhookHandler_IdempotencyDisabled(t *testing.T) {
+	markAWSReady()
+	store := db.NewMemory()
+	h := NewWebhookHandler(store, WebhookOptions{RateLimit: ratelimit.DefaultPolicy()})
+	req := lambdaReq(http.MethodPost, `{}`)
+	req.Headers[idempotency.HeaderName] = "order-1"
+
+	for i := 0; i < 2; i++ {
+		resp, err := h(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	}
+	assert.Len(t, store.Messages(), 2)
+}
+
+func TestNewWebhookHandler_AnswersChallenges(t *testing.T) {
+	markAWSReady()
+	ctx := context.Background()
+	store := db.NewMemory()
+	for name, preset := range map[string]string{"slack": "slack", "graph": "msgraph", "plain": ""} {
+		_, err := store.CreateSender(ctx, name, sender_auth.HashSecret(name+"-secret"), sender_auth.DefaultScopes)
+		require.NoError(t, err)
+		if preset == "" {
+			continue
+		}
+		responder, err := json.Marshal(challenge.Presets[preset])
+		require.NoError(t, err)
+		_, err = store.SetSenderChallenge(ctx, name, responder)
+		require.NoError(t, err)
+	}
+	h := NewWebhookHandler(store, DefaultWebhookOptions())
+
+	req := lambdaReq(http.MethodPost, `{"token":"t","challenge":"abc123","type":"url_verification"}`)
+	req.QueryStringParameters = map[string]string{senderQueryParam: "slack"}
+	resp, err := h(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Headers["Content-Type"])
+	assert.Equal(t, "nosniff", resp.Headers["X-Content-Type-Options"])
+	assert.JSONEq(t, `{"challenge":"abc123"}`, resp.Body)
+
+	req = lambdaReq(http.MethodGet, "")
+	req.QueryStringParameters = map[string]string{senderQueryParam: "graph", "validationToken": "Validation: token"}
+	resp, err = h(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain", resp.Headers["Content-Type"])
+	assert.Equal(t, "Validation: token", resp.Body)
+	assert.Empty(t, store.Messages(), "handshakes aren't stored")
+	assert.Equal(t, []string{"preauth:203.0.113.10"}, store.RateLimitKeys(), "naming a sender doesn't spend its quota")
+
+	// Anything that isn't the sender's handshake is handled as usual.
+	for _, tc := range []struct{ sender, body string }{
+		{"slack", `{"type":"event_callback","challenge":"abc123"}`},
+		{"plain", `{"type":"url_verification","challenge":"abc123"}`},
+		{"nobody", `{"type":"url_verification","challenge":"abc123"}`},
+		{"graph", `{}`},
+	} {
+		req := lambdaReq(http.MethodPost, tc.body)
+		req.QueryStringParameters = map[string]string{senderQueryParam: tc.sender}
+		resp, err := h(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode, tc.sender)
+
+		delete(req.Headers, sharedSecretHeaderName)
+		resp, err = h(ctx, req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, tc.sender)
+	}
+	assert.Len(t, store.Messages(), 4)
+
+	req = lambdaReq(http.MethodGet, "")
+	req.QueryStringParameters = map[string]string{senderQueryParam: "graph"}
+	resp, err = h(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode, "GET is only for handshakes")
+
+	_, err = store.SetSenderStatus(ctx, "slack", models.SenderDisabled)
+	require.NoError(t, err)
+	req = lambdaReq(http.MethodPost, `{"challenge":"abc123","type":"url_verification"}`)
+	req.QueryStringParameters = map[string]string{senderQueryParam: "slack"}
+	resp, err = h(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode, "a disabled sender's handshakes aren't answered")
+	assert.Len(t, store.Messages(), 5)
+}
+
+func TestChannelName(t *testing.T) {
+	for path, want := range map[string]string{
+		"":                             "",
+		"/":                            "",
+		"/webhook":                     "",
+		"/webhook/":                    "",
+		"/webhook/lims":                "lims",
+		"/webhook/lims/":               "lims",
+		"/integration/webhook/github":  "github",
+		"/webhook/lims/extra":          "",
+		"/messages/webhook-not-a-path": "",
+	} {
+		assert.Equal(t, want, channelName(path), path)
+	}
+}
+
+func TestSchemaCache(t *testing.T) {
+	var c schemaCache
+	updated := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	lims := models.Channel{ID: 1, UpdatedAt: updated, JSONSchema: []byte(`{"required":["run"]}`)}
+
+	first, err := c.compile(lims)
+	require.NoError(t, err)
+	again, err := c.compile(lims)
+	require.NoError(t, err)
+	assert.Same(t, first, again, "compiled once per channel version")
+
+	lims.UpdatedAt, lims.JSONSchema = updated.Add(time.Minute), []byte(`{"required":["sample"]}`)
+	changed, err := c.compile(lims)
+	require.NoError(t, err)
+	assert.NotSame(t, first, changed, "a channel set again is recompiled")
+	assert.NoError(t, changed.Validate([]byte(`{"sample":"S1"}`)))
+
+	_, err = c.compile(models.Channel{ID: 2, JSONSchema: []byte(`{"type":1}`)})
+	assert.Error(t, err)
+}
+
+func TestNewWebhookHandler_Channels(t *testing.T) {
+	aws.AwsOnce.Do(func() {})
+	config.SetForTest(config.NewForTest(config.Config{}, map[string]string{
+		config.KeyWebhookSharedSecret:                testSharedSecret,
+		config.KeySenderSigningSecretPrefix + "acme": "acme-signing",
+	}))
+	defer markAWSReady()
+	ctx := context.Background()
+	store := db.NewMemory()
+	_, err := store.CreateSender(ctx, "acme", sender_auth.HashSecret("acme-secret"), sender_auth.DefaultScopes)
+	require.NoError(t, err)
+	scheme, err := json.Marshal(signature.Presets["pennsieve"])
+	require.NoError(t, err)
+	_, err = store.SetSenderSignatureScheme(ctx, "acme", scheme)
+	require.NoError(t, err)
+	lims, err := store.PutChannel(ctx, models.Channel{
+		Name: "lims", Auth: models.ChannelAuthSecret, Methods: []string{http.MethodPost}, Senders: []string{"acme"}, MaxPayloadBytes: 64,
+		JSONSchema: []byte(`{"type":"object","required":["run"]}`),
+	})
+	require.NoError(t, err)
+	github, err := store.PutChannel(ctx, models.Channel{
+		Name: "github", Auth: models.ChannelAuthSignature, Methods: []string{http.MethodPost}, Senders: []string{"acme"}, MaxPayloadBytes: 1 << 20,
+	})
+	require.NoError(t, err)
+	_, err = store.CreateSender(ctx, "scheduler", sender_auth.HashSecret("scheduler-secret"), sender_auth.DefaultScopes)
+	require.NoError(t, err)
+	_, err = store.PutChannel(ctx, models.Channel{Name: "old", Auth: models.ChannelAuthAny, Methods: []string{http.MethodPost}, Senders: []string{"acme"}, MaxPayloadBytes: 64})
+	require.NoError(t, err)
+	_, err = store.SetChannelStatus(ctx, "old", models.ChannelDisabled)
+	require.NoError(t, err)
+	h := NewWebhookHandler(store, DefaultWebhookOptions())
+
+	send := func(req events.LambdaFunctionURLRequest, path string) events.LambdaFunctionURLResponse {
+		req.RawPath = path
+		resp, err := h(ctx, req)
+		require.NoError(t, err)
+		return resp
+	}
+	withSecret := func(method, body, secret string) events.LambdaFunctionURLRequest {
+		req := lambdaReq(method, body)
+		req.Headers[sharedSecretHeaderName] = secret
+		return req
+	}
+
+	resp := send(withSecret(http.MethodPost, `{"run":"R1"}`, "acme-secret"), "/webhook/lims")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode, resp.Body)
+	resp = send(signedReq(t, "acme", "acme-signing", `{"action":"opened"}`, "delivery-1"), "/webhook/github")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode, resp.Body)
+	resp = send(withSecret(http.MethodPut, `{"legacy":true}`, testSharedSecret), "/webhook")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode, resp.Body)
+	msgs := store.Messages()
+	require.Len(t, msgs, 3)
+	assert.Equal(t, lims.ID, msgs[0].ChannelID)
+	assert.Equal(t, github.ID, msgs[1].ChannelID)
+	assert.Zero(t, msgs[2].ChannelID, "/webhook keeps its own policy")
+
+	for name, tc := range map[string]struct {
+		req  events.LambdaFunctionURLRequest
+		path string
+		code int
+		msg  string
+	}{
+		"unknown channel":  {withSecret(http.MethodPost, `{"run":"R1"}`, "acme-secret"), "/webhook/nope", http.StatusNotFound, `unknown channel "nope"`},
+		"disabled channel": {withSecret(http.MethodPost, `{"run":"R1"}`, "acme-secret"), "/webhook/old", http.StatusNotFound, `unknown channel "old"`},
+		"method":           {withSecret(http.MethodPut, `{"run":"R1"}`, "acme-secret"), "/webhook/lims", http.StatusMethodNotAllowed, "method PUT not allowed"},
+		"size":             {withSecret(http.MethodPost, `{"run":"`+strings.Repeat("x", 64)+`"}`, "acme-secret"), "/webhook/lims", http.StatusRequestEntityTooLarge, "payload too large"},
+		"schema":           {withSecret(http.MethodPost, `{"sample":"S1"}`, "acme-secret"), "/webhook/lims", http.StatusUnprocessableEntity, `missing required property "run"`},
+		"legacy secret":    {withSecret(http.MethodPost, `{"run":"R1"}`, testSharedSecret), "/webhook/lims", http.StatusUnauthorized, "legacy shared secret"},
+		"signed on secret": {signedReq(t, "acme", "acme-signing", `{"run":"R1"}`, "delivery-2"), "/webhook/lims", http.StatusUnauthorized, "only accepts X-Pennsieve-Webhook-Secret"},
+		"secret on signed": {withSecret(http.MethodPost, `{}`, "acme-secret"), "/webhook/github", http.StatusUnauthorized, "only accepts signed requests"},
+		"unbound sender":   {withSecret(http.MethodPost, `{"run":"R1"}`, "scheduler-secret"), "/webhook/lims", http.StatusForbidden, "sender scheduler may not use channel lims"},
+	} {
+		resp := send(tc.req, tc.path)
+		assert.Equal(t, tc.code, resp.StatusCode, name)
+		var body models.WebhookResponse
+		require.NoError(t, json.Unmarshal([]byte(resp.Body), &body), name)
+		assert.Contains(t, body.Message, tc.msg, name)
+	}
+	assert.Len(t, store.Messages(), 3)
+}
@@ -0,0 +1,47 @@
+// Package idempotency holds the webhook receiver's Idempotency-Key rules:
+// which keys are valid, how long they are remembered and how a repeated
+// request's body is compared with the original. The keys themselves live
+// in the store (db.IdempotencyStore).
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// HeaderName is the request header carrying the key.
+const HeaderName = "Idempotency-Key"
+
+// ReplayedHeaderName is set on responses repeated from a key's original
+// request.
+const ReplayedHeaderName = "Idempotent-Replayed"
+
+// DefaultWindow is how long a key is remembered when no window is
+// configured: longer than any sender's retry schedule.
+const DefaultWindow = 24 * time.Hour
+
+// maxKeyLength bounds keys; UUIDs and similar tokens fit comfortably.
+const maxKeyLength = 255
+
+// ValidateKey rejects keys that are too long or contain anything but
+// printable ASCII.
+func ValidateKey(key string) error {
+	if len(key) > maxKeyLength {
+		return fmt.Errorf("%s must be at most %d characters", HeaderName, maxKeyLength)
+	}
+	for _, r := range key {
+		if r < 0x21 || r > 0x7e {
+			return fmt.Errorf("%s must be printable ASCII without spaces", HeaderName)
+		}
+	}
+	return nil
+}
+
+// BodyHash identifies a request body, so a key reused with a different
+// body can be told from a retry.
+func BodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,23 @@
+package idempotency
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateKey(t *testing.T) {
+	for _, ok := range []string{"a", "4f1d2c0e-9b7a-4c55-8f0e-2d9b1e6c7a10", strings.Repeat("k", maxKeyLength)} {
+		assert.NoError(t, ValidateKey(ok), ok)
+	}
+	for _, bad := range []string{strings.Repeat("k", maxKeyLength+1), "has space", "tab\t", "ünïcode"} {
+		assert.Error(t, ValidateKey(bad), bad)
+	}
+}
+
+func TestBodyHash(t *testing.T) {
+	assert.Equal(t, BodyHash([]byte(`{"a":1}`)), BodyHash([]byte(`{"a":1}`)))
+	assert.NotEqual(t, BodyHash([]byte(`{"a":1}`)), BodyHash([]byte(`{"a":2}`)))
+	assert.Len(t, BodyHash(nil), 64)
+}
@@ -0,0 +1,400 @@
+// Package jsonschema validates JSON documents against the subset of JSON
+// Schema that webhook channels use to describe their payloads: type,
+// enum, const, the string, number, object and array constraints below, and
+// nesting through properties, additionalProperties and items. Other
+// keywords, such as $schema, title and description, are ignored; $ref and
+// the combinators (allOf, anyOf, oneOf, not) are rejected rather than
+// silently ignored, so a schema never validates less than it appears to.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalid is returned for a document the schema rejects.
+var ErrInvalid = errors.New("payload does not match schema")
+
+// unsupported are keywords a Schema can't honor.
+var unsupported = []string{"$ref", "allOf", "anyOf", "oneOf", "not", "if", "patternProperties", "dependencies"}
+
+// Schema is a compiled schema.
+type Schema struct {
+	types                []string
+	enum                 []interface{}
+	constant             interface{}
+	hasConst             bool
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	minimum, maximum     *big.Float
+	exclusiveMinimum     *big.Float
+	exclusiveMaximum     *big.Float
+	required             []string
+	properties           map[string]*Schema
+	additional           *Schema
+	noAdditional         bool
+	items                *Schema
+	minItems, maxItems   *int
+}
+
+// raw is a schema as written.
+type raw struct {
+	Type                 json.RawMessage            `json:"type"`
+	Enum                 []interface{}              `json:"enum"`
+	Const                json.RawMessage            `json:"const"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	Pattern              *string                    `json:"pattern"`
+	Minimum              *json.Number               `json:"minimum"`
+	Maximum              *json.Number               `json:"maximum"`
+	ExclusiveMinimum     *json.Number               `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *json.Number               `json:"exclusiveMaximum"`
+	Required             []string                   `json:"required"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+}
+
+var validTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// Compile reads a schema.
+func Compile(data []byte) (*Schema, error) {
+	s, err := compile(data, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return s, nil
+}
+
+func compile(data []byte, path string) (*Schema, error) {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: a schema must be a JSON object", pointer(path))
+	}
+	for _, k := range unsupported {
+		if _, ok := keys[k]; ok {
+			return nil, fmt.Errorf("%s: %s is not supported", pointer(path), k)
+		}
+	}
+	var r raw
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&r); err != nil {
+		return nil, fmt.Errorf("%s: %v", pointer(path), err)
+	}
+
+	s := &Schema{
+		enum:      r.Enum,
+		minLength: r.MinLength, maxLength: r.MaxLength,
+		required: r.Required,
+		minItems: r.MinItems, maxItems: r.MaxItems,
+	}
+	if len(r.Type) > 0 {
+		var one string
+		if err := json.Unmarshal(r.Type, &one); err == nil {
+			s.types = []string{one}
+		} else if err := json.Unmarshal(r.Type, &s.types); err != nil {
+			return nil, fmt.Errorf("%s: type must be a string or an array of strings", pointer(path))
+		}
+		for _, t := range s.types {
+			if !validTypes[t] {
+				return nil, fmt.Errorf("%s: unknown type %q", pointer(path), t)
+			}
+		}
+	}
+	if len(r.Const) > 0 {
+		v, err := decode(r.Const)
+		if err != nil {
+			return nil, fmt.Errorf("%s: const: %v", pointer(path), err)
+		}
+		s.constant, s.hasConst = v, true
+	}
+	if r.Pattern != nil {
+		re, err := regexp.Compile(*r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: pattern: %v", pointer(path), err)
+		}
+		s.pattern = re
+	}
+	for _, b := range []struct {
+		n    *json.Number
+		dest **big.Float
+		name string
+	}{
+		{r.Minimum, &s.minimum, "minimum"},
+		{r.Maximum, &s.maximum, "maximum"},
+		{r.ExclusiveMinimum, &s.exclusiveMinimum, "exclusiveMinimum"},
+		{r.ExclusiveMaximum, &s.exclusiveMaximum, "exclusiveMaximum"},
+	} {
+		if b.n == nil {
+			continue
+		}
+		f, ok := new(big.Float).SetString(b.n.String())
+		if !ok {
+			return nil, fmt.Errorf("%s: %s must be a number", pointer(path), b.name)
+		}
+		*b.dest = f
+	}
+
+	if len(r.Properties) > 0 {
+		s.properties = make(map[string]*Schema, len(r.Properties))
+		for name, p := range r.Properties {
+			ps, err := compile(p, path+"/properties/"+escape(name))
+			if err != nil {
+				return nil, err
+			}
+			s.properties[name] = ps
+		}
+	}
+	if len(r.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(r.AdditionalProperties, &allowed); err == nil {
+			s.noAdditional = !allowed
+		} else if s.additional, err = compile(r.AdditionalProperties, path+"/additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+	if len(r.Items) > 0 {
+		var err error
+		if s.items, err = compile(r.Items, path+"/items"); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Validate checks a JSON document against the schema, returning an error
+// wrapping ErrInvalid that names the first value it rejects.
+func (s *Schema) Validate(doc []byte) error {
+	v, err := decode(doc)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if err := s.validate(v, ""); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return nil
+}
+
+func decode(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *Schema) validate(v interface{}, path string) error {
+	if len(s.types) > 0 && !s.hasType(v) {
+		return fmt.Errorf("%s: want %s, got %s", pointer(path), strings.Join(s.types, " or "), typeOf(v))
+	}
+	if s.hasConst && !equal(v, s.constant) {
+		return fmt.Errorf("%s: want %s", pointer(path), text(s.constant))
+	}
+	if len(s.enum) > 0 {
+		found := false
+		for _, e := range s.enum {
+			if equal(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: want one of %s", pointer(path), text(s.enum))
+		}
+	}
+
+	switch t := v.(type) {
+	case string:
+		return s.validateString(t, path)
+	case json.Number:
+		return s.validateNumber(t, path)
+	case map[string]interface{}:
+		return s.validateObject(t, path)
+	case []interface{}:
+		return s.validateArray(t, path)
+	}
+	return nil
+}
+
+func (s *Schema) validateString(v, path string) error {
+	n := utf8.RuneCountInString(v)
+	if s.minLength != nil && n < *s.minLength {
+		return fmt.Errorf("%s: shorter than %d characters", pointer(path), *s.minLength)
+	}
+	if s.maxLength != nil && n > *s.maxLength {
+		return fmt.Errorf("%s: longer than %d characters", pointer(path), *s.maxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(v) {
+		return fmt.Errorf("%s: does not match %q", pointer(path), s.pattern)
+	}
+	return nil
+}
+
+func (s *Schema) validateNumber(v json.Number, path string) error {
+	f, ok := new(big.Float).SetString(v.String())
+	if !ok {
+		return fmt.Errorf("%s: invalid number %s", pointer(path), v)
+	}
+	switch {
+	case s.minimum != nil && f.Cmp(s.minimum) < 0:
+		return fmt.Errorf("%s: less than %s", pointer(path), s.minimum.Text('g', -1))
+	case s.maximum != nil && f.Cmp(s.maximum) > 0:
+		return fmt.Errorf("%s: greater than %s", pointer(path), s.maximum.Text('g', -1))
+	case s.exclusiveMinimum != nil && f.Cmp(s.exclusiveMinimum) <= 0:
+		return fmt.Errorf("%s: not greater than %s", pointer(path), s.exclusiveMinimum.Text('g', -1))
+	case s.exclusiveMaximum != nil && f.Cmp(s.exclusiveMaximum) >= 0:
+		return fmt.Errorf("%s: not less than %s", pointer(path), s.exclusiveMaximum.Text('g', -1))
+	}
+	return nil
+}
+
+func (s *Schema) validateObject(v map[string]interface{}, path string) error {
+	for _, name := range s.required {
+		if _, ok := v[name]; !ok {
+			return fmt.Errorf("%s: missing required property %q", pointer(path), name)
+		}
+	}
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p, ok := s.properties[name]
+		switch {
+		case ok:
+		case s.noAdditional:
+			return fmt.Errorf("%s: unexpected property %q", pointer(path), name)
+		case s.additional != nil:
+			p = s.additional
+		default:
+			continue
+		}
+		if err := p.validate(v[name], path+"/"+escape(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateArray(v []interface{}, path string) error {
+	if s.minItems != nil && len(v) < *s.minItems {
+		return fmt.Errorf("%s: fewer than %d items", pointer(path), *s.minItems)
+	}
+	if s.maxItems != nil && len(v) > *s.maxItems {
+		return fmt.Errorf("%s: more than %d items", pointer(path), *s.maxItems)
+	}
+	if s.items == nil {
+		return nil
+	}
+	for i, e := range v {
+		if err := s.items.validate(e, fmt.Sprintf("%s/%d", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) hasType(v interface{}) bool {
+	actual := typeOf(v)
+	for _, t := range s.types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf names v's JSON type, "integer" for a number without a fraction.
+func typeOf(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, ok := new(big.Float).SetString(t.String()); ok && f.IsInt() {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// equal compares decoded JSON values, numbers by value.
+func equal(a, b interface{}) bool {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		af, ok1 := new(big.Float).SetString(an.String())
+		bf, ok2 := new(big.Float).SetString(bn.String())
+		return ok1 && ok2 && af.Cmp(bf) == 0
+	}
+	if aok != bok {
+		return false
+	}
+	switch at := a.(type) {
+	case []interface{}:
+		bt, ok := b.([]interface{})
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for i := range at {
+			if !equal(at[i], bt[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bt, ok := b.(map[string]interface{})
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for k, av := range at {
+			bv, ok := bt[k]
+			if !ok || !equal(av, bv) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func text(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// pointer renders a JSON pointer for messages, "/" for the document root.
+func pointer(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
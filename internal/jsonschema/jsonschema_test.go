@@ -0,0 +1,85 @@
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const runSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"title": "LIMS run",
+	"type": "object",
+	"required": ["event", "run"],
+	"properties": {
+		"event": {"enum": ["run.started", "run.finished"]},
+		"run": {
+			"type": "object",
+			"required": ["id"],
+			"additionalProperties": false,
+			"properties": {
+				"id": {"type": "string", "pattern": "^R[0-9]+$"},
+				"samples": {"type": "integer", "minimum": 1, "maximum": 96},
+				"tags": {"type": "array", "maxItems": 2, "items": {"type": "string", "minLength": 1}}
+			}
+		},
+		"version": {"const": 2}
+	}
+}`
+
+func TestSchema_Validate(t *testing.T) {
+	s, err := Compile([]byte(runSchema))
+	require.NoError(t, err)
+
+	for _, doc := range []string{
+		`{"event":"run.started","run":{"id":"R1"}}`,
+		`{"event":"run.finished","run":{"id":"R22","samples":96,"tags":["a","b"]},"version":2.0,"extra":true}`,
+	} {
+		assert.NoError(t, s.Validate([]byte(doc)), doc)
+	}
+
+	for doc, want := range map[string]string{
+		`[]`:                  "/: want object, got array",
+		`{"run":{"id":"R1"}}`: `/: missing required property "event"`,
+		`{"event":"run.paused","run":{"id":"R1"}}`:                       `/event: want one of ["run.started","run.finished"]`,
+		`{"event":"run.started","run":{"id":"X1"}}`:                      `/run/id: does not match "^R[0-9]+$"`,
+		`{"event":"run.started","run":{"id":1}}`:                         "/run/id: want string, got integer",
+		`{"event":"run.started","run":{"id":"R1","samples":1.5}}`:        "/run/samples: want integer, got number",
+		`{"event":"run.started","run":{"id":"R1","samples":0}}`:          "/run/samples: less than 1",
+		`{"event":"run.started","run":{"id":"R1","tags":["a",""]}}`:      "/run/tags/1: shorter than 1 characters",
+		`{"event":"run.started","run":{"id":"R1","tags":["a","b","c"]}}`: "/run/tags: more than 2 items",
+		`{"event":"run.started","run":{"id":"R1","lab":"x"}}`:            `/run: unexpected property "lab"`,
+		`{"event":"run.started","run":{"id":"R1"},"version":3}`:          "/version: want 2",
+		`{"event":`: "unexpected EOF",
+	} {
+		err := s.Validate([]byte(doc))
+		if assert.ErrorIs(t, err, ErrInvalid, doc) {
+			assert.Contains(t, err.Error(), want, doc)
+		}
+	}
+}
+
+func TestSchema_AdditionalPropertiesSchema(t *testing.T) {
+	s, err := Compile([]byte(`{"type":"object","additionalProperties":{"type":["string","null"]}}`))
+	require.NoError(t, err)
+	assert.NoError(t, s.Validate([]byte(`{"a":"x","b":null}`)))
+	assert.ErrorContains(t, s.Validate([]byte(`{"a":1}`)), "/a: want string or null, got integer")
+}
+
+func TestCompile_RejectsInvalidSchemas(t *testing.T) {
+	for schema, want := range map[string]string{
+		`[]`:                                  "a schema must be a JSON object",
+		`{"type":"float"}`:                    `unknown type "float"`,
+		`{"type":1}`:                          "type must be a string or an array of strings",
+		`{"pattern":"("}`:                     "pattern",
+		`{"properties":{"a":{"$ref":"#/x"}}}`: "/properties/a: $ref is not supported",
+		`{"anyOf":[{"type":"string"}]}`:       "anyOf is not supported",
+		`{"items":{"minLength":"one"}}`:       "/items",
+	} {
+		_, err := Compile([]byte(schema))
+		if assert.Error(t, err, schema) {
+			assert.Contains(t, err.Error(), want, schema)
+		}
+	}
+}
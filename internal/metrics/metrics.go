@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// namespace is the CloudWatch namespace every metric is published under.
+const namespace = "IntegrationService"
+
+// Metrics are emitted as CloudWatch Embedded Metric Format (EMF) log lines:
+// Lambda ships stdout to CloudWatch Logs, which extracts the metric with no
+// PutMetricData call or extra IAM permission. Lines go straight to stdout
+// rather than through log.Printf because the standard logger's timestamp
+// prefix would stop CloudWatch from recognising the JSON.
+var (
+	out      io.Writer = os.Stdout
+	outMutex sync.Mutex
+)
+
+// Count records a single occurrence of name.
+func Count(name string, dims map[string]string) {
+	Add(name, 1, dims)
+}
+
+// Add records value against name, with dims as CloudWatch dimensions. Keep
+// dimension values low-cardinality (never a raw org or dataset id).
+func Add(name string, value float64, dims map[string]string) {
+	Emit(map[string]float64{name: value}, dims)
+}
+
+// Emit records several metrics sharing the same dimensions in one log line.
+func Emit(values map[string]float64, dims map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(dims))
+	for k := range dims {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	definitions := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		definitions = append(definitions, map[string]string{"Name": name, "Unit": "Count"})
+	}
+
+	doc := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": time.Now().UnixMilli(),
+			"CloudWatchMetrics": []interface{}{
+				map[string]interface{}{
+					"Namespace":  namespace,
+					"Dimensions": [][]string{keys},
+					"Metrics":    definitions,
+				},
+			},
+		},
+	}
+	for name, value := range values {
+		doc[name] = value
+	}
+	for k, v := range dims {
+		doc[k] = v
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		log.Printf("metrics: marshal %v: %v", names, err)
+		return
+	}
+
+	outMutex.Lock()
+	defer outMutex.Unlock()
+	if _, err := out.Write(append(b, '\n')); err != nil {
+		log.Printf("metrics: write %v: %v", names, err)
+	}
+}
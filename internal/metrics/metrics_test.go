@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCount_EmitsEMFLine(t *testing.T) {
+	var buf bytes.Buffer
+	out = &buf
+
+	Count("UnknownOrganization", map[string]string{"Cache": "schema"})
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, float64(1), doc["UnknownOrganization"])
+	assert.Equal(t, "schema", doc["Cache"])
+
+	aws := doc["_aws"].(map[string]interface{})
+	directive := aws["CloudWatchMetrics"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, namespace, directive["Namespace"])
+	assert.Equal(t, []interface{}{[]interface{}{"Cache"}}, directive["Dimensions"])
+}
+
+func TestEmit_SkipsEmptyValues(t *testing.T) {
+	var buf bytes.Buffer
+	out = &buf
+
+	Emit(nil, nil)
+	assert.Empty(t, buf.String())
+
+	Emit(map[string]float64{"A": 2, "B": 3}, nil)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, float64(2), doc["A"])
+	assert.Equal(t, float64(3), doc["B"])
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// MessageFilter selects stored webhook messages, newest first. Zero
+// fields don't filter.
+type MessageFilter struct {
+	// Since and Until bound received_at: Since inclusive, Until exclusive.
+	Since time.Time
+	Until time.Time
+	// SenderID selects one sender's messages.
+	SenderID int64
+	// ChannelID selects one channel's messages.
+	ChannelID int64
+	// Method selects messages received with this HTTP method.
+	Method string
+	// Status selects messages in this processing status.
+	Status string
+	// Payload lists conditions the payload must all meet.
+	Payload []PayloadPredicate
+	// BeforeID continues a listing after the message with this id.
+	BeforeID int64
+	// Limit caps how many messages are returned.
+	Limit int
+}
+
+// PayloadPredicate requires the payload value at Path, rendered as text,
+// to equal Value. Strings compare without their quotes, other scalars by
+// their JSON text, and a missing or null value never matches. This is
+// Postgres's payload #>> path = value.
+type PayloadPredicate struct {
+	Path  []string
+	Value string
+}
+
+// Match evaluates p against a JSON payload.
+func (p PayloadPredicate) Match(payload []byte) bool {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return false
+	}
+	for _, key := range p.Path {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if v, ok = obj[key]; !ok {
+			return false
+		}
+	}
+	switch t := v.(type) {
+	case nil:
+		return false
+	case string:
+		return t == p.Value
+	case json.Number:
+		return t.String() == p.Value
+	default:
+		b, _ := json.Marshal(t)
+		return string(b) == p.Value
+	}
+}
+
+// StoredMessage is a received webhook message as returned by the message
+// API. Payload is omitted from listings.
+type StoredMessage struct {
+	ID          int64             `json:"id"`
+	RequestID   string            `json:"request_id"`
+	SenderID    int64             `json:"sender_id,omitempty"`
+	Sender      string            `json:"sender,omitempty"`
+	ChannelID   int64             `json:"channel_id,omitempty"`
+	Channel     string            `json:"channel,omitempty"`
+	ReceivedAt  time.Time         `json:"received_at"`
+	Method      string            `json:"method,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	SourceIP    string            `json:"source_ip,omitempty"`
+	UserAgent   string            `json:"user_agent,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	QueryString string            `json:"query_string,omitempty"`
+	Status      string            `json:"status"`
+	Attempts    int               `json:"attempts"`
+	LastError   string            `json:"last_error,omitempty"`
+	ProcessedAt *time.Time        `json:"processed_at,omitempty"`
+	Payload     json.RawMessage   `json:"payload,omitempty"`
+}
+
+// StoredMessagePage is one page of a message listing. NextCursor is set
+// when there may be more messages; pass it back as ?cursor= to get them.
+type StoredMessagePage struct {
+	Messages   []StoredMessage `json:"messages"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
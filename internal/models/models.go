@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type WebhookCache struct {
 	Updated  time.Time
@@ -13,11 +16,45 @@ type WebhookRecord struct {
 	DatasetID int
 }
 
+// DatasetCache holds the datasets of one org, keyed by integer dataset id.
+type DatasetCache struct {
+	Updated  time.Time
+	Datasets map[int]DatasetRecord
+}
+
+// DatasetRecord is the subset of a per-org datasets row used to enrich
+// delivered events.
+type DatasetRecord struct {
+	ID     int
+	NodeID string
+	Name   string
+}
+
+// EventMessage is the event envelope consumed from SNS/SQS and delivered to
+// webhook receivers. SchemaVersion is zero for legacy v1 envelopes, and Detail
+// is only forwarded for v2; see event_parser.ParseEventMessage.
+//
+// DatasetNodeID and DatasetName are not part of the published envelope; the
+// event lambda fills them in from the org's datasets table before delivery.
+// MessageID is the SQS message the event arrived in, kept so a failed event
+// can be reported back as a batch item failure; it is never delivered.
 type EventMessage struct {
-	OrgID    string `json:"organizationId"`
-	DataID   int    `json:"datasetId"`
-	Category string `json:"eventCategory"`
-	Type     string `json:"eventType"`
+	MessageID     string          `json:"-"`
+	SchemaVersion int             `json:"schemaVersion,omitempty"`
+	OrgID         string          `json:"organizationId"`
+	DataID        int             `json:"datasetId"`
+	DatasetNodeID string          `json:"datasetNodeId,omitempty"`
+	DatasetName   string          `json:"datasetName,omitempty"`
+	Category      string          `json:"eventCategory"`
+	Type          string          `json:"eventType"`
+	Detail        json.RawMessage `json:"eventDetail,omitempty"`
+}
+
+// CacheInvalidation scopes a webhook cache invalidation to an org, or to a
+// single dataset within it when DatasetID is non-zero.
+type CacheInvalidation struct {
+	OrgID     string `json:"organizationId"`
+	DatasetID int    `json:"datasetId,omitempty"`
 }
 
 type WebhookMessage struct {
@@ -26,11 +63,184 @@ type WebhookMessage struct {
 }
 
 // IncomingWebhook is the stored record for a received webhook message.
+// SenderID is 0 when the message wasn't attributed to a sender.
 type IncomingWebhook struct {
-	ID         int64
+	ID        int64
+	RequestID string
+	SenderID  int64
+	// ChannelID is the channel the message was received on, 0 for
+	// /webhook.
+	ChannelID int64
+	Payload   []byte
+	// RawBody is the body Payload was converted from, nil when the body
+	// was JSON.
+	RawBody    []byte
+	ReceivedAt time.Time
+	Request    RequestMetadata
+	Processing ProcessingState
+}
+
+// Message processing statuses, in lifecycle order. A failed message is
+// retried while it has attempts left.
+const (
+	MessageReceived   = "received"
+	MessageProcessing = "processing"
+	MessageProcessed  = "processed"
+	MessageFailed     = "failed"
+)
+
+// ProcessingState is where a stored message is in processing.
+type ProcessingState struct {
+	Status string
+	// Attempts counts processing attempts, including one in progress.
+	Attempts  int
+	LastError string
+	// NextAttemptAt is when the message is next due for processing, or
+	// while processing when its claim expires. It is nil once the message
+	// is processed or out of attempts.
+	NextAttemptAt *time.Time
+	ProcessedAt   *time.Time
+}
+
+// RequestMetadata describes the HTTP request a webhook message arrived in.
+// Header names are lower-case and credential-bearing headers are redacted.
+// It is empty for messages stored before it was captured.
+type RequestMetadata struct {
+	Method      string
+	Headers     map[string]string
+	SourceIP    string
+	UserAgent   string
+	ContentType string
+	QueryString string
+}
+
+// Sender statuses.
+const (
+	SenderActive   = "active"
+	SenderDisabled = "disabled"
+)
+
+// Sender is a named client of the inbound webhook receiver.
+type Sender struct {
+	ID     int64    `json:"sender_id"`
+	Name   string   `json:"name"`
+	Status string   `json:"status"`
+	Scopes []string `json:"scopes"`
+	// SignatureScheme is the JSON signature.Scheme the sender signs
+	// requests with, if any.
+	SignatureScheme json.RawMessage `json:"signature_scheme,omitempty"`
+	// Challenge is the JSON challenge.Responder answering the handshake
+	// the sender's provider verifies the endpoint with, if any.
+	Challenge json.RawMessage `json:"challenge,omitempty"`
+	// SecretRotatedAt is when the secret was last rotated, nil if never.
+	SecretRotatedAt *time.Time `json:"secret_rotated_at,omitempty"`
+	// PreviousSecretExpiresAt is when the secret replaced by the last
+	// rotation stops being accepted.
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	// PreviousSecretUsedAt is when the replaced secret was last presented.
+	PreviousSecretUsedAt *time.Time `json:"previous_secret_used_at,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// SharedSecretUse is a caller seen presenting the previous value of the
+// deprecated webhook shared secret.
+type SharedSecretUse struct {
+	SourceIP    string    `json:"source_ip"`
+	UserAgent   string    `json:"user_agent"`
+	Uses        int64     `json:"uses"`
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	LastSeenAt  time.Time `json:"last_seen_at"`
+}
+
+// InRotation reports whether the sender's previous secret is still
+// accepted at now.
+func (s Sender) InRotation(now time.Time) bool {
+	return s.PreviousSecretExpiresAt != nil && now.Before(*s.PreviousSecretExpiresAt)
+}
+
+// HasScope reports whether the sender was granted scope.
+func (s Sender) HasScope(scope string) bool {
+	for _, sc := range s.Scopes {
+		if sc == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Channel statuses.
+const (
+	ChannelActive   = "active"
+	ChannelDisabled = "disabled"
+)
+
+// Credentials a channel accepts.
+const (
+	// ChannelAuthAny accepts a sender's secret or signature.
+	ChannelAuthAny = "any"
+	// ChannelAuthSecret accepts only a sender's secret.
+	ChannelAuthSecret = "secret"
+	// ChannelAuthSignature accepts only signed requests.
+	ChannelAuthSignature = "signature"
+)
+
+// Channel is a routed endpoint of the webhook receiver, /webhook/{name},
+// with its own policy for the requests it accepts.
+type Channel struct {
+	ID     int64  `json:"channel_id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Auth is the credential the channel accepts, a ChannelAuth constant.
+	Auth string `json:"auth"`
+	// Methods are the HTTP methods the channel accepts.
+	Methods []string `json:"methods"`
+	// Senders name the senders whose requests the channel accepts; it
+	// accepts none without them.
+	Senders []string `json:"senders"`
+	// MaxPayloadBytes bounds request bodies, compressed or not.
+	MaxPayloadBytes int `json:"max_payload_bytes"`
+	// JSONSchema is the JSON Schema payloads must match, if any.
+	JSONSchema json.RawMessage `json:"json_schema,omitempty"`
+	// Processor names the worker processor for the channel's messages, ""
+	// for the default routes.
+	Processor string    `json:"processor,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AllowsMethod reports whether the channel accepts method.
+func (c Channel) AllowsMethod(method string) bool {
+	for _, m := range c.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsSender reports whether the channel takes requests from the
+// sender called name.
+func (c Channel) AcceptsSender(name string) bool {
+	for _, s := range c.Senders {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IdempotencyRecord is an Idempotency-Key remembered by the receiver with
+// the outcome of the request that first used it. StatusCode is 0 while
+// that request is still being stored.
+type IdempotencyRecord struct {
+	SenderID   int64
+	Key        string
+	BodyHash   string
 	RequestID  string
-	Payload    []byte
+	StatusCode int
 	ReceivedAt time.Time
+	ExpiresAt  time.Time
 }
 
 // WebhookResponse is the JSON body returned for every webhook request.
@@ -38,6 +38,18 @@ type Notification struct {
 	CreatedAt      time.Time       `json:"created_at"`
 }
 
+// NotificationDraft is a notification rendered for a topic but not yet
+// delivered. It goes to every subscription to Topic whose context is
+// contained in Context, so a subscription with an empty context receives
+// everything posted to the topic.
+type NotificationDraft struct {
+	Topic    string
+	Context  json.RawMessage
+	Title    string
+	Message  string
+	Metadata json.RawMessage
+}
+
 // NotificationErrorResponse is the JSON body returned for failed
 // notification/subscription API requests.
 type NotificationErrorResponse struct {
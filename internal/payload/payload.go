@@ -0,0 +1,166 @@
+// Package payload turns the bodies senders post into the JSON the receiver
+// stores. JSON bodies are stored as they are; form-encoded, XML and
+// plain-text bodies are converted to a canonical JSON document, keeping
+// the body they were converted from. gzip-encoded bodies are decompressed
+// first, up to a size limit, so a small compressed body can't expand
+// without bound.
+package payload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrUnsupported is returned for a content type or encoding the
+	// receiver doesn't accept.
+	ErrUnsupported = errors.New("unsupported content")
+	// ErrTooLarge is returned for a body over the limit once decompressed.
+	ErrTooLarge = errors.New("payload too large")
+	// ErrInvalid is returned for a body that isn't what its content type
+	// or encoding says.
+	ErrInvalid = errors.New("invalid payload")
+)
+
+// Content types a body is read as. A missing Content-Type is read as JSON,
+// as the receiver did before it accepted anything else.
+const (
+	TypeJSON = "application/json"
+	TypeForm = "application/x-www-form-urlencoded"
+	TypeXML  = "application/xml"
+	TypeText = "text/plain"
+)
+
+// TextField is the field a plain-text body is stored under.
+const TextField = "text"
+
+// Decoded is a body ready to store.
+type Decoded struct {
+	// JSON is the payload.
+	JSON []byte
+	// Original is the decompressed body JSON was converted from, nil when
+	// the body was JSON.
+	Original []byte
+	// Type is the content type the body was read as, one of the Type
+	// constants.
+	Type string
+}
+
+// Decode decompresses body according to contentEncoding and converts it to
+// JSON according to contentType. The decompressed body may be at most
+// maxBytes long. An empty body is the empty JSON object.
+func Decode(contentType, contentEncoding string, body []byte, maxBytes int) (Decoded, error) {
+	typ, err := mediaType(contentType)
+	if err != nil {
+		return Decoded{}, err
+	}
+	body, err = decompress(contentEncoding, body, maxBytes)
+	if err != nil {
+		return Decoded{}, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return Decoded{JSON: []byte("{}"), Type: typ}, nil
+	}
+
+	var doc interface{}
+	switch typ {
+	case TypeJSON:
+		if !json.Valid(body) {
+			return Decoded{}, fmt.Errorf("%w: payload must be valid JSON", ErrInvalid)
+		}
+		return Decoded{JSON: body, Type: typ}, nil
+	case TypeForm:
+		doc, err = formDocument(body)
+	case TypeXML:
+		doc, err = xmlDocument(body)
+	case TypeText:
+		doc = map[string]interface{}{TextField: string(body)}
+	}
+	if err != nil {
+		return Decoded{}, err
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return Decoded{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return Decoded{JSON: out, Original: body, Type: typ}, nil
+}
+
+// mediaType maps a Content-Type header to the type the body is read as.
+// Only UTF-8 (and its ASCII subset) bodies are accepted.
+func mediaType(contentType string) (string, error) {
+	if strings.TrimSpace(contentType) == "" {
+		return TypeJSON, nil
+	}
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: content type %q", ErrUnsupported, contentType)
+	}
+	if cs := strings.ToLower(params["charset"]); cs != "" && cs != "utf-8" && cs != "us-ascii" {
+		return "", fmt.Errorf("%w: charset %q", ErrUnsupported, cs)
+	}
+	switch {
+	case mt == TypeJSON, mt == "text/json", strings.HasSuffix(mt, "+json"):
+		return TypeJSON, nil
+	case mt == TypeForm:
+		return TypeForm, nil
+	case mt == TypeXML, mt == "text/xml", strings.HasSuffix(mt, "+xml"):
+		return TypeXML, nil
+	case mt == TypeText:
+		return TypeText, nil
+	}
+	return "", fmt.Errorf("%w: content type %q", ErrUnsupported, mt)
+}
+
+// decompress undoes contentEncoding, reading at most maxBytes.
+func decompress(contentEncoding string, body []byte, maxBytes int) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", "identity":
+		if len(body) > maxBytes {
+			return nil, ErrTooLarge
+		}
+		return body, nil
+	case "gzip", "x-gzip":
+	default:
+		return nil, fmt.Errorf("%w: content encoding %q", ErrUnsupported, contentEncoding)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(io.LimitReader(zr, int64(maxBytes)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if len(out) > maxBytes {
+		return nil, ErrTooLarge
+	}
+	return out, nil
+}
+
+// formDocument converts a form body to an object of its fields: a string
+// for a field given once, an array of strings for one given more often.
+func formDocument(body []byte) (interface{}, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	doc := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if len(v) == 1 {
+			doc[k] = v[0]
+		} else {
+			doc[k] = v
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,98 @@
+package payload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const limit = 1 << 10
+
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestDecode_ContentTypes(t *testing.T) {
+	for name, tc := range map[string]struct {
+		contentType, body string
+		want              string
+		converted         bool
+	}{
+		"json":             {"application/json", `{"a": 1}`, `{"a": 1}`, false},
+		"no content type":  {"", `[1, 2]`, `[1, 2]`, false},
+		"vendor json":      {"application/vnd.github+json; charset=utf-8", `{"a": 1}`, `{"a": 1}`, false},
+		"empty":            {"text/plain", "", `{}`, false},
+		"form":             {"application/x-www-form-urlencoded", "run=42&status=done&tag=a&tag=b", `{"run": "42", "status": "done", "tag": ["a", "b"]}`, true},
+		"text":             {"text/plain; charset=us-ascii", "instrument ready\n", `{"text": "instrument ready\n"}`, true},
+		"xml":              {"text/xml", `<?xml version="1.0"?><run id="7"><status>done</status><sample>a</sample><sample>b</sample></run>`, `{"run": {"@id": "7", "status": "done", "sample": ["a", "b"]}}`, true},
+		"xml text and ns":  {"application/atom+xml", `<x:feed xmlns:x="urn:x"><x:title lang="en">Hi</x:title><empty/></x:feed>`, `{"feed": {"title": {"@lang": "en", "#text": "Hi"}, "empty": ""}}`, true},
+		"xml root as text": {"application/xml", `<status> ok </status>`, `{"status": "ok"}`, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d, err := Decode(tc.contentType, "", []byte(tc.body), limit)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.want, string(d.JSON))
+			if tc.converted {
+				assert.Equal(t, tc.body, string(d.Original))
+			} else {
+				assert.Nil(t, d.Original)
+			}
+		})
+	}
+}
+
+func TestDecode_Gzip(t *testing.T) {
+	d, err := Decode("application/x-www-form-urlencoded", "gzip", gzipped(t, "a=1"), limit)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a": "1"}`, string(d.JSON))
+	assert.Equal(t, "a=1", string(d.Original), "the original is kept decompressed")
+
+	d, err = Decode("", "GZIP", gzipped(t, `{"a": 1}`), limit)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a": 1}`, string(d.JSON))
+
+	_, err = Decode("", "gzip", []byte(`{"a": 1}`), limit)
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestDecode_LimitAppliesAfterDecompression(t *testing.T) {
+	bomb := gzipped(t, `{"a": "`+strings.Repeat("0", 10*limit)+`"}`)
+	require.Less(t, len(bomb), limit)
+	_, err := Decode("application/json", "gzip", bomb, limit)
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	_, err = Decode("text/plain", "", bytes.Repeat([]byte("a"), limit+1), limit)
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestDecode_Rejects(t *testing.T) {
+	for name, tc := range map[string]struct {
+		contentType, encoding, body string
+		want                        error
+	}{
+		"invalid json":     {"application/json", "", `{"a":`, ErrInvalid},
+		"unknown type":     {"application/octet-stream", "", "x", ErrUnsupported},
+		"bad content type": {"application/", "", "x", ErrUnsupported},
+		"other charset":    {"text/plain; charset=iso-8859-1", "", "x", ErrUnsupported},
+		"other encoding":   {"application/json", "br", "x", ErrUnsupported},
+		"bad form":         {"application/x-www-form-urlencoded", "", "a=%zz", ErrInvalid},
+		"malformed xml":    {"application/xml", "", "<a><b></a>", ErrInvalid},
+		"two roots":        {"application/xml", "", "<a/><b/>", ErrInvalid},
+		"custom entity":    {"application/xml", "", `<!DOCTYPE a [<!ENTITY x "y">]><a>&x;</a>`, ErrInvalid},
+		"too deep":         {"application/xml", "", strings.Repeat("<a>", maxXMLDepth+1) + strings.Repeat("</a>", maxXMLDepth+1), ErrInvalid},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Decode(tc.contentType, tc.encoding, []byte(tc.body), limit)
+			assert.ErrorIs(t, err, tc.want)
+		})
+	}
+}
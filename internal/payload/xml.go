@@ -0,0 +1,105 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxXMLDepth bounds element nesting, which the conversion recurses on.
+const maxXMLDepth = 64
+
+// xmlDocument converts an XML body to {"<root>": <element>}. An element
+// with neither attributes nor children is its trimmed text; otherwise it
+// is an object with "@<name>" for each attribute, a field per child
+// element name (an array when the name repeats) and "#text" for any text.
+// Names drop their namespace prefix, and namespace declarations are left
+// out. encoding/xml expands only the predefined entities, so entity
+// expansion can't inflate the document.
+func xmlDocument(body []byte) (interface{}, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	var doc map[string]interface{}
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if doc != nil {
+				return nil, fmt.Errorf("%w: more than one root element", ErrInvalid)
+			}
+			v, err := xmlElement(dec, t, 1)
+			if err != nil {
+				return nil, err
+			}
+			doc = map[string]interface{}{t.Name.Local: v}
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return nil, fmt.Errorf("%w: text outside the root element", ErrInvalid)
+			}
+		}
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("%w: no root element", ErrInvalid)
+	}
+	return doc, nil
+}
+
+func xmlElement(dec *xml.Decoder, start xml.StartElement, depth int) (interface{}, error) {
+	if depth > maxXMLDepth {
+		return nil, fmt.Errorf("%w: elements nested deeper than %d", ErrInvalid, maxXMLDepth)
+	}
+	obj := make(map[string]interface{})
+	for _, a := range start.Attr {
+		if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" {
+			continue
+		}
+		obj["@"+a.Name.Local] = a.Value
+	}
+
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := xmlElement(dec, t, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			addChild(obj, t.Name.Local, child)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+			if len(obj) == 0 {
+				return s, nil
+			}
+			if s != "" {
+				obj["#text"] = s
+			}
+			return obj, nil
+		}
+	}
+}
+
+// addChild adds a child element, collecting repeated names in an array.
+func addChild(obj map[string]interface{}, name string, child interface{}) {
+	switch existing := obj[name].(type) {
+	case nil:
+		obj[name] = child
+	case []interface{}:
+		obj[name] = append(existing, child)
+	default:
+		obj[name] = []interface{}{existing, child}
+	}
+}
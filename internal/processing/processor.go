@@ -0,0 +1,149 @@
+// Package processing runs stored webhook messages through the processors
+// registered for them. A message moves from received to processing when a
+// worker claims it, then to processed, or to failed and back to processing
+// on each retry until it succeeds or runs out of attempts.
+package processing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+// Message is a claimed message with the name of its sender, "" for the
+// legacy shared secret, and of the channel it was received on, "" for
+// /webhook.
+type Message struct {
+	models.IncomingWebhook
+	Sender  string
+	Channel string
+	// ChannelProcessor is the named processor the channel sends its
+	// messages to, "" to route them like any other message.
+	ChannelProcessor string
+}
+
+// Processor handles one message. An error is retried with backoff unless
+// it is Permanent.
+type Processor interface {
+	Process(ctx context.Context, msg Message) error
+}
+
+// ProcessorFunc adapts a function to Processor.
+type ProcessorFunc func(ctx context.Context, msg Message) error
+
+func (f ProcessorFunc) Process(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// permanentError marks an error retrying can't fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one retrying can't fix, such as a payload the
+// processor doesn't understand, so the message fails without further
+// attempts.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// Route selects the messages a processor handles. An empty field matches
+// any value.
+type Route struct {
+	Sender string
+	Type   string
+}
+
+// DefaultTypeField is the payload field a message's type is read from
+// unless the registry is told otherwise.
+const DefaultTypeField = "type"
+
+// Processors channels can name. The worker registers these; a channel
+// naming any other would never have its messages processed.
+const (
+	ProcessorNotificationRules = "notification-rules"
+	ProcessorNone              = "none"
+)
+
+// IsProcessorName reports whether name is a processor channels can name.
+func IsProcessorName(name string) bool {
+	return name == ProcessorNotificationRules || name == ProcessorNone
+}
+
+// Registry maps routes and names to processors.
+type Registry struct {
+	typePath   []string
+	processors map[Route]Processor
+	named      map[string]Processor
+}
+
+// NewRegistry returns an empty registry reading message types from the
+// payload field at typePath, DefaultTypeField if none is given.
+func NewRegistry(typePath ...string) *Registry {
+	if len(typePath) == 0 {
+		typePath = []string{DefaultTypeField}
+	}
+	return &Registry{typePath: typePath, processors: make(map[Route]Processor), named: make(map[string]Processor)}
+}
+
+// Register sends messages matching route to p, replacing any processor
+// registered for the same route.
+func (r *Registry) Register(route Route, p Processor) {
+	r.processors[route] = p
+}
+
+// RegisterNamed makes p available to channels by name, replacing any
+// processor registered under the same name.
+func (r *Registry) RegisterNamed(name string, p Processor) {
+	r.named[name] = p
+}
+
+// Lookup returns the processor for msg. A message whose channel names a
+// processor goes to that one alone. Otherwise the most specific route
+// wins: sender and type, then sender, then type, then the catch-all
+// Route{}.
+func (r *Registry) Lookup(msg Message) (Processor, bool) {
+	if msg.ChannelProcessor != "" {
+		p, ok := r.named[msg.ChannelProcessor]
+		return p, ok
+	}
+	typ := r.Type(msg)
+	for _, route := range []Route{
+		{Sender: msg.Sender, Type: typ},
+		{Sender: msg.Sender},
+		{Type: typ},
+		{},
+	} {
+		if p, ok := r.processors[route]; ok {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Type returns msg's type: the string at the registry's type path in the
+// payload, or "" if there is none.
+func (r *Registry) Type(msg Message) string {
+	var v interface{}
+	if err := json.Unmarshal(msg.Payload, &v); err != nil {
+		return ""
+	}
+	for _, key := range r.typePath {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = obj[key]
+	}
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,77 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func message(sender, payload string) Message {
+	return Message{IncomingWebhook: models.IncomingWebhook{Payload: []byte(payload)}, Sender: sender}
+}
+
+func named(name string) Processor {
+	return ProcessorFunc(func(context.Context, Message) error { return errors.New(name) })
+}
+
+func lookupName(t *testing.T, r *Registry, msg Message) string {
+	p, ok := r.Lookup(msg)
+	if !ok {
+		return ""
+	}
+	return p.Process(context.Background(), msg).Error()
+}
+
+func TestRegistry_MostSpecificRouteWins(t *testing.T) {
+	r := NewRegistry()
+	r.Register(Route{Sender: "ci", Type: "pipeline"}, named("ci-pipeline"))
+	r.Register(Route{Sender: "ci"}, named("ci"))
+	r.Register(Route{Type: "pipeline"}, named("pipeline"))
+
+	assert.Equal(t, "ci-pipeline", lookupName(t, r, message("ci", `{"type":"pipeline"}`)))
+	assert.Equal(t, "ci", lookupName(t, r, message("ci", `{"type":"job"}`)))
+	assert.Equal(t, "pipeline", lookupName(t, r, message("lims", `{"type":"pipeline"}`)))
+	assert.Equal(t, "", lookupName(t, r, message("lims", `{"type":"sample"}`)))
+
+	r.Register(Route{}, named("catch-all"))
+	assert.Equal(t, "catch-all", lookupName(t, r, message("", `not json`)))
+}
+
+func TestRegistry_ChannelProcessor(t *testing.T) {
+	r := NewRegistry()
+	r.Register(Route{Sender: "ci"}, named("ci"))
+	r.RegisterNamed("lims-runs", named("lims-runs"))
+
+	msg := message("ci", `{}`)
+	msg.Channel, msg.ChannelProcessor = "lims", "lims-runs"
+	assert.Equal(t, "lims-runs", lookupName(t, r, msg), "the channel's processor beats every route")
+
+	msg.ChannelProcessor = "missing"
+	assert.Equal(t, "", lookupName(t, r, msg), "a channel's messages don't fall back to routes")
+}
+
+func TestIsProcessorName(t *testing.T) {
+	assert.True(t, IsProcessorName(ProcessorNotificationRules))
+	assert.True(t, IsProcessorName(ProcessorNone))
+	assert.False(t, IsProcessorName("notification_rules"))
+	assert.False(t, IsProcessorName(""))
+}
+
+func TestRegistry_Type(t *testing.T) {
+	assert.Equal(t, "push", NewRegistry().Type(message("", `{"type":"push"}`)))
+	assert.Equal(t, "", NewRegistry().Type(message("", `{"type":1}`)))
+	assert.Equal(t, "", NewRegistry().Type(message("", `[]`)))
+	assert.Equal(t, "created", NewRegistry("event", "action").Type(message("", `{"event":{"action":"created"}}`)))
+}
+
+func TestPermanent(t *testing.T) {
+	base := errors.New("unsupported payload")
+	err := fmt.Errorf("acme: %w", Permanent(base))
+	assert.True(t, IsPermanent(err))
+	assert.ErrorIs(t, err, base)
+	assert.False(t, IsPermanent(base))
+}
@@ -0,0 +1,238 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/metrics"
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+// stopMargin is how much of the invocation deadline is left unused so the
+// last batch finishes before Lambda times out. Whatever is still due is
+// picked up by the next run.
+const stopMargin = 30 * time.Second
+
+// maxErrorLength bounds the error recorded on a failed message.
+const maxErrorLength = 1000
+
+// Policy configures a worker.
+type Policy struct {
+	// BatchSize is how many messages are claimed at a time.
+	BatchSize int
+	// MaxAttempts is how many times a message is tried before it is left
+	// failed.
+	MaxAttempts int
+	// Backoff is the delay before the first retry; each further retry
+	// waits twice as long, up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Lease is how long a claimed message is held before another worker
+	// may claim it; longer than any processor takes.
+	Lease time.Duration
+}
+
+// RetryDelay is how long to wait after the given failed attempt (1-based).
+func (p Policy) RetryDelay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// Result summarizes a run.
+type Result struct {
+	Processed int64 `json:"processed"`
+	// Unrouted messages had no processor and were marked processed.
+	Unrouted int64 `json:"unrouted"`
+	Retried  int64 `json:"retried"`
+	// Failed messages are out of attempts or failed permanently.
+	Failed int64 `json:"failed"`
+	// Complete is false when the run stopped at the deadline with
+	// messages possibly still due.
+	Complete bool `json:"complete"`
+}
+
+// Worker processes due messages from a store.
+type Worker struct {
+	store    db.ProcessingStore
+	registry *Registry
+	policy   Policy
+	now      func() time.Time
+}
+
+// NewWorker returns a Worker dispatching to the processors in registry.
+func NewWorker(store db.ProcessingStore, registry *Registry, policy Policy) *Worker {
+	return &Worker{store: store, registry: registry, policy: policy, now: time.Now}
+}
+
+// Run claims and processes batches of due messages until none are left or
+// the deadline is near.
+func (w *Worker) Run(ctx context.Context) (Result, error) {
+	if w.policy.BatchSize <= 0 || w.policy.MaxAttempts <= 0 {
+		return Result{}, fmt.Errorf("processing batch size and max attempts must be positive, got %d and %d",
+			w.policy.BatchSize, w.policy.MaxAttempts)
+	}
+	if err := w.store.Ready(ctx); err != nil {
+		return Result{}, err
+	}
+
+	res := Result{Complete: true}
+	abandoned, err := w.store.FailAbandonedWebhookMessages(ctx, w.policy.MaxAttempts)
+	if err != nil {
+		return res, err
+	}
+	if abandoned > 0 {
+		res.Failed += abandoned
+		log.Printf("ERROR %d messages failed: their last attempt's claim expired", abandoned)
+	}
+	for {
+		if w.nearDeadline(ctx) {
+			res.Complete = false
+			break
+		}
+		n, err := w.batch(ctx, &res)
+		if err != nil {
+			return res, err
+		}
+		if n < w.policy.BatchSize {
+			break
+		}
+	}
+
+	metrics.Emit(map[string]float64{
+		"ProcessingProcessed": float64(res.Processed),
+		"ProcessingUnrouted":  float64(res.Unrouted),
+		"ProcessingRetried":   float64(res.Retried),
+		"ProcessingFailed":    float64(res.Failed),
+	}, nil)
+	log.Printf("processing: %d processed (%d unrouted), %d to retry, %d failed, complete=%v",
+		res.Processed, res.Unrouted, res.Retried, res.Failed, res.Complete)
+	return res, nil
+}
+
+// batch claims and processes one batch, returning how many were claimed.
+func (w *Worker) batch(ctx context.Context, res *Result) (int, error) {
+	claimed, err := w.store.ClaimWebhookMessages(ctx, w.policy.BatchSize, w.policy.Lease, w.policy.MaxAttempts)
+	if err != nil || len(claimed) == 0 {
+		return 0, err
+	}
+	senders, err := w.senderNames(ctx)
+	if err != nil {
+		return 0, err
+	}
+	channels, err := w.channels(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, rec := range claimed {
+		msg := Message{IncomingWebhook: rec, Sender: senders[rec.SenderID]}
+		if c, ok := channels[rec.ChannelID]; ok {
+			msg.Channel, msg.ChannelProcessor = c.Name, c.Processor
+		}
+		if err := w.process(ctx, msg, res); err != nil {
+			if errors.Is(err, db.ErrClaimLost) {
+				// Another worker reclaimed it after our lease ran out and
+				// will record its own outcome.
+				log.Printf("WARN %v", err)
+				continue
+			}
+			return len(claimed), err
+		}
+	}
+	return len(claimed), nil
+}
+
+// process runs msg through its processor and records the outcome.
+func (w *Worker) process(ctx context.Context, msg Message, res *Result) error {
+	attempt := msg.Processing.Attempts
+	var err error
+	p, ok := w.registry.Lookup(msg)
+	switch {
+	case ok:
+		err = run(ctx, p, msg)
+	case msg.ChannelProcessor != "":
+		// Retried like a failure, so messages wait for a worker that
+		// has the processor rather than being dropped.
+		err = fmt.Errorf("channel %s names unregistered processor %q", msg.Channel, msg.ChannelProcessor)
+	default:
+		res.Processed++
+		res.Unrouted++
+		return w.store.MarkWebhookMessageProcessed(ctx, msg.ID, attempt)
+	}
+	if err == nil {
+		res.Processed++
+		return w.store.MarkWebhookMessageProcessed(ctx, msg.ID, attempt)
+	}
+
+	errMsg := err.Error()
+	if len(errMsg) > maxErrorLength {
+		errMsg = strings.ToValidUTF8(errMsg[:maxErrorLength], "")
+	}
+	var retryAt *time.Time
+	if !IsPermanent(err) && attempt < w.policy.MaxAttempts {
+		t := w.now().Add(w.policy.RetryDelay(attempt))
+		retryAt = &t
+		res.Retried++
+		log.Printf("WARN message %s attempt %d failed, retrying at %s: %v", msg.RequestID, attempt, t.Format(time.RFC3339), err)
+	} else {
+		res.Failed++
+		log.Printf("ERROR message %s failed after %d attempts: %v", msg.RequestID, attempt, err)
+	}
+	return w.store.MarkWebhookMessageFailed(ctx, msg.ID, attempt, errMsg, retryAt)
+}
+
+// run calls p, turning a panic into an error so one bad message can't
+// stop the batch.
+func run(ctx context.Context, p Processor, msg Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("processor panic: %v", r)
+		}
+	}()
+	return p.Process(ctx, msg)
+}
+
+// senderNames maps sender ids to names.
+func (w *Worker) senderNames(ctx context.Context) (map[int64]string, error) {
+	senders, err := w.store.ListSenders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[int64]string, len(senders))
+	for _, s := range senders {
+		names[s.ID] = s.Name
+	}
+	return names, nil
+}
+
+// channels maps channel ids to channels.
+func (w *Worker) channels(ctx context.Context) (map[int64]models.Channel, error) {
+	channels, err := w.store.ListChannels(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]models.Channel, len(channels))
+	for _, c := range channels {
+		byID[c.ID] = c
+	}
+	return byID, nil
+}
+
+func (w *Worker) nearDeadline(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && deadline.Sub(w.now()) < stopMargin
+}
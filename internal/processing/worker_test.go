@@ -0,0 +1,187 @@
+package processing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/Pennsieve/integration-service/internal/sender_auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPolicy = Policy{BatchSize: 2, MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour, Lease: 5 * time.Minute}
+
+// clock is a settable time shared by a worker and its store.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestWorker(t *testing.T, registry *Registry, payloads ...string) (*Worker, *db.Memory, *clock) {
+	c := &clock{t: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)}
+	store := db.NewMemory()
+	store.SetNow(c.now)
+	acme, err := store.CreateSender(context.Background(), "acme", sender_auth.HashSecret("s"), sender_auth.DefaultScopes)
+	require.NoError(t, err)
+	for _, p := range payloads {
+		_, err := store.InsertWebhookMessage(context.Background(), models.IncomingWebhook{SenderID: acme.ID, Payload: []byte(p)})
+		require.NoError(t, err)
+	}
+	w := NewWorker(store, registry, testPolicy)
+	w.now = c.now
+	return w, store, c
+}
+
+func statuses(store *db.Memory) []string {
+	var res []string
+	for _, m := range store.Messages() {
+		res = append(res, m.Processing.Status)
+	}
+	return res
+}
+
+func TestWorker_ProcessesAcrossBatches(t *testing.T) {
+	var seen []string
+	r := NewRegistry()
+	r.Register(Route{Sender: "acme"}, ProcessorFunc(func(_ context.Context, msg Message) error {
+		seen = append(seen, string(msg.Payload))
+		return nil
+	}))
+	w, store, _ := newTestWorker(t, r, `{"n":1}`, `{"n":2}`, `{"n":3}`)
+
+	res, err := w.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Result{Processed: 3, Complete: true}, res)
+	assert.Equal(t, []string{`{"n":1}`, `{"n":2}`, `{"n":3}`}, seen)
+	assert.Equal(t, []string{models.MessageProcessed, models.MessageProcessed, models.MessageProcessed}, statuses(store))
+}
+
+func TestWorker_UnroutedMessagesAreProcessed(t *testing.T) {
+	w, store, _ := newTestWorker(t, NewRegistry(), `{}`)
+	res, err := w.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Result{Processed: 1, Unrouted: 1, Complete: true}, res)
+	assert.Equal(t, []string{models.MessageProcessed}, statuses(store))
+}
+
+func TestWorker_RetriesWithBackoffUntilOutOfAttempts(t *testing.T) {
+	r := NewRegistry()
+	r.Register(Route{}, ProcessorFunc(func(context.Context, Message) error { return errors.New("downstream unavailable") }))
+	w, store, c := newTestWorker(t, r, `{}`)
+	start := c.t
+
+	for attempt, wantRetry := range []time.Duration{time.Minute, 2 * time.Minute} {
+		res, err := w.Run(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Result{Retried: 1, Complete: true}, res, "attempt %d", attempt+1)
+
+		p := store.Messages()[0].Processing
+		assert.Equal(t, models.MessageFailed, p.Status)
+		assert.Equal(t, "downstream unavailable", p.LastError)
+		require.NotNil(t, p.NextAttemptAt)
+		assert.Equal(t, c.t.Add(wantRetry), *p.NextAttemptAt)
+
+		// Not due again until the backoff has passed.
+		res, err = w.Run(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, Result{Complete: true}, res)
+		c.t = *p.NextAttemptAt
+	}
+
+	res, err := w.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Result{Failed: 1, Complete: true}, res)
+	p := store.Messages()[0].Processing
+	assert.Equal(t, models.MessageFailed, p.Status)
+	assert.Equal(t, 3, p.Attempts)
+	assert.Nil(t, p.NextAttemptAt, "out of attempts")
+	assert.True(t, c.t.After(start))
+}
+
+func TestWorker_FailsMessagesWhoseRunsDie(t *testing.T) {
+	w, store, c := newTestWorker(t, NewRegistry(), `{}`)
+
+	// Claim every attempt and drop it, as a run killed mid-batch would.
+	for attempt := 1; attempt <= testPolicy.MaxAttempts; attempt++ {
+		claimed, err := store.ClaimWebhookMessages(context.Background(), 10, testPolicy.Lease, testPolicy.MaxAttempts)
+		require.NoError(t, err)
+		require.Len(t, claimed, 1, "attempt %d", attempt)
+		c.t = c.t.Add(testPolicy.Lease)
+	}
+
+	res, err := w.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Result{Failed: 1, Complete: true}, res)
+	p := store.Messages()[0].Processing
+	assert.Equal(t, models.MessageFailed, p.Status)
+	assert.Equal(t, testPolicy.MaxAttempts, p.Attempts)
+	assert.Equal(t, db.AbandonedError, p.LastError)
+	assert.Nil(t, p.NextAttemptAt, "not claimed again")
+}
+
+func TestWorker_PermanentErrorsAndPanicsFail(t *testing.T) {
+	r := NewRegistry()
+	r.Register(Route{Type: "bad"}, ProcessorFunc(func(context.Context, Message) error {
+		return Permanent(errors.New("unsupported payload"))
+	}))
+	r.Register(Route{Type: "crash"}, ProcessorFunc(func(context.Context, Message) error { panic("nil map") }))
+	w, store, _ := newTestWorker(t, r, `{"type":"bad"}`, `{"type":"crash"}`)
+
+	res, err := w.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.Failed)
+	assert.Equal(t, int64(1), res.Retried)
+	msgs := store.Messages()
+	assert.Nil(t, msgs[0].Processing.NextAttemptAt, "permanent errors aren't retried")
+	assert.Equal(t, "processor panic: nil map", msgs[1].Processing.LastError)
+	assert.NotNil(t, msgs[1].Processing.NextAttemptAt)
+}
+
+func TestWorker_ChannelProcessors(t *testing.T) {
+	var seen []Message
+	r := NewRegistry()
+	r.RegisterNamed("lims-runs", ProcessorFunc(func(_ context.Context, msg Message) error {
+		seen = append(seen, msg)
+		return nil
+	}))
+	w, store, _ := newTestWorker(t, r)
+	ctx := context.Background()
+	for _, c := range []models.Channel{{Name: "lims", Processor: "lims-runs"}, {Name: "scheduler", Processor: "cron"}} {
+		c, err := store.PutChannel(ctx, c)
+		require.NoError(t, err)
+		_, err = store.InsertWebhookMessage(ctx, models.IncomingWebhook{ChannelID: c.ID, Payload: []byte(`{}`)})
+		require.NoError(t, err)
+	}
+
+	res, err := w.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Processed: 1, Retried: 1, Complete: true}, res)
+	require.Len(t, seen, 1)
+	assert.Equal(t, "lims", seen[0].Channel)
+	msgs := store.Messages()
+	assert.Equal(t, `channel scheduler names unregistered processor "cron"`, msgs[1].Processing.LastError)
+	assert.NotNil(t, msgs[1].Processing.NextAttemptAt, "retried until a worker has the processor")
+}
+
+func TestWorker_StopsNearDeadline(t *testing.T) {
+	w, store, c := newTestWorker(t, NewRegistry(), `{}`)
+	ctx, cancel := context.WithDeadline(context.Background(), c.t.Add(stopMargin/2))
+	defer cancel()
+
+	res, err := w.Run(ctx)
+	require.NoError(t, err)
+	assert.False(t, res.Complete)
+	assert.Equal(t, []string{models.MessageReceived}, statuses(store))
+}
+
+func TestPolicy_RetryDelay(t *testing.T) {
+	p := Policy{Backoff: time.Minute, MaxBackoff: 5 * time.Minute}
+	var got []time.Duration
+	for attempt := 1; attempt <= 5; attempt++ {
+		got = append(got, p.RetryDelay(attempt))
+	}
+	assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}, got)
+}
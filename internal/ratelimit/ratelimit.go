@@ -0,0 +1,203 @@
+// Package ratelimit holds the webhook receiver's token-bucket policy: how
+// requests are keyed, the quota for each key, and the RateLimit-* response
+// headers describing a decision. The buckets themselves live in the store
+// (db.RateLimitStore) so every Lambda instance shares them.
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Quota allows Limit requests per Period: a bucket holds at most Limit
+// tokens and refills at Limit/Period, so a sender can burst up to Limit
+// and then sustain the average rate, with no doubled burst at a window
+// boundary.
+type Quota struct {
+	Limit  int
+	Period time.Duration
+}
+
+// DefaultQuota is used when no quota is configured.
+var DefaultQuota = Quota{Limit: 60, Period: time.Minute}
+
+// DefaultPreAuthQuota is the pre-authentication quota of each source IP
+// when none is configured: generous enough for several senders behind
+// one NAT, low enough to bound the sender lookups a stranger can cause.
+var DefaultPreAuthQuota = Quota{Limit: 600, Period: time.Minute}
+
+// ParseQuota parses "<limit>/<period>", e.g. "60/1m" or "1000/1h".
+func ParseQuota(s string) (Quota, error) {
+	limit, period, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Quota{}, fmt.Errorf("invalid quota %q, want <limit>/<period>", s)
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n <= 0 {
+		return Quota{}, fmt.Errorf("invalid quota %q: limit must be a positive integer", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Quota{}, fmt.Errorf("invalid quota %q: period must be a positive duration", s)
+	}
+	return Quota{Limit: n, Period: d}, nil
+}
+
+// RefillPerSecond is how many tokens the bucket regains each second.
+func (q Quota) RefillPerSecond() float64 {
+	return float64(q.Limit) / q.Period.Seconds()
+}
+
+func (q Quota) String() string {
+	return fmt.Sprintf("%d/%s", q.Limit, q.Period)
+}
+
+// KeyBy selects what a bucket is keyed on.
+type KeyBy string
+
+const (
+	// KeyBySender gives each registered sender its own bucket. Requests
+	// without one (the legacy shared secret) fall back to their source IP.
+	KeyBySender KeyBy = "sender"
+	// KeyByIP gives each source IP its own bucket.
+	KeyByIP KeyBy = "ip"
+	// KeyBySecret gives each presented credential its own bucket, so
+	// senders behind a shared NAT or proxy don't throttle each other.
+	// Signed requests present no secret and are keyed as by sender.
+	KeyBySecret KeyBy = "secret"
+)
+
+// ParseKeyBy validates a configured key kind.
+func ParseKeyBy(s string) (KeyBy, error) {
+	switch k := KeyBy(strings.ToLower(strings.TrimSpace(s))); k {
+	case KeyBySender, KeyByIP, KeyBySecret:
+		return k, nil
+	}
+	return "", fmt.Errorf("invalid rate limit key %q, want %q, %q or %q", s, KeyBySender, KeyByIP, KeyBySecret)
+}
+
+// Request is what a bucket key can be derived from.
+type Request struct {
+	// Sender is the registered sender's name, empty if there is none.
+	Sender   string
+	SourceIP string
+	Secret   string
+}
+
+// Policy decides which bucket a request draws from and how big it is.
+type Policy struct {
+	By      KeyBy
+	Default Quota
+	// PreAuth is the quota each source IP draws from before its
+	// credentials are checked, so unauthenticated requests can't each
+	// cost a sender lookup without limit. A zero Limit turns it off.
+	PreAuth Quota
+	// Overrides maps bucket keys, as returned by Key (e.g.
+	// "sender:acme" or "ip:203.0.113.7"), to their own quota.
+	Overrides map[string]Quota
+}
+
+// DefaultPolicy limits each sender to DefaultQuota, and each source IP to
+// DefaultPreAuthQuota before authentication.
+func DefaultPolicy() Policy {
+	return Policy{By: KeyBySender, Default: DefaultQuota, PreAuth: DefaultPreAuthQuota}
+}
+
+// Key returns the bucket key for req, prefixed with its kind so keys of
+// different kinds never collide. Secrets are keyed by a short SHA-256
+// fingerprint so the store never holds a usable credential.
+func (p Policy) Key(req Request) string {
+	switch {
+	case p.By == KeyBySecret && req.Secret != "":
+		return "secret:" + Fingerprint(req.Secret)
+	case p.By != KeyByIP && req.Sender != "":
+		return "sender:" + req.Sender
+	default:
+		return "ip:" + req.SourceIP
+	}
+}
+
+// preAuthPrefix starts pre-authentication bucket keys.
+const preAuthPrefix = "preauth:"
+
+// PreAuthKey returns the key of the pre-authentication bucket of a source
+// IP. Overrides apply to it like to any other key.
+func (p Policy) PreAuthKey(sourceIP string) string {
+	return preAuthPrefix + sourceIP
+}
+
+// Quota returns the quota for a bucket key.
+func (p Policy) Quota(key string) Quota {
+	if q, ok := p.Overrides[key]; ok {
+		return q
+	}
+	if strings.HasPrefix(key, preAuthPrefix) {
+		return p.PreAuth
+	}
+	return p.Default
+}
+
+// Fingerprint identifies a secret in logs and configuration without
+// revealing it.
+func Fingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Decision is the outcome of drawing a token.
+type Decision struct {
+	Allowed bool
+	Quota   Quota
+	// Tokens is what is left in the bucket after this request.
+	Tokens float64
+}
+
+// Remaining is how many further requests would be allowed right now.
+func (d Decision) Remaining() int {
+	return int(math.Max(0, math.Floor(d.Tokens)))
+}
+
+// Reset is how long until the bucket is full again.
+func (d Decision) Reset() time.Duration {
+	return d.refillTime(float64(d.Quota.Limit) - d.Tokens)
+}
+
+// RetryAfter is how long until the next request would be allowed.
+func (d Decision) RetryAfter() time.Duration {
+	if d.Tokens >= 1 {
+		return 0
+	}
+	return d.refillTime(1 - d.Tokens)
+}
+
+func (d Decision) refillTime(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / d.Quota.RefillPerSecond() * float64(time.Second))
+}
+
+// Headers returns the RateLimit-Limit, -Remaining and -Reset headers
+// (IETF draft-ietf-httpapi-ratelimit-headers), plus Retry-After on a
+// rejection. Durations are whole seconds, rounded up so a client that
+// waits exactly that long is not rejected again.
+func (d Decision) Headers() map[string]string {
+	h := map[string]string{
+		"RateLimit-Limit":     strconv.Itoa(d.Quota.Limit),
+		"RateLimit-Remaining": strconv.Itoa(d.Remaining()),
+		"RateLimit-Reset":     strconv.Itoa(ceilSeconds(d.Reset())),
+	}
+	if !d.Allowed {
+		h["Retry-After"] = strconv.Itoa(max(1, ceilSeconds(d.RetryAfter())))
+	}
+	return h
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuota(t *testing.T) {
+	q, err := ParseQuota("60/1m")
+	require.NoError(t, err)
+	assert.Equal(t, Quota{Limit: 60, Period: time.Minute}, q)
+	assert.Equal(t, 1.0, q.RefillPerSecond())
+
+	for _, bad := range []string{"", "60", "0/1m", "-1/1m", "60/0s", "60/soon", "x/1m"} {
+		_, err := ParseQuota(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestPolicy_KeyAndQuota(t *testing.T) {
+	req := Request{Sender: "acme", SourceIP: "203.0.113.7", Secret: "s3cret"}
+
+	p := DefaultPolicy()
+	assert.Equal(t, "sender:acme", p.Key(req))
+	assert.Equal(t, "ip:203.0.113.7", p.Key(Request{SourceIP: "203.0.113.7", Secret: "s3cret"}), "no sender falls back to IP")
+
+	p = Policy{By: KeyByIP, Default: DefaultQuota, Overrides: map[string]Quota{"ip:203.0.113.7": {Limit: 5, Period: time.Second}}}
+	assert.Equal(t, "ip:203.0.113.7", p.Key(req))
+	assert.Equal(t, Quota{Limit: 5, Period: time.Second}, p.Quota(p.Key(req)))
+	assert.Equal(t, DefaultQuota, p.Quota("ip:10.0.0.1"))
+
+	p.By = KeyBySecret
+	key := p.Key(req)
+	assert.Equal(t, "secret:"+Fingerprint("s3cret"), key)
+	assert.NotContains(t, key, "s3cret")
+	assert.Len(t, Fingerprint("s3cret"), 16)
+	assert.Equal(t, "sender:acme", p.Key(Request{Sender: "acme", SourceIP: "203.0.113.7"}), "signed requests have no secret")
+
+	p = DefaultPolicy()
+	p.Overrides = map[string]Quota{"preauth:10.0.0.1": {Limit: 5000, Period: time.Minute}}
+	assert.Equal(t, "preauth:203.0.113.7", p.PreAuthKey("203.0.113.7"))
+	assert.Equal(t, DefaultPreAuthQuota, p.Quota(p.PreAuthKey("203.0.113.7")))
+	assert.Equal(t, Quota{Limit: 5000, Period: time.Minute}, p.Quota(p.PreAuthKey("10.0.0.1")))
+}
+
+func TestDecision_Headers(t *testing.T) {
+	q := Quota{Limit: 60, Period: time.Minute}
+
+	allowed := Decision{Allowed: true, Quota: q, Tokens: 57.5}
+	assert.Equal(t, map[string]string{
+		"RateLimit-Limit":     "60",
+		"RateLimit-Remaining": "57",
+		"RateLimit-Reset":     "3",
+	}, allowed.Headers())
+
+	rejected := Decision{Allowed: false, Quota: q, Tokens: 0.25}
+	assert.Equal(t, map[string]string{
+		"RateLimit-Limit":     "60",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "60",
+		"Retry-After":         "1",
+	}, rejected.Headers())
+	assert.Equal(t, 750*time.Millisecond, rejected.RetryAfter())
+
+	slow := Decision{Allowed: false, Quota: Quota{Limit: 10, Period: time.Hour}, Tokens: 0}
+	assert.Equal(t, "360", slow.Headers()["Retry-After"])
+}
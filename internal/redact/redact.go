@@ -0,0 +1,93 @@
+// Package redact removes credentials from the request metadata the webhook
+// receiver stores alongside each message, so a secret presented by a
+// sender is never persisted.
+package redact
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Placeholder replaces a redacted value, so the stored request still shows
+// that the header or parameter was sent.
+const Placeholder = "[REDACTED]"
+
+// DefaultHeaders are always redacted, whatever else is configured.
+var DefaultHeaders = []string{
+	"authorization",
+	"proxy-authorization",
+	"cookie",
+	"set-cookie",
+	"x-pennsieve-webhook-secret",
+	"x-api-key",
+	"x-amz-security-token",
+}
+
+// sensitiveWords redact any header or query parameter whose name contains
+// one of them, which catches provider-specific credentials such as
+// X-Gitlab-Token or ?access_token= without listing each one.
+var sensitiveWords = []string{"secret", "token", "password", "passwd", "apikey", "api-key", "api_key", "credential", "session"}
+
+// Headers returns a copy of headers with lower-case names and the values
+// of DefaultHeaders, the names in extra and any name containing a
+// sensitive word replaced by Placeholder.
+func Headers(headers map[string]string, extra []string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	redacted := make(map[string]bool, len(DefaultHeaders)+len(extra))
+	for _, name := range append(append([]string(nil), DefaultHeaders...), extra...) {
+		redacted[strings.ToLower(name)] = true
+	}
+	out := make(map[string]string, len(headers))
+	for k, v := range headers {
+		name := strings.ToLower(k)
+		if redacted[name] || sensitive(name) {
+			v = Placeholder
+		}
+		out[name] = v
+	}
+	return out
+}
+
+// Query returns the raw query string with the values of parameters whose
+// name contains a sensitive word replaced by Placeholder. Parameter order
+// and encoding are otherwise kept as sent.
+func Query(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	params := strings.Split(raw, "&")
+	for i, p := range params {
+		rawName, _, hasValue := strings.Cut(p, "=")
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			name = rawName
+		}
+		if hasValue && sensitive(strings.ToLower(name)) {
+			params[i] = rawName + "=" + url.QueryEscape(Placeholder)
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// ParseList parses a comma-separated list of header names, ignoring
+// blanks.
+func ParseList(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, strings.ToLower(name))
+		}
+	}
+	return names
+}
+
+func sensitive(name string) bool {
+	for _, w := range sensitiveWords {
+		if strings.Contains(name, w) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package redact
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaders(t *testing.T) {
+	in := map[string]string{
+		"Content-Type":               "application/json",
+		"X-Pennsieve-Webhook-Secret": "s3cret",
+		"authorization":              "Bearer abc",
+		"X-Gitlab-Token":             "glt",
+		"X-Hub-Signature-256":        "sha256=00",
+		"X-Internal-Key":             "k",
+	}
+	out := Headers(in, []string{"X-Internal-Key"})
+	assert.Equal(t, map[string]string{
+		"content-type":               "application/json",
+		"x-pennsieve-webhook-secret": Placeholder,
+		"authorization":              Placeholder,
+		"x-gitlab-token":             Placeholder,
+		"x-hub-signature-256":        "sha256=00",
+		"x-internal-key":             Placeholder,
+	}, out)
+	assert.Equal(t, "s3cret", in["X-Pennsieve-Webhook-Secret"], "input is not modified")
+	assert.Nil(t, Headers(nil, nil))
+}
+
+func TestQuery(t *testing.T) {
+	assert.Equal(t, "", Query(""))
+	assert.Equal(t, "sender=acme&b=2", Query("sender=acme&b=2"))
+	assert.Equal(t, "sender=acme&access_token=%5BREDACTED%5D&flag",
+		Query("sender=acme&access_token=abc&flag"))
+	assert.Equal(t, "api%5Fkey=%5BREDACTED%5D", Query("api%5Fkey=abc"), "names are matched decoded")
+}
+
+func TestParseList(t *testing.T) {
+	assert.Equal(t, []string{"x-a", "x-b"}, ParseList(" X-A, ,x-b,"))
+	assert.Nil(t, ParseList(""))
+}
@@ -0,0 +1,117 @@
+package retention
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Archiver stores one archive file and returns where it went.
+type Archiver interface {
+	Archive(ctx context.Context, name string, data []byte) (location string, err error)
+}
+
+// archivedMessage is one NDJSON line. Payload is embedded as JSON, not a
+// base64 string, so archives can be queried in place (e.g. with Athena).
+// The request fields are omitted for messages stored without them, and
+// raw_body (base64) for messages whose body was JSON.
+type archivedMessage struct {
+	ID          int64             `json:"id"`
+	RequestID   string            `json:"request_id"`
+	SenderID    int64             `json:"sender_id,omitempty"`
+	ChannelID   int64             `json:"channel_id,omitempty"`
+	Payload     json.RawMessage   `json:"payload"`
+	ReceivedAt  time.Time         `json:"received_at"`
+	Method      string            `json:"method,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	SourceIP    string            `json:"source_ip,omitempty"`
+	UserAgent   string            `json:"user_agent,omitempty"`
+	ContentType string            `json:"content_type,omitempty"`
+	QueryString string            `json:"query_string,omitempty"`
+	RawBody     []byte            `json:"raw_body,omitempty"`
+}
+
+// EncodeNDJSONGzip renders messages as gzip-compressed newline-delimited
+// JSON, one message per line.
+func EncodeNDJSONGzip(messages []models.IncomingWebhook) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, m := range messages {
+		payload := json.RawMessage(m.Payload)
+		if !json.Valid(payload) {
+			// The column is JSONB, so this only guards against a
+			// hand-edited row breaking the whole archive.
+			b, _ := json.Marshal(string(m.Payload))
+			payload = b
+		}
+		line := archivedMessage{
+			ID:          m.ID,
+			RequestID:   m.RequestID,
+			SenderID:    m.SenderID,
+			ChannelID:   m.ChannelID,
+			Payload:     payload,
+			ReceivedAt:  m.ReceivedAt.UTC(),
+			Method:      m.Request.Method,
+			Headers:     m.Request.Headers,
+			SourceIP:    m.Request.SourceIP,
+			UserAgent:   m.Request.UserAgent,
+			ContentType: m.Request.ContentType,
+			QueryString: m.Request.QueryString,
+			RawBody:     m.RawBody,
+		}
+		if err := enc.Encode(line); err != nil {
+			return nil, fmt.Errorf("encode message %d: %w", m.ID, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// archiveName is partitioned by run date and names the id range it holds,
+// e.g. webhooks.messages/2026/10/19/1001-2000.ndjson.gz.
+func archiveName(now time.Time, batch []models.IncomingWebhook) string {
+	return path.Join("webhooks.messages", now.UTC().Format("2006/01/02"),
+		fmt.Sprintf("%d-%d.ndjson.gz", batch[0].ID, batch[len(batch)-1].ID))
+}
+
+// S3PutAPI is the subset of the S3 client used by S3Archiver.
+type S3PutAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3Archiver writes archives to bucket under prefix.
+type S3Archiver struct {
+	client S3PutAPI
+	bucket string
+	prefix string
+}
+
+func NewS3Archiver(client S3PutAPI, bucket, prefix string) *S3Archiver {
+	return &S3Archiver{client: client, bucket: bucket, prefix: prefix}
+}
+
+func (a *S3Archiver) Archive(ctx context.Context, name string, data []byte) (string, error) {
+	key := path.Join(a.prefix, name)
+	contentType, contentEncoding := "application/x-ndjson", "gzip"
+	_, err := a.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:          &a.bucket,
+		Key:             &key,
+		Body:            bytes.NewReader(data),
+		ContentType:     &contentType,
+		ContentEncoding: &contentEncoding,
+	})
+	if err != nil {
+		return "", fmt.Errorf("put s3://%s/%s: %w", a.bucket, key, err)
+	}
+	return fmt.Sprintf("s3://%s/%s", a.bucket, key), nil
+}
@@ -0,0 +1,77 @@
+package retention
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, data []byte) []archivedMessage {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	var lines []archivedMessage
+	sc := bufio.NewScanner(zr)
+	for sc.Scan() {
+		var m archivedMessage
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &m))
+		lines = append(lines, m)
+	}
+	require.NoError(t, sc.Err())
+	return lines
+}
+
+func TestEncodeNDJSONGzip(t *testing.T) {
+	received := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	data, err := EncodeNDJSONGzip([]models.IncomingWebhook{
+		{ID: 1, RequestID: "a", Payload: []byte(`{"x": [1, 2]}`), ReceivedAt: received},
+		{ID: 2, RequestID: "b", ChannelID: 4, Payload: []byte(`not json`), ReceivedAt: received, Request: models.RequestMetadata{
+			Method:  "PUT",
+			Headers: map[string]string{"content-type": "text/plain"},
+		}},
+	})
+	require.NoError(t, err)
+
+	lines := decode(t, data)
+	require.Len(t, lines, 2)
+	assert.Equal(t, int64(1), lines[0].ID)
+	assert.JSONEq(t, `{"x":[1,2]}`, string(lines[0].Payload))
+	assert.Equal(t, received, lines[0].ReceivedAt)
+	assert.Equal(t, `"not json"`, string(lines[1].Payload))
+	assert.Empty(t, lines[0].Method)
+	assert.Equal(t, "PUT", lines[1].Method)
+	assert.Equal(t, "text/plain", lines[1].Headers["content-type"])
+	assert.Zero(t, lines[0].ChannelID)
+	assert.Equal(t, int64(4), lines[1].ChannelID)
+}
+
+type fakeS3 struct {
+	input *s3.PutObjectInput
+	body  []byte
+}
+
+func (f *fakeS3) PutObject(_ context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.input = in
+	f.body, _ = io.ReadAll(in.Body)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestS3Archiver(t *testing.T) {
+	client := &fakeS3{}
+	location, err := NewS3Archiver(client, "archive", "dev").Archive(context.Background(), "webhooks.messages/2026/10/19/1-2.ndjson.gz", []byte("data"))
+	require.NoError(t, err)
+	assert.Equal(t, "s3://archive/dev/webhooks.messages/2026/10/19/1-2.ndjson.gz", location)
+	assert.Equal(t, "dev/webhooks.messages/2026/10/19/1-2.ndjson.gz", *client.input.Key)
+	assert.Equal(t, "gzip", *client.input.ContentEncoding)
+	assert.Equal(t, []byte("data"), client.body)
+}
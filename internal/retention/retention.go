@@ -0,0 +1,205 @@
+// Package retention purges expired rows from webhooks.messages,
+// webhooks.rate_limit_buckets, webhooks.nonces and
+// webhooks.idempotency_keys in bounded batches, optionally archiving
+// purged messages first.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/metrics"
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+// stopMargin is how much of the invocation deadline is left unused so the
+// last batch commits and the result is reported before Lambda times out.
+// Whatever is left over is picked up by the next scheduled run.
+const stopMargin = 10 * time.Second
+
+// Policy configures a run. A zero retention skips that table.
+type Policy struct {
+	MessagesRetention  time.Duration
+	RateLimitRetention time.Duration
+	BatchSize          int
+	// BatchPause is slept between batches to leave the database room for
+	// the receiver's writes during a large backlog purge.
+	BatchPause time.Duration
+}
+
+// Result summarizes a run.
+type Result struct {
+	MessagesDeleted        int64    `json:"messagesDeleted"`
+	MessagesArchived       int64    `json:"messagesArchived"`
+	RateLimitsDeleted      int64    `json:"rateLimitsDeleted"`
+	NoncesDeleted          int64    `json:"noncesDeleted"`
+	IdempotencyKeysDeleted int64    `json:"idempotencyKeysDeleted"`
+	Archives               []string `json:"archives,omitempty"`
+	// Complete is false when the run stopped at the deadline with expired
+	// rows possibly left over.
+	Complete bool `json:"complete"`
+}
+
+// Purger runs the retention policy against a store.
+type Purger struct {
+	store    db.RetentionStore
+	archiver Archiver
+	policy   Policy
+	now      func() time.Time
+	sleep    func(time.Duration)
+}
+
+// NewPurger returns a Purger. A nil archiver deletes messages without
+// archiving them.
+func NewPurger(store db.RetentionStore, archiver Archiver, policy Policy) *Purger {
+	return &Purger{store: store, archiver: archiver, policy: policy, now: time.Now, sleep: time.Sleep}
+}
+
+// Run purges the tables. Nonces and idempotency keys carry their own
+// expiry and are always purged once it has passed. An archive failure stops the message purge
+// before the unarchived batch is deleted.
+func (p *Purger) Run(ctx context.Context) (Result, error) {
+	if p.policy.BatchSize <= 0 {
+		return Result{}, fmt.Errorf("retention batch size must be positive, got %d", p.policy.BatchSize)
+	}
+	if err := p.store.Ready(ctx); err != nil {
+		return Result{}, err
+	}
+
+	res := Result{Complete: true}
+	now := p.now()
+
+	if p.policy.MessagesRetention > 0 {
+		cutoff := now.Add(-p.policy.MessagesRetention)
+		done, err := p.purgeMessages(ctx, cutoff, &res)
+		if err != nil {
+			return res, err
+		}
+		res.Complete = res.Complete && done
+	}
+
+	if p.policy.RateLimitRetention > 0 {
+		cutoff := now.Add(-p.policy.RateLimitRetention)
+		done, err := p.batches(ctx, func() (int64, error) {
+			n, err := p.store.DeleteIdleRateLimitBuckets(ctx, cutoff, p.policy.BatchSize)
+			res.RateLimitsDeleted += n
+			return n, err
+		})
+		if err != nil {
+			return res, err
+		}
+		res.Complete = res.Complete && done
+	}
+
+	for _, purge := range []struct {
+		delete  func(context.Context, time.Time, int) (int64, error)
+		deleted *int64
+	}{
+		{p.store.DeleteExpiredNonces, &res.NoncesDeleted},
+		{p.store.DeleteExpiredIdempotencyKeys, &res.IdempotencyKeysDeleted},
+	} {
+		done, err := p.batches(ctx, func() (int64, error) {
+			n, err := purge.delete(ctx, now, p.policy.BatchSize)
+			*purge.deleted += n
+			return n, err
+		})
+		if err != nil {
+			return res, err
+		}
+		res.Complete = res.Complete && done
+	}
+
+	metrics.Emit(map[string]float64{
+		"RetentionMessagesDeleted":        float64(res.MessagesDeleted),
+		"RetentionMessagesArchived":       float64(res.MessagesArchived),
+		"RetentionRateLimitsDeleted":      float64(res.RateLimitsDeleted),
+		"RetentionNoncesDeleted":          float64(res.NoncesDeleted),
+		"RetentionIdempotencyKeysDeleted": float64(res.IdempotencyKeysDeleted),
+	}, nil)
+	log.Printf("retention: deleted %d messages (%d archived), %d rate-limit rows, %d nonces and %d idempotency keys, complete=%v",
+		res.MessagesDeleted, res.MessagesArchived, res.RateLimitsDeleted, res.NoncesDeleted, res.IdempotencyKeysDeleted, res.Complete)
+	return res, nil
+}
+
+func (p *Purger) purgeMessages(ctx context.Context, cutoff time.Time, res *Result) (bool, error) {
+	if p.archiver == nil {
+		return p.batches(ctx, func() (int64, error) {
+			n, err := p.store.DeleteExpiredWebhookMessages(ctx, cutoff, p.policy.BatchSize)
+			res.MessagesDeleted += n
+			return n, err
+		})
+	}
+
+	return p.batches(ctx, func() (int64, error) {
+		batch, err := p.store.ExpiredWebhookMessages(ctx, cutoff, p.policy.BatchSize)
+		if err != nil || len(batch) == 0 {
+			return 0, err
+		}
+		location, err := p.archive(ctx, batch)
+		if err != nil {
+			return 0, err
+		}
+		res.MessagesArchived += int64(len(batch))
+		res.Archives = append(res.Archives, location)
+
+		n, err := p.store.DeleteWebhookMessages(ctx, messageIDs(batch))
+		res.MessagesDeleted += n
+		if err != nil {
+			return n, err
+		}
+		// Report a full batch by what was selected: a row deleted under us
+		// shouldn't end the run early.
+		return int64(len(batch)), nil
+	})
+}
+
+func (p *Purger) archive(ctx context.Context, batch []models.IncomingWebhook) (string, error) {
+	data, err := EncodeNDJSONGzip(batch)
+	if err != nil {
+		return "", err
+	}
+	location, err := p.archiver.Archive(ctx, archiveName(p.now(), batch), data)
+	if err != nil {
+		return "", fmt.Errorf("archive messages %d-%d: %w", batch[0].ID, batch[len(batch)-1].ID, err)
+	}
+	return location, nil
+}
+
+// batches calls batch until it handles fewer rows than a full batch (the
+// table is clean) or the deadline is near, reporting which happened.
+func (p *Purger) batches(ctx context.Context, batch func() (int64, error)) (bool, error) {
+	for {
+		if p.nearDeadline(ctx) {
+			return false, nil
+		}
+		n, err := batch()
+		if err != nil {
+			return false, err
+		}
+		if n < int64(p.policy.BatchSize) {
+			return true, nil
+		}
+		if p.policy.BatchPause > 0 {
+			p.sleep(p.policy.BatchPause)
+		}
+	}
+}
+
+func (p *Purger) nearDeadline(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	deadline, ok := ctx.Deadline()
+	return ok && deadline.Sub(p.now()) < stopMargin
+}
+
+func messageIDs(batch []models.IncomingWebhook) []int64 {
+	ids := make([]int64, len(batch))
+	for i, m := range batch {
+		ids[i] = m.ID
+	}
+	return ids
+}
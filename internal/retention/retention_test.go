@@ -0,0 +1,174 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeArchiver keeps every archive in memory, failing once fail is set.
+type fakeArchiver struct {
+	files map[string][]byte
+	fail  error
+}
+
+func (a *fakeArchiver) Archive(_ context.Context, name string, data []byte) (string, error) {
+	if a.fail != nil {
+		return "", a.fail
+	}
+	if a.files == nil {
+		a.files = make(map[string][]byte)
+	}
+	a.files[name] = data
+	return "mem://" + name, nil
+}
+
+var now = time.Date(2026, 10, 19, 3, 0, 0, 0, time.UTC)
+
+// seed stores old messages received 60 days ago and recent ones received
+// an hour ago, plus one idle and one live rate-limit bucket, nonce and
+// idempotency key.
+func seed(t *testing.T, old, recent int) *db.Memory {
+	t.Helper()
+	ctx := context.Background()
+	store := db.NewMemory()
+	store.SetNow(func() time.Time { return now.Add(-60 * 24 * time.Hour) })
+	for i := 0; i < old; i++ {
+		_, err := store.InsertWebhookMessage(ctx, models.IncomingWebhook{RequestID: fmt.Sprintf("old-%d", i), Payload: []byte(`{"n":1}`)})
+		require.NoError(t, err)
+	}
+	_, _, err := store.TakeRateLimitToken(ctx, "ip:10.0.0.1", 60, 1)
+	require.NoError(t, err)
+	store.SetNow(func() time.Time { return now.Add(-time.Hour) })
+	for i := 0; i < recent; i++ {
+		_, err := store.InsertWebhookMessage(ctx, models.IncomingWebhook{RequestID: fmt.Sprintf("new-%d", i), Payload: []byte(`{"n":2}`)})
+		require.NoError(t, err)
+	}
+	_, _, err = store.TakeRateLimitToken(ctx, "ip:10.0.0.2", 60, 1)
+	require.NoError(t, err)
+	_, err = store.RecordNonce(ctx, 1, "expired", now.Add(-time.Minute))
+	require.NoError(t, err)
+	_, err = store.RecordNonce(ctx, 1, "live", now.Add(time.Minute))
+	require.NoError(t, err)
+	_, _, err = store.ReserveIdempotencyKey(ctx, 1, "expired", "h", now.Add(-time.Minute))
+	require.NoError(t, err)
+	_, _, err = store.ReserveIdempotencyKey(ctx, 1, "live", "h", now.Add(time.Minute))
+	require.NoError(t, err)
+	return store
+}
+
+func newTestPurger(store db.RetentionStore, archiver Archiver, batch int) *Purger {
+	p := NewPurger(store, archiver, Policy{
+		MessagesRetention:  30 * 24 * time.Hour,
+		RateLimitRetention: 24 * time.Hour,
+		BatchSize:          batch,
+	})
+	p.now = func() time.Time { return now }
+	return p
+}
+
+func TestRun_DeletesOnlyExpiredRowsInBatches(t *testing.T) {
+	store := seed(t, 7, 3)
+
+	res, err := newTestPurger(store, nil, 3).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), res.MessagesDeleted)
+	assert.Equal(t, int64(0), res.MessagesArchived)
+	assert.Equal(t, int64(1), res.RateLimitsDeleted)
+	assert.Equal(t, int64(1), res.NoncesDeleted)
+	assert.Equal(t, int64(1), res.IdempotencyKeysDeleted)
+	assert.True(t, res.Complete)
+
+	remaining := store.Messages()
+	require.Len(t, remaining, 3)
+	for _, m := range remaining {
+		assert.Contains(t, m.RequestID, "new-")
+	}
+	assert.Equal(t, []string{"ip:10.0.0.2"}, store.RateLimitKeys())
+	fresh, err := store.RecordNonce(context.Background(), 1, "live", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, fresh, "unexpired nonces are kept")
+	_, reserved, err := store.ReserveIdempotencyKey(context.Background(), 1, "live", "h", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, reserved, "unexpired idempotency keys are kept")
+}
+
+func TestRun_ArchivesBeforeDeleting(t *testing.T) {
+	store := seed(t, 5, 1)
+	archiver := &fakeArchiver{}
+
+	res, err := newTestPurger(store, archiver, 2).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), res.MessagesArchived)
+	assert.Equal(t, int64(5), res.MessagesDeleted)
+	assert.Equal(t, []string{
+		"mem://webhooks.messages/2026/10/19/1-2.ndjson.gz",
+		"mem://webhooks.messages/2026/10/19/3-4.ndjson.gz",
+		"mem://webhooks.messages/2026/10/19/5-5.ndjson.gz",
+	}, res.Archives)
+
+	lines := decode(t, archiver.files["webhooks.messages/2026/10/19/1-2.ndjson.gz"])
+	require.Len(t, lines, 2)
+	assert.Equal(t, "old-0", lines[0].RequestID)
+	assert.JSONEq(t, `{"n":1}`, string(lines[0].Payload))
+	assert.Len(t, store.Messages(), 1)
+}
+
+func TestRun_ArchiveFailureKeepsMessages(t *testing.T) {
+	store := seed(t, 4, 0)
+	archiver := &fakeArchiver{fail: errors.New("access denied")}
+
+	res, err := newTestPurger(store, archiver, 10).Run(context.Background())
+	assert.ErrorContains(t, err, "archive messages 1-4")
+	assert.Equal(t, int64(0), res.MessagesDeleted)
+	assert.Len(t, store.Messages(), 4)
+}
+
+func TestRun_StopsNearDeadline(t *testing.T) {
+	store := seed(t, 4, 0)
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(stopMargin/2))
+	defer cancel()
+
+	res, err := newTestPurger(store, nil, 2).Run(ctx)
+	require.NoError(t, err)
+	assert.False(t, res.Complete)
+	assert.Equal(t, int64(0), res.MessagesDeleted)
+	assert.Len(t, store.Messages(), 4)
+}
+
+func TestRun_ZeroRetentionSkipsTable(t *testing.T) {
+	store := seed(t, 2, 0)
+	p := newTestPurger(store, nil, 10)
+	p.policy.MessagesRetention = 0
+
+	res, err := p.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.MessagesDeleted)
+	assert.Equal(t, int64(1), res.RateLimitsDeleted)
+	assert.Len(t, store.Messages(), 2)
+}
+
+func TestRun_PausesBetweenFullBatches(t *testing.T) {
+	store := seed(t, 4, 0)
+	p := newTestPurger(store, nil, 2)
+	p.policy.BatchPause = time.Second
+	var pauses int
+	p.sleep = func(time.Duration) { pauses++ }
+
+	_, err := p.Run(context.Background())
+	require.NoError(t, err)
+	// Two full message batches, then an empty one ending the loop.
+	assert.Equal(t, 2, pauses)
+}
+
+func TestRun_RejectsInvalidBatchSize(t *testing.T) {
+	_, err := newTestPurger(db.NewMemory(), nil, 0).Run(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/Pennsieve/integration-service/internal/processing"
+)
+
+// Engine is a processing.Processor delivering the notifications of every
+// rule a message matches.
+type Engine struct {
+	store db.RuleStore
+	rules []Rule
+}
+
+// NewEngine returns an Engine evaluating rules, as returned by Parse.
+func NewEngine(store db.RuleStore, rules []Rule) *Engine {
+	return &Engine{store: store, rules: rules}
+}
+
+// Render returns the notifications msg's matching rules render, in rule
+// order.
+func (e *Engine) Render(msg processing.Message) ([]models.NotificationDraft, error) {
+	var drafts []models.NotificationDraft
+	for i := range e.rules {
+		r := &e.rules[i]
+		if !r.Matches(msg) {
+			continue
+		}
+		d, err := r.Render(msg)
+		if err != nil {
+			return nil, fmt.Errorf("notification rule %q: %w", r.Name, err)
+		}
+		drafts = append(drafts, d)
+	}
+	return drafts, nil
+}
+
+// Process delivers msg's notifications together, so a retry after a
+// failure doesn't repeat any. A message a rule can't render fails without
+// retries: the payload won't change.
+func (e *Engine) Process(ctx context.Context, msg processing.Message) error {
+	drafts, err := e.Render(msg)
+	if err != nil {
+		return processing.Permanent(err)
+	}
+	if len(drafts) == 0 {
+		return nil
+	}
+	n, err := e.store.CreateNotifications(ctx, drafts)
+	if err != nil {
+		return err
+	}
+	log.Printf("message %s: %d rules matched, %d notifications created", msg.RequestID, len(drafts), n)
+	return nil
+}
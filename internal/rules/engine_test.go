@@ -0,0 +1,55 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/processing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine_NotifiesMatchingSubscribers(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemory()
+	topic := store.AddTopic("pipelines", "")
+	everything, _, err := store.CreateSubscription(ctx, 1, topic.TopicID, nil)
+	require.NoError(t, err)
+	dataset42, _, err := store.CreateSubscription(ctx, 2, topic.TopicID, []byte(`{"dataset_id": 42}`))
+	require.NoError(t, err)
+	_, _, err = store.CreateSubscription(ctx, 3, topic.TopicID, []byte(`{"dataset_id": 7}`))
+	require.NoError(t, err)
+
+	rules, err := Parse([]byte(pipelineRules))
+	require.NoError(t, err)
+	e := NewEngine(store, rules)
+
+	require.NoError(t, e.Process(ctx, ciMessage(finished)))
+	require.NoError(t, e.Process(ctx, ciMessage(`{"event":"pipeline.started"}`)))
+
+	for user, sub := range map[int64]int64{1: everything.SubscriptionID, 2: dataset42.SubscriptionID} {
+		got, err := store.GetTopicNotifications(ctx, topic.TopicID, user, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, got, 1, "user %d", user)
+		assert.Equal(t, sub, got[0].SubscriptionID)
+		assert.Equal(t, "Pipeline qc finished", got[0].Title)
+		var metadata map[string]interface{}
+		require.NoError(t, json.Unmarshal(got[0].Metadata, &metadata))
+		assert.Equal(t, "https://ci/qc/7", metadata["url"])
+	}
+	got, err := store.GetTopicNotifications(ctx, topic.TopicID, 3, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, got, "other dataset's subscriber")
+}
+
+func TestEngine_RenderErrorsArePermanent(t *testing.T) {
+	rules, err := Parse([]byte(pipelineRules))
+	require.NoError(t, err)
+	e := NewEngine(db.NewMemory(), rules)
+
+	err = e.Process(context.Background(), ciMessage(`{"event":"pipeline.finished","pipeline":{"status":"success"}}`))
+	require.Error(t, err)
+	assert.True(t, processing.IsPermanent(err))
+}
@@ -0,0 +1,302 @@
+// Package rules turns stored webhook messages into user notifications. A
+// rule matches messages by sender and payload values and renders a
+// notification for a topic from templates over the message, so an external
+// system can notify the users subscribed to that topic by calling the
+// receiver.
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/Pennsieve/integration-service/internal/processing"
+)
+
+// Rule renders a notification for the messages it matches. Title, Message
+// and every string in Context and Metadata are text/template templates
+// over the message:
+//
+//	.payload      the decoded JSON payload
+//	.sender       the sender's name, "" for the legacy shared secret
+//	.request_id   the receiver's request id
+//	.received_at  when the message was received
+//
+// Referencing a payload field that isn't there is an error, so When should
+// require any field the templates rely on. A Context or Metadata string
+// that is a single action, such as "{{.payload.dataset.id}}", keeps the
+// JSON type of its value instead of becoming a string. The json function
+// renders a value as JSON text.
+type Rule struct {
+	Name string `json:"name"`
+	// Sender restricts the rule to one sender's messages.
+	Sender string `json:"sender,omitempty"`
+	// When maps dotted payload paths to the values they must have, compared
+	// like the message API's payload filters.
+	When  map[string]string `json:"when,omitempty"`
+	Topic string            `json:"topic"`
+	// Context selects the topic's subscribers: those whose subscription
+	// context it contains. Empty reaches only subscribers with an empty
+	// context.
+	Context  json.RawMessage `json:"context,omitempty"`
+	Title    string          `json:"title"`
+	Message  string          `json:"message"`
+	Metadata json.RawMessage `json:"metadata,omitempty"`
+
+	when     []models.PayloadPredicate
+	title    *template.Template
+	message  *template.Template
+	context  interface{}
+	metadata interface{}
+}
+
+// Parse reads and compiles a JSON array of rules.
+func Parse(data []byte) ([]Rule, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var rules []Rule
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("invalid notification rules: %w", err)
+	}
+
+	seen := make(map[string]bool, len(rules))
+	for i := range rules {
+		r := &rules[i]
+		if r.Name == "" {
+			return nil, fmt.Errorf("notification rule %d has no name", i)
+		}
+		if seen[r.Name] {
+			return nil, fmt.Errorf("duplicate notification rule %q", r.Name)
+		}
+		seen[r.Name] = true
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("notification rule %q: %w", r.Name, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r *Rule) compile() error {
+	if r.Topic == "" || r.Title == "" || r.Message == "" {
+		return errors.New("topic, title and message are required")
+	}
+
+	paths := make([]string, 0, len(r.When))
+	for p := range r.When {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		path := strings.Split(p, ".")
+		for _, key := range path {
+			if key == "" {
+				return fmt.Errorf("invalid when path %q", p)
+			}
+		}
+		r.when = append(r.when, models.PayloadPredicate{Path: path, Value: r.When[p]})
+	}
+
+	var err error
+	if r.title, err = parseTemplate("title", r.Title); err != nil {
+		return err
+	}
+	if r.message, err = parseTemplate("message", r.Message); err != nil {
+		return err
+	}
+	if r.context, err = compileJSON("context", r.Context); err != nil {
+		return err
+	}
+	if _, ok := r.context.(map[string]interface{}); r.context != nil && !ok {
+		return errors.New("context must be a JSON object")
+	}
+	if r.metadata, err = compileJSON("metadata", r.Metadata); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Matches reports whether the rule applies to msg.
+func (r *Rule) Matches(msg processing.Message) bool {
+	if r.Sender != "" && r.Sender != msg.Sender {
+		return false
+	}
+	for _, p := range r.when {
+		if !p.Match(msg.Payload) {
+			return false
+		}
+	}
+	return true
+}
+
+// Render renders the rule's notification for msg.
+func (r *Rule) Render(msg processing.Message) (models.NotificationDraft, error) {
+	data, err := templateData(msg)
+	if err != nil {
+		return models.NotificationDraft{}, err
+	}
+	d := models.NotificationDraft{Topic: r.Topic}
+	if d.Title, err = execute(r.title, data); err != nil {
+		return d, err
+	}
+	if d.Message, err = execute(r.message, data); err != nil {
+		return d, err
+	}
+	if d.Context, err = renderJSON(r.context, data); err != nil {
+		return d, err
+	}
+	if d.Metadata, err = renderJSON(r.metadata, data); err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+func templateData(msg processing.Message) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(msg.Payload))
+	dec.UseNumber()
+	var payload interface{}
+	if err := dec.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("payload is not JSON: %w", err)
+	}
+	return map[string]interface{}{
+		"payload":     payload,
+		"sender":      msg.Sender,
+		"request_id":  msg.RequestID,
+		"received_at": msg.ReceivedAt,
+	}, nil
+}
+
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=error").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return t, nil
+}
+
+func execute(t *template.Template, data interface{}) (string, error) {
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// singleAction matches a template that is one action, whose value keeps
+// its JSON type when rendered into a JSON document.
+var singleAction = regexp.MustCompile(`^\{\{(?:- )?([^{}]*?)(?: -)?\}\}$`)
+
+// jsonString is a string template inside a JSON document. typed templates
+// render their value as JSON rather than as text.
+type jsonString struct {
+	tmpl  *template.Template
+	typed bool
+}
+
+// compileJSON compiles every string in a JSON document as a template.
+func compileJSON(name string, raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return compileValue(name, doc)
+}
+
+func compileValue(name string, v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			c, err := compileValue(name+"."+k, e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = c
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, e := range t {
+			c, err := compileValue(fmt.Sprintf("%s[%d]", name, i), e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = c
+		}
+		return out, nil
+	case string:
+		if m := singleAction.FindStringSubmatch(t); m != nil {
+			tmpl, err := parseTemplate(name, "{{json ("+m[1]+")}}")
+			return jsonString{tmpl: tmpl, typed: true}, err
+		}
+		tmpl, err := parseTemplate(name, t)
+		return jsonString{tmpl: tmpl}, err
+	default:
+		return v, nil
+	}
+}
+
+// renderJSON renders a document compiled by compileJSON, nil for none.
+func renderJSON(doc interface{}, data interface{}) (json.RawMessage, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	v, err := renderValue(doc, data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func renderValue(v interface{}, data interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			r, err := renderValue(e, data)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, e := range t {
+			r, err := renderValue(e, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	case jsonString:
+		s, err := execute(t.tmpl, data)
+		if err != nil || !t.typed {
+			return s, err
+		}
+		return json.RawMessage(s), nil
+	default:
+		return v, nil
+	}
+}
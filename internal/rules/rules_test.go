@@ -0,0 +1,94 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/Pennsieve/integration-service/internal/processing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pipelineRules = `[{
+	"name": "pipeline-finished",
+	"sender": "ci",
+	"when": {"event": "pipeline.finished", "pipeline.status": "success"},
+	"topic": "pipelines",
+	"context": {"dataset_id": "{{.payload.dataset.id}}", "source": "ci"},
+	"title": "Pipeline {{.payload.pipeline.name}} finished",
+	"message": "{{.payload.pipeline.name}} finished for dataset {{.payload.dataset.id}} ({{.request_id}})",
+	"metadata": {"url": "{{.payload.pipeline.url}}", "steps": "{{.payload.pipeline.steps}}", "by": "{{.sender}}"}
+}]`
+
+func ciMessage(payload string) processing.Message {
+	return processing.Message{
+		IncomingWebhook: models.IncomingWebhook{
+			RequestID:  "req-1",
+			Payload:    []byte(payload),
+			ReceivedAt: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+		},
+		Sender: "ci",
+	}
+}
+
+const finished = `{"event":"pipeline.finished","dataset":{"id":42},
+	"pipeline":{"name":"qc","status":"success","url":"https://ci/qc/7","steps":["lint","test"]}}`
+
+func TestParse_RendersMatchingMessages(t *testing.T) {
+	rules, err := Parse([]byte(pipelineRules))
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	r := &rules[0]
+
+	msg := ciMessage(finished)
+	require.True(t, r.Matches(msg))
+	d, err := r.Render(msg)
+	require.NoError(t, err)
+	assert.Equal(t, "pipelines", d.Topic)
+	assert.Equal(t, "Pipeline qc finished", d.Title)
+	assert.Equal(t, "qc finished for dataset 42 (req-1)", d.Message)
+	assert.JSONEq(t, `{"dataset_id": 42, "source": "ci"}`, string(d.Context), "single actions keep their JSON type")
+	assert.JSONEq(t, `{"url": "https://ci/qc/7", "steps": ["lint", "test"], "by": "ci"}`, string(d.Metadata))
+}
+
+func TestRule_Matches(t *testing.T) {
+	rules, err := Parse([]byte(pipelineRules))
+	require.NoError(t, err)
+	r := &rules[0]
+
+	other := ciMessage(finished)
+	other.Sender = "lims"
+	assert.False(t, r.Matches(other), "other sender")
+	assert.False(t, r.Matches(ciMessage(`{"event":"pipeline.finished","pipeline":{"status":"failed"}}`)))
+	assert.False(t, r.Matches(ciMessage(`{"event":"pipeline.started"}`)))
+	assert.False(t, r.Matches(ciMessage(`not json`)))
+}
+
+func TestRule_RenderMissingFieldFails(t *testing.T) {
+	rules, err := Parse([]byte(pipelineRules))
+	require.NoError(t, err)
+	_, err = rules[0].Render(ciMessage(`{"event":"pipeline.finished","pipeline":{"name":"qc","status":"success"}}`))
+	assert.Error(t, err)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"not an array":    `{"name": "x"}`,
+		"unknown field":   `[{"name": "x", "topic": "t", "title": "t", "message": "m", "target": "y"}]`,
+		"no name":         `[{"topic": "t", "title": "t", "message": "m"}]`,
+		"duplicate":       `[{"name": "x", "topic": "t", "title": "t", "message": "m"}, {"name": "x", "topic": "t", "title": "t", "message": "m"}]`,
+		"no topic":        `[{"name": "x", "title": "t", "message": "m"}]`,
+		"bad template":    `[{"name": "x", "topic": "t", "title": "{{.payload", "message": "m"}]`,
+		"bad metadata":    `[{"name": "x", "topic": "t", "title": "t", "message": "m", "metadata": {"a": "{{end}}"}}]`,
+		"context not obj": `[{"name": "x", "topic": "t", "title": "t", "message": "m", "context": ["a"]}]`,
+		"empty when path": `[{"name": "x", "topic": "t", "title": "t", "message": "m", "when": {"a..b": "1"}}]`,
+	} {
+		_, err := Parse([]byte(data))
+		assert.Error(t, err, name)
+	}
+
+	rules, err := Parse([]byte("  "))
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+}
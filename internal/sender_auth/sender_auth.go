@@ -0,0 +1,184 @@
+// Package sender_auth identifies the sender of an inbound webhook from the
+// secret it presents, or the signature it makes, against the named senders
+// in webhooks.senders.
+package sender_auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+)
+
+// ScopeWebhooksWrite allows a sender to post messages to the receiver.
+const ScopeWebhooksWrite = "webhooks:write"
+
+// DefaultScopes are granted to new senders unless others are given.
+var DefaultScopes = []string{ScopeWebhooksWrite}
+
+// secretPrefix marks generated secrets so they are recognizable in logs
+// and by secret scanners.
+const secretPrefix = "pwhs_"
+
+var (
+	// ErrInvalidCredential means no sender matches the presented secret.
+	ErrInvalidCredential = errors.New("invalid or missing webhook secret")
+	// ErrSenderDisabled means the secret belongs to a disabled sender.
+	ErrSenderDisabled = errors.New("sender disabled")
+	// ErrMissingScope means the sender wasn't granted the required scope.
+	ErrMissingScope = errors.New("sender lacks required scope")
+)
+
+// Match says which secret authenticated a request.
+type Match string
+
+const (
+	// MatchCurrent is the sender's current secret.
+	MatchCurrent Match = "current"
+	// MatchPrevious is the secret replaced by the sender's last rotation,
+	// accepted until its overlap window ends.
+	MatchPrevious Match = "previous"
+	// MatchLegacy is the deprecated global shared secret.
+	MatchLegacy Match = "legacy"
+	// MatchLegacyPrevious is the global shared secret replaced by its
+	// last rotation, accepted until its expiry.
+	MatchLegacyPrevious Match = "legacy-previous"
+)
+
+// IsLegacy reports whether m is either value of the global shared secret.
+func (m Match) IsLegacy() bool {
+	return m == MatchLegacy || m == MatchLegacyPrevious
+}
+
+// LegacySecret is an accepted value of the deprecated global shared
+// secret.
+type LegacySecret struct {
+	Value string
+	// Expires ends its acceptance; zero never does.
+	Expires time.Time
+	// Previous marks the value replaced by the last rotation.
+	Previous bool
+}
+
+// previousUseInterval throttles recording uses of a previous secret to
+// one write per sender per interval.
+const previousUseInterval = time.Minute
+
+// LegacySender is reported for requests authenticated with the deprecated
+// global shared secret. It has no id, so its messages are stored without
+// a sender.
+var LegacySender = models.Sender{Name: "shared-secret", Status: models.SenderActive, Scopes: DefaultScopes}
+
+// HashSecret is what webhooks.senders stores for a secret.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewSecret returns a random 256-bit secret for a new sender.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate secret: %w", err)
+	}
+	return secretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Authenticator resolves presented secrets and signatures to senders.
+type Authenticator struct {
+	senders db.SenderStore
+	legacy  func(context.Context) ([]LegacySecret, error)
+	signing func(ctx context.Context, sender string) (string, error)
+}
+
+// NewAuthenticator looks senders up in senders. legacy, if not nil,
+// returns the values of the deprecated global shared secret (none when
+// unset), each accepted as LegacySender until it expires while existing
+// integrations move to their own senders.
+// signing returns a sender's HMAC signing secret; it may be nil if signed
+// requests aren't accepted.
+func NewAuthenticator(senders db.SenderStore, legacy func(context.Context) ([]LegacySecret, error), signing func(ctx context.Context, sender string) (string, error)) *Authenticator {
+	return &Authenticator{senders: senders, legacy: legacy, signing: signing}
+}
+
+// Authenticate returns the sender presenting secret if it is active and
+// holds scope, and which of its secrets matched. Uses of a previous
+// secret are recorded on the sender so operators can see who hasn't
+// switched yet. Store failures are returned as they are, so callers can
+// tell an outage from a bad credential.
+func (a *Authenticator) Authenticate(ctx context.Context, secret, scope string) (models.Sender, Match, error) {
+	if secret == "" {
+		return models.Sender{}, "", ErrInvalidCredential
+	}
+	s, previous, err := a.senders.GetSenderBySecretHash(ctx, HashSecret(secret))
+	match := MatchCurrent
+	switch {
+	case errors.Is(err, db.ErrSenderNotFound):
+		if match = a.matchLegacy(ctx, secret); match == "" {
+			return models.Sender{}, "", ErrInvalidCredential
+		}
+		s = LegacySender
+	case err != nil:
+		return models.Sender{}, "", err
+	case previous:
+		match = MatchPrevious
+		a.recordPreviousUse(ctx, s)
+	}
+
+	return s, match, authorize(s, scope)
+}
+
+func (a *Authenticator) recordPreviousUse(ctx context.Context, s models.Sender) {
+	if s.PreviousSecretUsedAt != nil && time.Since(*s.PreviousSecretUsedAt) < previousUseInterval {
+		return
+	}
+	if err := a.senders.MarkPreviousSecretUsed(ctx, s.ID); err != nil {
+		log.Printf("WARN record previous secret use by sender %s: %v", s.Name, err)
+	}
+}
+
+// authorize checks an identified sender may act with scope.
+func authorize(s models.Sender, scope string) error {
+	if s.Status != models.SenderActive {
+		return ErrSenderDisabled
+	}
+	if !s.HasScope(scope) {
+		return fmt.Errorf("%w %s", ErrMissingScope, scope)
+	}
+	return nil
+}
+
+// matchLegacy returns which unexpired value of the global shared secret
+// secret is, or "" if none.
+func (a *Authenticator) matchLegacy(ctx context.Context, secret string) Match {
+	if a.legacy == nil {
+		return ""
+	}
+	values, err := a.legacy(ctx)
+	if err != nil {
+		log.Printf("ERROR webhook shared secret unavailable: %v", err)
+		return ""
+	}
+	now := time.Now()
+	for _, v := range values {
+		if v.Value == "" || (!v.Expires.IsZero() && !now.Before(v.Expires)) {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(v.Value)) == 1 {
+			if v.Previous {
+				return MatchLegacyPrevious
+			}
+			return MatchLegacy
+		}
+	}
+	return ""
+}
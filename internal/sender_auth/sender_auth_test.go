@@ -0,0 +1,150 @@
+package sender_auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func legacy(secrets ...LegacySecret) func(context.Context) ([]LegacySecret, error) {
+	return func(context.Context) ([]LegacySecret, error) { return secrets, nil }
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	require.NoError(t, err)
+	b, err := NewSecret()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(a, secretPrefix))
+	assert.Len(t, a, len(secretPrefix)+43)
+	assert.NotEqual(t, a, b)
+	assert.Len(t, HashSecret(a), 64)
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemory()
+	acme, err := store.CreateSender(ctx, "acme", HashSecret("acme-secret"), DefaultScopes)
+	require.NoError(t, err)
+	_, err = store.CreateSender(ctx, "reader", HashSecret("reader-secret"), []string{"webhooks:read"})
+	require.NoError(t, err)
+	_, err = store.CreateSender(ctx, "gone", HashSecret("gone-secret"), DefaultScopes)
+	require.NoError(t, err)
+	_, err = store.SetSenderStatus(ctx, "gone", models.SenderDisabled)
+	require.NoError(t, err)
+
+	auth := NewAuthenticator(store, legacy(LegacySecret{Value: "shared"}), nil)
+
+	s, match, err := auth.Authenticate(ctx, "acme-secret", ScopeWebhooksWrite)
+	require.NoError(t, err)
+	assert.Equal(t, acme, s)
+	assert.Equal(t, MatchCurrent, match)
+
+	s, match, err = auth.Authenticate(ctx, "shared", ScopeWebhooksWrite)
+	require.NoError(t, err)
+	assert.Equal(t, LegacySender, s)
+	assert.Equal(t, MatchLegacy, match)
+
+	_, _, err = auth.Authenticate(ctx, "reader-secret", ScopeWebhooksWrite)
+	assert.ErrorIs(t, err, ErrMissingScope)
+	assert.ErrorContains(t, err, ScopeWebhooksWrite)
+
+	s, _, err = auth.Authenticate(ctx, "gone-secret", ScopeWebhooksWrite)
+	assert.ErrorIs(t, err, ErrSenderDisabled)
+	assert.Equal(t, "gone", s.Name)
+
+	for _, bad := range []string{"", "wrong"} {
+		_, _, err = auth.Authenticate(ctx, bad, ScopeWebhooksWrite)
+		assert.ErrorIs(t, err, ErrInvalidCredential)
+	}
+}
+
+func TestAuthenticate_PreviousSecretDuringOverlap(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemory()
+	_, err := store.CreateSender(ctx, "acme", HashSecret("old-secret"), DefaultScopes)
+	require.NoError(t, err)
+	_, err = store.RotateSenderSecret(ctx, "acme", HashSecret("new-secret"), time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	auth := NewAuthenticator(store, nil, nil)
+
+	_, match, err := auth.Authenticate(ctx, "new-secret", ScopeWebhooksWrite)
+	require.NoError(t, err)
+	assert.Equal(t, MatchCurrent, match)
+	acme, err := store.GetSenderByName(ctx, "acme")
+	require.NoError(t, err)
+	assert.Nil(t, acme.PreviousSecretUsedAt)
+
+	s, match, err := auth.Authenticate(ctx, "old-secret", ScopeWebhooksWrite)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", s.Name)
+	assert.Equal(t, MatchPrevious, match)
+	acme, err = store.GetSenderByName(ctx, "acme")
+	require.NoError(t, err)
+	assert.NotNil(t, acme.PreviousSecretUsedAt, "the use is recorded")
+
+	_, err = store.RotateSenderSecret(ctx, "acme", HashSecret("newer-secret"), time.Now())
+	require.NoError(t, err)
+	_, _, err = auth.Authenticate(ctx, "new-secret", ScopeWebhooksWrite)
+	assert.ErrorIs(t, err, ErrInvalidCredential, "a rotation without overlap revokes at once")
+}
+
+func TestAuthenticate_LegacySecretUnsetOrUnavailable(t *testing.T) {
+	ctx := context.Background()
+	store := db.NewMemory()
+
+	for _, auth := range []*Authenticator{
+		NewAuthenticator(store, nil, nil),
+		NewAuthenticator(store, legacy(), nil),
+		NewAuthenticator(store, legacy(LegacySecret{}), nil),
+		NewAuthenticator(store, func(context.Context) ([]LegacySecret, error) { return nil, errors.New("ssm down") }, nil),
+	} {
+		_, _, err := auth.Authenticate(ctx, "anything", ScopeWebhooksWrite)
+		assert.ErrorIs(t, err, ErrInvalidCredential)
+	}
+}
+
+func TestAuthenticate_LegacySecretRotation(t *testing.T) {
+	ctx := context.Background()
+	auth := NewAuthenticator(db.NewMemory(), legacy(
+		LegacySecret{Value: "new", Expires: time.Now().Add(30 * 24 * time.Hour)},
+		LegacySecret{Value: "old", Expires: time.Now().Add(time.Hour), Previous: true},
+		LegacySecret{Value: "older", Expires: time.Now().Add(-time.Second), Previous: true},
+	), nil)
+
+	s, match, err := auth.Authenticate(ctx, "new", ScopeWebhooksWrite)
+	require.NoError(t, err)
+	assert.Equal(t, LegacySender, s)
+	assert.Equal(t, MatchLegacy, match)
+
+	_, match, err = auth.Authenticate(ctx, "old", ScopeWebhooksWrite)
+	require.NoError(t, err)
+	assert.Equal(t, MatchLegacyPrevious, match)
+	assert.True(t, match.IsLegacy())
+
+	_, _, err = auth.Authenticate(ctx, "older", ScopeWebhooksWrite)
+	assert.ErrorIs(t, err, ErrInvalidCredential, "an expired secret is refused")
+}
+
+// failingSenders fails every lookup, as during a database outage.
+type failingSenders struct {
+	*db.Memory
+}
+
+func (failingSenders) GetSenderBySecretHash(context.Context, string) (models.Sender, bool, error) {
+	return models.Sender{}, false, errors.New("connection reset")
+}
+
+func TestAuthenticate_StoreErrorIsNotACredentialError(t *testing.T) {
+	auth := NewAuthenticator(failingSenders{db.NewMemory()}, legacy(LegacySecret{Value: "shared"}), nil)
+	_, _, err := auth.Authenticate(context.Background(), "shared", ScopeWebhooksWrite)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredential)
+}
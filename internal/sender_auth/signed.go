@@ -0,0 +1,52 @@
+package sender_auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/Pennsieve/integration-service/internal/signature"
+)
+
+// AuthenticateSignature returns the named sender if the request carries
+// a valid signature under the sender's scheme, and the sender is active
+// and holds scope. header looks a request header up by name.
+//
+// An unknown sender, or one that doesn't sign, fails like a bad
+// signature so callers can't probe for sender names. The returned
+// Verified carries the nonce the caller must check for replays.
+func (a *Authenticator) AuthenticateSignature(ctx context.Context, name string, header func(string) string, body []byte, scope string, now time.Time) (models.Sender, signature.Verified, error) {
+	s, err := a.senders.GetSenderByName(ctx, name)
+	if errors.Is(err, db.ErrSenderNotFound) {
+		return models.Sender{}, signature.Verified{}, signature.ErrInvalidSignature
+	} else if err != nil {
+		return models.Sender{}, signature.Verified{}, err
+	}
+	return a.AuthenticateSenderSignature(ctx, s, header, body, scope, now)
+}
+
+// AuthenticateSenderSignature is AuthenticateSignature for a sender the
+// caller already looked up by name; the zero Sender stands for an unknown
+// one.
+func (a *Authenticator) AuthenticateSenderSignature(ctx context.Context, s models.Sender, header func(string) string, body []byte, scope string, now time.Time) (models.Sender, signature.Verified, error) {
+	if s.ID == 0 || len(s.SignatureScheme) == 0 || a.signing == nil {
+		return models.Sender{}, signature.Verified{}, signature.ErrInvalidSignature
+	}
+
+	scheme, err := signature.Parse(string(s.SignatureScheme))
+	if err != nil {
+		return models.Sender{}, signature.Verified{}, fmt.Errorf("sender %s: %w", s.Name, err)
+	}
+	secret, err := a.signing(ctx, s.Name)
+	if err != nil {
+		return models.Sender{}, signature.Verified{}, fmt.Errorf("signing secret for sender %s: %w", s.Name, err)
+	}
+	v, err := scheme.Verify([]byte(secret), header, body, now)
+	if err != nil {
+		return models.Sender{}, v, err
+	}
+	return s, v, authorize(s, scope)
+}
@@ -0,0 +1,97 @@
+package sender_auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Pennsieve/integration-service/internal/db"
+	"github.com/Pennsieve/integration-service/internal/models"
+	"github.com/Pennsieve/integration-service/internal/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signingSecrets(secrets map[string]string) func(context.Context, string) (string, error) {
+	return func(_ context.Context, sender string) (string, error) {
+		s, ok := secrets[sender]
+		if !ok {
+			return "", errors.New("not configured")
+		}
+		return s, nil
+	}
+}
+
+func signedHeaders(t *testing.T, scheme, secret string, body []byte, at time.Time) func(string) string {
+	t.Helper()
+	s, err := signature.Parse(scheme)
+	require.NoError(t, err)
+	hdr := http.Header{}
+	for k, v := range s.Sign([]byte(secret), body, "delivery-1", at) {
+		hdr.Set(k, v)
+	}
+	return hdr.Get
+}
+
+func TestAuthenticateSignature(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1_760_000_000, 0)
+	body := []byte(`{"event":"ping"}`)
+	pennsieve, err := json.Marshal(signature.Presets["pennsieve"])
+	require.NoError(t, err)
+	store := db.NewMemory()
+	for _, name := range []string{"acme", "gone", "reader", "plain", "nosecret"} {
+		scopes := DefaultScopes
+		if name == "reader" {
+			scopes = []string{"webhooks:read"}
+		}
+		_, err := store.CreateSender(ctx, name, HashSecret(name+"-secret"), scopes)
+		require.NoError(t, err)
+		if name != "plain" {
+			_, err = store.SetSenderSignatureScheme(ctx, name, pennsieve)
+			require.NoError(t, err)
+		}
+	}
+	_, err = store.SetSenderStatus(ctx, "gone", models.SenderDisabled)
+	require.NoError(t, err)
+
+	auth := NewAuthenticator(store, nil, signingSecrets(map[string]string{
+		"acme": "acme-signing", "gone": "gone-signing", "reader": "reader-signing", "plain": "plain-signing",
+	}))
+
+	s, v, err := auth.AuthenticateSignature(ctx, "acme", signedHeaders(t, "pennsieve", "acme-signing", body, now), body, ScopeWebhooksWrite, now)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", s.Name)
+	assert.NotEmpty(t, v.Nonce)
+
+	_, _, err = auth.AuthenticateSignature(ctx, "acme", signedHeaders(t, "pennsieve", "wrong", body, now), body, ScopeWebhooksWrite, now)
+	assert.ErrorIs(t, err, signature.ErrInvalidSignature)
+
+	_, _, err = auth.AuthenticateSignature(ctx, "acme", signedHeaders(t, "pennsieve", "acme-signing", body, now.Add(-time.Hour)), body, ScopeWebhooksWrite, now)
+	assert.ErrorIs(t, err, signature.ErrTimestampOutOfRange)
+
+	for _, name := range []string{"unknown", "plain"} {
+		_, _, err = auth.AuthenticateSignature(ctx, name, signedHeaders(t, "pennsieve", name+"-signing", body, now), body, ScopeWebhooksWrite, now)
+		assert.ErrorIs(t, err, signature.ErrInvalidSignature, name)
+	}
+
+	_, _, err = auth.AuthenticateSignature(ctx, "gone", signedHeaders(t, "pennsieve", "gone-signing", body, now), body, ScopeWebhooksWrite, now)
+	assert.ErrorIs(t, err, ErrSenderDisabled)
+	_, _, err = auth.AuthenticateSignature(ctx, "reader", signedHeaders(t, "pennsieve", "reader-signing", body, now), body, ScopeWebhooksWrite, now)
+	assert.ErrorIs(t, err, ErrMissingScope)
+
+	_, _, err = auth.AuthenticateSignature(ctx, "nosecret", signedHeaders(t, "pennsieve", "x", body, now), body, ScopeWebhooksWrite, now)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, signature.ErrInvalidSignature, "a missing secret is a configuration error")
+
+	acme, err := store.GetSenderByName(ctx, "acme")
+	require.NoError(t, err)
+	s, _, err = auth.AuthenticateSenderSignature(ctx, acme, signedHeaders(t, "pennsieve", "acme-signing", body, now), body, ScopeWebhooksWrite, now)
+	require.NoError(t, err)
+	assert.Equal(t, acme, s)
+	_, _, err = auth.AuthenticateSenderSignature(ctx, models.Sender{}, signedHeaders(t, "pennsieve", "acme-signing", body, now), body, ScopeWebhooksWrite, now)
+	assert.ErrorIs(t, err, signature.ErrInvalidSignature, "an unknown sender")
+}
@@ -0,0 +1,291 @@
+// Package signature verifies HMAC-SHA256 request signatures in the styles
+// webhook providers use: a signature header over the body, optionally
+// prefixed with a timestamp and a nonce header, in hex or base64.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encodings of the signature header value.
+const (
+	EncodingHex    = "hex"
+	EncodingBase64 = "base64"
+)
+
+// Placeholders in Scheme.Template.
+const (
+	placeholderTimestamp = "{timestamp}"
+	placeholderNonce     = "{nonce}"
+	placeholderBody      = "{body}"
+)
+
+// DefaultTolerance bounds the clock skew and delivery delay accepted for
+// timestamped schemes that don't set their own.
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	// ErrMissingSignature means the signature (or a required timestamp
+	// or nonce) header is absent or malformed.
+	ErrMissingSignature = errors.New("missing or malformed signature")
+	// ErrInvalidSignature means no signature in the header matches.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrTimestampOutOfRange means the signed timestamp is too far from
+	// now, as a replayed request's would be.
+	ErrTimestampOutOfRange = errors.New("signature timestamp outside tolerance")
+)
+
+// Scheme describes how a sender signs requests. It is stored as JSON on
+// the sender.
+type Scheme struct {
+	// SignatureHeader carries the signature. Several comma- or
+	// space-separated signatures are accepted, any one matching.
+	SignatureHeader string `json:"signature_header"`
+	// Prefix is stripped from each signature before decoding, e.g.
+	// "sha256=" or "v0=".
+	Prefix   string `json:"prefix,omitempty"`
+	Encoding string `json:"encoding"`
+	// TimestampHeader, if set, carries the signing time in Unix seconds;
+	// requests outside Tolerance of now are rejected.
+	TimestampHeader string `json:"timestamp_header,omitempty"`
+	// Template builds the signed content from {timestamp}, {nonce} and
+	// {body}.
+	Template  string   `json:"template"`
+	Tolerance Duration `json:"tolerance,omitempty"`
+	// NonceHeader, if set, carries a unique delivery id used for replay
+	// detection. It must be signed through {nonce}, or a replay could
+	// pass with a fresh one; without it the signature itself is the nonce.
+	NonceHeader string `json:"nonce_header,omitempty"`
+}
+
+// Presets are schemes of common providers, selectable by name.
+var Presets = map[string]Scheme{
+	// Pennsieve's own senders.
+	"pennsieve": {
+		SignatureHeader: "X-Pennsieve-Signature",
+		Prefix:          "sha256=",
+		Encoding:        EncodingHex,
+		TimestampHeader: "X-Pennsieve-Timestamp",
+		Template:        placeholderTimestamp + "." + placeholderNonce + "." + placeholderBody,
+		NonceHeader:     "X-Pennsieve-Nonce",
+	},
+	// GitHub signs only the body. Its X-GitHub-Delivery id isn't signed,
+	// so the signature is the nonce.
+	"github": {
+		SignatureHeader: "X-Hub-Signature-256",
+		Prefix:          "sha256=",
+		Encoding:        EncodingHex,
+		Template:        placeholderBody,
+	},
+	"slack": {
+		SignatureHeader: "X-Slack-Signature",
+		Prefix:          "v0=",
+		Encoding:        EncodingHex,
+		TimestampHeader: "X-Slack-Request-Timestamp",
+		Template:        "v0:" + placeholderTimestamp + ":" + placeholderBody,
+	},
+}
+
+// Parse reads a scheme from a preset name or a JSON object, filling in
+// defaults, and validates it.
+func Parse(s string) (Scheme, error) {
+	if p, ok := Presets[s]; ok {
+		return p.withDefaults(), nil
+	}
+	var sc Scheme
+	if err := json.Unmarshal([]byte(s), &sc); err != nil {
+		return Scheme{}, fmt.Errorf("signature scheme must be a preset (pennsieve, github, slack) or JSON: %w", err)
+	}
+	sc = sc.withDefaults()
+	return sc, sc.Validate()
+}
+
+func (s Scheme) withDefaults() Scheme {
+	if s.Encoding == "" {
+		s.Encoding = EncodingHex
+	}
+	if s.Template == "" {
+		s.Template = placeholderBody
+		if s.TimestampHeader != "" {
+			s.Template = placeholderTimestamp + "." + placeholderBody
+		}
+	}
+	if s.TimestampHeader != "" && s.Tolerance == 0 {
+		s.Tolerance = Duration(DefaultTolerance)
+	}
+	return s
+}
+
+// Validate reports a scheme that could never verify or would sign less
+// than it should.
+func (s Scheme) Validate() error {
+	switch {
+	case s.SignatureHeader == "":
+		return errors.New("signature scheme needs a signature_header")
+	case s.Encoding != EncodingHex && s.Encoding != EncodingBase64:
+		return fmt.Errorf("signature encoding must be %q or %q, got %q", EncodingHex, EncodingBase64, s.Encoding)
+	case !strings.Contains(s.Template, placeholderBody):
+		return errors.New("signature template must include {body}")
+	case s.TimestampHeader != "" && !strings.Contains(s.Template, placeholderTimestamp):
+		return errors.New("signature template must include {timestamp} when timestamp_header is set")
+	case s.NonceHeader != "" && !strings.Contains(s.Template, placeholderNonce):
+		return errors.New("signature template must include {nonce} when nonce_header is set")
+	case s.NonceHeader == "" && strings.Contains(s.Template, placeholderNonce):
+		return errors.New("signature template includes {nonce} but no nonce_header is set")
+	case s.Tolerance < 0:
+		return errors.New("signature tolerance must not be negative")
+	}
+	return nil
+}
+
+// signsNonce reports whether the nonce header is part of the signed
+// content. Schemes stored before {nonce} existed may set NonceHeader
+// without it; their nonce header is ignored.
+func (s Scheme) signsNonce() bool {
+	return s.NonceHeader != "" && strings.Contains(s.Template, placeholderNonce)
+}
+
+// Verified describes an accepted signature.
+type Verified struct {
+	// Timestamp is the signed time, zero for untimestamped schemes.
+	Timestamp time.Time
+	// Nonce identifies the delivery for replay detection.
+	Nonce string
+	// NonceExpires is when the nonce may be forgotten: the request can no
+	// longer pass verification by then, or is past the replay window.
+	NonceExpires time.Time
+}
+
+// untimestampedReplayWindow is how long nonces of schemes without a
+// timestamp are remembered. Such a request stays valid forever, so this
+// only covers the retries a provider typically makes.
+const untimestampedReplayWindow = 24 * time.Hour
+
+// ReplayWindow is how long a verified nonce must be remembered to reject
+// replays: past the tolerance on either side of the signed time, after
+// which the timestamp check rejects the request anyway.
+func (s Scheme) ReplayWindow() time.Duration {
+	if s.TimestampHeader == "" {
+		return untimestampedReplayWindow
+	}
+	return 2 * time.Duration(s.Tolerance)
+}
+
+// Verify checks the request's signature with secret at time now. header
+// looks a request header up by name, case-insensitively.
+func (s Scheme) Verify(secret []byte, header func(string) string, body []byte, now time.Time) (Verified, error) {
+	var (
+		v  Verified
+		ts string
+	)
+	if s.TimestampHeader != "" {
+		raw := header(s.TimestampHeader)
+		sec, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("%w: bad %s", ErrMissingSignature, s.TimestampHeader)
+		}
+		v.Timestamp = time.Unix(sec, 0)
+		if skew := now.Sub(v.Timestamp); skew > time.Duration(s.Tolerance) || -skew > time.Duration(s.Tolerance) {
+			return v, ErrTimestampOutOfRange
+		}
+		ts = raw
+	}
+	// Only a signed nonce identifies the delivery; an unsigned one could
+	// be changed by whoever replays the request.
+	var nonce string
+	if s.signsNonce() {
+		if nonce = header(s.NonceHeader); nonce == "" {
+			return v, fmt.Errorf("%w: missing %s", ErrMissingSignature, s.NonceHeader)
+		}
+	}
+	expected := s.mac(secret, ts, nonce, body)
+
+	candidates := strings.FieldsFunc(header(s.SignatureHeader), func(r rune) bool { return r == ',' || r == ' ' })
+	if len(candidates) == 0 {
+		return v, ErrMissingSignature
+	}
+	for _, c := range candidates {
+		sig, err := s.decode(strings.TrimPrefix(c, s.Prefix))
+		if err != nil || !hmac.Equal(sig, expected) {
+			continue
+		}
+		v.Nonce = nonce
+		if v.Nonce == "" {
+			v.Nonce = hex.EncodeToString(sig)
+		}
+		v.NonceExpires = now.Add(s.ReplayWindow())
+		return v, nil
+	}
+	return v, ErrInvalidSignature
+}
+
+func (s Scheme) decode(sig string) ([]byte, error) {
+	if s.Encoding == EncodingBase64 {
+		return base64.StdEncoding.DecodeString(sig)
+	}
+	return hex.DecodeString(sig)
+}
+
+// mac signs the template filled with ts, nonce and body. The body is
+// substituted last so a literal "{timestamp}" inside it is signed as is.
+func (s Scheme) mac(secret []byte, ts, nonce string, body []byte) []byte {
+	content := strings.ReplaceAll(s.Template, placeholderTimestamp, ts)
+	content = strings.ReplaceAll(content, placeholderNonce, nonce)
+	content = strings.Replace(content, placeholderBody, string(body), 1)
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(content))
+	return m.Sum(nil)
+}
+
+// Sign returns the header values a sender using this scheme would send
+// for body at time t with nonce, which schemes without a nonce header
+// ignore; for tests and client examples.
+func (s Scheme) Sign(secret []byte, body []byte, nonce string, t time.Time) map[string]string {
+	headers := map[string]string{}
+	var ts string
+	if s.TimestampHeader != "" {
+		ts = strconv.FormatInt(t.Unix(), 10)
+		headers[s.TimestampHeader] = ts
+	}
+	if s.signsNonce() {
+		headers[s.NonceHeader] = nonce
+	} else {
+		nonce = ""
+	}
+	sum := s.mac(secret, ts, nonce, body)
+	enc := hex.EncodeToString(sum)
+	if s.Encoding == EncodingBase64 {
+		enc = base64.StdEncoding.EncodeToString(sum)
+	}
+	headers[s.SignatureHeader] = s.Prefix + enc
+	return headers
+}
+
+// Duration is a time.Duration written as a string such as "5m" in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
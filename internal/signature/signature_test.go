@@ -0,0 +1,172 @@
+package signature
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	secret = []byte("signing-secret")
+	body   = []byte(`{"event":"ping"}`)
+	now    = time.Unix(1_760_000_000, 0)
+)
+
+func headerFunc(h map[string]string) func(string) string {
+	hdr := http.Header{}
+	for k, v := range h {
+		hdr.Set(k, v)
+	}
+	return hdr.Get
+}
+
+func TestVerify_Presets(t *testing.T) {
+	for name := range Presets {
+		t.Run(name, func(t *testing.T) {
+			s, err := Parse(name)
+			require.NoError(t, err)
+			headers := s.Sign(secret, body, "delivery-1", now)
+
+			v, err := s.Verify(secret, headerFunc(headers), body, now.Add(time.Minute))
+			require.NoError(t, err)
+			assert.NotEmpty(t, v.Nonce)
+			assert.Equal(t, now.Add(time.Minute+s.ReplayWindow()), v.NonceExpires)
+
+			_, err = s.Verify(secret, headerFunc(headers), []byte(`{"event":"pong"}`), now)
+			assert.ErrorIs(t, err, ErrInvalidSignature, "a modified body fails")
+			_, err = s.Verify([]byte("other"), headerFunc(headers), body, now)
+			assert.ErrorIs(t, err, ErrInvalidSignature, "another secret fails")
+		})
+	}
+}
+
+func TestVerify_KnownGitHubSignature(t *testing.T) {
+	// From GitHub's "Validating webhook deliveries" documentation.
+	s := Presets["github"]
+	headers := headerFunc(map[string]string{
+		"X-Hub-Signature-256": "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+	})
+	_, err := s.Verify([]byte("It's a Secret to Everybody"), headers, []byte("Hello, World!"), now)
+	assert.NoError(t, err)
+}
+
+func TestVerify_TimestampTolerance(t *testing.T) {
+	s := Presets["pennsieve"].withDefaults()
+	headers := headerFunc(s.Sign(secret, body, "delivery-1", now))
+
+	_, err := s.Verify(secret, headers, body, now.Add(DefaultTolerance))
+	assert.NoError(t, err)
+	_, err = s.Verify(secret, headers, body, now.Add(DefaultTolerance+time.Second))
+	assert.ErrorIs(t, err, ErrTimestampOutOfRange)
+	_, err = s.Verify(secret, headers, body, now.Add(-DefaultTolerance-time.Second))
+	assert.ErrorIs(t, err, ErrTimestampOutOfRange, "timestamps from the future are bounded too")
+
+	// Re-signing with another timestamp changes the signature.
+	tampered := s.Sign(secret, body, "delivery-1", now)
+	tampered[s.TimestampHeader] = "1760000001"
+	_, err = s.Verify(secret, headerFunc(tampered), body, now)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
+
+func TestVerify_MissingHeaders(t *testing.T) {
+	s := Presets["slack"].withDefaults()
+	_, err := s.Verify(secret, headerFunc(nil), body, now)
+	assert.ErrorIs(t, err, ErrMissingSignature)
+
+	headers := s.Sign(secret, body, "delivery-1", now)
+	delete(headers, s.SignatureHeader)
+	_, err = s.Verify(secret, headerFunc(headers), body, now)
+	assert.ErrorIs(t, err, ErrMissingSignature)
+}
+
+func TestVerify_AnyOfSeveralSignatures(t *testing.T) {
+	s, err := Parse(`{"signature_header": "X-Sig", "encoding": "base64"}`)
+	require.NoError(t, err)
+	headers := s.Sign(secret, body, "delivery-1", now)
+	good := headers["X-Sig"]
+	headers["X-Sig"] = s.Sign([]byte("old"), body, "", now)["X-Sig"] + "," + good
+
+	v, err := s.Verify(secret, headerFunc(headers), body, now)
+	require.NoError(t, err)
+	assert.Len(t, v.Nonce, 64, "without a nonce header the signature is the nonce")
+}
+
+func TestVerify_ReplayWithNewNonce(t *testing.T) {
+	s, err := Parse("pennsieve")
+	require.NoError(t, err)
+	captured := s.Sign(secret, body, "delivery-1", now)
+
+	v, err := s.Verify(secret, headerFunc(captured), body, now)
+	require.NoError(t, err)
+	assert.Equal(t, "delivery-1", v.Nonce)
+
+	captured[s.NonceHeader] = "delivery-2"
+	_, err = s.Verify(secret, headerFunc(captured), body, now)
+	assert.ErrorIs(t, err, ErrInvalidSignature, "the nonce is signed")
+	delete(captured, s.NonceHeader)
+	_, err = s.Verify(secret, headerFunc(captured), body, now)
+	assert.ErrorIs(t, err, ErrMissingSignature)
+
+	// GitHub's delivery id isn't signed, so changing it leaves the nonce,
+	// the signature, as it was.
+	gh, err := Parse("github")
+	require.NoError(t, err)
+	captured = gh.Sign(secret, body, "", now)
+	first, err := gh.Verify(secret, headerFunc(captured), body, now)
+	require.NoError(t, err)
+	captured["X-GitHub-Delivery"] = "another-delivery"
+	second, err := gh.Verify(secret, headerFunc(captured), body, now)
+	require.NoError(t, err)
+	assert.Equal(t, first.Nonce, second.Nonce)
+
+	// A scheme stored before {nonce} existed ignores its unsigned header.
+	legacy := Scheme{SignatureHeader: "X-Sig", Encoding: EncodingHex, Template: "{body}", NonceHeader: "X-Nonce"}
+	captured = legacy.Sign(secret, body, "delivery-1", now)
+	captured["X-Nonce"] = "delivery-2"
+	v, err = legacy.Verify(secret, headerFunc(captured), body, now)
+	require.NoError(t, err)
+	assert.Len(t, v.Nonce, 64)
+}
+
+func TestParse(t *testing.T) {
+	s, err := Parse(`{"signature_header": "X-Sig", "timestamp_header": "X-Ts", "tolerance": "30s"}`)
+	require.NoError(t, err)
+	assert.Equal(t, Scheme{
+		SignatureHeader: "X-Sig",
+		Encoding:        EncodingHex,
+		TimestampHeader: "X-Ts",
+		Template:        "{timestamp}.{body}",
+		Tolerance:       Duration(30 * time.Second),
+	}, s)
+
+	b, err := json.Marshal(s)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"tolerance":"30s"`)
+
+	for _, bad := range []string{
+		"unknown-preset",
+		`{}`,
+		`{"signature_header": "X-Sig", "encoding": "base32"}`,
+		`{"signature_header": "X-Sig", "template": "{timestamp}"}`,
+		`{"signature_header": "X-Sig", "timestamp_header": "X-Ts", "template": "{body}"}`,
+		`{"signature_header": "X-Sig", "nonce_header": "X-Nonce", "template": "{body}"}`,
+		`{"signature_header": "X-Sig", "template": "{nonce}.{body}"}`,
+	} {
+		_, err := Parse(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	s, err := Parse("pennsieve")
+	require.NoError(t, err)
+	assert.Equal(t, 2*DefaultTolerance, s.ReplayWindow())
+
+	s, err = Parse("github")
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, s.ReplayWindow())
+}
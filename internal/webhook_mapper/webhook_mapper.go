@@ -2,34 +2,54 @@ package webhook_mapper
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"time"
 
 	"github.com/Pennsieve/integration-service/internal/cache"
 	"github.com/Pennsieve/integration-service/internal/models"
 )
 
-const (
-	cacheExpiration = 10 * time.Minute
-)
-
-func MapWebhookMessages(ctx context.Context, mapped map[string][]models.EventMessage, forceRefresh bool) map[string]models.WebhookMessage {
+// MapWebhookMessages groups events by "datasetId:eventCategory" and attaches
+// the URLs subscribed to each group. Orgs whose webhooks could not be loaded,
+// and that have no previously cached entry to fall back on, are returned in
+// the second map with the cause so the caller can have their events retried
+// instead of dropping them.
+//
+// invalidations are applied before any lookup, so a batch that enables a
+// webhook on a dataset is matched against the updated subscriptions.
+func MapWebhookMessages(ctx context.Context, mapped map[string][]models.EventMessage, invalidations []models.CacheInvalidation) (map[string]models.WebhookMessage, map[string]error) {
 	result := make(map[string]models.WebhookMessage)
+	failed := make(map[string]error)
+
+	for _, inv := range invalidations {
+		cache.Invalidate(ctx, inv)
+	}
 
 	for orgID, events := range mapped {
-		cacheEntry, exists := cache.Get(orgID)
+		datasetIDs := make([]int, 0, len(events))
+		for _, evt := range events {
+			datasetIDs = append(datasetIDs, evt.DataID)
+		}
 
-		if forceRefresh || !exists || time.Since(cacheEntry.Updated) > cacheExpiration {
-			cache.RefreshWebhookCache(ctx, orgID)
-			cacheEntry, exists = cache.Get(orgID)
+		cacheEntry, err := cache.LookupDatasets(ctx, orgID, datasetIDs)
+		switch {
+		case errors.Is(err, cache.ErrInvalidOrgID) || errors.Is(err, cache.ErrUnknownOrg):
+			// Retrying can't fix a bad org id, so these are dropped.
+			log.Printf("Dropping %d events for org %s: %v\n", len(events), orgID, err)
+			continue
+		case err != nil:
+			failed[orgID] = err
+			continue
 		}
 
-		if !exists || len(cacheEntry.Webhooks) == 0 {
+		if len(cacheEntry.Webhooks) == 0 {
 			log.Printf("No webhooks found for org %s\n", orgID)
 			continue
 		}
 
+		datasetEntry, _ := cache.GetDatasets(orgID)
+
 		webhookLookup := buildWebhookLookup(cacheEntry.Webhooks)
 		/*
 			EventMessage.Category (json:"eventCategory") is used to build the message bucket key (fmt.Sprintf("%d:%s", evt.DataID, evt.Category)).
@@ -42,6 +62,13 @@ func MapWebhookMessages(ctx context.Context, mapped map[string][]models.EventMes
 			// fail and webhooks won't be sent.
 			key := fmt.Sprintf("%d:%s", evt.DataID, evt.Category)
 
+			if ds, ok := datasetEntry.Datasets[evt.DataID]; ok {
+				evt.DatasetNodeID = ds.NodeID
+				evt.DatasetName = ds.Name
+			} else {
+				log.Printf("No dataset %d found for org %s; delivering without node id\n", evt.DataID, orgID)
+			}
+
 			entry := result[key]
 			entry.Messages = append(entry.Messages, evt)
 
@@ -53,8 +80,9 @@ func MapWebhookMessages(ctx context.Context, mapped map[string][]models.EventMes
 		}
 	}
 
-	return result
+	return result, failed
 }
+
 func buildWebhookLookup(webhooks []models.WebhookRecord) map[string][]string {
 	lookup := make(map[string][]string)
 	for _, w := range webhooks {
@@ -2,10 +2,14 @@ package webhook_mapper
 
 import (
 	"context"
+	"errors"
+	"regexp"
 	"testing"
 	"time"
 
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/Pennsieve/integration-service/internal/cache"
+	"github.com/Pennsieve/integration-service/internal/db"
 	"github.com/Pennsieve/integration-service/internal/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -38,7 +42,7 @@ func TestMapWebhookMessages_MatchesEventsToURLs(t *testing.T) {
 		"org1": {{OrgID: "org1", DataID: 1, Category: "FILES", Type: "UPLOAD"}},
 	}
 
-	result := MapWebhookMessages(context.Background(), mapped, false)
+	result, _ := MapWebhookMessages(context.Background(), mapped, nil)
 
 	require.Contains(t, result, "1:FILES")
 	assert.Equal(t, []string{"https://a.example/hook"}, result["1:FILES"].URLs)
@@ -57,9 +61,85 @@ func TestMapWebhookMessages_NoMatchingWebhookYieldsNoURLs(t *testing.T) {
 		"org2": {{OrgID: "org2", DataID: 1, Category: "FILES", Type: "UPLOAD"}},
 	}
 
-	result := MapWebhookMessages(context.Background(), mapped, false)
+	result, _ := MapWebhookMessages(context.Background(), mapped, nil)
 
 	// The event is still recorded, but with no URLs since nothing subscribed.
 	require.Contains(t, result, "1:FILES")
 	assert.Empty(t, result["1:FILES"].URLs)
 }
+
+func TestMapWebhookMessages_EnrichesDatasetNodeIDAndName(t *testing.T) {
+	cache.Set("org3", models.WebhookCache{
+		Updated: time.Now(),
+		Webhooks: []models.WebhookRecord{
+			{APIURL: "https://a.example/hook", EventName: "FILES", DatasetID: 5},
+		},
+	})
+	cache.SetDatasets("org3", models.DatasetCache{
+		Updated: time.Now(),
+		Datasets: map[int]models.DatasetRecord{
+			5: {ID: 5, NodeID: "N:dataset:abc", Name: "My Dataset"},
+		},
+	})
+
+	mapped := map[string][]models.EventMessage{
+		"org3": {{OrgID: "org3", DataID: 5, Category: "FILES", Type: "CREATE_PACKAGE"}},
+	}
+
+	result, _ := MapWebhookMessages(context.Background(), mapped, nil)
+
+	require.Contains(t, result, "5:FILES")
+	require.Len(t, result["5:FILES"].Messages, 1)
+	assert.Equal(t, "N:dataset:abc", result["5:FILES"].Messages[0].DatasetNodeID)
+	assert.Equal(t, "My Dataset", result["5:FILES"].Messages[0].DatasetName)
+}
+
+func TestMapWebhookMessages_RefreshFailureServesStaleEntry(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	cache.SetSchema("4", "4")
+	cache.SetOrgSize("4", false)
+	cache.Set("4", models.WebhookCache{
+		Updated: time.Now().Add(-time.Hour),
+		Webhooks: []models.WebhookRecord{
+			{APIURL: "https://a.example/hook", EventName: "FILES", DatasetID: 1},
+		},
+	})
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "4".webhooks`)).WillReturnError(errors.New("connection reset"))
+
+	mapped := map[string][]models.EventMessage{
+		"4": {{OrgID: "4", DataID: 1, Category: "FILES", Type: "CREATE_PACKAGE"}},
+	}
+
+	result, failed := MapWebhookMessages(context.Background(), mapped, nil)
+
+	assert.Empty(t, failed)
+	require.Contains(t, result, "1:FILES")
+	assert.Equal(t, []string{"https://a.example/hook"}, result["1:FILES"].URLs)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMapWebhookMessages_RefreshFailureWithoutCacheFailsOrg(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer mockDB.Close()
+	db.SetPoolForTest(mockDB)
+
+	cache.SetSchema("5", "5")
+	cache.SetOrgSize("5", false)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "5".webhooks`)).WillReturnError(errors.New("connection reset"))
+
+	mapped := map[string][]models.EventMessage{
+		"5": {{OrgID: "5", DataID: 1, Category: "FILES", Type: "CREATE_PACKAGE"}},
+	}
+
+	result, failed := MapWebhookMessages(context.Background(), mapped, nil)
+
+	assert.Empty(t, result)
+	require.Contains(t, failed, "5")
+	assert.Contains(t, failed["5"].Error(), "connection reset")
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -59,6 +59,13 @@ resource "aws_apigatewayv2_route" "webhook_route" {
   authorization_type = "NONE"
 }
 
+resource "aws_apigatewayv2_route" "webhook_channel_route" {
+  api_id             = aws_apigatewayv2_api.integration_service_api.id
+  route_key          = "ANY /webhook/{channel}"
+  target             = "integrations/${aws_apigatewayv2_integration.webhook_integration.id}"
+  authorization_type = "NONE"
+}
+
 resource "aws_apigatewayv2_api_mapping" "integration_service_api_map" {
   api_id          = aws_apigatewayv2_api.integration_service_api.id
   domain_name     = var.api_domain_name
@@ -151,4 +158,58 @@ resource "aws_lambda_permission" "notification_apigateway_permission" {
   function_name = aws_lambda_function.notification_lambda.function_name
   principal     = "apigateway.amazonaws.com"
   source_arn    = "${aws_apigatewayv2_api.integration_service_api.execution_arn}/*/*"
-}
\ No newline at end of file
+}
+##################################################
+# Message API — read access to webhooks.messages
+##################################################
+
+# Same Pennsieve Lambda authorizer as the Notifications API; the handler
+# additionally requires the caller to be a Pennsieve super-admin.
+resource "aws_apigatewayv2_integration" "messages_integration" {
+  api_id                 = aws_apigatewayv2_api.integration_service_api.id
+  integration_type       = "AWS_PROXY"
+  connection_type        = "INTERNET"
+  integration_method     = "POST"
+  integration_uri        = aws_lambda_function.messages_lambda.invoke_arn
+  payload_format_version = "2.0"
+}
+
+resource "aws_apigatewayv2_route" "messages_list_route" {
+  api_id             = aws_apigatewayv2_api.integration_service_api.id
+  route_key          = "GET /messages"
+  target             = "integrations/${aws_apigatewayv2_integration.messages_integration.id}"
+  authorization_type = "CUSTOM"
+  authorizer_id      = aws_apigatewayv2_authorizer.pennsieve_lambda_authorizer.id
+}
+
+resource "aws_apigatewayv2_route" "messages_get_route" {
+  api_id             = aws_apigatewayv2_api.integration_service_api.id
+  route_key          = "GET /messages/{requestId}"
+  target             = "integrations/${aws_apigatewayv2_integration.messages_integration.id}"
+  authorization_type = "CUSTOM"
+  authorizer_id      = aws_apigatewayv2_authorizer.pennsieve_lambda_authorizer.id
+}
+
+resource "aws_apigatewayv2_route" "messages_get_payload_route" {
+  api_id             = aws_apigatewayv2_api.integration_service_api.id
+  route_key          = "GET /messages/{requestId}/payload"
+  target             = "integrations/${aws_apigatewayv2_integration.messages_integration.id}"
+  authorization_type = "CUSTOM"
+  authorizer_id      = aws_apigatewayv2_authorizer.pennsieve_lambda_authorizer.id
+}
+
+resource "aws_apigatewayv2_route" "messages_get_raw_route" {
+  api_id             = aws_apigatewayv2_api.integration_service_api.id
+  route_key          = "GET /messages/{requestId}/raw"
+  target             = "integrations/${aws_apigatewayv2_integration.messages_integration.id}"
+  authorization_type = "CUSTOM"
+  authorizer_id      = aws_apigatewayv2_authorizer.pennsieve_lambda_authorizer.id
+}
+
+resource "aws_lambda_permission" "messages_apigateway_permission" {
+  statement_id  = "AllowExecutionFromAPIGateway"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.messages_lambda.function_name
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "${aws_apigatewayv2_api.integration_service_api.execution_arn}/*/*"
+}
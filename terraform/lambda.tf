@@ -20,6 +20,7 @@ resource "aws_lambda_function" "event_integration_consumer_lambda" {
     variables = {
       ENV = var.environment_name
       PENNSIEVE_DOMAIN = data.terraform_remote_state.account.outputs.domain_name,
+      DB_AUTH_MODE = var.db_auth_mode
 #      WEBHOOK_SQS_QUEUE_NAME = aws_sqs_queue.webhook_integration_queue.name
     }
   }
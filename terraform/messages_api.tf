@@ -0,0 +1,106 @@
+resource "aws_lambda_function" "messages_lambda" {
+  description   = "Message API Lambda — serves read access to the webhook messages stored by the receiver"
+  function_name = "${var.environment_name}-${var.service_name}-messages-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  handler       = "bootstrap"
+  runtime       = "provided.al2023"
+  role          = aws_iam_role.messages_lambda_role.arn
+  timeout       = 30
+  memory_size   = 128
+  s3_bucket     = var.lambda_bucket
+  s3_key        = "${var.service_name}/messages_handler/${var.service_name}-messages-${var.image_tag}.zip"
+
+  vpc_config {
+    subnet_ids         = tolist(data.terraform_remote_state.vpc.outputs.private_subnet_ids)
+    security_group_ids = [data.terraform_remote_state.platform_infrastructure.outputs.integration_service_security_group_id]
+  }
+
+  environment {
+    variables = {
+      ENV              = var.environment_name
+      PENNSIEVE_DOMAIN = data.terraform_remote_state.account.outputs.domain_name
+      DB_AUTH_MODE     = var.db_auth_mode
+    }
+  }
+
+  depends_on = [aws_cloudwatch_log_group.messages_log_group]
+}
+
+resource "aws_cloudwatch_log_group" "messages_log_group" {
+  name              = "/aws/lambda/${var.environment_name}-${var.service_name}-messages-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  retention_in_days = 30
+}
+
+resource "aws_iam_role" "messages_lambda_role" {
+  name = "${var.environment_name}-${var.service_name}-messages-role-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+      Action    = "sts:AssumeRole"
+    }]
+  })
+}
+
+resource "aws_iam_policy" "messages_lambda_policy" {
+  name = "${var.environment_name}-${var.service_name}-messages-policy-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+
+  policy = data.aws_iam_policy_document.messages_policy_document.json
+}
+
+data "aws_iam_policy_document" "messages_policy_document" {
+  statement {
+    sid    = "MessagesCloudwatch"
+    effect = "Allow"
+    actions = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents",
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid    = "MessagesVPC"
+    effect = "Allow"
+    actions = [
+      "ec2:CreateNetworkInterface",
+      "ec2:DescribeNetworkInterfaces",
+      "ec2:DeleteNetworkInterface",
+      "ec2:AssignPrivateIpAddresses",
+      "ec2:UnassignPrivateIpAddresses",
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid    = "MessagesSSM"
+    effect = "Allow"
+    actions = [
+      "ssm:GetParameter",
+      "ssm:GetParameters",
+      "ssm:GetParametersByPath",
+    ]
+    resources = ["arn:aws:ssm:${data.aws_region.current_region.name}:${data.aws_caller_identity.current.account_id}:parameter/${var.environment_name}/${var.service_name}/*"]
+  }
+
+  statement {
+    sid    = "MessagesSSMKMS"
+    effect = "Allow"
+    actions = ["kms:Decrypt", "kms:GenerateDataKey*"]
+    resources = ["arn:aws:kms:${data.aws_region.current_region.name}:${data.aws_caller_identity.current.account_id}:key/alias/aws/ssm"]
+  }
+
+  statement {
+    sid    = "MessagesRDS"
+    effect = "Allow"
+    actions = ["rds-db:connect"]
+    resources = [local.rds_db_connect_arn]
+  }
+}
+
+resource "aws_iam_role_policy_attachment" "messages_policy_attachment" {
+  role       = aws_iam_role.messages_lambda_role.name
+  policy_arn = aws_iam_policy.messages_lambda_policy.arn
+}
@@ -18,6 +18,7 @@ resource "aws_lambda_function" "notification_lambda" {
     variables = {
       ENV              = var.environment_name
       PENNSIEVE_DOMAIN = data.terraform_remote_state.account.outputs.domain_name
+      DB_AUTH_MODE     = var.db_auth_mode
     }
   }
 
@@ -22,4 +22,8 @@ output "webhook_receiver_url" {
 output "notification_api_url" {
   description = "Base HTTPS URL for the Notifications API described in terraform/notification-service.yml"
   value       = "https://${var.api_domain_name}/integration/notification"
-}
\ No newline at end of file
+}
+output "messages_api_url" {
+  description = "Base HTTPS URL for the message API serving stored webhook messages"
+  value       = "https://${var.api_domain_name}/integration/messages"
+}
@@ -0,0 +1,139 @@
+resource "aws_lambda_function" "retention_lambda" {
+  description   = "Retention Lambda — purges expired webhooks.messages and rate_limit_buckets rows, optionally archiving messages to S3"
+  function_name = "${var.environment_name}-${var.service_name}-retention-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  handler       = "bootstrap"
+  runtime       = "provided.al2023"
+  role          = aws_iam_role.retention_lambda_role.arn
+  timeout       = 900
+  memory_size   = 256
+  s3_bucket     = var.lambda_bucket
+  s3_key        = "${var.service_name}/retention_handler/${var.service_name}-retention-${var.image_tag}.zip"
+
+  # Overlapping runs would only compete for the same rows.
+  reserved_concurrent_executions = 1
+
+  vpc_config {
+    subnet_ids         = tolist(data.terraform_remote_state.vpc.outputs.private_subnet_ids)
+    security_group_ids = [data.terraform_remote_state.platform_infrastructure.outputs.integration_service_security_group_id]
+  }
+
+  environment {
+    variables = {
+      ENV                      = var.environment_name
+      PENNSIEVE_DOMAIN         = data.terraform_remote_state.account.outputs.domain_name
+      DB_AUTH_MODE             = var.db_auth_mode
+      RETENTION_ARCHIVE_BUCKET = var.retention_archive_bucket
+    }
+  }
+
+  depends_on = [aws_cloudwatch_log_group.retention_log_group]
+}
+
+resource "aws_cloudwatch_log_group" "retention_log_group" {
+  name              = "/aws/lambda/${var.environment_name}-${var.service_name}-retention-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  retention_in_days = 30
+}
+
+resource "aws_cloudwatch_event_rule" "retention_schedule" {
+  name                = "${var.environment_name}-${var.service_name}-retention-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+  description         = "Runs the integration-service retention Lambda"
+  schedule_expression = var.retention_schedule
+}
+
+resource "aws_cloudwatch_event_target" "retention_schedule_target" {
+  rule = aws_cloudwatch_event_rule.retention_schedule.name
+  arn  = aws_lambda_function.retention_lambda.arn
+}
+
+resource "aws_lambda_permission" "retention_schedule_permission" {
+  statement_id  = "AllowExecutionFromEventBridge"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.retention_lambda.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.retention_schedule.arn
+}
+
+resource "aws_iam_role" "retention_lambda_role" {
+  name = "${var.environment_name}-${var.service_name}-retention-role-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+      Action    = "sts:AssumeRole"
+    }]
+  })
+}
+
+resource "aws_iam_policy" "retention_lambda_policy" {
+  name = "${var.environment_name}-${var.service_name}-retention-policy-${data.terraform_remote_state.region.outputs.aws_region_shortname}"
+
+  policy = data.aws_iam_policy_document.retention_policy_document.json
+}
+
+data "aws_iam_policy_document" "retention_policy_document" {
+  statement {
+    sid    = "RetentionCloudwatch"
+    effect = "Allow"
+    actions = [
+      "logs:CreateLogGroup",
+      "logs:CreateLogStream",
+      "logs:PutLogEvents",
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid    = "RetentionVPC"
+    effect = "Allow"
+    actions = [
+      "ec2:CreateNetworkInterface",
+      "ec2:DescribeNetworkInterfaces",
+      "ec2:DeleteNetworkInterface",
+      "ec2:AssignPrivateIpAddresses",
+      "ec2:UnassignPrivateIpAddresses",
+    ]
+    resources = ["*"]
+  }
+
+  statement {
+    sid    = "RetentionSSM"
+    effect = "Allow"
+    actions = [
+      "ssm:GetParameter",
+      "ssm:GetParameters",
+      "ssm:GetParametersByPath",
+    ]
+    resources = ["arn:aws:ssm:${data.aws_region.current_region.name}:${data.aws_caller_identity.current.account_id}:parameter/${var.environment_name}/${var.service_name}/*"]
+  }
+
+  statement {
+    sid    = "RetentionSSMKMS"
+    effect = "Allow"
+    actions = ["kms:Decrypt", "kms:GenerateDataKey*"]
+    resources = ["arn:aws:kms:${data.aws_region.current_region.name}:${data.aws_caller_identity.current.account_id}:key/alias/aws/ssm"]
+  }
+
+  statement {
+    sid    = "RetentionRDS"
+    effect = "Allow"
+    actions = ["rds-db:connect"]
+    resources = [local.rds_db_connect_arn]
+  }
+
+  dynamic "statement" {
+    for_each = var.retention_archive_bucket == "" ? [] : [var.retention_archive_bucket]
+    content {
+      sid       = "RetentionArchive"
+      effect    = "Allow"
+      actions   = ["s3:PutObject"]
+      resources = ["arn:aws:s3:::${statement.value}/*"]
+    }
+  }
+}
+
+resource "aws_iam_role_policy_attachment" "retention_policy_attachment" {
+  role       = aws_iam_role.retention_lambda_role.name
+  policy_arn = aws_iam_policy.retention_lambda_policy.arn
+}
@@ -22,6 +22,10 @@ resource "aws_lambda_event_source_mapping" "event_integration_source_mapping" {
   function_name    = aws_lambda_function.event_integration_consumer_lambda.arn
   batch_size = 50
   maximum_batching_window_in_seconds = 2
+
+  # The consumer returns the message ids of events whose org webhooks could
+  # not be loaded, so only those records are redelivered.
+  function_response_types = ["ReportBatchItemFailures"]
 }
 
 # Grant SNS to post to SQS queue
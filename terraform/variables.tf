@@ -28,6 +28,28 @@ variable "postgres_user" {
   description = "The username for the Postgres database. This is used to connect to the database."
 }
 
+variable "db_auth_mode" {
+  type        = string
+  default     = "password"
+  description = "How the lambdas authenticate to Postgres: \"password\" (SSM password) or \"iam\" (RDS IAM auth tokens via RDS Proxy)."
+}
+
+variable "retention_archive_bucket" {
+  type        = string
+  default     = ""
+  description = "S3 bucket that receives purged webhook messages as gzipped NDJSON. Leave empty to purge without archiving."
+}
+
+variable "retention_schedule" {
+  type    = string
+  default = "cron(0 7 * * ? *)"
+}
+
+variable "worker_schedule" {
+  type    = string
+  default = "rate(1 minute)"
+}
+
 locals {
   
   common_tags = {